@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/AliciaSchep/pgbabble/pkg/agent"
+	"github.com/AliciaSchep/pgbabble/pkg/chat"
+	"github.com/AliciaSchep/pgbabble/pkg/display"
+	"github.com/spf13/cobra"
+)
+
+// Output formats for pgbabble ask
+var askOutputs = []string{"table", "csv", "json"}
+
+// exitNotRun is the exit status of pgbabble ask when the LLM proposed queries but none
+// of them was executed, because they were rejected, blocked or failed
+const exitNotRun = 2
+
+var (
+	askApprove string
+	askOutput  string
+)
+
+var askCmd = &cobra.Command{
+	Use:   "ask <question> [postgresql://uri]",
+	Short: "Answer one question and exit, for scripts and scheduled reports",
+	Long: `Runs a single turn of the assistant for a question without the interactive prompt.
+The result of the last query executed is written to stdout in the chosen format;
+connection details, progress and the SQL that ran are written to stderr.
+
+--approve sets how proposed queries are approved:
+  prompt         ask on the terminal for each query (default)
+  auto-readonly  run every query without asking, on a read-only connection
+                 (sampled column values are still never sent to the LLM)
+  never          run no queries; answer from the schema alone
+
+Exit status is 0 on success, 1 on an error (invalid flags, connection or LLM
+failure) and 2 when the assistant proposed queries but none was executed.`,
+	Example: `  # Print a CSV report without asking for approval
+  pgbabble ask "how many orders were placed last week, per day?" \
+    --approve=auto-readonly --output csv --dbname shop > orders.csv
+
+  # Pipe JSON results to jq
+  pgbabble ask "top 5 customers by revenue" --approve=auto-readonly --output json \
+    "postgresql://user@localhost/shop" | jq '.rows[0]'`,
+	Args:          cobra.RangeArgs(1, 2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runAsk,
+}
+
+func init() {
+	addSessionFlags(askCmd.Flags())
+	askCmd.Flags().StringVar(&askApprove, "approve", chat.ApprovePrompt, "How queries are approved: "+strings.Join(chat.ApprovalPolicies, ", "))
+	askCmd.Flags().StringVar(&askOutput, "output", "table", "Result format: "+strings.Join(askOutputs, ", "))
+	rootCmd.AddCommand(askCmd)
+}
+
+func runAsk(cmd *cobra.Command, args []string) error {
+	if !slices.Contains(chat.ApprovalPolicies, askApprove) {
+		return fmt.Errorf("invalid --approve: %s (must be: %s)", askApprove, strings.Join(chat.ApprovalPolicies, ", "))
+	}
+	if !slices.Contains(askOutputs, askOutput) {
+		return fmt.Errorf("invalid --output: %s (must be: %s)", askOutput, strings.Join(askOutputs, ", "))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var uri string
+	if len(args) == 2 {
+		uri = args[1]
+	}
+	// Everything the session prints along the way is a diagnostic; only the results go to stdout
+	chatSession, closeSession, err := newSession(ctx, cmd, uri, askApprove == chat.ApproveAutoReadOnly, os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer closeSession()
+
+	result, err := chatSession.Ask(ctx, args[0], askApprove)
+	if err != nil {
+		return err
+	}
+	if err := writeAskOutput(os.Stdout, os.Stderr, askOutput, args[0], result); err != nil {
+		return err
+	}
+	if len(result.Results) == 0 && result.Proposed > 0 {
+		return &exitError{code: exitNotRun, err: errors.New("no query was executed")}
+	}
+	return nil
+}
+
+// askJSON is the --output json document
+type askJSON struct {
+	Question  string            `json:"question"`
+	Answer    string            `json:"answer"`
+	SQL       string            `json:"sql,omitempty"`
+	Params    []string          `json:"params,omitempty"`
+	Columns   []string          `json:"columns"`
+	Rows      []json.RawMessage `json:"rows"`
+	RowCount  int               `json:"row_count"`
+	Truncated bool              `json:"truncated"`
+}
+
+// writeAskOutput writes the result of the last query executed to out. The answer goes
+// to out as well in the table and json formats, and to diag with csv.
+func writeAskOutput(out, diag io.Writer, format, question string, result *chat.AskResult) error {
+	var last *agent.StoredResult
+	if n := len(result.Results); n > 0 {
+		last = result.Results[n-1]
+		if last.Truncated {
+			fmt.Fprintf(diag, "⚠️  Only the first %d rows were fetched\n", len(last.Rows))
+		}
+	}
+
+	switch format {
+	case "csv":
+		fmt.Fprintln(diag, result.Answer)
+		if last == nil {
+			return nil
+		}
+		return display.WriteCSV(out, last.ColumnNames, last.Rows)
+
+	case "json":
+		doc := askJSON{Question: question, Answer: result.Answer, Rows: []json.RawMessage{}}
+		if last != nil {
+			doc.SQL, doc.Params, doc.Columns = last.SQL, last.Params, last.ColumnNames
+			doc.RowCount, doc.Truncated = len(last.Rows), last.Truncated
+			for _, row := range last.Rows {
+				encoded, err := display.JSONRow(last.ColumnNames, row)
+				if err != nil {
+					return err
+				}
+				doc.Rows = append(doc.Rows, encoded)
+			}
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(doc)
+
+	default:
+		if last != nil {
+			formatter := display.NewTableFormatter(last.ColumnNames)
+			formatter.AnalyzeData(last.Rows)
+			widths := formatter.CalculateColumnWidths()
+			fmt.Fprint(out, formatter.FormatHeader(widths))
+			for _, row := range last.Rows {
+				fmt.Fprint(out, formatter.FormatRow(row, widths))
+			}
+			fmt.Fprintln(out)
+		}
+		_, err := fmt.Fprintln(out, result.Answer)
+		return err
+	}
+}
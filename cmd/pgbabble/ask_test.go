@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/AliciaSchep/pgbabble/pkg/agent"
+	"github.com/AliciaSchep/pgbabble/pkg/chat"
+)
+
+func TestWriteAskOutput(t *testing.T) {
+	result := &chat.AskResult{
+		Answer: "There were 2 orders last week.",
+		Results: []*agent.StoredResult{
+			{SQL: "SELECT 1", ColumnNames: []string{"one"}, Rows: [][]interface{}{{1}}},
+			{SQL: "SELECT day, count(*) FROM orders GROUP BY day", ColumnNames: []string{"day", "count"}, Rows: [][]interface{}{{"mon", int64(1)}, {"tue", nil}}},
+		},
+		Proposed: 2,
+	}
+
+	var out, diag bytes.Buffer
+	if err := writeAskOutput(&out, &diag, "csv", "orders?", result); err != nil {
+		t.Fatalf("csv output failed: %v", err)
+	}
+	if out.String() != "day,count\nmon,1\ntue,\n" {
+		t.Errorf("expected only the last result as CSV on stdout, got %q", out.String())
+	}
+	if !strings.Contains(diag.String(), result.Answer) {
+		t.Errorf("expected the answer on stderr with csv, got %q", diag.String())
+	}
+
+	out.Reset()
+	if err := writeAskOutput(&out, &diag, "json", "orders?", result); err != nil {
+		t.Fatalf("json output failed: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	if doc["answer"] != result.Answer || doc["row_count"] != float64(2) || doc["sql"] != result.Results[1].SQL {
+		t.Errorf("unexpected JSON document: %v", doc)
+	}
+	if !strings.Contains(out.String(), `"rows":[{"day":"mon","count":1},{"day":"tue","count":null}]`) {
+		t.Errorf("expected rows as objects in column order, got %s", out.String())
+	}
+
+	out.Reset()
+	if err := writeAskOutput(&out, &diag, "table", "orders?", result); err != nil {
+		t.Fatalf("table output failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "mon") || !strings.HasSuffix(out.String(), result.Answer+"\n") {
+		t.Errorf("expected the table followed by the answer, got %q", out.String())
+	}
+
+	// Without a query the JSON still has the answer and no rows
+	out.Reset()
+	if err := writeAskOutput(&out, &diag, "json", "which table has orders?", &chat.AskResult{Answer: "orders"}); err != nil {
+		t.Fatalf("json output failed: %v", err)
+	}
+	if !strings.Contains(out.String(), `"answer":"orders"`) || !strings.Contains(out.String(), `"rows":[]`) {
+		t.Errorf("unexpected JSON without results: %s", out.String())
+	}
+}
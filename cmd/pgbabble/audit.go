@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AliciaSchep/pgbabble/pkg/audit"
+	"github.com/AliciaSchep/pgbabble/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditFile    string
+	auditSession string
+	auditSince   string
+	auditUntil   string
+	auditEvents  bool
+	auditJSON    bool
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Summarize the audit log of what was exchanged with the LLM",
+	Long: `Reads the audit log written with --audit-log (or "audit_log" in the config file)
+and summarizes it per session. Use --events to list the individual events instead,
+or --json to print the matching log entries unchanged.`,
+	Example: `  # Summarize every session
+  pgbabble audit --file ~/pgbabble-audit.jsonl
+
+  # List what one session sent and received
+  pgbabble audit --session 3f9c2a7d1b6e4f08 --events
+
+  # Sessions in a date range (until is inclusive for dates)
+  pgbabble audit --since 2026-01-01 --until 2026-01-31`,
+	Args: cobra.NoArgs,
+	RunE: runAudit,
+}
+
+func init() {
+	auditCmd.Flags().StringVar(&auditFile, "file", "", "Audit log file (default: audit_log from the config file)")
+	auditCmd.Flags().StringVar(&configPath, "config", "", "Config file (default: pgbabble/config.json in the user config directory)")
+	auditCmd.Flags().StringVar(&auditSession, "session", "", "Only include this session")
+	auditCmd.Flags().StringVar(&auditSince, "since", "", "Only include events at or after this date or RFC 3339 time")
+	auditCmd.Flags().StringVar(&auditUntil, "until", "", "Only include events up to this date (inclusive) or before this RFC 3339 time")
+	auditCmd.Flags().BoolVar(&auditEvents, "events", false, "List individual events instead of per-session summaries")
+	auditCmd.Flags().BoolVar(&auditJSON, "json", false, "Print matching log entries as JSON lines")
+	rootCmd.AddCommand(auditCmd)
+}
+
+func runAudit(cmd *cobra.Command, args []string) error {
+	path := auditFile
+	if path == "" {
+		appConfig, err := config.LoadAppConfig(configPath)
+		if err != nil {
+			return err
+		}
+		path = appConfig.AuditLog
+	}
+	if path == "" {
+		return fmt.Errorf("no audit log configured: use --file or set audit_log in the config file")
+	}
+
+	filter := audit.Filter{Session: auditSession}
+	var err error
+	if filter.Since, err = parseAuditTime(auditSince, false); err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	if filter.Until, err = parseAuditTime(auditUntil, true); err != nil {
+		return fmt.Errorf("invalid --until: %w", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	events, err := audit.ReadEvents(file)
+	if err != nil {
+		return err
+	}
+	events = filter.Apply(events)
+
+	out := cmd.OutOrStdout()
+	switch {
+	case auditJSON:
+		encoder := json.NewEncoder(out)
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	case auditEvents:
+		return printAuditEvents(out, events)
+	default:
+		return printAuditSummaries(out, audit.Summarize(events))
+	}
+}
+
+// parseAuditTime parses a date or RFC 3339 time; a date used as an upper bound covers the whole day
+func parseAuditTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date (YYYY-MM-DD) or RFC 3339 time", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func printAuditSummaries(out io.Writer, summaries []audit.SessionSummary) error {
+	if len(summaries) == 0 {
+		fmt.Fprintln(out, "No audit events found.")
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SESSION\tSTART\tDURATION\tDATABASE\tMODES\tREQUESTS\tTOOL CALLS\tAPPROVED\tREJECTED\tEXECUTED\tFAILED\tROWS")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+			s.Session, s.Start.Local().Format("2006-01-02 15:04"), s.End.Sub(s.Start).Round(time.Second),
+			s.Database, strings.Join(s.Modes, " > "), s.Requests, s.ToolCalls,
+			s.Approved, s.Rejected, s.Executed, s.Failed, s.Rows)
+	}
+	return w.Flush()
+}
+
+func printAuditEvents(out io.Writer, events []audit.Event) error {
+	if len(events) == 0 {
+		fmt.Fprintln(out, "No audit events found.")
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSESSION\tTYPE\tMODE\tDETAILS")
+	for _, event := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			event.Time.Local().Format("2006-01-02 15:04:05"), event.Session, event.Type, event.Mode, auditDetails(event))
+	}
+	return w.Flush()
+}
+
+// auditDetails describes an event on one line
+func auditDetails(event audit.Event) string {
+	var details []string
+	switch event.Type {
+	case audit.EventSessionStart:
+		details = append(details, "database "+event.Database, "model "+event.Model)
+	case audit.EventRequest:
+		details = append(details, fmt.Sprintf("%d messages, %d bytes new, system prompt %.12s", event.MessageCount, len(event.Messages), event.SystemPromptHash))
+	case audit.EventResponse:
+		details = append(details, fmt.Sprintf("%d bytes", len(event.Response)))
+	case audit.EventToolCall:
+		details = append(details, event.Tool, fmt.Sprintf("%d bytes returned", len(event.ToolResult)))
+	case audit.EventSQLDecision:
+		details = append(details, event.Tool, event.Decision, oneLine(event.SQL))
+	case audit.EventShareDecision:
+		details = append(details, event.Tool, event.Decision, event.Column)
+	case audit.EventSQLExecuted:
+		if event.Rows != nil {
+			details = append(details, fmt.Sprintf("%d rows", *event.Rows))
+		}
+		details = append(details, oneLine(event.SQL))
+	case audit.EventModeChange:
+		details = append(details, "from "+event.PreviousMode)
+	}
+	if event.Error != "" {
+		details = append(details, "error: "+oneLine(event.Error))
+	}
+	nonEmpty := details[:0]
+	for _, detail := range details {
+		if detail != "" {
+			nonEmpty = append(nonEmpty, detail)
+		}
+	}
+	return strings.Join(nonEmpty, " | ")
+}
+
+// oneLine collapses whitespace so SQL fits on a single line
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
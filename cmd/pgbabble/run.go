@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/AliciaSchep/pgbabble/pkg/chat"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	runApprove   string
+	runOutputDir string
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run [script.pgb] [postgresql://uri]",
+	Short: "Run a script of questions and slash commands, saving each step's results",
+	Long: `Runs a script of natural-language prompts and slash commands, one per line, as the
+interactive session would. Blank lines and lines starting with # are skipped. Without
+a script file (or with -), the script is read from stdin when it is not a terminal.
+
+The results of the queries run by each step are saved as CSV files named after the
+step in --output-dir: step-003.csv, then step-003-2.csv when step 3 runs another query.
+The run stops at the first step that fails or at /quit.
+
+--approve sets how proposed queries are approved:
+  prompt         ask on the terminal for each query (default; needs a script file)
+  auto-readonly  run every query without asking, on a read-only connection
+                 (sampled column values are still never sent to the LLM)
+  never          run no queries`,
+	Example: `  # A runbook checked into git
+  cat weekly.pgb
+  # Weekly order review
+  /describe orders
+  how many orders were placed per day last week?
+  which 10 customers spent the most last week?
+
+  pgbabble run weekly.pgb --approve=auto-readonly --output-dir reports/week-42 --dbname shop
+
+  # Read the script from stdin
+  echo "how many customers signed up today?" | pgbabble run --approve=auto-readonly --dbname shop`,
+	Args:          cobra.MaximumNArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE:          runScript,
+}
+
+func init() {
+	addSessionFlags(runCmd.Flags())
+	runCmd.Flags().StringVar(&runApprove, "approve", chat.ApprovePrompt, "How queries are approved: "+strings.Join(chat.ApprovalPolicies, ", "))
+	runCmd.Flags().StringVar(&runOutputDir, "output-dir", "", "Directory for the step results (default: pgbabble_run_<timestamp>)")
+	rootCmd.AddCommand(runCmd)
+}
+
+func runScript(cmd *cobra.Command, args []string) error {
+	if !slices.Contains(chat.ApprovalPolicies, runApprove) {
+		return fmt.Errorf("invalid --approve: %s (must be: %s)", runApprove, strings.Join(chat.ApprovalPolicies, ", "))
+	}
+
+	// Read the script before connecting so a missing file fails fast
+	script := os.Stdin
+	if len(args) > 0 && args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open script: %w", err)
+		}
+		defer file.Close()
+		script = file
+	} else {
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			return errors.New("no script: give a script file or pipe one to stdin")
+		}
+		if runApprove == chat.ApprovePrompt {
+			return errors.New("--approve=prompt needs stdin for the answers; use a script file, or --approve=auto-readonly or never")
+		}
+	}
+	steps, err := chat.ParseScript(script)
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		return errors.New("the script has no steps")
+	}
+
+	if runOutputDir == "" {
+		runOutputDir = "pgbabble_run_" + time.Now().Format("2006-01-02_15-04-05")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var uri string
+	if len(args) == 2 {
+		uri = args[1]
+	}
+	chatSession, closeSession, err := newSession(ctx, cmd, uri, runApprove == chat.ApproveAutoReadOnly, os.Stdout)
+	if err != nil {
+		return err
+	}
+	defer closeSession()
+	fmt.Printf("Running %d step(s); results are saved in %s\n\n", len(steps), runOutputDir)
+
+	return chatSession.RunScript(ctx, steps, runApprove, runOutputDir)
+}
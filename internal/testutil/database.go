@@ -173,6 +173,8 @@ func GetRealDatabaseConfig() *config.DBConfig {
 func SetupTestSchema(ctx context.Context, execFunc func(context.Context, string) error) error {
 	schema := `
 	-- Drop tables if they exist (for clean setup)
+	DROP FUNCTION IF EXISTS test_order_item_count(integer);
+	DROP VIEW IF EXISTS test_order_summary;
 	DROP TABLE IF EXISTS test_order_items CASCADE;
 	DROP TABLE IF EXISTS test_orders CASCADE;
 	DROP TABLE IF EXISTS test_products CASCADE;
@@ -237,6 +239,22 @@ func SetupTestSchema(ctx context.Context, execFunc func(context.Context, string)
 		(2, 3, 1, 19.99),
 		(3, 4, 1, 12.99),
 		(3, 5, 1, 199.99);
+
+	-- Create a view and a function for definition introspection
+	CREATE VIEW test_order_summary AS
+		SELECT o.id, u.username, o.total_amount, o.status
+		FROM test_orders o
+		JOIN test_users u ON u.id = o.user_id;
+	COMMENT ON VIEW test_order_summary IS 'Orders with the username of the buyer';
+
+	CREATE FUNCTION test_order_item_count(p_order_id integer) RETURNS bigint
+		LANGUAGE sql STABLE
+		AS 'SELECT count(*) FROM test_order_items WHERE order_id = p_order_id';
+	COMMENT ON FUNCTION test_order_item_count(integer) IS 'Number of line items in an order';
+
+	-- Enable row-level security on orders (not forced, so the owner still sees all rows)
+	ALTER TABLE test_orders ENABLE ROW LEVEL SECURITY;
+	CREATE POLICY test_orders_not_deleted ON test_orders FOR SELECT USING (status <> 'deleted');
 	`
 
 	return execFunc(ctx, schema)
@@ -245,6 +263,8 @@ func SetupTestSchema(ctx context.Context, execFunc func(context.Context, string)
 // CleanupTestSchema removes test tables
 func CleanupTestSchema(ctx context.Context, execFunc func(context.Context, string) error) error {
 	cleanup := `
+	DROP FUNCTION IF EXISTS test_order_item_count(integer);
+	DROP VIEW IF EXISTS test_order_summary;
 	DROP TABLE IF EXISTS test_order_items CASCADE;
 	DROP TABLE IF EXISTS test_orders CASCADE;
 	DROP TABLE IF EXISTS test_products CASCADE;
@@ -0,0 +1,244 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/AliciaSchep/pgbabble/pkg/db"
+	"github.com/AliciaSchep/pgbabble/pkg/explain"
+)
+
+// Thresholds for proposing an index on a sequentially scanned table
+const (
+	// maxIndexSelectivity is the share of a table's rows above which a filter is not worth indexing
+	maxIndexSelectivity = 0.3
+	// minIndexTableRows is the estimated table size below which a sequential scan is cheap anyway
+	minIndexTableRows = 1000
+)
+
+// IndexSuggestion is a proposed index. The statement is only shown, never executed.
+type IndexSuggestion struct {
+	Table     string // schema-qualified table name
+	Columns   []string
+	Statement string
+	Reason    string
+	// Set when the index was validated with a hypothetical plan (hypopg)
+	Validated bool
+	Used      bool // whether the planner chose the hypothetical index
+	CostAfter float64
+}
+
+// IndexAdvice is the result of analyzing a query's plan for missing indexes
+type IndexAdvice struct {
+	SQL         string
+	Cost        float64 // estimated total cost of the current plan
+	Suggestions []IndexSuggestion
+	Notes       []string // candidates that were considered and rejected, and why
+	HypoPG      bool     // whether suggestions were validated with hypothetical indexes
+}
+
+// AdviseIndexes analyzes a query's plan and the existing indexes of the tables it scans
+// sequentially, and proposes CREATE INDEX statements. When the hypopg extension is installed,
+// each proposal is validated by planning the query again with the index created hypothetically.
+func AdviseIndexes(ctx context.Context, conn db.Connection, sqlQuery string) (*IndexAdvice, error) {
+	if err := validateSafeQuery(sqlQuery); err != nil {
+		return nil, err
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	conn.EnsureConnection(ctx)
+	planJSON, err := queryPlan(queryCtx, conn, "EXPLAIN (FORMAT JSON) "+sqlQuery, false)
+	if err != nil {
+		return nil, newDatabaseError(err, sqlQuery)
+	}
+	plan, err := explain.Parse(planJSON)
+	if err != nil {
+		return nil, err
+	}
+	recordPlanIdentifiers(conn, plan)
+
+	advice := &IndexAdvice{SQL: sqlQuery, Cost: plan.Root.TotalCost}
+	tableRows := tableRowEstimates(ctx, conn, plan)
+	for _, candidate := range explain.IndexCandidates(plan) {
+		suggestion, note := adviseCandidate(queryCtx, conn, plan, candidate, tableRows)
+		if suggestion != nil {
+			advice.Suggestions = append(advice.Suggestions, *suggestion)
+		}
+		if note != "" {
+			advice.Notes = append(advice.Notes, note)
+		}
+	}
+	if len(advice.Suggestions) == 0 {
+		return advice, nil
+	}
+
+	advice.HypoPG = true
+	var validated []IndexSuggestion
+	for _, suggestion := range advice.Suggestions {
+		hypoJSON, err := conn.HypotheticalPlan(queryCtx, sqlQuery, []string{suggestion.Statement})
+		if errors.Is(err, db.ErrHypoPGUnavailable) {
+			advice.HypoPG = false
+			return advice, nil
+		}
+		if err != nil {
+			advice.Notes = append(advice.Notes, fmt.Sprintf("could not validate %s: %v", suggestion.Statement, err))
+			validated = append(validated, suggestion)
+			continue
+		}
+		hypoPlan, err := explain.Parse(hypoJSON)
+		if err != nil {
+			advice.Notes = append(advice.Notes, fmt.Sprintf("could not validate %s: %v", suggestion.Statement, err))
+			validated = append(validated, suggestion)
+			continue
+		}
+
+		suggestion.Validated = true
+		suggestion.Used = usesHypotheticalIndex(hypoPlan)
+		suggestion.CostAfter = hypoPlan.Root.TotalCost
+		if !suggestion.Used {
+			advice.Notes = append(advice.Notes, fmt.Sprintf("a hypothetical index on %s (%s) was not used by the planner", suggestion.Table, strings.Join(suggestion.Columns, ", ")))
+			continue
+		}
+		validated = append(validated, suggestion)
+	}
+	advice.Suggestions = validated
+	return advice, nil
+}
+
+// adviseCandidate turns a filtered sequential scan into an index suggestion, or returns
+// a note explaining why no index is proposed
+func adviseCandidate(ctx context.Context, conn db.Connection, plan *explain.Plan, candidate explain.IndexCandidate, tableRows func(string) (int64, bool)) (*IndexSuggestion, string) {
+	node := candidate.Node
+	schema, table, err := conn.ResolveTableName(ctx, db.QualifiedName{Schema: node.Schema, Name: node.RelationName}.String())
+	if err != nil {
+		return nil, fmt.Sprintf("could not resolve table %s: %v", candidate.Relation, err)
+	}
+	tableName := db.QualifiedName{Schema: schema, Name: table}.String()
+
+	rows, known := int64(0), false
+	if tableRows != nil {
+		if rows, known = tableRows(schema + "." + table); !known {
+			rows, known = tableRows(table)
+		}
+	}
+	if known && rows < minIndexTableRows {
+		return nil, fmt.Sprintf("%s is small (~%d rows); a sequential scan is cheap", tableName, rows)
+	}
+	if known && rows > 0 && node.PlanRows/float64(rows) > maxIndexSelectivity {
+		return nil, fmt.Sprintf("the filter on %s matches ~%.0f%% of its rows; an index is unlikely to help", tableName, 100*node.PlanRows/float64(rows))
+	}
+
+	// Only propose columns that really are columns of the table
+	info, err := conn.DescribeTable(ctx, schema, table)
+	if err != nil {
+		return nil, fmt.Sprintf("could not describe table %s: %v", tableName, err)
+	}
+	exists := make(map[string]bool, len(info.Columns))
+	for _, col := range info.Columns {
+		exists[col.Name] = true
+	}
+	var columns []string
+	for _, col := range candidate.Columns() {
+		if exists[col] {
+			columns = append(columns, col)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, ""
+	}
+
+	indexes, err := conn.ListIndexes(ctx, schema, table)
+	if err != nil {
+		return nil, fmt.Sprintf("could not list indexes of %s: %v", tableName, err)
+	}
+	for _, index := range indexes {
+		if len(index.Columns) > 0 && index.Columns[0] == columns[0] {
+			return nil, fmt.Sprintf("existing index %s on %s already starts with %s; the planner preferred a sequential scan", index.Name, tableName, columns[0])
+		}
+	}
+
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = db.QuoteIdentifier(col)
+	}
+	reason := fmt.Sprintf("Seq Scan on %s filters on %s", tableName, strings.Join(columns, ", "))
+	if known {
+		reason += fmt.Sprintf(", keeping ~%.0f of ~%d rows", node.PlanRows, rows)
+	}
+	if plan.Root.TotalCost > 0 {
+		reason += fmt.Sprintf(" (%.0f%% of the estimated cost)", 100*node.TotalCost/plan.Root.TotalCost)
+	}
+	return &IndexSuggestion{
+		Table:     tableName,
+		Columns:   columns,
+		Statement: fmt.Sprintf("CREATE INDEX ON %s (%s);", tableName, strings.Join(quoted, ", ")),
+		Reason:    reason,
+	}, ""
+}
+
+// usesHypotheticalIndex reports whether a plan uses an index created by hypopg,
+// whose names start with the index's oid in angle brackets
+func usesHypotheticalIndex(plan *explain.Plan) bool {
+	used := false
+	plan.Walk(func(node *explain.Node, depth int) {
+		used = used || strings.HasPrefix(node.IndexName, "<")
+	})
+	return used
+}
+
+// benefit describes the estimated improvement of a suggestion
+func (a *IndexAdvice) benefit(s IndexSuggestion) string {
+	if !s.Validated {
+		if a.HypoPG {
+			return "not validated"
+		}
+		return "not validated (install the hypopg extension to estimate the benefit)"
+	}
+	if a.Cost <= 0 {
+		return fmt.Sprintf("estimated cost %.0f → %.0f", a.Cost, s.CostAfter)
+	}
+	return fmt.Sprintf("estimated cost %.0f → %.0f (%.0f%% lower)", a.Cost, s.CostAfter, 100*(a.Cost-s.CostAfter)/a.Cost)
+}
+
+// Report formats the advice for the terminal
+func (a *IndexAdvice) Report() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Current plan: estimated cost %.0f\n", a.Cost)
+	if len(a.Suggestions) == 0 {
+		b.WriteString("\nNo index suggestions for this query.\n")
+	} else {
+		b.WriteString("\nSuggested indexes (not created; review and run them yourself):\n")
+		for _, s := range a.Suggestions {
+			fmt.Fprintf(&b, "\n  %s\n", s.Statement)
+			fmt.Fprintf(&b, "    %s\n", s.Reason)
+			fmt.Fprintf(&b, "    Benefit: %s\n", a.benefit(s))
+		}
+	}
+	if len(a.Notes) > 0 {
+		b.WriteString("\nNotes:\n")
+		for _, note := range a.Notes {
+			fmt.Fprintf(&b, "  - %s\n", note)
+		}
+	}
+	return b.String()
+}
+
+// Summary describes the advice for the LLM
+func (a *IndexAdvice) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Index suggestions for the query (estimated cost of the current plan: %.0f). The statements were shown to the user and were NOT executed.\n", a.Cost)
+	if len(a.Suggestions) == 0 {
+		b.WriteString("No indexes are suggested.\n")
+	}
+	for _, s := range a.Suggestions {
+		fmt.Fprintf(&b, "- %s %s; %s\n", s.Statement, s.Reason, a.benefit(s))
+	}
+	for _, note := range a.Notes {
+		fmt.Fprintf(&b, "Note: %s\n", note)
+	}
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/AliciaSchep/pgbabble/pkg/db"
+)
+
+func TestAdviseIndexes(t *testing.T) {
+	const seqScanPlan = `[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "orders", "Alias": "orders", "Startup Cost": 0, "Total Cost": 20000, "Plan Rows": 50, "Plan Width": 40,
+		"Filter": "((status = 'pending'::text) AND (placed_at >= '2024-01-01'::date))"}}]`
+	const hypoPlan = `[{"Plan": {"Node Type": "Index Scan", "Index Name": "<13412>btree_orders_status_placed_at", "Relation Name": "orders", "Startup Cost": 0.4, "Total Cost": 120, "Plan Rows": 50, "Plan Width": 40}}]`
+
+	newConn := func() *MockConnection {
+		return &MockConnection{
+			tables: []db.TableInfo{{
+				Schema: "public", Name: "orders", Type: "table", EstimatedRows: 1_000_000,
+				Columns: []db.ColumnInfo{{Name: "id"}, {Name: "status"}, {Name: "placed_at"}},
+			}},
+			indexes: map[string][]db.IndexInfo{
+				"public.orders": {{Name: "orders_pkey", TableName: "orders", Columns: []string{"id"}, IsPrimary: true}},
+			},
+			queryRows: func(sql string) [][]interface{} {
+				return [][]interface{}{{seqScanPlan}}
+			},
+		}
+	}
+	ctx := context.Background()
+	query := "SELECT * FROM orders WHERE status = 'pending' AND placed_at >= '2024-01-01'"
+
+	t.Run("without hypopg", func(t *testing.T) {
+		advice, err := AdviseIndexes(ctx, newConn(), query)
+		if err != nil {
+			t.Fatalf("AdviseIndexes failed: %v", err)
+		}
+		if advice.HypoPG || len(advice.Suggestions) != 1 {
+			t.Fatalf("expected one unvalidated suggestion, got %+v", advice)
+		}
+		if got := advice.Suggestions[0].Statement; got != "CREATE INDEX ON public.orders (status, placed_at);" {
+			t.Errorf("unexpected statement: %s", got)
+		}
+		if report := advice.Report(); !strings.Contains(report, "install the hypopg extension") {
+			t.Errorf("expected hint about hypopg in report:\n%s", report)
+		}
+	})
+
+	t.Run("validated with hypopg", func(t *testing.T) {
+		conn := newConn()
+		var statements []string
+		conn.hypotheticalPlan = func(sql string, createIndexStatements []string) string {
+			statements = createIndexStatements
+			return hypoPlan
+		}
+		advice, err := AdviseIndexes(ctx, conn, query)
+		if err != nil {
+			t.Fatalf("AdviseIndexes failed: %v", err)
+		}
+		if len(statements) != 1 || !strings.HasPrefix(statements[0], "CREATE INDEX ON public.orders") {
+			t.Errorf("expected the suggestion to be planned hypothetically, got %v", statements)
+		}
+		if !advice.HypoPG || len(advice.Suggestions) != 1 || !advice.Suggestions[0].Used {
+			t.Fatalf("expected one validated suggestion, got %+v", advice)
+		}
+		if summary := advice.Summary(); !strings.Contains(summary, "estimated cost 20000 → 120 (99% lower)") || !strings.Contains(summary, "NOT executed") {
+			t.Errorf("unexpected summary:\n%s", summary)
+		}
+	})
+
+	t.Run("existing index", func(t *testing.T) {
+		conn := newConn()
+		conn.indexes["public.orders"] = append(conn.indexes["public.orders"], db.IndexInfo{Name: "orders_status_idx", Columns: []string{"status"}})
+		advice, err := AdviseIndexes(ctx, conn, query)
+		if err != nil {
+			t.Fatalf("AdviseIndexes failed: %v", err)
+		}
+		if len(advice.Suggestions) != 0 || len(advice.Notes) != 1 || !strings.Contains(advice.Notes[0], "orders_status_idx") {
+			t.Errorf("expected no suggestion because of the existing index, got %+v", advice)
+		}
+	})
+
+	t.Run("small table", func(t *testing.T) {
+		conn := newConn()
+		conn.tables[0].EstimatedRows = 200
+		advice, err := AdviseIndexes(ctx, conn, query)
+		if err != nil {
+			t.Fatalf("AdviseIndexes failed: %v", err)
+		}
+		if len(advice.Suggestions) != 0 {
+			t.Errorf("expected no suggestion for a small table, got %+v", advice.Suggestions)
+		}
+	})
+}
+
+func TestSuggestIndexesTool_SchemaOnly(t *testing.T) {
+	conn := &MockConnection{}
+	tool := createSuggestIndexesTool(conn, func(string) bool { return true }, "schema-only", ExecutionOptions{})
+	conn.queryRows = func(sql string) [][]interface{} {
+		return [][]interface{}{{`[{"Plan": {"Node Type": "Result", "Total Cost": 0.01}}]`}}
+	}
+
+	result, err := tool.Handler(context.Background(), map[string]interface{}{"sql": "SELECT 1", "explanation": "test"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.IsError || !strings.Contains(result.Content, "not shared in schema-only mode") {
+		t.Errorf("expected plan details to be withheld, got: %s", result.Content)
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
+	"github.com/AliciaSchep/pgbabble/pkg/audit"
+	"github.com/AliciaSchep/pgbabble/pkg/db"
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
 )
@@ -18,6 +22,13 @@ type Agent struct {
 	conversation []anthropic.MessageParam
 	mode         string
 	model        string
+	dbContext    string
+	pseudonyms   *db.Pseudonyms // nil unless identifiers are pseudonymized
+	modeRaised   bool           // the mode was switched to share more data during the conversation
+	output       io.Writer      // where tool calls are reported to the user; stdout when nil
+
+	audit           *audit.Logger // nil unless auditing is enabled
+	auditedMessages int           // conversation messages already written to the audit log
 }
 
 type ToolDefinition struct {
@@ -51,9 +62,53 @@ func (a *Agent) AddTool(tool ToolDefinition) {
 	a.tools = append(a.tools, tool)
 }
 
+// SetDatabaseContext sets database-specific information (such as accessible objects) included in the system prompt
+func (a *Agent) SetDatabaseContext(info string) {
+	a.dbContext = info
+}
+
+// SetPseudonyms makes the agent replace schema, table and column names with pseudonyms in
+// everything sent to the LLM, and translate them back in tool arguments and responses
+func (a *Agent) SetPseudonyms(p *db.Pseudonyms) {
+	a.pseudonyms = p
+}
+
+// SetOutput sets where tool calls are reported to the user
+func (a *Agent) SetOutput(w io.Writer) {
+	a.output = w
+}
+
+func (a *Agent) out() io.Writer {
+	if a.output == nil {
+		return os.Stdout
+	}
+	return a.output
+}
+
+// SetAuditLog records every request, response and tool call in an audit log
+func (a *Agent) SetAuditLog(l *audit.Logger) {
+	a.audit = l
+}
+
+// SetMode switches the privacy mode and replaces the tools, whose behavior depends on the mode
+func (a *Agent) SetMode(mode string, tools []ToolDefinition) {
+	if SharesMoreThan(mode, a.mode) {
+		a.modeRaised = true
+	}
+	a.mode = mode
+	a.tools = tools
+}
+
 // ClearConversation clears the conversation history
 func (a *Agent) ClearConversation() {
 	a.conversation = []anthropic.MessageParam{}
+	a.auditedMessages = 0
+}
+
+// restoreConversation rolls the conversation back after a failed or cancelled turn
+func (a *Agent) restoreConversation(conversation []anthropic.MessageParam) {
+	a.conversation = conversation
+	a.auditedMessages = min(a.auditedMessages, len(conversation))
 }
 
 // generateSystemMessage creates a system message that includes mode-specific information
@@ -71,11 +126,33 @@ or you can run the same or a modified query again for them to see the results.
 DO NOT MAKE UP results when talking with user or imply that you can see actual query result data. You can see schema information but NOT actual query result data, table sizes, or explain execution plans.
 If the user asks for a result from a prior query, you should clarify that you cannot see the results, but that they can use the "/browse" command to view the results from last query
 or you can run the same or a modified query again for them to see the results.
+`
+	case "aggregate-only":
+		modeDescription = `IMPORTANT -- Running queries will display results to the user. You only see results of aggregation queries, never individual records.
+A result is shared with you only if the query aggregates rows (GROUP BY, or aggregate functions over the whole table) and its select list includes a count(*) column. Groups whose count is below the minimum group size are suppressed before you see them, so totals you compute from shared rows may be incomplete.
+To interpret distributions, write queries like SELECT category, count(*), avg(amount) FROM ... GROUP BY category. Window functions and UNION queries are not shared.
+DO NOT MAKE UP results for queries that were not shared with you; the user can use the "/browse" command to view the results from the last query.
 `
 	default:
 		modeDescription = ""
 	}
 
+	if a.modeRaised {
+		modeDescription += `
+The privacy mode was changed during this conversation. Results of queries run before the change were not shared with you and will not be; if you need them, ask the user to run the query again.
+`
+	}
+
+	if a.dbContext != "" {
+		modeDescription += "\nDatabase access for this session:\n" + a.pseudonyms.PseudonymizeText(a.dbContext)
+	}
+
+	if a.pseudonyms != nil {
+		modeDescription += `
+Schema, table and column names are replaced by pseudonyms (s_001, t_017, c_004) for confidentiality. Use the pseudonyms exactly as given in tool calls and SQL; they are translated to the real names before anything runs, and the user sees the real names. Do not guess what the pseudonyms stand for.
+`
+	}
+
 	return fmt.Sprintf(`You are a PostgreSQL expert assistant that helps users write SQL queries.
 
 %s
@@ -87,16 +164,21 @@ Available tools:
 - describe_table: Get detailed information about a specific table including columns and types
 - get_relationships: Find foreign key relationships for a table
 - search_columns: Find columns matching a pattern across tables
+- get_view_definition: See the SQL definition of a view or materialized view
+- list_functions: Find user-defined functions; only IMMUTABLE/STABLE functions may be called in queries
+- column_stats: See column cardinality, null fraction and value distribution statistics
 - execute_sql: Execute a SQL query after user approval
-- explain_query: Analyze query execution plans for performance optimization
+- explain_query: Analyze query execution plans for performance optimization; request analyze only when actual timings are needed
+- suggest_indexes: Propose CREATE INDEX statements for a slow query; they are shown to the user, never executed
+- sample_column_values: Ask the user to share a few distinct values of a column (e.g. exact spelling of codes)
 
 MANDATORY Workflow:
 1. Unless the user has provided specific table names, ALWAYS start by calling list_tables to understand the database or search_columns to understand what tables to focus on.
-2. Use describe_table and get_relationships to better understand tables and relationships
+2. Use describe_table and get_relationships to better understand tables and relationships. For views, use get_view_definition to reuse the logic they already encapsulate
 3. Generate SQL based on actual schema information
 4. ALWAYS call execute_sql tool to run queries - never just show SQL text
 5. Let the tool handle user approval and execution
-6. For performance questions or complex queries, use explain_query to analyze execution plans
+6. For performance questions or complex queries, use explain_query to analyze execution plans, and suggest_indexes when a query scans large tables
 7. If a SQL query or explain execution is rejected by the user, always ask for clarification before proposing another sql
 query to execute
 8. Don't run multiple queries in a row without checking in with the user in between each query.
@@ -111,7 +193,7 @@ func (a *Agent) SendMessage(ctx context.Context, userMessage string) (string, er
 	copy(originalConversation, a.conversation)
 
 	// Add user message to conversation history
-	a.conversation = append(a.conversation, anthropic.NewUserMessage(anthropic.NewTextBlock(userMessage)))
+	a.conversation = append(a.conversation, anthropic.NewUserMessage(anthropic.NewTextBlock(a.pseudonyms.PseudonymizeMessage(userMessage))))
 
 	systemMessage := a.generateSystemMessage()
 
@@ -119,7 +201,7 @@ func (a *Agent) SendMessage(ctx context.Context, userMessage string) (string, er
 		message, err := a.runInference(ctx, a.conversation, systemMessage)
 		if err != nil {
 			// Restore conversation to previous state since the call failed
-			a.conversation = originalConversation
+			a.restoreConversation(originalConversation)
 			return "", err
 		}
 		a.conversation = append(a.conversation, message.ToParam())
@@ -135,10 +217,10 @@ func (a *Agent) SendMessage(ctx context.Context, userMessage string) (string, er
 				// Check if context was cancelled before tool execution
 				if ctx.Err() != nil {
 					// Restore conversation to previous state since context was cancelled
-					a.conversation = originalConversation
+					a.restoreConversation(originalConversation)
 					return "", ctx.Err()
 				}
-				fmt.Printf("🛠️  LLM called tool: %s\n", content.Name)
+				fmt.Fprintf(a.out(), "🛠️  LLM called tool: %s\n", content.Name)
 				result := a.executeTool(ctx, content.ID, content.Name, content.Input)
 				toolResults = append(toolResults, result)
 			}
@@ -146,7 +228,7 @@ func (a *Agent) SendMessage(ctx context.Context, userMessage string) (string, er
 
 		// If no tools were used, return the text response
 		if len(toolResults) == 0 {
-			return textResponse, nil
+			return a.pseudonyms.Restore(textResponse), nil
 		}
 
 		// Add tool results and continue the conversation
@@ -178,13 +260,52 @@ func (a *Agent) runInference(ctx context.Context, conversation []anthropic.Messa
 		params.Tools = anthropicTools
 	}
 
+	a.auditRequest(conversation, systemMessage)
 	message, err := a.client.Messages.New(ctx, params)
 	if err != nil {
+		a.audit.Record(audit.Event{Type: audit.EventResponse, Mode: a.mode, Error: err.Error()})
 		return nil, fmt.Errorf("failed to call Anthropic API: %w", err)
 	}
+	a.auditResponse(message)
 	return message, nil
 }
 
+// auditRequest logs the messages added to the conversation since the previous request
+func (a *Agent) auditRequest(conversation []anthropic.MessageParam, systemMessage string) {
+	if a.audit == nil {
+		return
+	}
+	start := min(a.auditedMessages, len(conversation))
+	messages, err := json.Marshal(conversation[start:])
+	if err != nil {
+		messages = nil
+	}
+	a.audit.Record(audit.Event{
+		Type:             audit.EventRequest,
+		Mode:             a.mode,
+		Model:            a.model,
+		SystemPromptHash: audit.HashPrompt(systemMessage),
+		Messages:         messages,
+		MessageCount:     len(conversation),
+	})
+	a.auditedMessages = len(conversation)
+}
+
+// auditResponse logs a response exactly as it was received
+func (a *Agent) auditResponse(message *anthropic.Message) {
+	if a.audit == nil {
+		return
+	}
+	response := json.RawMessage(message.RawJSON())
+	if len(response) == 0 {
+		var err error
+		if response, err = json.Marshal(message.ToParam()); err != nil {
+			response = nil
+		}
+	}
+	a.audit.Record(audit.Event{Type: audit.EventResponse, Mode: a.mode, Response: response})
+}
+
 func (a *Agent) executeTool(ctx context.Context, id, name string, input json.RawMessage) anthropic.ContentBlockParamUnion {
 	var toolDef ToolDefinition
 	var found bool
@@ -208,25 +329,27 @@ func (a *Agent) executeTool(ctx context.Context, id, name string, input json.Raw
 		}
 	}
 
-	response, err := toolDef.Function(ctx, input)
-	if err != nil {
-		// Create a tool result block for error case
-		return anthropic.ContentBlockParamUnion{
-			OfToolResult: &anthropic.ToolResultBlockParam{
-				ToolUseID: id,
-				IsError:   anthropic.Bool(true),
-				Content: []anthropic.ToolResultBlockParamContentUnion{
-					{OfText: &anthropic.TextBlockParam{Text: err.Error()}},
-				},
-			},
-		}
+	response, err := toolDef.Function(ctx, a.translateToolInput(input))
+	isError := err != nil
+	if isError {
+		response = err.Error()
 	}
-
-	// Create a tool result block for success case with the actual response
+	response = a.pseudonymizeToolOutput(response)
+
+	a.audit.Record(audit.Event{
+		Type:       audit.EventToolCall,
+		Mode:       a.mode,
+		Tool:       name,
+		ToolInput:  input,
+		ToolResult: response,
+		IsError:    isError,
+	})
+
+	// Create a tool result block with the actual response
 	return anthropic.ContentBlockParamUnion{
 		OfToolResult: &anthropic.ToolResultBlockParam{
 			ToolUseID: id,
-			IsError:   anthropic.Bool(false),
+			IsError:   anthropic.Bool(isError),
 			Content: []anthropic.ToolResultBlockParamContentUnion{
 				{OfText: &anthropic.TextBlockParam{Text: response}},
 			},
@@ -234,6 +357,59 @@ func (a *Agent) executeTool(ctx context.Context, id, name string, input json.Raw
 	}
 }
 
+// pseudonymizeToolOutput replaces identifiers in tool output, leaving data values untouched
+func (a *Agent) pseudonymizeToolOutput(text string) string {
+	var out strings.Builder
+	for {
+		start := strings.Index(text, dataStart)
+		if start < 0 {
+			out.WriteString(a.pseudonyms.PseudonymizeText(text))
+			return out.String()
+		}
+		out.WriteString(a.pseudonyms.PseudonymizeText(text[:start]))
+		text = text[start+len(dataStart):]
+		end := strings.Index(text, dataEnd)
+		if end < 0 {
+			out.WriteString(text)
+			return out.String()
+		}
+		out.WriteString(text[:end])
+		text = text[end+len(dataEnd):]
+	}
+}
+
+// sqlArguments are tool arguments holding SQL or SQL names, where real identifiers must be quoted
+var sqlArguments = map[string]bool{"sql": true, "table_name": true, "view_name": true}
+
+// translateToolInput replaces pseudonyms in tool arguments with the real identifiers
+func (a *Agent) translateToolInput(input json.RawMessage) json.RawMessage {
+	if a.pseudonyms == nil {
+		return input
+	}
+	var args map[string]interface{}
+	if err := json.Unmarshal(input, &args); err != nil {
+		return input
+	}
+	for key, value := range args {
+		text, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if sqlArguments[key] {
+			if translated, err := a.pseudonyms.TranslateSQL(text); err == nil {
+				args[key] = translated
+			}
+			continue
+		}
+		args[key] = a.pseudonyms.Restore(text)
+	}
+	translated, err := json.Marshal(args)
+	if err != nil {
+		return input
+	}
+	return translated
+}
+
 // ConvertToolToDefinition converts our Tool to ToolDefinition format
 func ConvertToolToDefinition(tool *Tool) ToolDefinition {
 	return ToolDefinition{
@@ -10,7 +10,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/AliciaSchep/pgbabble/pkg/db"
 	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 func TestNewAgent(t *testing.T) {
@@ -113,6 +115,20 @@ func TestAgent_ClearConversation(t *testing.T) {
 	}
 }
 
+func TestAgent_SetDatabaseContext(t *testing.T) {
+	agent := &Agent{mode: "default"}
+
+	if strings.Contains(agent.generateSystemMessage(), "Database access for this session") {
+		t.Error("expected no database access section before context is set")
+	}
+
+	agent.SetDatabaseContext("NO SELECT privilege (never query these): hr.salaries")
+	message := agent.generateSystemMessage()
+	if !strings.Contains(message, "Database access for this session:\nNO SELECT privilege (never query these): hr.salaries") {
+		t.Errorf("expected system message to include database context, got: %s", message)
+	}
+}
+
 func TestConvertToolToDefinition(t *testing.T) {
 	// Create a test tool
 	tool := &Tool{
@@ -240,6 +256,52 @@ func TestAgent_executeTool(t *testing.T) {
 	}
 }
 
+func TestAgent_executeTool_Pseudonymized(t *testing.T) {
+	pseudonyms := db.NewPseudonyms()
+	conn := &MockConnection{
+		tables:  []db.TableInfo{{Schema: "public", Name: "customers"}},
+		columns: []db.ColumnInfo{{Name: "email", TableSchema: "public", TableName: "customers"}},
+	}
+	if err := pseudonyms.Load(context.Background(), conn); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	var received map[string]interface{}
+	agent := &Agent{
+		tools: []ToolDefinition{
+			{
+				Name: "test_tool",
+				Function: func(ctx context.Context, input json.RawMessage) (string, error) {
+					if err := json.Unmarshal(input, &received); err != nil {
+						return "", err
+					}
+					return "Table: public.customers, column email, values " + dataValue("email") + " and " + dataValue("customers"), nil
+				},
+			},
+		},
+		pseudonyms: pseudonyms,
+	}
+
+	input := json.RawMessage(`{"sql": "SELECT c_001 FROM s_001.t_001", "column_name": "c_001", "explanation": "Emails in t_001", "limit": 5}`)
+	result := agent.executeTool(context.Background(), "test-id", "test_tool", input)
+
+	if received["sql"] != "SELECT email FROM public.customers" {
+		t.Errorf("Expected SQL to use real names, got %v", received["sql"])
+	}
+	if received["column_name"] != "email" || received["explanation"] != "Emails in customers" || received["limit"] != float64(5) {
+		t.Errorf("Unexpected translated arguments: %v", received)
+	}
+
+	text := result.OfToolResult.Content[0].OfText.Text
+	if text != "Table: s_001.t_001, column c_001, values email and customers" {
+		t.Errorf("Expected identifiers but not data values to be pseudonymized, got %q", text)
+	}
+
+	if !strings.Contains(agent.generateSystemMessage(), "pseudonyms") {
+		t.Error("Expected system message to explain pseudonyms")
+	}
+}
+
 // Context Cancellation and Cleanup Tests
 
 func TestContextCancellationBehavior(t *testing.T) {
@@ -1113,22 +1175,22 @@ func TestFormatDatabaseError(t *testing.T) {
 	}{
 		{
 			name:     "table not found error",
-			input:    fmt.Errorf(`pq: relation "nonexistent_table" does not exist`),
+			input:    &pgconn.PgError{Severity: "ERROR", Code: "42P01", Message: `relation "nonexistent_table" does not exist`},
 			expected: "Table or view not found",
 		},
 		{
 			name:     "column not found error",
-			input:    fmt.Errorf(`pq: column "nonexistent_column" does not exist`),
+			input:    &pgconn.PgError{Severity: "ERROR", Code: "42703", Message: `column "nonexistent_column" does not exist`},
 			expected: "Column not found",
 		},
 		{
 			name:     "syntax error",
-			input:    fmt.Errorf(`pq: syntax error at or near "SELCT"`),
+			input:    &pgconn.PgError{Severity: "ERROR", Code: "42601", Message: `syntax error at or near "SELCT"`},
 			expected: "SQL syntax error",
 		},
 		{
 			name:     "permission denied error",
-			input:    fmt.Errorf(`pq: permission denied for table users`),
+			input:    &pgconn.PgError{Severity: "ERROR", Code: "42501", Message: "permission denied for table users"},
 			expected: "Permission denied",
 		},
 		{
@@ -1146,16 +1208,31 @@ func TestFormatDatabaseError(t *testing.T) {
 			input:    fmt.Errorf(`dial tcp: lookup postgres: no such host`),
 			expected: "Network connectivity issue",
 		},
+		{
+			name:     "localized table not found error",
+			input:    fmt.Errorf("query failed: %w", &pgconn.PgError{Severity: "FEHLER", Code: "42P01", Message: `Relation »bestellungen« existiert nicht`}),
+			expected: "Table or view not found",
+		},
+		{
+			name:     "unknown code in known class",
+			input:    &pgconn.PgError{Severity: "ERROR", Code: "22P02", Message: `invalid input syntax for type integer: "abc"`},
+			expected: "Invalid data value",
+		},
 		{
 			name:     "generic database error",
 			input:    fmt.Errorf(`some other database error`),
 			expected: "Database error: some other database error",
 		},
+		{
+			name:     "error text alone is not classified",
+			input:    fmt.Errorf(`relation "orders" does not exist`),
+			expected: "Database error: relation",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := formatDatabaseError(tt.input)
+			result := formatDatabaseError(tt.input, "")
 			if !strings.Contains(result, tt.expected) {
 				t.Errorf("formatDatabaseError() = %v, want to contain %v", result, tt.expected)
 			}
@@ -1438,3 +1515,29 @@ func TestAgent_ConversationRollbackOnCancellation(t *testing.T) {
 
 	t.Log("Conversation rollback test passed - original conversation state preserved after API failure")
 }
+
+func TestAgent_SetMode(t *testing.T) {
+	agent := &Agent{mode: "share-results"}
+
+	agent.SetMode("default", []ToolDefinition{{Name: "list_tables"}})
+	if agent.mode != "default" || len(agent.tools) != 1 {
+		t.Errorf("Expected mode and tools to be replaced, got %s with %d tools", agent.mode, len(agent.tools))
+	}
+	if strings.Contains(agent.generateSystemMessage(), "privacy mode was changed") {
+		t.Error("Expected no note after switching to a more private mode")
+	}
+
+	agent.SetMode("share-results", nil)
+	if !strings.Contains(agent.generateSystemMessage(), "privacy mode was changed") {
+		t.Error("Expected a note that earlier results were not shared")
+	}
+}
+
+func TestModes(t *testing.T) {
+	if !IsValidMode("aggregate-only") || IsValidMode("everything") {
+		t.Error("Unexpected mode validation")
+	}
+	if !SharesMoreThan("share-results", "default") || SharesMoreThan("schema-only", "default") {
+		t.Error("Unexpected mode ordering")
+	}
+}
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/AliciaSchep/pgbabble/pkg/sqlparse"
+)
+
+// DefaultMinGroupSize is the k-anonymity threshold used by aggregate-only mode when none is configured
+const DefaultMinGroupSize = 10
+
+// aggregateResultData prepares results for sharing in aggregate-only mode. Results are only
+// shared when the query aggregates rows and reports a count(...) per group; groups whose
+// count is below the minimum group size are suppressed. Otherwise WithheldReason explains
+// why nothing was shared.
+func aggregateResultData(sqlQuery string, data *QueryResultData, opts ExecutionOptions) *QueryResultData {
+	minGroupSize := opts.MinGroupSize
+	if minGroupSize <= 0 {
+		minGroupSize = DefaultMinGroupSize
+	}
+
+	withheld := &QueryResultData{
+		ColumnNames: data.ColumnNames,
+		TotalRows:   data.TotalRows,
+	}
+
+	aggregation, err := sqlparse.AnalyzeAggregation(sqlQuery)
+	if err != nil {
+		withheld.WithheldReason = fmt.Sprintf("the query could not be analyzed (%v)", err)
+		return withheld
+	}
+	if !aggregation.IsAggregate {
+		withheld.WithheldReason = aggregation.Reason
+		return withheld
+	}
+	if aggregation.CountColumn < 0 || aggregation.CountColumn >= len(data.ColumnNames) {
+		withheld.WithheldReason = "the select list has no count(...) column to check group sizes against"
+		return withheld
+	}
+	// count(...) is always bigint; anything else means the column was not located correctly
+	if aggregation.CountColumn < len(data.ColumnTypes) && data.ColumnTypes[aggregation.CountColumn] != "int8" {
+		withheld.WithheldReason = fmt.Sprintf("result column %q is not the count(...) column of the select list", data.ColumnNames[aggregation.CountColumn])
+		return withheld
+	}
+
+	shared := *data
+	shared.Rows = nil
+	shared.MinGroupSize = minGroupSize
+	for _, row := range data.Rows {
+		if aggregation.CountColumn >= len(row) {
+			continue
+		}
+		count, ok := asFloat(row[aggregation.CountColumn])
+		if !ok || count < float64(minGroupSize) {
+			shared.SuppressedGroups++
+			continue
+		}
+		shared.Rows = append(shared.Rows, row)
+	}
+
+	llmRowLimit := min(len(shared.Rows), 50)
+	shared.Truncated = len(shared.Rows) > 50
+	shared.Rows = shared.Rows[:llmRowLimit]
+	return opts.Masker.Mask(&shared)
+}
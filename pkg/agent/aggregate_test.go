@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAggregateResultData(t *testing.T) {
+	data := &QueryResultData{
+		ColumnNames: []string{"region", "n"},
+		ColumnTypes: []string{"text", "int8"},
+		Rows: [][]interface{}{
+			{"north", int64(120)},
+			{"south", int64(3)},
+			{"east", int64(10)},
+			{"west", nil},
+		},
+		TotalRows: 4,
+	}
+
+	shared := aggregateResultData("SELECT region, count(*) AS n FROM orders GROUP BY region", data, ExecutionOptions{})
+	if shared.WithheldReason != "" {
+		t.Fatalf("Expected results to be shared, got reason %q", shared.WithheldReason)
+	}
+	if len(shared.Rows) != 2 || shared.Rows[0][0] != "north" || shared.Rows[1][0] != "east" {
+		t.Errorf("Expected north and east groups to be shared, got %v", shared.Rows)
+	}
+	if shared.SuppressedGroups != 2 || shared.MinGroupSize != DefaultMinGroupSize {
+		t.Errorf("Expected 2 groups suppressed below %d, got %d below %d", DefaultMinGroupSize, shared.SuppressedGroups, shared.MinGroupSize)
+	}
+	if len(data.Rows) != 4 {
+		t.Errorf("Expected original rows to be untouched, got %d rows", len(data.Rows))
+	}
+
+	shared = aggregateResultData("SELECT region, count(*) AS n FROM orders GROUP BY region", data, ExecutionOptions{MinGroupSize: 200})
+	if len(shared.Rows) != 0 || shared.SuppressedGroups != 4 {
+		t.Errorf("Expected every group to be suppressed, got %v", shared.Rows)
+	}
+
+	withheld := []struct {
+		sql    string
+		reason string
+	}{
+		{"SELECT region, email FROM users", "does not aggregate"},
+		{"SELECT region, avg(amount) FROM orders GROUP BY region", "count(...)"},
+		{"SELECT region, count(*) OVER () FROM orders", "window"},
+		{"SELECT o.*, count(*) FROM orders o GROUP BY o.id", "*"},
+		{"SELECT string_agg(region, ','), count(*) FROM orders", "string_agg"},
+		{"SELECT count(*) AS region, region AS n FROM orders GROUP BY 2", "not the count(...) column"},
+	}
+	for _, tt := range withheld {
+		shared := aggregateResultData(tt.sql, data, ExecutionOptions{})
+		if len(shared.Rows) != 0 || !strings.Contains(shared.WithheldReason, tt.reason) {
+			t.Errorf("%s: expected rows withheld because of %q, got %d rows and reason %q", tt.sql, tt.reason, len(shared.Rows), shared.WithheldReason)
+		}
+	}
+}
+
+func TestFormatQueryResult_AggregateOnly(t *testing.T) {
+	result := formatQueryResult("aggregate-only", 5, time.Millisecond, &QueryResultData{
+		ColumnNames:      []string{"region", "n"},
+		Rows:             [][]interface{}{{"north", int64(120)}},
+		MinGroupSize:     10,
+		SuppressedGroups: 1,
+	})
+	if !strings.Contains(result, "north") || !strings.Contains(result, "1 group(s) with a count below 10 were suppressed") {
+		t.Errorf("Expected shared rows and a suppression note, got: %s", result)
+	}
+
+	result = formatQueryResult("aggregate-only", 5, time.Millisecond, &QueryResultData{
+		ColumnNames:    []string{"id"},
+		WithheldReason: "the query does not aggregate rows",
+	})
+	if !strings.Contains(result, "not shared with you because the query does not aggregate rows") || strings.Contains(result, "Query Results:") {
+		t.Errorf("Expected withheld explanation without a table, got: %s", result)
+	}
+}
@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/AliciaSchep/pgbabble/pkg/display"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DefaultMaxCorrections is the number of automatic correction rounds allowed for one failed query
+const DefaultMaxCorrections = 2
+
+// fixableSQLStates are the errors the LLM is asked to correct on its own:
+// syntax errors, undefined columns and undefined tables
+var fixableSQLStates = map[string]bool{
+	"42601": true,
+	"42703": true,
+	"42P01": true,
+}
+
+// Corrections tracks automatic correction rounds after execute_sql fails with a
+// fixable error. While a correction is pending, the next proposed query is shown
+// to the user as a diff against the one that failed. A nil *Corrections disables
+// self-correction.
+type Corrections struct {
+	max       int
+	rounds    int    // corrections proposed since the last query that did not fail with a fixable error
+	failedSQL string // query the next proposal corrects; empty when no correction is pending
+	failure   string // short description of why failedSQL failed
+}
+
+// NewCorrections allows up to max correction rounds per failed query
+func NewCorrections(max int) *Corrections {
+	if max <= 0 {
+		max = DefaultMaxCorrections
+	}
+	return &Corrections{max: max}
+}
+
+// Reset ends the current correction sequence, e.g. after a query succeeds or is
+// rejected, or when the conversation is cleared
+func (c *Corrections) Reset() {
+	if c == nil {
+		return
+	}
+	c.rounds = 0
+	c.failedSQL = ""
+	c.failure = ""
+}
+
+// approvalPrompt returns the approval prompt for a proposed query. A proposal
+// that follows a fixable failure counts as a correction round and is shown as a diff.
+func (c *Corrections) approvalPrompt(explanation, sqlQuery string) string {
+	if c == nil || c.failedSQL == "" {
+		return fmt.Sprintf("%s\n\nSQL Query:\n%s", explanation, sqlQuery)
+	}
+
+	c.rounds++
+	prompt := fmt.Sprintf("%s\n\nCorrection %d of %d for the query that failed with: %s\n\nChanges to the SQL:\n%s",
+		explanation, c.rounds, c.max, c.failure, display.LineDiff(c.failedSQL, sqlQuery))
+	c.failedSQL = ""
+	c.failure = ""
+	return prompt
+}
+
+// failed records a failed query and returns instructions for the LLM: correct
+// the query right away, or stop and check in with the user once the limit is reached.
+// It returns "" when the error is not one the LLM should fix on its own.
+func (c *Corrections) failed(sqlQuery string, err error) string {
+	if c == nil {
+		return ""
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || !fixableSQLStates[pgErr.Code] {
+		c.Reset()
+		return ""
+	}
+	if c.rounds >= c.max {
+		c.Reset()
+		return fmt.Sprintf("The limit of %d automatic corrections was reached. Do not propose another query yet; explain the error to the user and ask how they want to proceed.", c.max)
+	}
+
+	c.failedSQL = sqlQuery
+	c.failure = fmt.Sprintf("%s: %s", classifyPgError(pgErr).label, pgErr.Message)
+	return fmt.Sprintf("Self-correction is enabled: call execute_sql again right away with a corrected query, without asking the user first. The user will see your correction as a diff against the failed query (correction %d of %d).", c.rounds+1, c.max)
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestExecuteSQLTool_SelfCorrection(t *testing.T) {
+	ctx := context.Background()
+	conn := &MockConnection{queryError: &pgconn.PgError{Severity: "ERROR", Code: "42703", Message: `column "nme" does not exist`}}
+
+	var prompts []string
+	approve := true
+	corrections := NewCorrections(2)
+	tool := createExecuteSQLTool(conn, func(prompt string) bool {
+		prompts = append(prompts, prompt)
+		return approve
+	}, "default", ExecutionOptions{Corrections: corrections})
+
+	run := func(sql string) *ToolResult {
+		t.Helper()
+		result, err := tool.Handler(ctx, map[string]interface{}{"sql": sql, "explanation": "List names"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result
+	}
+
+	// The first failure asks the LLM to correct the query right away
+	result := run("SELECT nme\nFROM users")
+	if !result.IsError || !strings.Contains(result.Content, "correction 1 of 2") {
+		t.Errorf("expected self-correction instructions, got: %s", result.Content)
+	}
+	if strings.Contains(prompts[0], "Correction") {
+		t.Errorf("expected the first proposal to be shown in full, got: %s", prompts[0])
+	}
+
+	// The correction is shown as a diff against the failed query
+	result = run("SELECT name\nFROM users")
+	if !strings.Contains(prompts[1], "Correction 1 of 2") || !strings.Contains(prompts[1], `Column not found: column "nme" does not exist`) {
+		t.Errorf("expected correction header, got: %s", prompts[1])
+	}
+	if !strings.Contains(prompts[1], "- SELECT nme\n+ SELECT name\n  FROM users") {
+		t.Errorf("expected a diff against the failed query, got: %s", prompts[1])
+	}
+	if !strings.Contains(result.Content, "correction 2 of 2") {
+		t.Errorf("expected a second correction round, got: %s", result.Content)
+	}
+
+	// After the last round the LLM is told to check in with the user
+	result = run("SELECT full_name\nFROM users")
+	if !strings.Contains(prompts[2], "Correction 2 of 2") {
+		t.Errorf("expected second correction header, got: %s", prompts[2])
+	}
+	if !strings.Contains(result.Content, "limit of 2 automatic corrections was reached") {
+		t.Errorf("expected correction limit message, got: %s", result.Content)
+	}
+
+	// The next proposal starts over and is shown in full
+	run("SELECT username FROM users")
+	if strings.Contains(prompts[3], "Correction") {
+		t.Errorf("expected a fresh proposal after the limit, got: %s", prompts[3])
+	}
+
+	// Rejecting a correction ends the sequence
+	approve = false
+	run("SELECT login FROM users")
+	if !strings.Contains(prompts[4], "Correction 1 of 2") {
+		t.Errorf("expected correction header, got: %s", prompts[4])
+	}
+	run("SELECT login FROM users")
+	if strings.Contains(prompts[5], "Correction") {
+		t.Errorf("expected rejection to end the correction sequence, got: %s", prompts[5])
+	}
+
+	// A correction left pending when the turn ends does not carry over to the next turn,
+	// which the session starts with a reset
+	approve = true
+	run("SELECT nme FROM users")
+	corrections.Reset()
+	run("SELECT name FROM users")
+	if strings.Contains(prompts[7], "Correction") {
+		t.Errorf("expected a new turn to drop the pending correction, got: %s", prompts[7])
+	}
+}
+
+func TestCorrections_NotFixable(t *testing.T) {
+	corrections := NewCorrections(2)
+
+	if instructions := corrections.failed("SELECT 1/0", &pgconn.PgError{Code: "22012", Message: "division by zero"}); instructions != "" {
+		t.Errorf("expected no instructions for a division by zero, got: %s", instructions)
+	}
+	if prompt := corrections.approvalPrompt("Retry", "SELECT 1"); strings.Contains(prompt, "Correction") {
+		t.Errorf("expected a plain approval prompt, got: %s", prompt)
+	}
+
+	var disabled *Corrections
+	if instructions := disabled.failed("SELECT nme", &pgconn.PgError{Code: "42703"}); instructions != "" {
+		t.Errorf("expected nil corrections to be disabled, got: %s", instructions)
+	}
+	if prompt := disabled.approvalPrompt("Run", "SELECT 1"); prompt != "Run\n\nSQL Query:\nSELECT 1" {
+		t.Errorf("unexpected approval prompt: %q", prompt)
+	}
+}
@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// errorCategory describes a class of database errors for the user and the LLM
+type errorCategory struct {
+	label    string
+	guidance string // instructions for the LLM, empty when there is nothing specific to suggest
+}
+
+// sqlStateCategories classifies errors by exact SQLSTATE code
+var sqlStateCategories = map[string]errorCategory{
+	"42P01": {"Table or view not found", "Use the list_tables tool to see available tables."},
+	"3F000": {"Schema not found", "Use the list_tables tool to see available schemas and tables."},
+	"42703": {"Column not found", "Use the describe_table tool to see available columns."},
+	"42883": {"Function not found", "Check the function name and argument types; use list_functions for user-defined functions, and add explicit casts if the argument types do not match."},
+	"42702": {"Ambiguous column reference", "Qualify the column with its table name or alias."},
+	"42725": {"Ambiguous function call", "Add explicit casts to the arguments so a single function matches."},
+	"42803": {"Grouping error", "Every selected column must appear in the GROUP BY clause or be used in an aggregate function."},
+	"42804": {"Data type mismatch", "Add an explicit cast or compare values of the same type."},
+	"42846": {"Invalid type cast", "The value cannot be cast to that type; check the column type with describe_table."},
+	"42601": {"SQL syntax error", "Please check your query syntax."},
+	"42501": {"Permission denied", "The connected role cannot read this table or column. Use list_tables and describe_table to see which tables and columns are accessible."},
+	"25006": {"Read-only transaction", "Only read-only queries can be run; rewrite the query without modifying data."},
+	"57014": {"Query cancelled", "The query was cancelled by the server, usually by statement_timeout. Try a more selective query or add a LIMIT clause."},
+	"22012": {"Division by zero", "Guard the divisor, for example with NULLIF(divisor, 0)."},
+}
+
+// sqlStateClassCategories classifies errors by the two character SQLSTATE class
+// when the exact code has no category of its own
+var sqlStateClassCategories = map[string]errorCategory{
+	"08": {"Database connection issue", "The connection may have been lost. Attempting to reconnect..."},
+	"22": {"Invalid data value", "A value could not be converted or is out of range; check literals and casts against the column types."},
+	"23": {"Constraint violation", ""},
+	"42": {"SQL error", "Check table and column names with describe_table and review the query."},
+	"53": {"Insufficient database resources", "Try a more selective query or add a LIMIT clause."},
+	"54": {"Query too complex", "Simplify the query or split it into smaller queries."},
+	"57": {"Query interrupted by the server", ""},
+	"58": {"Database system error", ""},
+	"XX": {"Internal database error", ""},
+}
+
+// classifyPgError returns the category for a PostgreSQL error by its SQLSTATE
+func classifyPgError(pgErr *pgconn.PgError) errorCategory {
+	if category, ok := sqlStateCategories[pgErr.Code]; ok {
+		return category
+	}
+	if len(pgErr.Code) == 5 {
+		if category, ok := sqlStateClassCategories[pgErr.Code[:2]]; ok {
+			return category
+		}
+	}
+	return errorCategory{label: "Database error"}
+}
+
+// classifyConnectionError categorizes errors that happen before or outside a
+// PostgreSQL response, such as refused connections and network failures
+func classifyConnectionError(err error) (errorCategory, bool) {
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return sqlStateClassCategories["08"], true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return errorCategory{"Network connectivity issue", "The database server may be unreachable."}, true
+	}
+
+	// Errors from the driver and the network stack are not localized, so their text is stable
+	errStr := err.Error()
+	if strings.Contains(errStr, "connection") && (strings.Contains(errStr, "refused") || strings.Contains(errStr, "closed")) {
+		return sqlStateClassCategories["08"], true
+	}
+	if strings.Contains(errStr, "dial") || strings.Contains(errStr, "network") || strings.Contains(errStr, "timeout") {
+		return errorCategory{"Network connectivity issue", "The database server may be unreachable."}, true
+	}
+	return errorCategory{}, false
+}
+
+// formatDatabaseError provides LLM-friendly error messages with the structured
+// PostgreSQL error fields and tool instructions. sqlQuery is the statement that
+// was sent, used to show where the error occurred; it may be empty.
+func formatDatabaseError(err error, sqlQuery string) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		category := classifyPgError(pgErr)
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s: %s (SQLSTATE %s).", category.label, pgErr.Message, pgErr.Code)
+		if category.guidance != "" {
+			b.WriteString(" " + category.guidance)
+		}
+		if pointer := errorPointer(pgErr, sqlQuery); pointer != "" {
+			b.WriteString("\n" + pointer)
+		}
+		writeErrorFields(&b, pgErr)
+		return b.String()
+	}
+
+	if category, ok := classifyConnectionError(err); ok {
+		return fmt.Sprintf("%s: %v. %s", category.label, err, category.guidance)
+	}
+
+	// Return original error if it is not a PostgreSQL or connection error
+	return fmt.Sprintf("Database error: %v", err)
+}
+
+// databaseError carries the LLM-friendly message for a failed query while keeping
+// the original error available to errors.As
+type databaseError struct {
+	message string
+	err     error
+}
+
+func (e *databaseError) Error() string { return e.message }
+func (e *databaseError) Unwrap() error { return e.err }
+
+// newDatabaseError wraps a query error with its formatDatabaseError message
+func newDatabaseError(err error, sqlQuery string) error {
+	return &databaseError{message: formatDatabaseError(err, sqlQuery), err: err}
+}
+
+// formatUserError provides user-friendly error messages without LLM tool instructions,
+// with a caret under the error position like psql
+func formatUserError(err error, sqlQuery string) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s\n%v", classifyPgError(pgErr).label, pgErr)
+		if pointer := errorPointer(pgErr, sqlQuery); pointer != "" {
+			b.WriteString("\n" + pointer)
+		}
+		writeErrorFields(&b, pgErr)
+		return b.String()
+	}
+
+	if category, ok := classifyConnectionError(err); ok {
+		return fmt.Sprintf("%s\n%v", category.label, err)
+	}
+
+	// Return original error if it is not a PostgreSQL or connection error
+	return fmt.Sprintf("Database error\n%v", err)
+}
+
+// writeErrorFields appends the optional fields of a PostgreSQL error, one per line
+func writeErrorFields(b *strings.Builder, pgErr *pgconn.PgError) {
+	object := pgErr.TableName
+	if object != "" && pgErr.SchemaName != "" {
+		object = pgErr.SchemaName + "." + object
+	}
+
+	fields := []struct{ name, value string }{
+		{"Detail", pgErr.Detail},
+		{"Hint", pgErr.Hint},
+		{"Table", object},
+		{"Column", pgErr.ColumnName},
+		{"Data type", pgErr.DataTypeName},
+		{"Constraint", pgErr.ConstraintName},
+		{"Where", pgErr.Where},
+	}
+	for _, field := range fields {
+		if field.value != "" {
+			fmt.Fprintf(b, "\n%s: %s", field.name, field.value)
+		}
+	}
+}
+
+// errorPointer shows the line of SQL where the error occurred with a caret under
+// the error position. Errors inside a function body point into the internal query.
+func errorPointer(pgErr *pgconn.PgError, sqlQuery string) string {
+	query, position := sqlQuery, int(pgErr.Position)
+	if position == 0 && pgErr.InternalPosition > 0 && pgErr.InternalQuery != "" {
+		query, position = pgErr.InternalQuery, int(pgErr.InternalPosition)
+	}
+	if query == "" || position <= 0 {
+		return ""
+	}
+
+	line, column, text := locatePosition(query, position)
+	if text == "" {
+		return ""
+	}
+	prefix := fmt.Sprintf("LINE %d: ", line)
+	return prefix + text + "\n" + strings.Repeat(" ", len(prefix)) + caretPadding(text, column) + "^"
+}
+
+// maxPointerWidth limits how much of a long SQL line is shown around the error position
+const maxPointerWidth = 80
+
+// locatePosition converts a 1-based character position in query into a 1-based
+// line number, a 1-based column and the text of that line. Long lines are cut
+// down to a window around the position, with "..." marking the cut.
+func locatePosition(query string, position int) (int, int, string) {
+	runes := []rune(query)
+	if position > len(runes)+1 {
+		return 0, 0, ""
+	}
+
+	line, start := 1, 0
+	for i := 0; i < position-1 && i < len(runes); i++ {
+		if runes[i] == '\n' {
+			line++
+			start = i + 1
+		}
+	}
+	end := start
+	for end < len(runes) && runes[end] != '\n' {
+		end++
+	}
+	text := []rune(strings.TrimRight(string(runes[start:end]), "\r"))
+	column := position - start
+
+	if len(text) > maxPointerWidth {
+		from := max(0, column-1-maxPointerWidth/2)
+		to := min(len(text), from+maxPointerWidth)
+		from = max(0, to-maxPointerWidth)
+
+		window := string(text[from:to])
+		if from > 0 {
+			window = "..." + window
+			column = column - from + 3
+		}
+		if to < len(text) {
+			window += "..."
+		}
+		return line, column, window
+	}
+	return line, column, string(text)
+}
+
+// caretPadding returns the whitespace that puts a caret under the given column,
+// keeping tabs so the caret lines up with tab-indented SQL
+func caretPadding(text string, column int) string {
+	var padding strings.Builder
+	for i, r := range []rune(text) {
+		if i >= column-1 {
+			break
+		}
+		if r == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+	}
+	return padding.String()
+}
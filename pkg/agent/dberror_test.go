@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestFormatUserError_Caret(t *testing.T) {
+	sqlQuery := "SELECT id,\n       nme\nFROM users"
+	pgErr := &pgconn.PgError{
+		Severity: "ERROR",
+		Code:     "42703",
+		Message:  `column "nme" does not exist`,
+		Hint:     `Perhaps you meant to reference the column "users.name".`,
+		Position: 19,
+	}
+
+	result := formatUserError(pgErr, sqlQuery)
+	expected := "Column not found\n" +
+		`ERROR: column "nme" does not exist (SQLSTATE 42703)` + "\n" +
+		"LINE 2:        nme\n" +
+		"               ^\n" +
+		`Hint: Perhaps you meant to reference the column "users.name".`
+	if result != expected {
+		t.Errorf("formatUserError() =\n%s\nwant\n%s", result, expected)
+	}
+}
+
+func TestFormatDatabaseError_StructuredFields(t *testing.T) {
+	pgErr := &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           "23505",
+		Message:        "duplicate key value violates unique constraint",
+		Detail:         "Key (email)=(a@example.com) already exists.",
+		SchemaName:     "public",
+		TableName:      "users",
+		ConstraintName: "users_email_key",
+	}
+
+	result := formatDatabaseError(pgErr, "SELECT 1")
+	for _, want := range []string{
+		"Constraint violation: duplicate key value violates unique constraint (SQLSTATE 23505).",
+		"Detail: Key (email)=(a@example.com) already exists.",
+		"Table: public.users",
+		"Constraint: users_email_key",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %q in:\n%s", want, result)
+		}
+	}
+	if strings.Contains(result, "LINE") {
+		t.Errorf("expected no position pointer without a position, got:\n%s", result)
+	}
+}
+
+func TestErrorPointer(t *testing.T) {
+	tests := []struct {
+		name     string
+		pgErr    *pgconn.PgError
+		sql      string
+		expected string
+	}{
+		{
+			name:     "first character",
+			pgErr:    &pgconn.PgError{Position: 1},
+			sql:      "SELCT 1",
+			expected: "LINE 1: SELCT 1\n        ^",
+		},
+		{
+			name:     "tab indented",
+			pgErr:    &pgconn.PgError{Position: 12},
+			sql:      "SELECT\n\tfoo(",
+			expected: "LINE 2: \tfoo(\n        \t   ^",
+		},
+		{
+			name:     "multibyte characters count as one position",
+			pgErr:    &pgconn.PgError{Position: 12},
+			sql:      "SELECT 'é', x",
+			expected: "LINE 1: SELECT 'é', x\n                   ^",
+		},
+		{
+			name:     "internal query of a function",
+			pgErr:    &pgconn.PgError{InternalPosition: 8, InternalQuery: "SELECT missing FROM t"},
+			sql:      "SELECT f()",
+			expected: "LINE 1: SELECT missing FROM t\n               ^",
+		},
+		{
+			name:     "no position",
+			pgErr:    &pgconn.PgError{},
+			sql:      "SELECT 1",
+			expected: "",
+		},
+		{
+			name:     "position past the end",
+			pgErr:    &pgconn.PgError{Position: 50},
+			sql:      "SELECT 1",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := errorPointer(tt.pgErr, tt.sql); result != tt.expected {
+				t.Errorf("errorPointer() =\n%q\nwant\n%q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLocatePosition_LongLine(t *testing.T) {
+	line := strings.Repeat("a", 100) + "X" + strings.Repeat("b", 100)
+	lineNo, column, text := locatePosition(line, 101)
+	if lineNo != 1 {
+		t.Errorf("expected line 1, got %d", lineNo)
+	}
+	if !strings.HasPrefix(text, "...") || !strings.HasSuffix(text, "...") {
+		t.Errorf("expected long line to be cut on both sides, got %q", text)
+	}
+	if []rune(text)[column-1] != 'X' {
+		t.Errorf("expected column %d to point at X in %q", column, text)
+	}
+}
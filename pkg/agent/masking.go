@@ -0,0 +1,363 @@
+package agent
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AliciaSchep/pgbabble/pkg/config"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	defaultTruncateLength = 3
+	defaultBucketSize     = 10
+)
+
+// Built-in detectors for personal data embedded in text values. Credit cards are
+// checked before phone numbers since a card number contains phone-like digit runs.
+var (
+	emailPattern      = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	creditCardPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	phonePattern      = regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{3}\)|\b\d{3})[\s.-]?\d{3}[\s.-]?\d{4}\b`)
+	ipv4Pattern       = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+)
+
+// ResultMasker masks query result values before they are shared with the LLM
+type ResultMasker struct {
+	rules     []config.MaskRule
+	detectors bool
+	key       []byte // per-session key so hashed values cannot be looked up across sessions
+}
+
+// NewResultMasker creates a masker from the masking configuration
+func NewResultMasker(cfg config.MaskingConfig) (*ResultMasker, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate masking key: %w", err)
+	}
+	return &ResultMasker{
+		rules:     cfg.Rules,
+		detectors: !cfg.DisableDetectors,
+		key:       key,
+	}, nil
+}
+
+// Mask returns a copy of data with masked values and MaskedColumns describing what was masked.
+// The original data is left untouched for local display.
+func (m *ResultMasker) Mask(data *QueryResultData) *QueryResultData {
+	if m == nil || data == nil {
+		return data
+	}
+
+	masked := *data
+	masked.Rows = make([][]interface{}, len(data.Rows))
+	for i, row := range data.Rows {
+		masked.Rows[i] = append([]interface{}{}, row...)
+	}
+	masked.MaskedColumns = nil
+
+	for col, name := range data.ColumnNames {
+		typeName := ""
+		if col < len(data.ColumnTypes) {
+			typeName = data.ColumnTypes[col]
+		}
+
+		source := ""
+		if col < len(data.SourceColumns) {
+			source = data.SourceColumns[col]
+		}
+
+		if rule, ok := m.ruleFor(name, source, typeName); ok {
+			for _, row := range masked.Rows {
+				if col < len(row) && row[col] != nil {
+					row[col] = m.applyRule(rule, typeName, row[col])
+				}
+			}
+			masked.MaskedColumns = append(masked.MaskedColumns, fmt.Sprintf("%s (%s)", name, rule.Action))
+			continue
+		}
+
+		if !m.detectors {
+			continue
+		}
+		found := make(map[string]bool)
+		for _, row := range masked.Rows {
+			if col < len(row) && row[col] != nil {
+				row[col] = detectAndMask(row[col], found)
+			}
+		}
+		if len(found) > 0 {
+			kinds := make([]string, 0, len(found))
+			for kind := range found {
+				kinds = append(kinds, kind)
+			}
+			sort.Strings(kinds)
+			masked.MaskedColumns = append(masked.MaskedColumns, fmt.Sprintf("%s (detected %s)", name, strings.Join(kinds, ", ")))
+		}
+	}
+
+	return &masked
+}
+
+// MaskArrayText masks the elements of an array of a column's values in Postgres text form,
+// such as the most common values in its planner statistics, as Mask would mask the column.
+// It reports false when the array cannot be read, in which case it must not be shared.
+func (m *ResultMasker) MaskArrayText(column, typeName, array string) (string, bool) {
+	if m == nil {
+		return array, true
+	}
+	var elements pgtype.Array[string]
+	if err := pgtype.NewMap().Scan(pgtype.TextArrayOID, pgtype.TextFormatCode, []byte(array), &elements); err != nil || len(elements.Dims) > 1 {
+		return "", false
+	}
+
+	data := &QueryResultData{ColumnNames: []string{column}, ColumnTypes: []string{typeName}}
+	for _, element := range elements.Elements {
+		data.Rows = append(data.Rows, []interface{}{element})
+	}
+	masked := m.Mask(data)
+
+	var b strings.Builder
+	b.WriteString("{")
+	for i, row := range masked.Rows {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(quoteArrayElement(formatValue(row[0])))
+	}
+	b.WriteString("}")
+	return b.String(), true
+}
+
+// quoteArrayElement quotes an array element the way Postgres does in array text output
+func quoteArrayElement(element string) string {
+	if element != "" && !strings.EqualFold(element, "null") && !strings.ContainsAny(element, "{},\" \\\t\n") {
+		return element
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(element) + `"`
+}
+
+// ruleFor returns the first rule matching the column type and either the output column name
+// or the name of the table column it reads, so that renaming a column does not unmask it
+func (m *ResultMasker) ruleFor(column, source, typeName string) (config.MaskRule, bool) {
+	for _, rule := range m.rules {
+		if rule.Column != "" {
+			pattern := strings.ToLower(rule.Column)
+			matchesColumn, _ := path.Match(pattern, strings.ToLower(column))
+			matchesSource, _ := path.Match(pattern, strings.ToLower(source))
+			if !matchesColumn && !(source != "" && matchesSource) {
+				continue
+			}
+		}
+		if rule.Type != "" {
+			if ok, _ := path.Match(rule.Type, typeName); !ok {
+				continue
+			}
+		}
+		return rule, true
+	}
+	return config.MaskRule{}, false
+}
+
+// needsSourceColumns reports whether any rule matches column names, in which case result
+// columns should be traced back to the table columns they read
+func (m *ResultMasker) needsSourceColumns() bool {
+	if m == nil {
+		return false
+	}
+	for _, rule := range m.rules {
+		if rule.Column != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *ResultMasker) applyRule(rule config.MaskRule, typeName string, value interface{}) interface{} {
+	switch rule.Action {
+	case config.MaskHash:
+		mac := hmac.New(sha256.New, m.key)
+		mac.Write([]byte(formatValue(value)))
+		return "hash:" + hex.EncodeToString(mac.Sum(nil))[:12]
+
+	case config.MaskTruncate:
+		length := rule.Length
+		if length == 0 {
+			length = defaultTruncateLength
+		}
+		runes := []rune(formatValue(value))
+		if len(runes) <= length {
+			return string(runes)
+		}
+		return string(runes[:length]) + "..."
+
+	case config.MaskMonth:
+		if t, ok := asTime(value); ok {
+			return t.Format("2006-01")
+		}
+		return placeholder(typeName)
+
+	case config.MaskBucket:
+		size := rule.BucketSize
+		if size == 0 {
+			size = defaultBucketSize
+		}
+		if f, ok := asFloat(value); ok {
+			low := math.Floor(f/size) * size
+			return fmt.Sprintf("[%s, %s)", formatNumber(low), formatNumber(low+size))
+		}
+		return placeholder(typeName)
+
+	default: // placeholder
+		return placeholder(typeName)
+	}
+}
+
+func placeholder(typeName string) string {
+	if typeName == "" {
+		return "<masked>"
+	}
+	return "<" + typeName + ">"
+}
+
+// detectAndMask replaces personal data found in a value, recording the kinds found.
+// jsonb objects, arrays and records are masked element by element, keeping their shape.
+func detectAndMask(value interface{}, found map[string]bool) interface{} {
+	switch v := value.(type) {
+	case netip.Addr, netip.Prefix, net.IP, *net.IPNet:
+		found["IP address"] = true
+		return "<ip>"
+	case string:
+		return maskText(v, found)
+	case map[string]interface{}:
+		masked := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			masked[maskText(key, found)] = detectAndMask(element, found)
+		}
+		return masked
+	case []interface{}:
+		masked := make([]interface{}, len(v))
+		for i, element := range v {
+			masked[i] = detectAndMask(element, found)
+		}
+		return masked
+	case []string:
+		masked := make([]string, len(v))
+		for i, element := range v {
+			masked[i] = maskText(element, found)
+		}
+		return masked
+	default:
+		return value
+	}
+}
+
+// maskText replaces emails, credit card numbers, phone numbers and IP addresses in text
+func maskText(text string, found map[string]bool) string {
+	if ip := net.ParseIP(strings.TrimSpace(text)); ip != nil {
+		found["IP address"] = true
+		return "<ip>"
+	}
+
+	text = replaceMatches(emailPattern, text, "<email>", "email", found, nil)
+	text = replaceMatches(creditCardPattern, text, "<credit card>", "credit card", found, luhnValid)
+	text = replaceMatches(ipv4Pattern, text, "<ip>", "IP address", found, func(s string) bool {
+		return net.ParseIP(s) != nil
+	})
+	text = replaceMatches(phonePattern, text, "<phone>", "phone", found, nil)
+	return text
+}
+
+func replaceMatches(pattern *regexp.Regexp, text, replacement, kind string, found map[string]bool, valid func(string) bool) string {
+	return pattern.ReplaceAllStringFunc(text, func(match string) string {
+		if valid != nil && !valid(match) {
+			return match
+		}
+		found[kind] = true
+		return replacement
+	})
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum used by card numbers
+func luhnValid(s string) bool {
+	sum := 0
+	double := false
+	digits := 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+func asTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func asFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case pgtype.Numeric:
+		f, err := v.Float64Value()
+		if err != nil || !f.Valid {
+			return 0, false
+		}
+		return f.Float64, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AliciaSchep/pgbabble/pkg/config"
+)
+
+func newTestMasker(t *testing.T, cfg config.MaskingConfig) *ResultMasker {
+	t.Helper()
+	masker, err := NewResultMasker(cfg)
+	if err != nil {
+		t.Fatalf("NewResultMasker failed: %v", err)
+	}
+	return masker
+}
+
+func TestResultMasker_Rules(t *testing.T) {
+	masker := newTestMasker(t, config.MaskingConfig{
+		Rules: []config.MaskRule{
+			{Column: "customer_id", Action: config.MaskHash},
+			{Column: "NAME", Action: config.MaskTruncate, Length: 2},
+			{Type: "timestamp*", Action: config.MaskMonth},
+			{Column: "salary", Action: config.MaskBucket, BucketSize: 1000},
+			{Column: "notes", Action: config.MaskPlaceholder},
+		},
+	})
+
+	data := &QueryResultData{
+		ColumnNames: []string{"customer_id", "name", "created_at", "salary", "notes", "status"},
+		ColumnTypes: []string{"int4", "text", "timestamptz", "numeric", "text", "text"},
+		Rows: [][]interface{}{
+			{int32(42), "Alice", time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC), float64(52340), "likes tea", "active"},
+			{int32(42), "Bo", time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), int64(999), nil, "inactive"},
+		},
+	}
+
+	masked := masker.Mask(data)
+
+	first, second := masked.Rows[0], masked.Rows[1]
+	if first[0] != second[0] || !strings.HasPrefix(first[0].(string), "hash:") {
+		t.Errorf("Expected equal values to hash identically, got %v and %v", first[0], second[0])
+	}
+	if first[1] != "Al..." || second[1] != "Bo" {
+		t.Errorf("Unexpected truncation: %v, %v", first[1], second[1])
+	}
+	if first[2] != "2024-03" || second[2] != "2023-12" {
+		t.Errorf("Unexpected month generalization: %v, %v", first[2], second[2])
+	}
+	if first[3] != "[52000, 53000)" || second[3] != "[0, 1000)" {
+		t.Errorf("Unexpected buckets: %v, %v", first[3], second[3])
+	}
+	if first[4] != "<text>" || second[4] != nil {
+		t.Errorf("Expected placeholder and NULL to be kept, got %v, %v", first[4], second[4])
+	}
+	if first[5] != "active" {
+		t.Errorf("Expected unmatched column to be unchanged, got %v", first[5])
+	}
+
+	// Local data must stay unmasked
+	if data.Rows[0][1] != "Alice" {
+		t.Errorf("Expected original rows to be unchanged, got %v", data.Rows[0][1])
+	}
+
+	expected := "customer_id (hash), name (truncate), created_at (month), salary (bucket), notes (placeholder)"
+	if got := strings.Join(masked.MaskedColumns, ", "); got != expected {
+		t.Errorf("Expected masked columns %q, got %q", expected, got)
+	}
+}
+
+func TestResultMasker_RenamedColumns(t *testing.T) {
+	masker := newTestMasker(t, config.MaskingConfig{
+		Rules:            []config.MaskRule{{Column: "ssn", Action: config.MaskPlaceholder}},
+		DisableDetectors: true,
+	})
+
+	// SELECT ssn AS x, lower(ssn) AS y: x reads users.ssn directly, y is computed
+	data := &QueryResultData{
+		ColumnNames:   []string{"x", "y"},
+		ColumnTypes:   []string{"text", "text"},
+		SourceColumns: []string{"ssn", ""},
+		Rows:          [][]interface{}{{"123-45-6789", "123-45-6789"}},
+	}
+
+	masked := masker.Mask(data)
+	if masked.Rows[0][0] != "<text>" {
+		t.Errorf("Expected renamed column to be masked by its source column rule, got %v", masked.Rows[0][0])
+	}
+	// Known limitation: computed columns have no source column, so only type rules and
+	// the built-in detectors apply to them
+	if masked.Rows[0][1] != "123-45-6789" {
+		t.Errorf("Expected computed column to be matched by name only, got %v", masked.Rows[0][1])
+	}
+}
+
+func TestResultMasker_Detectors(t *testing.T) {
+	masker := newTestMasker(t, config.MaskingConfig{})
+
+	data := &QueryResultData{
+		ColumnNames: []string{"contact", "card", "client", "addr", "comment", "order_ref"},
+		Rows: [][]interface{}{
+			{"mail alice@example.com", "4111 1111 1111 1111", "10.0.0.1", netip.MustParseAddr("192.168.1.1"), "call (555) 123-4567", "2024-01-15"},
+		},
+	}
+
+	masked := masker.Mask(data)
+	row := masked.Rows[0]
+
+	expected := []interface{}{"mail <email>", "<credit card>", "<ip>", "<ip>", "call <phone>", "2024-01-15"}
+	for i, value := range expected {
+		if row[i] != value {
+			t.Errorf("Column %s: expected %v, got %v", data.ColumnNames[i], value, row[i])
+		}
+	}
+
+	footer := strings.Join(masked.MaskedColumns, ", ")
+	for _, part := range []string{"contact (detected email)", "card (detected credit card)", "addr (detected IP address)", "comment (detected phone)"} {
+		if !strings.Contains(footer, part) {
+			t.Errorf("Expected masked columns to contain %q, got %q", part, footer)
+		}
+	}
+	if strings.Contains(footer, "order_ref") {
+		t.Errorf("Expected date-like text not to be masked, got %q", footer)
+	}
+
+	// Values nested in jsonb, arrays and records are masked too
+	nested := masker.Mask(&QueryResultData{
+		ColumnNames: []string{"profile", "emails", "tags"},
+		Rows: [][]interface{}{
+			{
+				map[string]interface{}{"name": "Alice", "contact": map[string]interface{}{"email": "alice@example.com"}, "ips": []interface{}{"10.0.0.1"}},
+				[]interface{}{"bob@example.com", nil, "no email here"},
+				[]interface{}{"vip", float64(3)},
+			},
+		},
+	})
+	if got := fmt.Sprint(nested.Rows[0][0]); got != "map[contact:map[email:<email>] ips:[<ip>] name:Alice]" {
+		t.Errorf("Expected email and IP in jsonb value to be masked, got %s", got)
+	}
+	if got := fmt.Sprint(nested.Rows[0][1]); got != "[<email> <nil> no email here]" {
+		t.Errorf("Expected email in text[] value to be masked, got %s", got)
+	}
+	footer = strings.Join(nested.MaskedColumns, ", ")
+	if footer != "profile (detected IP address, email), emails (detected email)" {
+		t.Errorf("Expected nested values in the masked columns footer, got %q", footer)
+	}
+
+	// Numbers that fail the card checksum are left alone
+	if got := maskText("ref 1234 5678 9012 3456", map[string]bool{}); got != "ref 1234 5678 9012 3456" {
+		t.Errorf("Expected non-Luhn number to be kept, got %q", got)
+	}
+
+	disabled := newTestMasker(t, config.MaskingConfig{DisableDetectors: true})
+	if got := disabled.Mask(data); got.Rows[0][0] != "mail alice@example.com" || len(got.MaskedColumns) != 0 {
+		t.Errorf("Expected detectors to be disabled, got %+v", got)
+	}
+}
+
+func TestFormatQueryResult_MaskedFooter(t *testing.T) {
+	data := &QueryResultData{
+		ColumnNames:   []string{"email"},
+		Rows:          [][]interface{}{{"<email>"}},
+		TotalRows:     1,
+		MaskedColumns: []string{"email (detected email)"},
+	}
+
+	result := formatQueryResult("share-results", 1, time.Millisecond, data)
+	if !strings.Contains(result, "Masked for privacy (the user sees the real values): email (detected email)") {
+		t.Errorf("Expected masking footer, got: %s", result)
+	}
+
+	var nilMasker *ResultMasker
+	if nilMasker.Mask(data) != data {
+		t.Error("Expected nil masker to return data unchanged")
+	}
+}
@@ -0,0 +1,23 @@
+package agent
+
+// Modes lists the privacy modes from the least to the most data shared with the LLM
+var Modes = []string{"schema-only", "default", "aggregate-only", "share-results"}
+
+// IsValidMode reports whether mode is a known privacy mode
+func IsValidMode(mode string) bool {
+	return modeLevel(mode) >= 0
+}
+
+// SharesMoreThan reports whether mode shares more data with the LLM than other
+func SharesMoreThan(mode, other string) bool {
+	return modeLevel(mode) > modeLevel(other)
+}
+
+func modeLevel(mode string) int {
+	for i, m := range Modes {
+		if m == mode {
+			return i
+		}
+	}
+	return -1
+}
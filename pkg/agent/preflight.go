@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AliciaSchep/pgbabble/pkg/db"
+	"github.com/AliciaSchep/pgbabble/pkg/explain"
+)
+
+// DefaultCostWarning is the estimated plan cost above which the approval prompt warns
+const DefaultCostWarning = 1000000
+
+// preflightTimeout bounds the silent EXPLAIN run before a query is shown for approval
+const preflightTimeout = 10 * time.Second
+
+// preflightEstimate is the planner's estimate for a proposed query
+type preflightEstimate struct {
+	cost       float64
+	rows       float64
+	highlights []explain.Highlight // sequential scans on large tables
+}
+
+// preflightQuery silently runs EXPLAIN on a proposed query with its parameter values, if any.
+// It returns nil when the query cannot be planned, e.g. because of a syntax error, which
+// execution reports properly.
+func preflightQuery(ctx context.Context, conn db.Connection, sqlQuery string, args ...interface{}) *preflightEstimate {
+	if err := validateSafeQuery(sqlQuery); err != nil {
+		return nil
+	}
+
+	timeout := preflightTimeout
+	if QueryTimeout < timeout {
+		timeout = QueryTimeout
+	}
+	queryCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	planJSON, err := queryPlan(queryCtx, conn, "EXPLAIN (FORMAT JSON) "+sqlQuery, false, args...)
+	if err != nil || planJSON == nil {
+		return nil
+	}
+	plan, err := explain.Parse(planJSON)
+	if err != nil {
+		return nil
+	}
+	recordPlanIdentifiers(conn, plan)
+
+	estimate := &preflightEstimate{cost: plan.Root.TotalCost, rows: plan.Root.PlanRows}
+	for _, h := range explain.Analyze(plan, tableRowEstimates(ctx, conn, plan)) {
+		if h.Kind == explain.KindSeqScan {
+			estimate.highlights = append(estimate.highlights, h)
+		}
+	}
+	return estimate
+}
+
+// blocked reports whether the estimate exceeds the hard cost cap, if one is set
+func (e *preflightEstimate) blocked(opts ExecutionOptions) bool {
+	return e != nil && opts.MaxQueryCost > 0 && e.cost > opts.MaxQueryCost
+}
+
+// describe summarizes the estimate for the approval prompt, warning loudly when
+// the cost exceeds the warning threshold
+func (e *preflightEstimate) describe(opts ExecutionOptions) string {
+	if e == nil {
+		return ""
+	}
+	threshold := opts.CostWarning
+	if threshold <= 0 {
+		threshold = DefaultCostWarning
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n\nPlanner estimate: cost %.0f, ~%.0f rows", e.cost, e.rows)
+	if e.cost > threshold {
+		fmt.Fprintf(&b, "\n⚠️  WARNING: THIS QUERY IS EXPENSIVE - estimated cost %.0f is above the warning threshold of %.0f", e.cost, threshold)
+	}
+	for _, h := range e.highlights {
+		fmt.Fprintf(&b, "\n⚠️  %s", h.Message)
+	}
+	return b.String()
+}
+
+// blockedByCostResult tells the LLM that a query was not shown for approval because of its
+// estimated cost. In schema-only mode the LLM gets no planner numbers, since cost, scans and
+// row counts describe the data.
+func blockedByCostResult(e *preflightEstimate, mode string, opts ExecutionOptions) *ToolResult {
+	if mode == "schema-only" {
+		return &ToolResult{
+			Content: "Query blocked before approval: the planner's estimated cost exceeds the hard limit set by the user. Rewrite the query to read less data, for example by filtering on indexed columns, aggregating, or adding a LIMIT clause.",
+			IsError: true,
+		}
+	}
+
+	var scans []string
+	for _, h := range e.highlights {
+		scans = append(scans, h.Message)
+	}
+	content := fmt.Sprintf("Query blocked before approval: the planner's estimated cost (%.0f) exceeds the hard limit of %.0f set by the user.", e.cost, opts.MaxQueryCost)
+	if len(scans) > 0 {
+		content += " The plan includes: " + strings.Join(scans, "; ") + "."
+	}
+	content += " Rewrite the query to read less data, for example by filtering on indexed columns, aggregating, or adding a LIMIT clause."
+	return &ToolResult{Content: content, IsError: true}
+}
@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/AliciaSchep/pgbabble/pkg/db"
+)
+
+func TestExecuteSQLTool_Preflight(t *testing.T) {
+	const seqScanPlan = `[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "events", "Alias": "events", "Startup Cost": 0, "Total Cost": 2500000, "Plan Rows": 100000000, "Plan Width": 40}}]`
+
+	newConn := func() *MockConnection {
+		return &MockConnection{
+			tables: []db.TableInfo{{Schema: "public", Name: "events", Type: "table", EstimatedRows: 100_000_000}},
+			queryRows: func(sql string) [][]interface{} {
+				if strings.HasPrefix(sql, "EXPLAIN (FORMAT JSON) ") {
+					return [][]interface{}{{seqScanPlan}}
+				}
+				return nil
+			},
+		}
+	}
+	input := map[string]interface{}{"sql": "SELECT * FROM events", "explanation": "All events"}
+	ctx := context.Background()
+
+	t.Run("warns in the approval prompt", func(t *testing.T) {
+		var prompt string
+		tool := createExecuteSQLTool(newConn(), func(p string) bool {
+			prompt = p
+			return false
+		}, "default", ExecutionOptions{})
+
+		if _, err := tool.Handler(ctx, input); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, want := range []string{
+			"Planner estimate: cost 2500000, ~100000000 rows",
+			"WARNING: THIS QUERY IS EXPENSIVE",
+			"sequential scan on large table events (~100.0M rows)",
+		} {
+			if !strings.Contains(prompt, want) {
+				t.Errorf("expected %q in approval prompt:\n%s", want, prompt)
+			}
+		}
+	})
+
+	t.Run("no warning below the threshold", func(t *testing.T) {
+		var prompt string
+		tool := createExecuteSQLTool(newConn(), func(p string) bool {
+			prompt = p
+			return false
+		}, "default", ExecutionOptions{CostWarning: 5000000})
+
+		if _, err := tool.Handler(ctx, input); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(prompt, "Planner estimate") || strings.Contains(prompt, "EXPENSIVE") {
+			t.Errorf("expected an estimate without a cost warning:\n%s", prompt)
+		}
+	})
+
+	t.Run("blocked above the hard cap", func(t *testing.T) {
+		asked := false
+		tool := createExecuteSQLTool(newConn(), func(p string) bool {
+			asked = true
+			return true
+		}, "default", ExecutionOptions{MaxQueryCost: 1000000})
+
+		result, err := tool.Handler(ctx, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if asked {
+			t.Error("expected blocked query not to be shown for approval")
+		}
+		if !result.IsError || !strings.Contains(result.Content, "exceeds the hard limit of 1000000") {
+			t.Errorf("expected blocked result, got: %s", result.Content)
+		}
+	})
+
+	t.Run("blocked in schema-only mode", func(t *testing.T) {
+		tool := createExecuteSQLTool(newConn(), func(p string) bool { return true }, "schema-only", ExecutionOptions{MaxQueryCost: 1000000})
+
+		result, err := tool.Handler(ctx, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError || !strings.Contains(result.Content, "exceeds the hard limit set by the user") {
+			t.Errorf("expected blocked result, got: %s", result.Content)
+		}
+		for _, leaked := range []string{"2500000", "1000000", "events", "rows"} {
+			if strings.Contains(result.Content, leaked) {
+				t.Errorf("expected no planner details in schema-only mode, found %q in: %s", leaked, result.Content)
+			}
+		}
+	})
+
+	t.Run("no estimate when the query cannot be planned", func(t *testing.T) {
+		var prompt string
+		conn := &MockConnection{}
+		tool := createExecuteSQLTool(conn, func(p string) bool {
+			prompt = p
+			return false
+		}, "default", ExecutionOptions{MaxQueryCost: 1})
+
+		if _, err := tool.Handler(ctx, input); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Contains(prompt, "Planner estimate") {
+			t.Errorf("expected no estimate, got:\n%s", prompt)
+		}
+	})
+}
@@ -94,6 +94,7 @@ func (tr *ToolRegistry) ExecuteTool(ctx context.Context, name string, input map[
 		}, err
 	}
 
+	result.Content = stripDataMarkers(result.Content)
 	return result, nil
 }
 
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultResultHistory is how many query results a session keeps for /browse and /save
+const DefaultResultHistory = 10
+
+// StoredResult is a query result kept for browsing and saving
+type StoredResult struct {
+	ID             int
+	SQL            string
+	Params         []string // values of the query's $1, $2, ... parameters
+	Explanation    string   // what the query is for, as shown when it was approved
+	ExecutedAt     time.Time
+	Duration       time.Duration
+	ColumnNames    []string
+	ColumnTypes    []string // Postgres type names, empty when unknown
+	ColumnTypeMods []int32  // Postgres type modifiers, such as a numeric's precision; -1 when none
+	Rows           [][]interface{}
+	Truncated      bool // the row limit was reached and further rows were not fetched
+}
+
+// ResultStore keeps a session's most recent query results, numbered from 1 in the
+// order they ran. It is safe for concurrent use; a nil store keeps nothing.
+type ResultStore struct {
+	mu      sync.Mutex
+	max     int
+	nextID  int
+	results []*StoredResult // oldest first
+	// recorded holds every result added since Record was called, nil when not recording
+	recorded *[]*StoredResult
+}
+
+// NewResultStore creates a store holding the last max results
+func NewResultStore(max int) *ResultStore {
+	if max < 1 {
+		max = DefaultResultHistory
+	}
+	return &ResultStore{max: max, nextID: 1}
+}
+
+// Add stores a result, assigning its id and evicting the oldest result when full
+func (s *ResultStore) Add(r *StoredResult) *StoredResult {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.ID = s.nextID
+	s.nextID++
+	s.results = append(s.results, r)
+	if s.recorded != nil {
+		*s.recorded = append(*s.recorded, r)
+	}
+	if len(s.results) > s.max {
+		s.results = append([]*StoredResult(nil), s.results[len(s.results)-s.max:]...)
+	}
+	return r
+}
+
+// Get returns the result with the given id, or false if it was never stored or has been evicted
+func (s *ResultStore) Get(id int) (*StoredResult, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.results {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// Last returns the most recent result, or nil if there is none
+func (s *ResultStore) Last() *StoredResult {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.results) == 0 {
+		return nil
+	}
+	return s.results[len(s.results)-1]
+}
+
+// List returns the stored results, oldest first
+func (s *ResultStore) List() []*StoredResult {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*StoredResult(nil), s.results...)
+}
+
+// Record starts keeping every result added from now on, however many there are, until the
+// returned function is called. That function returns the recorded results in the order they ran.
+func (s *ResultStore) Record() func() []*StoredResult {
+	if s == nil {
+		return func() []*StoredResult { return nil }
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recorded := []*StoredResult{}
+	s.recorded = &recorded
+	return func() []*StoredResult {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.recorded == &recorded {
+			s.recorded = nil
+		}
+		return recorded
+	}
+}
@@ -0,0 +1,39 @@
+package agent
+
+import "testing"
+
+func TestResultStore(t *testing.T) {
+	store := NewResultStore(2)
+	for _, sql := range []string{"SELECT 1", "SELECT 2", "SELECT 3"} {
+		store.Add(&StoredResult{SQL: sql})
+	}
+
+	if _, ok := store.Get(1); ok {
+		t.Error("expected the oldest result to be evicted")
+	}
+	if r, ok := store.Get(2); !ok || r.SQL != "SELECT 2" {
+		t.Errorf("expected result #2, got %+v", r)
+	}
+	if last := store.Last(); last == nil || last.ID != 3 {
+		t.Errorf("expected result #3 to be the last, got %+v", last)
+	}
+	if list := store.List(); len(list) != 2 || list[0].ID != 2 || list[1].ID != 3 {
+		t.Errorf("expected results #2 and #3 oldest first, got %+v", list)
+	}
+
+	// Recording keeps every result added, including those the store has evicted
+	stop := store.Record()
+	for _, sql := range []string{"SELECT 4", "SELECT 5", "SELECT 6"} {
+		store.Add(&StoredResult{SQL: sql})
+	}
+	recorded := stop()
+	store.Add(&StoredResult{SQL: "SELECT 7"})
+	if len(recorded) != 3 || recorded[0].ID != 4 || recorded[2].ID != 6 {
+		t.Errorf("expected results #4 to #6 to be recorded, got %+v", recorded)
+	}
+
+	var none *ResultStore
+	if none.Add(&StoredResult{}) != nil || none.Last() != nil || len(none.List()) != 0 || none.Record()() != nil {
+		t.Error("expected a nil store to keep nothing")
+	}
+}
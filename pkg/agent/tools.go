@@ -5,43 +5,92 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/AliciaSchep/pgbabble/pkg/audit"
 	"github.com/AliciaSchep/pgbabble/pkg/db"
 	"github.com/AliciaSchep/pgbabble/pkg/display"
 	pkgerrors "github.com/AliciaSchep/pgbabble/pkg/errors"
+	"github.com/AliciaSchep/pgbabble/pkg/explain"
+	"github.com/AliciaSchep/pgbabble/pkg/history"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 // QueryTimeout is the default timeout for SQL query execution
 var QueryTimeout = 60 * time.Second
 
-// LastQueryResult stores the most recent query result for browsing
-var LastQueryResult *QueryResultWithData
-
-// QueryResultWithData extends QueryResultData with additional metadata
-type QueryResultWithData struct {
-	QueryResultData
-	AllRows   [][]interface{}
-	QueryText string
-}
-
-// CreateSchemaTools creates all schema inspection tools for the LLM
-func CreateSchemaTools(conn db.Connection, mode string) []*Tool {
+// CreateSchemaTools creates all schema inspection tools for the LLM. Column values in
+// statistics are masked with masker; nil shares them unmasked.
+func CreateSchemaTools(conn db.Connection, mode string, masker *ResultMasker) []*Tool {
 	return []*Tool{
 		createListTablesTool(conn, mode),
 		createDescribeTableTool(conn),
 		createGetRelationshipsTool(conn),
 		createSearchColumnsTool(conn),
+		createGetViewDefinitionTool(conn),
+		createListFunctionsTool(conn),
+		createColumnStatsTool(conn, mode, masker),
+	}
+}
+
+// ExecutionOptions configures optional behavior of the SQL execution tools
+type ExecutionOptions struct {
+	// Masker masks result values shared with the LLM; nil shares them unmasked
+	Masker *ResultMasker
+	// MinGroupSize is the smallest group shared in aggregate-only mode; 0 uses DefaultMinGroupSize
+	MinGroupSize int
+	// Audit records query decisions and executions; nil disables auditing
+	Audit *audit.Logger
+	// Corrections enables automatic correction of fixable query errors; nil disables it
+	Corrections *Corrections
+	// MaxAnalyzeCost is the highest estimated plan cost EXPLAIN ANALYZE may run for; 0 uses DefaultMaxAnalyzeCost
+	MaxAnalyzeCost float64
+	// CostWarning is the estimated cost above which the approval prompt warns; 0 uses DefaultCostWarning
+	CostWarning float64
+	// MaxQueryCost blocks queries whose estimated cost is higher without asking the user; 0 disables the cap
+	MaxQueryCost float64
+	// Results keeps the session's recent query results; nil keeps none
+	Results *ResultStore
+	// History records every executed, failed, rejected or blocked query; nil records nothing
+	History *history.Log
+	// ConfirmShare asks the user whether sampled column values may be sent to the LLM;
+	// nil never shares them
+	ConfirmShare func(preview string) bool
+	// Output receives progress, results and messages for the user; nil writes to stdout
+	Output io.Writer
+}
+
+// out returns where messages for the user are written
+func (o ExecutionOptions) out() io.Writer {
+	if o.Output == nil {
+		return os.Stdout
 	}
+	return o.Output
 }
 
+// syncOutput flushes progress written to a file such as the terminal
+func syncOutput(w io.Writer) {
+	if f, ok := w.(*os.File); ok {
+		_ = f.Sync()
+	}
+}
+
+// DefaultMaxAnalyzeCost is the default estimated cost limit for EXPLAIN ANALYZE
+const DefaultMaxAnalyzeCost = 100000
+
 // CreateExecutionTools creates SQL execution tools for the LLM
-func CreateExecutionTools(conn db.Connection, getUserApproval func(string) bool, mode string) []*Tool {
+func CreateExecutionTools(conn db.Connection, getUserApproval func(string) bool, mode string, opts ExecutionOptions) []*Tool {
 	return []*Tool{
-		createExecuteSQLTool(conn, getUserApproval, mode),
-		createExplainQueryTool(conn, getUserApproval, mode),
+		createExecuteSQLTool(conn, getUserApproval, mode, opts),
+		createExplainQueryTool(conn, getUserApproval, mode, opts),
+		createSuggestIndexesTool(conn, getUserApproval, mode, opts),
+		createSampleColumnValuesTool(conn, mode, opts),
 	}
 }
 
@@ -85,21 +134,23 @@ func createListTablesTool(conn db.Connection, mode string) *Tool {
 				result.WriteString(strings.Repeat("-", len(schema)+8) + "\n")
 
 				for _, table := range schemaTables {
-					if mode == "default" || mode == "share-results" {
-						// Include estimated table size information for default and share-results modes
+					if mode != "schema-only" {
+						// Include estimated table size information in every mode except schema-only
 						if table.EstimatedRows <= 0 {
-							result.WriteString(fmt.Sprintf("- %s (%s) - empty or no stats\n", table.Name, table.Type))
+							result.WriteString(fmt.Sprintf("- %s (%s) - empty or no stats%s\n", table.Name, table.Type, formatAccessMarkers(table)))
 						} else {
-							result.WriteString(fmt.Sprintf("- %s (%s) - ~%d rows (estimated)\n", table.Name, table.Type, table.EstimatedRows))
+							result.WriteString(fmt.Sprintf("- %s (%s) - ~%d rows (estimated)%s\n", table.Name, table.Type, table.EstimatedRows, formatAccessMarkers(table)))
 						}
 					} else {
 						// Schema-only mode: no size information
-						result.WriteString(fmt.Sprintf("- %s (%s)\n", table.Name, table.Type))
+						result.WriteString(fmt.Sprintf("- %s (%s)%s\n", table.Name, table.Type, formatAccessMarkers(table)))
 					}
 				}
 				result.WriteString("\n")
 			}
 
+			result.WriteString("Legend: [NO ACCESS] = cannot be queried by the connected role; [PARTIAL ACCESS] = only some columns can be selected; [RLS] = row-level security limits visible rows\n")
+
 			return &ToolResult{
 				Content: result.String(),
 			}, nil
@@ -107,6 +158,65 @@ func createListTablesTool(conn db.Connection, mode string) *Tool {
 	}
 }
 
+// formatAccessMarkers returns privilege and row-level security markers for a table listing
+func formatAccessMarkers(table db.TableInfo) string {
+	var markers string
+	switch table.Access {
+	case db.AccessNone:
+		markers += " [NO ACCESS]"
+	case db.AccessPartial:
+		markers += " [PARTIAL ACCESS]"
+	}
+	if table.RowSecurity {
+		markers += " [RLS]"
+	}
+	return markers
+}
+
+// SummarizeTableAccess describes which tables the connected role can read, for the system prompt
+func SummarizeTableAccess(tables []db.TableInfo) string {
+	const maxListed = 50
+
+	var noAccess, partial, rls []string
+	for _, table := range tables {
+		name := table.Schema + "." + table.Name
+		switch table.Access {
+		case db.AccessNone:
+			noAccess = append(noAccess, name)
+		case db.AccessPartial:
+			partial = append(partial, name)
+		}
+		if table.RowSecurity && table.IsReadable() {
+			rls = append(rls, name)
+		}
+	}
+
+	if len(noAccess) == 0 && len(partial) == 0 && len(rls) == 0 {
+		return fmt.Sprintf("The connected role can read all %d tables and views.", len(tables))
+	}
+
+	listNames := func(names []string) string {
+		if len(names) > maxListed {
+			return fmt.Sprintf("%s and %d more", strings.Join(names[:maxListed], ", "), len(names)-maxListed)
+		}
+		return strings.Join(names, ", ")
+	}
+
+	var summary strings.Builder
+	summary.WriteString(fmt.Sprintf("The connected role can read %d of %d tables and views.\n",
+		len(tables)-len(noAccess), len(tables)))
+	if len(noAccess) > 0 {
+		summary.WriteString(fmt.Sprintf("NO SELECT privilege (never query these): %s\n", listNames(noAccess)))
+	}
+	if len(partial) > 0 {
+		summary.WriteString(fmt.Sprintf("Only some columns readable (check describe_table before selecting columns, avoid SELECT *): %s\n", listNames(partial)))
+	}
+	if len(rls) > 0 {
+		summary.WriteString(fmt.Sprintf("Row-level security enabled (results only include rows permitted by policies): %s\n", listNames(rls)))
+	}
+	return summary.String()
+}
+
 // createDescribeTableTool creates a tool to describe a specific table
 func createDescribeTableTool(conn db.Connection) *Tool {
 	return &Tool{
@@ -117,7 +227,7 @@ func createDescribeTableTool(conn db.Connection) *Tool {
 			Properties: map[string]interface{}{
 				"table_name": map[string]interface{}{
 					"type":        "string",
-					"description": "Name of the table to describe. Can include schema (e.g., 'public.users' or just 'users')",
+					"description": "Name of the table to describe. Can include schema (e.g., 'public.users' or just 'users', resolved using the search_path)",
 				},
 			},
 			Required: []string{"table_name"},
@@ -131,14 +241,13 @@ func createDescribeTableTool(conn db.Connection) *Tool {
 				}, fmt.Errorf("invalid table_name parameter")
 			}
 
-			// Parse schema.table if provided
-			schema := "public"
-			if strings.Contains(tableName, ".") {
-				parts := strings.Split(tableName, ".")
-				if len(parts) == 2 {
-					schema = parts[0]
-					tableName = parts[1]
-				}
+			// Resolve schema.table against the search_path
+			schema, tableName, err := conn.ResolveTableName(ctx, tableName)
+			if err != nil {
+				return &ToolResult{
+					Content: fmt.Sprintf("Error: %v", err),
+					IsError: true,
+				}, err
 			}
 
 			table, err := conn.DescribeTable(ctx, schema, tableName)
@@ -154,6 +263,7 @@ func createDescribeTableTool(conn db.Connection) *Tool {
 			if table.Description != "" {
 				result.WriteString(fmt.Sprintf("Description: %s\n", table.Description))
 			}
+			writeTableSecurity(&result, table)
 			result.WriteString("\n")
 
 			if len(table.Columns) == 0 {
@@ -181,6 +291,9 @@ func createDescribeTableTool(conn db.Connection) *Tool {
 				if defaultVal == "" {
 					defaultVal = "(none)"
 				}
+				if col.SelectDenied {
+					defaultVal += " [NO SELECT PRIVILEGE]"
+				}
 
 				result.WriteString(fmt.Sprintf("%-20s %-15s %-8s %-8s %s\n",
 					col.Name, col.DataType, nullable, key, defaultVal))
@@ -204,6 +317,39 @@ func createDescribeTableTool(conn db.Connection) *Tool {
 	}
 }
 
+// writeTableSecurity writes access level and row-level security details for a table
+func writeTableSecurity(result *strings.Builder, table *db.TableInfo) {
+	switch table.Access {
+	case db.AccessNone:
+		result.WriteString("Access: NO SELECT privilege - queries on this table will fail\n")
+	case db.AccessPartial:
+		result.WriteString("Access: PARTIAL - only columns without [NO SELECT PRIVILEGE] can be selected\n")
+	}
+
+	if !table.RowSecurity {
+		return
+	}
+	if table.ForceRLS {
+		result.WriteString("Row-level security: ENABLED (forced, also applies to the table owner)\n")
+	} else {
+		result.WriteString("Row-level security: ENABLED\n")
+	}
+	if len(table.Policies) == 0 {
+		result.WriteString("  No policies defined - no rows are visible unless the role owns the table or bypasses RLS\n")
+	}
+	for _, policy := range table.Policies {
+		kind := "permissive"
+		if !policy.Permissive {
+			kind = "restrictive"
+		}
+		result.WriteString(fmt.Sprintf("  Policy %s: %s, %s, roles: %s", policy.Name, policy.Command, kind, strings.Join(policy.Roles, ", ")))
+		if policy.Using != "" {
+			result.WriteString(fmt.Sprintf(", USING (%s)", policy.Using))
+		}
+		result.WriteString("\n")
+	}
+}
+
 // createGetRelationshipsTool creates a tool to get foreign key relationships for a table
 func createGetRelationshipsTool(conn db.Connection) *Tool {
 	return &Tool{
@@ -228,14 +374,13 @@ func createGetRelationshipsTool(conn db.Connection) *Tool {
 				}, fmt.Errorf("invalid table_name parameter")
 			}
 
-			// Parse schema.table if provided
-			schema := "public"
-			if strings.Contains(tableName, ".") {
-				parts := strings.Split(tableName, ".")
-				if len(parts) == 2 {
-					schema = parts[0]
-					tableName = parts[1]
-				}
+			// Resolve schema.table against the search_path
+			schema, tableName, err := conn.ResolveTableName(ctx, tableName)
+			if err != nil {
+				return &ToolResult{
+					Content: fmt.Sprintf("Error: %v", err),
+					IsError: true,
+				}, err
 			}
 
 			foreignKeys, err := conn.GetForeignKeys(ctx, schema, tableName)
@@ -335,6 +480,278 @@ func createSearchColumnsTool(conn db.Connection) *Tool {
 	}
 }
 
+// createGetViewDefinitionTool creates a tool to fetch the SQL definition of a view
+func createGetViewDefinitionTool(conn db.Connection) *Tool {
+	return &Tool{
+		Name:        "get_view_definition",
+		Description: "Gets the SQL definition of a view or materialized view. Use this to understand logic a view already encapsulates instead of re-implementing it",
+		InputSchema: ToolSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"view_name": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the view. Can include schema (e.g., 'public.active_users' or just 'active_users')",
+				},
+			},
+			Required: []string{"view_name"},
+		},
+		Handler: func(ctx context.Context, input map[string]interface{}) (*ToolResult, error) {
+			viewName, ok := input["view_name"].(string)
+			if !ok {
+				return &ToolResult{
+					Content: "Error: view_name must be a string",
+					IsError: true,
+				}, fmt.Errorf("invalid view_name parameter")
+			}
+
+			// Resolve schema.view against the search_path
+			schema, viewName, err := conn.ResolveTableName(ctx, viewName)
+			if err != nil {
+				return &ToolResult{
+					Content: fmt.Sprintf("Error: %v", err),
+					IsError: true,
+				}, err
+			}
+
+			view, err := conn.GetViewDefinition(ctx, schema, viewName)
+			if err != nil {
+				return &ToolResult{
+					Content: fmt.Sprintf("Error getting definition of %s.%s: %v", schema, viewName, err),
+					IsError: true,
+				}, err
+			}
+
+			var result strings.Builder
+			result.WriteString(fmt.Sprintf("View: %s.%s (%s)\n", view.Schema, view.Name, view.Type))
+			if view.Description != "" {
+				result.WriteString(fmt.Sprintf("Description: %s\n", view.Description))
+			}
+			result.WriteString("\nDefinition:\n")
+			result.WriteString("===========\n")
+			result.WriteString(strings.TrimSpace(view.Definition) + "\n")
+
+			return &ToolResult{
+				Content: result.String(),
+			}, nil
+		},
+	}
+}
+
+// createListFunctionsTool creates a tool to list and describe user-defined functions
+func createListFunctionsTool(conn db.Connection) *Tool {
+	return &Tool{
+		Name:        "list_functions",
+		Description: "Lists user-defined SQL functions with their signature, return type, volatility, language and description. Only IMMUTABLE and STABLE functions may be called from queries",
+		InputSchema: ToolSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"pattern": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional pattern to filter function names (case-insensitive, supports partial matches)",
+				},
+			},
+			Required: []string{},
+		},
+		Handler: func(ctx context.Context, input map[string]interface{}) (*ToolResult, error) {
+			pattern, _ := input["pattern"].(string)
+
+			functions, err := conn.ListFunctions(ctx, pattern)
+			if err != nil {
+				return &ToolResult{
+					Content: fmt.Sprintf("Error listing functions: %v", err),
+					IsError: true,
+				}, err
+			}
+
+			if len(functions) == 0 {
+				return &ToolResult{
+					Content: "No user-defined functions found.",
+				}, nil
+			}
+
+			var callable, notCallable []db.FunctionInfo
+			for _, fn := range functions {
+				if fn.IsCallableFromQuery() {
+					callable = append(callable, fn)
+				} else {
+					notCallable = append(notCallable, fn)
+				}
+			}
+
+			var result strings.Builder
+			result.WriteString("User-Defined Functions:\n")
+			result.WriteString("=======================\n\n")
+
+			if len(callable) > 0 {
+				result.WriteString("Callable from queries (IMMUTABLE/STABLE):\n")
+				result.WriteString("-----------------------------------------\n")
+				for _, fn := range callable {
+					writeFunctionInfo(&result, fn)
+				}
+				result.WriteString("\n")
+			}
+
+			if len(notCallable) > 0 {
+				result.WriteString("NOT callable from queries (VOLATILE - may modify data):\n")
+				result.WriteString("-------------------------------------------------------\n")
+				for _, fn := range notCallable {
+					writeFunctionInfo(&result, fn)
+				}
+			}
+
+			return &ToolResult{
+				Content: result.String(),
+			}, nil
+		},
+	}
+}
+
+// writeFunctionInfo writes a single function description to the builder
+func writeFunctionInfo(result *strings.Builder, fn db.FunctionInfo) {
+	result.WriteString(fmt.Sprintf("- %s RETURNS %s [%s, %s]\n",
+		fn.Signature(), fn.ReturnType, strings.ToUpper(fn.Volatility), fn.Language))
+	if fn.Description != "" {
+		result.WriteString(fmt.Sprintf("  %s\n", fn.Description))
+	}
+}
+
+// createColumnStatsTool creates a tool to read planner statistics for table columns
+func createColumnStatsTool(conn db.Connection, mode string, masker *ResultMasker) *Tool {
+	return &Tool{
+		Name:        "column_stats",
+		Description: "Gets planner statistics for table columns (distinct values, null fraction, average width, physical ordering correlation). Useful for writing good filters and understanding cardinality",
+		InputSchema: ToolSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"table_name": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the table. Can include schema (e.g., 'public.orders' or just 'orders')",
+				},
+				"column_name": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional column name. If omitted, statistics for all columns are returned",
+				},
+			},
+			Required: []string{"table_name"},
+		},
+		Handler: func(ctx context.Context, input map[string]interface{}) (*ToolResult, error) {
+			tableName, ok := input["table_name"].(string)
+			if !ok {
+				return &ToolResult{
+					Content: "Error: table_name must be a string",
+					IsError: true,
+				}, fmt.Errorf("invalid table_name parameter")
+			}
+			columnName, _ := input["column_name"].(string)
+
+			// Schema-only mode: no statistics are shared
+			if mode == "schema-only" {
+				return &ToolResult{
+					Content: "Column statistics are not shared in schema-only mode for privacy. Rely on column names and types instead.",
+				}, nil
+			}
+
+			// Resolve schema.table against the search_path
+			schema, tableName, err := conn.ResolveTableName(ctx, tableName)
+			if err != nil {
+				return &ToolResult{
+					Content: fmt.Sprintf("Error: %v", err),
+					IsError: true,
+				}, err
+			}
+
+			stats, err := conn.GetColumnStats(ctx, schema, tableName)
+			if err != nil {
+				return &ToolResult{
+					Content: fmt.Sprintf("Error getting column statistics for %s.%s: %v", schema, tableName, err),
+					IsError: true,
+				}, err
+			}
+
+			if columnName != "" {
+				var filtered []db.ColumnStats
+				for _, st := range stats {
+					if st.Column == columnName {
+						filtered = append(filtered, st)
+					}
+				}
+				stats = filtered
+			}
+
+			if len(stats) == 0 {
+				return &ToolResult{
+					Content: fmt.Sprintf("No statistics available for %s.%s. The table may not have been analyzed yet, or the column does not exist.", schema, tableName),
+				}, nil
+			}
+
+			var result strings.Builder
+			result.WriteString(fmt.Sprintf("Column Statistics for %s.%s:\n", schema, tableName))
+			result.WriteString(strings.Repeat("=", 50) + "\n\n")
+
+			for _, st := range stats {
+				result.WriteString(fmt.Sprintf("Column: %s\n", st.Column))
+				result.WriteString(fmt.Sprintf("  Null fraction: %.1f%%\n", st.NullFraction*100))
+				result.WriteString(fmt.Sprintf("  Distinct values: %s\n", formatNDistinct(st.NDistinct)))
+				result.WriteString(fmt.Sprintf("  Average width: %d bytes\n", st.AvgWidth))
+				if st.Correlation != nil {
+					result.WriteString(fmt.Sprintf("  Correlation: %.2f\n", *st.Correlation))
+				}
+
+				// Actual values are only shared in share-results mode, masked like query results
+				if mode == "share-results" {
+					if st.MostCommonVals != "" {
+						if values, ok := masker.MaskArrayText(st.Column, st.TypeName, st.MostCommonVals); ok {
+							result.WriteString(fmt.Sprintf("  Most common values: %s\n", dataValue(values)))
+							result.WriteString(fmt.Sprintf("  Most common frequencies: %s\n", formatFrequencies(st.MostCommonFreqs)))
+						} else {
+							result.WriteString("  Most common values: withheld because they could not be masked\n")
+						}
+					}
+					if st.HistogramBounds != "" {
+						if bounds, ok := masker.MaskArrayText(st.Column, st.TypeName, st.HistogramBounds); ok {
+							result.WriteString(fmt.Sprintf("  Histogram bounds: %s\n", dataValue(bounds)))
+						} else {
+							result.WriteString("  Histogram bounds: withheld because they could not be masked\n")
+						}
+					}
+				}
+				result.WriteString("\n")
+			}
+
+			if mode != "share-results" {
+				result.WriteString("Note: most common values and histogram bounds are not shared in this mode.\n")
+			}
+
+			return &ToolResult{
+				Content: result.String(),
+			}, nil
+		},
+	}
+}
+
+// formatNDistinct describes pg_stats.n_distinct, which is negative when it is a fraction of rows
+func formatNDistinct(nDistinct float64) string {
+	switch {
+	case nDistinct == -1:
+		return "all values are unique"
+	case nDistinct < 0:
+		return fmt.Sprintf("~%.1f%% of rows are distinct (scales with table size)", -nDistinct*100)
+	case nDistinct == 0:
+		return "unknown"
+	default:
+		return fmt.Sprintf("~%.0f", nDistinct)
+	}
+}
+
+// formatFrequencies formats most-common-value frequencies as percentages
+func formatFrequencies(freqs []float64) string {
+	parts := make([]string, len(freqs))
+	for i, f := range freqs {
+		parts[i] = fmt.Sprintf("%.1f%%", f*100)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
 // MarshalToolsToJSON converts tools to JSON for debugging/logging
 func MarshalToolsToJSON(tools []*Tool) (string, error) {
 	// Create a simplified version for JSON marshaling
@@ -361,7 +778,7 @@ func MarshalToolsToJSON(tools []*Tool) (string, error) {
 }
 
 // createExecuteSQLTool creates a tool for executing SQL queries with user approval
-func createExecuteSQLTool(conn db.Connection, getUserApproval func(string) bool, mode string) *Tool {
+func createExecuteSQLTool(conn db.Connection, getUserApproval func(string) bool, mode string, opts ExecutionOptions) *Tool {
 	return &Tool{
 		Name:        "execute_sql",
 		Description: "Execute a SQL query after getting user approval. Use this when you have generated a SQL query that answers the user's question. IMPORTANT: If the user rejects the query, do NOT immediately offer another SQL query. Instead, ask the user what they want changed or modified about the query approach.",
@@ -393,10 +810,26 @@ func createExecuteSQLTool(conn db.Connection, getUserApproval func(string) bool,
 				explanation = "SQL query execution"
 			}
 
-			// Present SQL to user for approval
-			approved := getUserApproval(fmt.Sprintf("%s\n\nSQL Query:\n%s", explanation, sqlQuery))
+			// Reject references to hidden objects before bothering the user
+			if err := validateQueryObjects(ctx, conn, sqlQuery); err != nil {
+				return blockedQueryResult(opts.out(), err), nil
+			}
+
+			// Check the planner's estimate before bothering the user
+			estimate := preflightQuery(ctx, conn, sqlQuery)
+			if estimate.blocked(opts) {
+				pkgerrors.To(opts.out()).UserWarning("Query blocked: estimated cost %.0f exceeds the limit of %.0f", estimate.cost, opts.MaxQueryCost)
+				opts.History.Record(history.Entry{SQL: sqlQuery, Outcome: history.OutcomeBlocked})
+				return blockedByCostResult(estimate, mode, opts), nil
+			}
+
+			// Present SQL to user for approval, as a diff when it corrects a failed query
+			approved := getUserApproval(opts.Corrections.approvalPrompt(explanation, sqlQuery) + estimate.describe(opts))
+			recordDecision(opts, mode, "execute_sql", sqlQuery, approved)
 
 			if !approved {
+				opts.Corrections.Reset()
+				opts.History.Record(history.Entry{SQL: sqlQuery, Outcome: history.OutcomeRejected})
 				return &ToolResult{
 					Content: "User rejected the query execution. Do NOT immediately offer another SQL query. Instead, ask the user what they want changed, modified, or what approach they prefer. Find out what was wrong with the query or what they wanted differently.",
 					IsError: false,
@@ -404,13 +837,20 @@ func createExecuteSQLTool(conn db.Connection, getUserApproval func(string) bool,
 			}
 
 			// Execute the approved query
-			result, err := executeApprovedSQL(ctx, conn, sqlQuery, mode)
+			result, err := executeApprovedSQL(ctx, conn, Query{SQL: sqlQuery, Explanation: explanation}, mode, opts)
 			if err != nil {
+				opts.Audit.Record(audit.Event{Type: audit.EventSQLExecuted, Mode: mode, Tool: "execute_sql", SQL: sqlQuery, Error: err.Error()})
+				opts.History.Record(history.Entry{SQL: sqlQuery, Outcome: history.OutcomeFailed, Error: err.Error()})
+				content := fmt.Sprintf("Query execution failed: %s", err.Error())
+				if instructions := opts.Corrections.failed(sqlQuery, err); instructions != "" {
+					content += "\n\n" + instructions
+				}
 				return &ToolResult{
-					Content: fmt.Sprintf("Query execution failed: %s", err.Error()),
+					Content: content,
 					IsError: true,
 				}, nil
 			}
+			opts.Corrections.Reset()
 
 			return &ToolResult{
 				Content: result,
@@ -420,19 +860,119 @@ func createExecuteSQLTool(conn db.Connection, getUserApproval func(string) bool,
 	}
 }
 
+// recordDecision writes the user's decision on a proposed query to the audit log
+func recordDecision(opts ExecutionOptions, mode, tool, sqlQuery string, approved bool) {
+	decision := audit.DecisionRejected
+	if approved {
+		decision = audit.DecisionApproved
+	}
+	opts.Audit.Record(audit.Event{Type: audit.EventSQLDecision, Mode: mode, Tool: tool, SQL: sqlQuery, Decision: decision})
+}
+
+// Query is a query to execute with the values of its $1, $2, ... parameters and what it is for
+type Query struct {
+	SQL         string
+	Params      []string // sent as text, so the server converts them to the parameters' types
+	Explanation string
+}
+
+// args returns the parameter values as query arguments
+func (q Query) args() []interface{} {
+	args := make([]interface{}, len(q.Params))
+	for i, p := range q.Params {
+		args[i] = p
+	}
+	return args
+}
+
+// RunQuery executes a query the user asked for directly, such as a /replay of a past query,
+// without involving the LLM. The results are shown and kept like those of an approved query.
+// Problems are reported to the user as they happen and also returned.
+func RunQuery(ctx context.Context, conn db.Connection, q Query, mode string, opts ExecutionOptions) error {
+	if err := validateQueryObjects(ctx, conn, q.SQL); err != nil {
+		pkgerrors.To(opts.out()).UserError("Query blocked: %v", err)
+		return err
+	}
+	if estimate := preflightQuery(ctx, conn, q.SQL, q.args()...); estimate.blocked(opts) {
+		pkgerrors.To(opts.out()).UserWarning("Query blocked: estimated cost %.0f exceeds the limit of %.0f", estimate.cost, opts.MaxQueryCost)
+		opts.History.Record(history.Entry{SQL: q.SQL, Params: q.Params, Outcome: history.OutcomeBlocked})
+		return fmt.Errorf("query blocked: estimated cost %.0f exceeds the limit of %.0f", estimate.cost, opts.MaxQueryCost)
+	}
+
+	if _, err := executeApprovedSQL(ctx, conn, q, mode, opts); err != nil {
+		opts.Audit.Record(audit.Event{Type: audit.EventSQLExecuted, Mode: mode, SQL: q.SQL, Error: err.Error()})
+		opts.History.Record(history.Entry{SQL: q.SQL, Params: q.Params, Outcome: history.OutcomeFailed, Error: err.Error()})
+		return err
+	}
+	return nil
+}
+
+// ExportQuery runs a query the user asked to export, such as a stored result saved to a file,
+// and passes its rows to export as they arrive instead of keeping them; export returns the
+// number of rows it wrote. The query is checked, capped by cost, limited by QueryTimeout and
+// recorded like RunQuery. Approval is up to the caller.
+func ExportQuery(ctx context.Context, conn db.Connection, q Query, mode string, opts ExecutionOptions, export func(pgx.Rows) (int, error)) error {
+	if err := validateSafeQuery(q.SQL); err != nil {
+		pkgerrors.To(opts.out()).UserError("Query blocked: %v", err)
+		return err
+	}
+	if err := validateQueryObjects(ctx, conn, q.SQL); err != nil {
+		pkgerrors.To(opts.out()).UserError("Query blocked: %v", err)
+		return err
+	}
+	if estimate := preflightQuery(ctx, conn, q.SQL, q.args()...); estimate.blocked(opts) {
+		pkgerrors.To(opts.out()).UserWarning("Query blocked: estimated cost %.0f exceeds the limit of %.0f", estimate.cost, opts.MaxQueryCost)
+		opts.History.Record(history.Entry{SQL: q.SQL, Params: q.Params, Outcome: history.OutcomeBlocked})
+		return fmt.Errorf("query blocked: estimated cost %.0f exceeds the limit of %.0f", estimate.cost, opts.MaxQueryCost)
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+	conn.EnsureConnection(ctx)
+
+	startTime := time.Now()
+	rowCount, err := func() (int, error) {
+		rows, err := conn.Query(queryCtx, q.SQL, q.args()...)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		count, err := export(rows)
+		if err != nil {
+			return count, err
+		}
+		return count, rows.Err()
+	}()
+	if err != nil {
+		if queryCtx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("query timed out after %v", QueryTimeout)
+		}
+		opts.Audit.Record(audit.Event{Type: audit.EventSQLExecuted, Mode: mode, SQL: q.SQL, Error: err.Error()})
+		opts.History.Record(history.Entry{SQL: q.SQL, Params: q.Params, Outcome: history.OutcomeFailed, Error: err.Error()})
+		return err
+	}
+
+	opts.Audit.Record(audit.Event{Type: audit.EventSQLExecuted, Mode: mode, SQL: q.SQL, Rows: &rowCount})
+	opts.History.Record(history.Entry{SQL: q.SQL, Params: q.Params, Outcome: history.OutcomeExecuted, Rows: &rowCount, Duration: time.Since(startTime)})
+	return nil
+}
+
 // executeApprovedSQL executes SQL and returns execution metadata (not actual data)
-func executeApprovedSQL(ctx context.Context, conn db.Connection, sqlQuery string, mode string) (string, error) {
+func executeApprovedSQL(ctx context.Context, conn db.Connection, q Query, mode string, opts ExecutionOptions) (string, error) {
 	// Validate that query is safe to execute
-	if err := validateSafeQuery(sqlQuery); err != nil {
+	if err := validateSafeQuery(q.SQL); err != nil {
 		return "", err
 	}
 
 	// Only SELECT and WITH queries are allowed
-	return executeSelectQuery(ctx, conn, sqlQuery, mode)
+	return executeSelectQuery(ctx, conn, q, mode, opts)
 }
 
 // executeSelectQuery executes a SELECT query and displays results to user
-func executeSelectQuery(ctx context.Context, conn db.Connection, sqlQuery string, mode string) (string, error) {
+func executeSelectQuery(ctx context.Context, conn db.Connection, q Query, mode string, opts ExecutionOptions) (string, error) {
+	out := opts.out()
+	sqlQuery := q.SQL
+
 	// Add configurable query timeout while preserving cancellation from parent context
 	queryCtx, cancel := context.WithTimeout(ctx, QueryTimeout)
 	defer cancel()
@@ -450,8 +990,8 @@ func executeSelectQuery(ctx context.Context, conn db.Connection, sqlQuery string
 			select {
 			case <-ticker.C:
 				elapsed := time.Since(startTime)
-				fmt.Printf("\rQuery running... %v elapsed", elapsed.Round(time.Second))
-				_ = os.Stdout.Sync()
+				fmt.Fprintf(out, "\rQuery running... %v elapsed", elapsed.Round(time.Second))
+				syncOutput(out)
 			case <-queryCtx.Done():
 				// Context cancelled - stop progress indicator
 				return
@@ -461,24 +1001,24 @@ func executeSelectQuery(ctx context.Context, conn db.Connection, sqlQuery string
 		}
 	}()
 
-	fmt.Print("Executing query...")
-	_ = os.Stdout.Sync()
+	fmt.Fprint(out, "Executing query...")
+	syncOutput(out)
 
 	// Ensure we have a healthy connection (use parent context, not query context)
 	conn.EnsureConnection(ctx)
 
-	rows, err := conn.Query(queryCtx, sqlQuery)
+	rows, err := conn.Query(queryCtx, sqlQuery, q.args()...)
 
 	// Stop progress indicator
 	close(done)
-	fmt.Print("\r") // Clear the progress line
+	fmt.Fprint(out, "\r") // Clear the progress line
 
 	if err != nil {
-		fmt.Print("\r") // Clear progress line
+		fmt.Fprint(out, "\r") // Clear progress line
 
 		// Check for context cancellation and provide appropriate message
 		if errors.Is(err, context.Canceled) || queryCtx.Err() == context.Canceled {
-			fmt.Println("⏹️  Query cancelled by user")
+			fmt.Fprintln(out, "⏹️  Query cancelled by user")
 
 			// With connection pools, cancelled connections are automatically handled
 			// No need for manual reconnection
@@ -486,38 +1026,44 @@ func executeSelectQuery(ctx context.Context, conn db.Connection, sqlQuery string
 			return "Query was cancelled by the user. The database connection remains active and ready for new queries. Please ask the user what they would like to do next.", nil
 		}
 		if queryCtx.Err() == context.DeadlineExceeded {
-			pkgerrors.UserError("Query timed out after %v", QueryTimeout)
+			pkgerrors.To(out).UserError("Query timed out after %v", QueryTimeout)
 			return "", fmt.Errorf("query timed out after %v - please check if your query is optimized or try adding LIMIT clause", QueryTimeout)
 		}
 
 		// Show concise error for technical users (without LLM instructions)
-		userErrorMsg := formatUserError(err)
-		pkgerrors.UserError("Query failed: %s", userErrorMsg)
+		userErrorMsg := formatUserError(err, sqlQuery)
+		pkgerrors.To(out).UserError("Query failed: %s", userErrorMsg)
 
 		// Return LLM-friendly error message with tool instructions
-		llmErrorMsg := formatDatabaseError(err)
-		return "", fmt.Errorf("%s", llmErrorMsg)
+		return "", newDatabaseError(err, sqlQuery)
 	}
 	defer rows.Close()
 
 	// Get column descriptions
 	fieldDescriptions := rows.FieldDescriptions()
 	columnNames := make([]string, len(fieldDescriptions))
+	columnTypes := make([]string, len(fieldDescriptions))
+	columnTypeMods := make([]int32, len(fieldDescriptions))
+	typeMap := pgtype.NewMap()
 	for i, fd := range fieldDescriptions {
 		columnNames[i] = string(fd.Name)
+		columnTypeMods[i] = fd.TypeModifier
+		if dataType, ok := typeMap.TypeForOID(fd.DataTypeOID); ok {
+			columnTypes[i] = dataType.Name
+		}
 	}
 
 	// Collect all rows first for both display and LLM data
 	allRows := make([][]interface{}, 0)
 	rowCount := 0
+	truncated := false
 
 	for rows.Next() {
 		values, err := rows.Values()
 		if err != nil {
-			userErrorMsg := formatUserError(err)
-			pkgerrors.UserError("Error processing query results: %s", userErrorMsg)
-			llmErrorMsg := formatDatabaseError(err)
-			return "", fmt.Errorf("%s", llmErrorMsg)
+			userErrorMsg := formatUserError(err, sqlQuery)
+			pkgerrors.To(out).UserError("Error processing query results: %s", userErrorMsg)
+			return "", newDatabaseError(err, sqlQuery)
 		}
 
 		// Make a copy of values to avoid reference issues
@@ -529,14 +1075,15 @@ func executeSelectQuery(ctx context.Context, conn db.Connection, sqlQuery string
 
 		// Limit to prevent overwhelming memory usage
 		if rowCount >= 10000 {
-			fmt.Printf("⚠️  Query returned more than 10,000 rows, limiting display...\n")
+			truncated = true
+			fmt.Fprintf(out, "⚠️  Query returned more than 10,000 rows, limiting display...\n")
 			break
 		}
 	}
 
 	// Display results to user with intelligent formatting
-	fmt.Println("\n📊 Query Results:")
-	fmt.Println(strings.Repeat("=", 50))
+	fmt.Fprintln(out, "\n📊 Query Results:")
+	fmt.Fprintln(out, strings.Repeat("=", 50))
 
 	if len(allRows) > 0 {
 		// Create table formatter and analyze data
@@ -546,65 +1093,114 @@ func executeSelectQuery(ctx context.Context, conn db.Connection, sqlQuery string
 		widths := formatter.CalculateColumnWidths()
 
 		// Print header
-		fmt.Print(formatter.FormatHeader(widths))
+		fmt.Fprint(out, formatter.FormatHeader(widths))
 
 		// Print rows (limit display to 25 for initial view)
 		displayLimit := min(len(allRows), 25)
 		for i := 0; i < displayLimit; i++ {
-			fmt.Print(formatter.FormatRow(allRows[i], widths))
+			fmt.Fprint(out, formatter.FormatRow(allRows[i], widths))
 		}
 
 		if len(allRows) > displayLimit {
-			fmt.Printf("... (showing first %d of %d rows, use /browse to view all)\n", displayLimit, len(allRows))
+			fmt.Fprintf(out, "... (showing first %d of %d rows, use /browse to view all)\n", displayLimit, len(allRows))
 		}
 	}
 
-	// Prepare collected data for LLM if in share-results mode
-	var collectedData *QueryResultData
-	if mode == "share-results" {
-		llmRowLimit := min(len(allRows), 50)
-		collectedData = &QueryResultData{
-			ColumnNames: columnNames,
-			Rows:        allRows[:llmRowLimit],
-			TotalRows:   rowCount,
-			Truncated:   len(allRows) > 50,
+	// Trace result columns back to table columns so masking rules survive renaming
+	shareMode := mode
+	var sourceColumns []string
+	if (mode == "share-results" || mode == "aggregate-only") && opts.Masker.needsSourceColumns() {
+		sourceColumns, err = conn.SourceColumns(ctx, fieldDescriptions)
+		if err != nil {
+			// Without sources a renamed column could escape its rule, so share no rows
+			pkgerrors.To(out).UserError("Could not resolve result columns for masking: %v", err)
+			shareMode = "schema-only"
 		}
 	}
 
-	if err := rows.Err(); err != nil {
-		userErrorMsg := formatUserError(err)
-		pkgerrors.UserError("Error during query result iteration: %s", userErrorMsg)
-		llmErrorMsg := formatDatabaseError(err)
-		return "", fmt.Errorf("%s", llmErrorMsg)
+	// Prepare collected data for LLM if in share-results mode
+	var collectedData *QueryResultData
+	switch shareMode {
+	case "share-results":
+		llmRowLimit := min(len(allRows), 50)
+		collectedData = opts.Masker.Mask(&QueryResultData{
+			ColumnNames:   columnNames,
+			ColumnTypes:   columnTypes,
+			SourceColumns: sourceColumns,
+			Rows:          allRows[:llmRowLimit],
+			TotalRows:     rowCount,
+			Truncated:     len(allRows) > 50,
+		})
+	case "aggregate-only":
+		collectedData = aggregateResultData(sqlQuery, &QueryResultData{
+			ColumnNames:   columnNames,
+			ColumnTypes:   columnTypes,
+			SourceColumns: sourceColumns,
+			Rows:          allRows,
+			TotalRows:     rowCount,
+		}, opts)
+	}
+
+	if err := rows.Err(); err != nil {
+		userErrorMsg := formatUserError(err, sqlQuery)
+		pkgerrors.To(out).UserError("Error during query result iteration: %s", userErrorMsg)
+		return "", newDatabaseError(err, sqlQuery)
 	}
 
 	// Calculate execution time
 	executionTime := time.Since(startTime)
 
-	// Store results for browse functionality
-	LastQueryResult = &QueryResultWithData{
-		QueryResultData: QueryResultData{
-			ColumnNames: columnNames,
-			Rows:        allRows,
-			TotalRows:   rowCount,
-			Truncated:   false,
-		},
-		AllRows:   allRows,
-		QueryText: sqlQuery,
+	// Keep the results for /browse and /save
+	stored := opts.Results.Add(&StoredResult{
+		SQL:            sqlQuery,
+		Params:         q.Params,
+		Explanation:    q.Explanation,
+		ExecutedAt:     startTime,
+		Duration:       executionTime,
+		ColumnNames:    columnNames,
+		ColumnTypes:    columnTypes,
+		ColumnTypeMods: columnTypeMods,
+		Rows:           allRows,
+		Truncated:      truncated,
+	})
+
+	opts.Audit.Record(audit.Event{Type: audit.EventSQLExecuted, Mode: mode, Tool: "execute_sql", SQL: sqlQuery, Rows: &rowCount})
+	opts.History.Record(history.Entry{SQL: sqlQuery, Params: q.Params, Outcome: history.OutcomeExecuted, Rows: &rowCount, Duration: executionTime})
+
+	if stored != nil {
+		fmt.Fprintf(out, "\n✅ Query executed successfully (%d rows in %v, result #%d)\n", rowCount, executionTime, stored.ID)
+	} else {
+		fmt.Fprintf(out, "\n✅ Query executed successfully (%d rows in %v)\n", rowCount, executionTime)
 	}
-
-	fmt.Printf("\n✅ Query executed successfully (%d rows in %v)\n\n", rowCount, executionTime)
+	if collectedData != nil && len(collectedData.MaskedColumns) > 0 {
+		pkgerrors.To(out).UserInfo("Masked before sharing with the LLM: %s", strings.Join(collectedData.MaskedColumns, ", "))
+	}
+	if collectedData != nil && collectedData.WithheldReason != "" {
+		pkgerrors.To(out).UserInfo("Results not shared with the LLM: %s", collectedData.WithheldReason)
+	}
+	if collectedData != nil && collectedData.SuppressedGroups > 0 {
+		pkgerrors.To(out).UserInfo("%d group(s) with fewer than %d rows were not shared with the LLM", collectedData.SuppressedGroups, collectedData.MinGroupSize)
+	}
+	fmt.Fprintln(out)
 
 	// Format result for LLM based on mode using collected data
-	return formatQueryResult(mode, rowCount, executionTime, collectedData), nil
+	return formatQueryResult(shareMode, rowCount, executionTime, collectedData), nil
 }
 
 // QueryResultData represents the actual data from a query for LLM sharing
 type QueryResultData struct {
-	ColumnNames []string
-	Rows        [][]interface{}
-	TotalRows   int
-	Truncated   bool
+	ColumnNames   []string
+	ColumnTypes   []string // Postgres type names, empty when unknown
+	SourceColumns []string // table column each result column reads, empty for computed columns
+	Rows          [][]interface{}
+	TotalRows     int
+	Truncated     bool
+	MaskedColumns []string // Columns masked before sharing, with how they were masked
+
+	// Aggregate-only mode
+	MinGroupSize     int    // groups smaller than this were suppressed
+	SuppressedGroups int    // number of groups suppressed
+	WithheldReason   string // why no rows were shared, empty when they were
 }
 
 // formatQueryResult formats the query execution result based on the mode
@@ -614,33 +1210,24 @@ func formatQueryResult(mode string, rowCount int, executionTime time.Duration, d
 	case "share-results":
 		var result strings.Builder
 		result.WriteString(fmt.Sprintf("Query executed successfully, %d rows returned in %v\n\n", rowCount, executionTime))
+		writeResultTable(&result, data)
+		result.WriteString(nextStep)
+		return result.String()
 
-		result.WriteString("Query Results:\n")
-		result.WriteString(strings.Repeat("=", 50) + "\n")
-
-		// Add column headers
-		result.WriteString("| ")
-		for _, name := range data.ColumnNames {
-			result.WriteString(fmt.Sprintf("%-15s | ", truncateString(name, 15)))
-		}
-		result.WriteString("\n")
-		result.WriteString(strings.Repeat("-", len(data.ColumnNames)*18) + "\n")
-
-		// Add data rows
-		for _, row := range data.Rows {
-			result.WriteString("| ")
-			for _, value := range row {
-				result.WriteString(fmt.Sprintf("%-15s | ", truncateString(formatValue(value), 15)))
-			}
-			result.WriteString("\n")
+	case "aggregate-only":
+		var result strings.Builder
+		result.WriteString(fmt.Sprintf("Query executed successfully, %d rows returned in %v. Results were displayed to the user.\n\n", rowCount, executionTime))
+		if data.WithheldReason != "" {
+			result.WriteString(fmt.Sprintf("Results were not shared with you because %s. ", data.WithheldReason))
+			result.WriteString("In aggregate-only mode only aggregated results are shared: GROUP BY queries (or aggregates over the whole table) that include a count(*) column, so that small groups can be suppressed.\n")
+			result.WriteString(nextStep)
+			return result.String()
 		}
-
-		if data.Truncated {
-			result.WriteString("... (showing first 50 rows for analysis)\n")
+		writeResultTable(&result, data)
+		if data.SuppressedGroups > 0 {
+			result.WriteString(fmt.Sprintf("%d group(s) with a count below %d were suppressed for privacy and are not shown.\n", data.SuppressedGroups, data.MinGroupSize))
 		}
-
 		result.WriteString(nextStep)
-
 		return result.String()
 
 	case "schema-only":
@@ -651,6 +1238,38 @@ func formatQueryResult(mode string, rowCount int, executionTime time.Duration, d
 	}
 }
 
+// writeResultTable writes result rows shared with the LLM as a text table
+func writeResultTable(result *strings.Builder, data *QueryResultData) {
+	result.WriteString("Query Results:\n")
+	result.WriteString(strings.Repeat("=", 50) + "\n")
+
+	// Add column headers
+	result.WriteString("| ")
+	for _, name := range data.ColumnNames {
+		result.WriteString(fmt.Sprintf("%-15s | ", truncateString(name, 15)))
+	}
+	result.WriteString("\n")
+	result.WriteString(strings.Repeat("-", len(data.ColumnNames)*18) + "\n")
+
+	// Add data rows
+	for _, row := range data.Rows {
+		result.WriteString("| ")
+		for _, value := range row {
+			cell := truncateString(formatValue(value), 15)
+			result.WriteString(dataValue(cell) + strings.Repeat(" ", max(0, 15-utf8.RuneCountInString(cell))) + " | ")
+		}
+		result.WriteString("\n")
+	}
+
+	if data.Truncated {
+		result.WriteString("... (showing first 50 rows for analysis)\n")
+	}
+
+	if len(data.MaskedColumns) > 0 {
+		result.WriteString(fmt.Sprintf("Masked for privacy (the user sees the real values): %s\n", strings.Join(data.MaskedColumns, ", ")))
+	}
+}
+
 // validateSafeQuery ensures the query is safe to execute (SELECT/WITH only)
 func validateSafeQuery(sqlQuery string) error {
 	// Clean and normalize the query
@@ -701,6 +1320,36 @@ func validateSafeQuery(sqlQuery string) error {
 	return fmt.Errorf("only SELECT and WITH queries are allowed for security reasons")
 }
 
+// blockedQueryResult tells the user and the LLM why a query was rejected before approval
+func blockedQueryResult(out io.Writer, err error) *ToolResult {
+	var violation *db.PolicyViolationError
+	if errors.As(err, &violation) {
+		pkgerrors.To(out).UserError("Query blocked by data policy:")
+		for _, reason := range violation.Reasons {
+			fmt.Fprintf(out, "   - %s\n", reason)
+		}
+		return &ToolResult{
+			Content: fmt.Sprintf("Query blocked before approval: %v. These tables and columns are protected by the data policy and cannot be queried in any mode. Do not try to work around the policy; tell the user which data is protected and offer a query without it.", err),
+			IsError: true,
+		}
+	}
+
+	pkgerrors.To(out).UserError("Query blocked: %v", err)
+	return &ToolResult{
+		Content: fmt.Sprintf("Query blocked before approval: %v. Only use tables returned by list_tables.", err),
+		IsError: true,
+	}
+}
+
+// validateQueryObjects checks the tables a query references when the connection restricts them
+func validateQueryObjects(ctx context.Context, conn db.Connection, sqlQuery string) error {
+	validator, ok := conn.(db.QueryValidator)
+	if !ok {
+		return nil
+	}
+	return validator.ValidateQuery(ctx, sqlQuery)
+}
+
 // validateQueryContent checks for dangerous functions or patterns within allowed queries
 func validateQueryContent(query string) error {
 	// List of dangerous functions/patterns to block
@@ -738,6 +1387,26 @@ func validateQueryContent(query string) error {
 	return nil
 }
 
+// Tool output between dataStart and dataEnd is a data value rather than schema text. Values are
+// shared as they are, since a value that happens to match a table or column name is not an
+// identifier; the agent pseudonymizes the text around them and removes the markers.
+const (
+	dataStart = "\uE000"
+	dataEnd   = "\uE001"
+)
+
+var dataMarkers = strings.NewReplacer(dataStart, "", dataEnd, "")
+
+// dataValue marks a value in tool output as data
+func dataValue(value string) string {
+	return dataStart + dataMarkers.Replace(value) + dataEnd
+}
+
+// stripDataMarkers removes the data markers from tool output
+func stripDataMarkers(text string) string {
+	return dataMarkers.Replace(text)
+}
+
 // Helper functions
 func truncateString(s string, maxLen int) string {
 	if len(s) <= maxLen {
@@ -753,77 +1422,11 @@ func formatValue(value interface{}) string {
 	return fmt.Sprintf("%v", value)
 }
 
-// formatDatabaseError provides LLM-friendly error messages with tool instructions
-func formatDatabaseError(err error) string {
-	errStr := err.Error()
-
-	// Handle common PostgreSQL error patterns
-	if strings.Contains(errStr, "relation") && strings.Contains(errStr, "does not exist") {
-		return fmt.Sprintf("Table or view not found: %v. Use the list_tables tool to see available tables.", err)
-	}
-
-	if strings.Contains(errStr, "column") && strings.Contains(errStr, "does not exist") {
-		return fmt.Sprintf("Column not found: %v. Use the describe_table tool to see available columns.", err)
-	}
-
-	if strings.Contains(errStr, "syntax error") {
-		return fmt.Sprintf("SQL syntax error: %v. Please check your query syntax.", err)
-	}
-
-	if strings.Contains(errStr, "permission denied") {
-		return fmt.Sprintf("Permission denied: %v. You may not have access to this table or operation.", err)
-	}
-
-	if strings.Contains(errStr, "connection") && (strings.Contains(errStr, "refused") || strings.Contains(errStr, "closed")) {
-		return fmt.Sprintf("Database connection issue: %v. The connection may have been lost. Attempting to reconnect...", err)
-	}
-
-	if strings.Contains(errStr, "dial") || strings.Contains(errStr, "network") || strings.Contains(errStr, "timeout") {
-		return fmt.Sprintf("Network connectivity issue: %v. The database server may be unreachable.", err)
-	}
-
-	// Return original error if no specific pattern matches
-	return fmt.Sprintf("Database error: %v", err)
-}
-
-// formatUserError provides user-friendly error messages without LLM tool instructions
-func formatUserError(err error) string {
-	errStr := err.Error()
-
-	// Handle common PostgreSQL error patterns
-	if strings.Contains(errStr, "relation") && strings.Contains(errStr, "does not exist") {
-		return fmt.Sprintf("Table or view not found\n%v", err)
-	}
-
-	if strings.Contains(errStr, "column") && strings.Contains(errStr, "does not exist") {
-		return fmt.Sprintf("Column not found\n%v", err)
-	}
-
-	if strings.Contains(errStr, "syntax error") {
-		return fmt.Sprintf("SQL syntax error\n%v", err)
-	}
-
-	if strings.Contains(errStr, "permission denied") {
-		return fmt.Sprintf("Permission denied\n%v", err)
-	}
-
-	if strings.Contains(errStr, "connection") && (strings.Contains(errStr, "refused") || strings.Contains(errStr, "closed")) {
-		return fmt.Sprintf("Database connection issue\n%v", err)
-	}
-
-	if strings.Contains(errStr, "dial") || strings.Contains(errStr, "network") || strings.Contains(errStr, "timeout") {
-		return fmt.Sprintf("Network connectivity issue\n%v", err)
-	}
-
-	// Return original error if no specific pattern matches
-	return fmt.Sprintf("Database error\n%v", err)
-}
-
 // createExplainQueryTool creates a tool for analyzing query execution plans
-func createExplainQueryTool(conn db.Connection, getUserApproval func(string) bool, mode string) *Tool {
+func createExplainQueryTool(conn db.Connection, getUserApproval func(string) bool, mode string, opts ExecutionOptions) *Tool {
 	return &Tool{
 		Name:        "explain_query",
-		Description: "Analyze a SQL query's execution plan using EXPLAIN (without actually executing the query). This helps understand query performance and optimization opportunities. IMPORTANT: If the user declines analysis, ask what they want changed or if they prefer a different approach.",
+		Description: "Analyze a SQL query's execution plan using EXPLAIN (without actually executing the query). This helps understand query performance and optimization opportunities. Set analyze to true only when actual timings and row counts are needed. IMPORTANT: If the user declines analysis, ask what they want changed or if they prefer a different approach.",
 		InputSchema: ToolSchema{
 			Type: "object",
 			Properties: map[string]interface{}{
@@ -835,6 +1438,10 @@ func createExplainQueryTool(conn db.Connection, getUserApproval func(string) boo
 					"type":        "string",
 					"description": "Brief explanation of why you want to analyze this query",
 				},
+				"analyze": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Also run EXPLAIN ANALYZE, which executes the query (in a read-only transaction that is rolled back) to measure actual timings and row counts. Needs a separate user approval and is refused for queries with a high estimated cost.",
+				},
 			},
 			Required: []string{"sql", "explanation"},
 		},
@@ -852,8 +1459,20 @@ func createExplainQueryTool(conn db.Connection, getUserApproval func(string) boo
 				explanation = "Query analysis"
 			}
 
+			// Reject references to hidden objects before bothering the user
+			if err := validateQueryObjects(ctx, conn, sqlQuery); err != nil {
+				return blockedQueryResult(opts.out(), err), nil
+			}
+
+			analyze, _ := input["analyze"].(bool)
+
 			// Present query to user for approval
-			approved := getUserApproval(fmt.Sprintf("%s\n\nQuery to analyze:\n%s\n\nNote: This will run EXPLAIN (not ANALYZE) - no data will be modified", explanation, sqlQuery))
+			note := "Note: This will run EXPLAIN (not ANALYZE) - no data will be modified"
+			if analyze {
+				note += "\nEXPLAIN ANALYZE was also requested; you will be asked separately before the query is executed"
+			}
+			approved := getUserApproval(fmt.Sprintf("%s\n\nQuery to analyze:\n%s\n\n%s", explanation, sqlQuery, note))
+			recordDecision(opts, mode, "explain_query", sqlQuery, approved)
 
 			if !approved {
 				return &ToolResult{
@@ -871,14 +1490,20 @@ func createExplainQueryTool(conn db.Connection, getUserApproval func(string) boo
 			}
 
 			// Always execute EXPLAIN to show results to user
-			explainSQL := "EXPLAIN " + sqlQuery
-			result, err := executeExplainQuery(ctx, conn, explainSQL, sqlQuery)
+			explainSQL := "EXPLAIN (FORMAT JSON) " + sqlQuery
+			result, plan, err := executeExplainQuery(ctx, conn, opts.out(), explainSQL, sqlQuery, false)
 			if err != nil {
+				opts.Audit.Record(audit.Event{Type: audit.EventSQLExecuted, Mode: mode, Tool: "explain_query", SQL: explainSQL, Error: err.Error()})
 				return &ToolResult{
 					Content: fmt.Sprintf("EXPLAIN query failed: %s", err.Error()),
 					IsError: true,
 				}, nil
 			}
+			opts.Audit.Record(audit.Event{Type: audit.EventSQLExecuted, Mode: mode, Tool: "explain_query", SQL: explainSQL})
+
+			if analyze && plan != nil {
+				result = runExplainAnalyze(ctx, conn, getUserApproval, mode, opts, sqlQuery, plan, result)
+			}
 
 			// Conditionally share with LLM based on mode
 			if mode == "schema-only" {
@@ -897,8 +1522,48 @@ func createExplainQueryTool(conn db.Connection, getUserApproval func(string) boo
 	}
 }
 
-// executeExplainQuery executes EXPLAIN query and returns formatted results for LLM
-func executeExplainQuery(ctx context.Context, conn db.Connection, explainSQL, originalSQL string) (string, error) {
+// runExplainAnalyze runs EXPLAIN ANALYZE after checking the estimated plan's cost against
+// the limit and getting a separate approval. It returns the content for the LLM: the
+// analyzed plan, or the estimated plan result with the reason EXPLAIN ANALYZE did not run.
+func runExplainAnalyze(ctx context.Context, conn db.Connection, getUserApproval func(string) bool, mode string, opts ExecutionOptions, sqlQuery string, estimated *explain.Plan, estimatedResult string) string {
+	maxCost := opts.MaxAnalyzeCost
+	if maxCost <= 0 {
+		maxCost = DefaultMaxAnalyzeCost
+	}
+	cost := estimated.Root.TotalCost
+	if cost > maxCost {
+		pkgerrors.To(opts.out()).UserWarning("EXPLAIN ANALYZE not run: estimated cost %.0f exceeds the limit of %.0f", cost, maxCost)
+		return estimatedResult + fmt.Sprintf("\nEXPLAIN ANALYZE was refused: the estimated total cost (%.0f) exceeds the configured limit (%.0f). Work from the estimated plan above.", cost, maxCost)
+	}
+
+	analyzeSQL := "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) " + sqlQuery
+	approved := getUserApproval(fmt.Sprintf("⚠️  EXPLAIN ANALYZE EXECUTES the query to measure actual timings and row counts.\n\nQuery:\n%s\n\n"+
+		"Estimated total cost: %.0f (limit %.0f)\n"+
+		"It runs in a read-only transaction that is rolled back, and is cancelled after %v. Query results are not shown, only the plan.",
+		sqlQuery, cost, maxCost, QueryTimeout))
+	recordDecision(opts, mode, "explain_query", analyzeSQL, approved)
+	if !approved {
+		return estimatedResult + "\nThe user declined to run EXPLAIN ANALYZE; only the estimated plan above is available."
+	}
+
+	result, _, err := executeExplainQuery(ctx, conn, opts.out(), analyzeSQL, sqlQuery, true)
+	if err != nil {
+		opts.Audit.Record(audit.Event{Type: audit.EventSQLExecuted, Mode: mode, Tool: "explain_query", SQL: analyzeSQL, Error: err.Error()})
+		return estimatedResult + fmt.Sprintf("\nEXPLAIN ANALYZE failed: %s", err.Error())
+	}
+	opts.Audit.Record(audit.Event{Type: audit.EventSQLExecuted, Mode: mode, Tool: "explain_query", SQL: analyzeSQL})
+	return result
+}
+
+// executeExplainQuery executes EXPLAIN query, shows the plan tree to the user and returns
+// a summary for the LLM along with the parsed plan. With analyze, the EXPLAIN ANALYZE
+// statement runs in a read-only transaction that is rolled back.
+func executeExplainQuery(ctx context.Context, conn db.Connection, out io.Writer, explainSQL, originalSQL string, analyze bool) (string, *explain.Plan, error) {
+	// Callers validate too, but with analyze the statement really runs
+	if err := validateSafeQuery(originalSQL); err != nil {
+		return "", nil, err
+	}
+
 	// Add timeout for EXPLAIN queries while preserving cancellation from parent context
 	queryCtx, cancel := context.WithTimeout(ctx, QueryTimeout)
 	defer cancel()
@@ -909,83 +1574,332 @@ func executeExplainQuery(ctx context.Context, conn db.Connection, explainSQL, or
 	// Ensure we have a healthy connection (use parent context, not query context)
 	conn.EnsureConnection(ctx)
 
-	rows, err := conn.Query(queryCtx, explainSQL)
+	planJSON, err := queryPlan(queryCtx, conn, explainSQL, analyze)
 	if err != nil {
 		// Check for context cancellation and provide appropriate message
 		if errors.Is(err, context.Canceled) || queryCtx.Err() == context.Canceled {
-			fmt.Println("⏹️  EXPLAIN query cancelled by user")
+			fmt.Fprintln(out, "⏹️  EXPLAIN query cancelled by user")
 
 			// With connection pools, cancelled connections are automatically handled
 			// No need for manual reconnection
 
-			return "EXPLAIN query was cancelled by the user. The database connection remains active and ready for new queries.", nil
+			return "EXPLAIN query was cancelled by the user. The database connection remains active and ready for new queries.", nil, nil
 		}
 		if queryCtx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("EXPLAIN query timed out after %v", QueryTimeout)
+			pkgerrors.To(out).UserError("EXPLAIN timed out after %v", QueryTimeout)
+			return "", nil, fmt.Errorf("EXPLAIN query timed out after %v", QueryTimeout)
 		}
-		return "", fmt.Errorf("%s", formatDatabaseError(err))
+		pkgerrors.To(out).UserError("EXPLAIN failed: %s", formatUserError(err, explainSQL))
+		return "", nil, newDatabaseError(err, explainSQL)
 	}
-	defer rows.Close()
 
+	plan, err := explain.Parse(planJSON)
+	if err != nil {
+		return "", nil, err
+	}
+	recordPlanIdentifiers(conn, plan)
+	highlights := explain.Analyze(plan, tableRowEstimates(ctx, conn, plan))
+
+	// Calculate execution time
+	executionTime := time.Since(startTime)
+
+	// Display to user
+	if analyze {
+		fmt.Fprintln(out, "\n📊 Query Execution Plan (EXPLAIN ANALYZE, estimated vs actual rows):")
+	} else {
+		fmt.Fprintln(out, "\n📊 Query Execution Plan:")
+	}
+	fmt.Fprintln(out, strings.Repeat("=", 50))
+	fmt.Fprint(out, explain.Render(plan, highlights))
+	fmt.Fprintf(out, "\n✅ EXPLAIN completed in %v\n\n", executionTime)
+
+	// Give the LLM a compact summary of the plan tree rather than the raw output
 	var result strings.Builder
 	result.WriteString("Query Execution Plan Analysis:\n")
 	result.WriteString("============================\n\n")
 	result.WriteString(fmt.Sprintf("Original Query:\n%s\n\n", originalSQL))
-	result.WriteString("Execution Plan:\n")
-	result.WriteString("---------------\n")
+	if analyze {
+		result.WriteString("Execution Plan from EXPLAIN ANALYZE (estimated and actual rows per node; actual rows and time are per loop):\n")
+	} else {
+		result.WriteString("Execution Plan (one line per node, children indented under their parent):\n")
+	}
+	result.WriteString(explain.Summary(plan, highlights))
 
-	// Read all plan rows
-	planLines := []string{}
-	for rows.Next() {
-		values, err := rows.Values()
-		if err != nil {
-			return "", fmt.Errorf("%s", formatDatabaseError(err))
-		}
+	return result.String(), plan, nil
+}
 
-		// EXPLAIN returns a single column with the plan text
-		if len(values) > 0 {
-			planLine := formatValue(values[0])
-			planLines = append(planLines, planLine)
+// queryPlan runs an EXPLAIN (FORMAT JSON) statement and returns the plan, which comes back
+// as a single json value. With analyze it runs in a read-only transaction that is rolled back.
+func queryPlan(ctx context.Context, conn db.Connection, explainSQL string, analyze bool, args ...interface{}) ([]byte, error) {
+	var planJSON []byte
+	scan := func(rows pgx.Rows) error {
+		for rows.Next() {
+			if err := rows.Scan(&planJSON); err != nil {
+				return err
+			}
 		}
+		return rows.Err()
 	}
 
-	if err := rows.Err(); err != nil {
-		return "", fmt.Errorf("%s", formatDatabaseError(err))
+	if analyze {
+		err := conn.QueryReadOnly(ctx, explainSQL, scan)
+		return planJSON, err
 	}
-
-	// Format the plan for LLM consumption
-	for _, line := range planLines {
-		result.WriteString(line + "\n")
+	rows, err := conn.Query(ctx, explainSQL, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
+	err = scan(rows)
+	return planJSON, err
+}
 
-	result.WriteString("\nThis execution plan shows:\n")
-	result.WriteString("- The operations PostgreSQL will perform\n")
-	result.WriteString("- The order of operations (read from innermost to outermost)\n")
-	result.WriteString("- Cost estimates for each operation\n")
-	result.WriteString("- Join methods and access patterns\n")
-	result.WriteString("\nUse this information to suggest optimizations like:\n")
-	result.WriteString("- Adding indexes on frequently filtered columns\n")
-	result.WriteString("- Rewriting queries for better performance\n")
-	result.WriteString("- Identifying expensive operations\n")
+// recordPlanIdentifiers passes the object names in a plan to a connection that pseudonymizes
+// them, so that names not seen before, such as index names, are not sent to the LLM
+func recordPlanIdentifiers(conn db.Connection, plan *explain.Plan) {
+	recorder, ok := conn.(db.IdentifierRecorder)
+	if !ok {
+		return
+	}
+	plan.Walk(func(node *explain.Node, depth int) {
+		recorder.RecordIdentifiers(db.IdentifierSchema, node.Schema)
+		recorder.RecordIdentifiers(db.IdentifierTable, node.RelationName)
+		recorder.RecordIdentifiers(db.IdentifierIndex, node.IndexName)
+	})
+}
 
-	// Calculate execution time
-	executionTime := time.Since(startTime)
+// tableRowEstimates returns a lookup of estimated table sizes for the tables the plan
+// scans sequentially, or nil if there are none or the sizes are unavailable
+func tableRowEstimates(ctx context.Context, conn db.Connection, plan *explain.Plan) func(string) (int64, bool) {
+	seqScans := false
+	plan.Walk(func(node *explain.Node, depth int) {
+		seqScans = seqScans || node.NodeType == "Seq Scan"
+	})
+	if !seqScans {
+		return nil
+	}
 
-	// Display to user
-	fmt.Println("\n📊 Query Execution Plan:")
-	fmt.Println(strings.Repeat("=", 50))
-	for _, line := range planLines {
-		fmt.Println(line)
+	tables, err := conn.ListTables(ctx)
+	if err != nil {
+		return nil
+	}
+	rows := make(map[string]int64, 2*len(tables))
+	for _, table := range tables {
+		rows[table.Schema+"."+table.Name] = table.EstimatedRows
+		// Plans name tables without their schema; use the largest table of that name
+		rows[table.Name] = max(rows[table.Name], table.EstimatedRows)
+	}
+	return func(relation string) (int64, bool) {
+		n, ok := rows[relation]
+		return n, ok
 	}
-	fmt.Printf("\n✅ EXPLAIN completed (%d plan lines in %v)\n\n", len(planLines), executionTime)
+}
+
+// createSuggestIndexesTool creates a tool that proposes indexes for a query. The CREATE INDEX
+// statements are shown to the user and never executed.
+func createSuggestIndexesTool(conn db.Connection, getUserApproval func(string) bool, mode string, opts ExecutionOptions) *Tool {
+	return &Tool{
+		Name:        "suggest_indexes",
+		Description: "Propose CREATE INDEX statements for a slow query by analyzing its plan (EXPLAIN, without executing it) and the existing indexes of the tables it scans. When the hypopg extension is installed, each index is validated with a hypothetical plan to estimate the benefit. The statements are shown to the user and are never executed.",
+		InputSchema: ToolSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"sql": map[string]interface{}{
+					"type":        "string",
+					"description": "The SELECT query to find indexes for",
+				},
+				"explanation": map[string]interface{}{
+					"type":        "string",
+					"description": "Brief explanation of why you want index suggestions for this query",
+				},
+			},
+			Required: []string{"sql", "explanation"},
+		},
+		Handler: func(ctx context.Context, input map[string]interface{}) (*ToolResult, error) {
+			sqlQuery, ok := input["sql"].(string)
+			if !ok {
+				return &ToolResult{
+					Content: "Error: sql parameter must be a string",
+					IsError: true,
+				}, fmt.Errorf("invalid sql parameter")
+			}
+
+			explanation, ok := input["explanation"].(string)
+			if !ok {
+				explanation = "Index suggestions"
+			}
+
+			// Reject references to hidden objects before bothering the user
+			if err := validateQueryObjects(ctx, conn, sqlQuery); err != nil {
+				return blockedQueryResult(opts.out(), err), nil
+			}
+
+			approved := getUserApproval(fmt.Sprintf("%s\n\nQuery to find indexes for:\n%s\n\n"+
+				"Note: This runs EXPLAIN (not ANALYZE) and reads the tables' index definitions. Suggested indexes are only shown, never created.", explanation, sqlQuery))
+			recordDecision(opts, mode, "suggest_indexes", sqlQuery, approved)
+			if !approved {
+				return &ToolResult{
+					Content: "User declined index analysis. Ask the user what they would like to do instead.",
+					IsError: false,
+				}, nil
+			}
 
-	return result.String(), nil
+			advice, err := AdviseIndexes(ctx, conn, sqlQuery)
+			if err != nil {
+				opts.Audit.Record(audit.Event{Type: audit.EventSQLExecuted, Mode: mode, Tool: "suggest_indexes", SQL: sqlQuery, Error: err.Error()})
+				pkgerrors.To(opts.out()).UserError("Index analysis failed: %s", formatUserError(err, sqlQuery))
+				return &ToolResult{
+					Content: fmt.Sprintf("Index analysis failed: %s", err.Error()),
+					IsError: true,
+				}, nil
+			}
+			opts.Audit.Record(audit.Event{Type: audit.EventSQLExecuted, Mode: mode, Tool: "suggest_indexes", SQL: "EXPLAIN (FORMAT JSON) " + sqlQuery})
+
+			fmt.Fprintln(opts.out(), "\n🔎 Index Suggestions:")
+			fmt.Fprintln(opts.out(), strings.Repeat("=", 50))
+			fmt.Fprint(opts.out(), advice.Report())
+			fmt.Fprintln(opts.out())
+
+			if mode == "schema-only" {
+				return &ToolResult{
+					Content: fmt.Sprintf("Index suggestions were displayed to the user (%d suggested). Plan details are not shared in schema-only mode for privacy.", len(advice.Suggestions)),
+					IsError: false,
+				}, nil
+			}
+			return &ToolResult{
+				Content: advice.Summary(),
+				IsError: false,
+			}, nil
+		},
+	}
 }
 
-// min returns the smaller of two integers
-func min(a, b int) int {
-	if a < b {
-		return a
+// Sample value limits for the sample_column_values tool
+const (
+	defaultSampleValues = 10
+	maxSampleValues     = 50
+	maxSampleValueLen   = 100
+)
+
+// createSampleColumnValuesTool creates a tool that shares a few distinct column values with explicit user consent
+func createSampleColumnValuesTool(conn db.Connection, mode string, opts ExecutionOptions) *Tool {
+	return &Tool{
+		Name:        "sample_column_values",
+		Description: "Fetch a few distinct values of a column (e.g. to learn the exact spelling of status codes). The values are shown to the user, who decides whether they may be shared with you. IMPORTANT: If the user declines, do not ask for the same values again.",
+		InputSchema: ToolSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"table_name": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the table. Can include schema (e.g., 'public.orders' or just 'orders')",
+				},
+				"column_name": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the column to sample",
+				},
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Maximum number of distinct values to fetch (default %d, max %d)", defaultSampleValues, maxSampleValues),
+				},
+				"explanation": map[string]interface{}{
+					"type":        "string",
+					"description": "Brief explanation of why you need to see these values",
+				},
+			},
+			Required: []string{"table_name", "column_name", "explanation"},
+		},
+		Handler: func(ctx context.Context, input map[string]interface{}) (*ToolResult, error) {
+			tableName, ok := input["table_name"].(string)
+			if !ok {
+				return &ToolResult{
+					Content: "Error: table_name must be a string",
+					IsError: true,
+				}, fmt.Errorf("invalid table_name parameter")
+			}
+
+			columnName, ok := input["column_name"].(string)
+			if !ok {
+				return &ToolResult{
+					Content: "Error: column_name must be a string",
+					IsError: true,
+				}, fmt.Errorf("invalid column_name parameter")
+			}
+
+			explanation, ok := input["explanation"].(string)
+			if !ok {
+				explanation = "Sample column values"
+			}
+
+			// Schema-only mode: no data values are ever shared
+			if mode == "schema-only" {
+				return &ToolResult{
+					Content: "Sample values are not shared in schema-only mode for privacy. Ask the user to describe the values instead.",
+				}, nil
+			}
+
+			limit := defaultSampleValues
+			if l, ok := input["limit"].(float64); ok && l > 0 {
+				limit = min(int(l), maxSampleValues)
+			}
+
+			// Resolve schema.table against the search_path
+			schema, tableName, err := conn.ResolveTableName(ctx, tableName)
+			if err != nil {
+				return &ToolResult{
+					Content: fmt.Sprintf("Error: %v", err),
+					IsError: true,
+				}, err
+			}
+			qualifiedName := fmt.Sprintf("%s.%s.%s", schema, tableName, columnName)
+
+			queryCtx, cancel := context.WithTimeout(ctx, QueryTimeout)
+			defer cancel()
+
+			values, err := conn.SampleColumnValues(queryCtx, schema, tableName, columnName, limit)
+			if err != nil {
+				pkgerrors.To(opts.out()).UserError("Sampling values failed: %s", formatUserError(err, ""))
+				return &ToolResult{
+					Content: fmt.Sprintf("Sampling values failed: %s", formatDatabaseError(err, "")),
+					IsError: true,
+				}, nil
+			}
+
+			if len(values) == 0 {
+				return &ToolResult{
+					Content: fmt.Sprintf("No non-null values found in %s.", qualifiedName),
+				}, nil
+			}
+
+			var preview strings.Builder
+			preview.WriteString(fmt.Sprintf("%s\n\nSample of %d distinct values from %s:\n", explanation, len(values), qualifiedName))
+			for _, value := range values {
+				preview.WriteString(fmt.Sprintf("  - %s\n", truncateString(value, maxSampleValueLen)))
+			}
+			preview.WriteString("\nThese values have NOT been shared yet. Approve to send exactly these values to the AI assistant.")
+
+			approved := opts.ConfirmShare != nil && opts.ConfirmShare(preview.String())
+			decision := audit.DecisionRejected
+			if approved {
+				decision = audit.DecisionApproved
+			}
+			opts.Audit.Record(audit.Event{Type: audit.EventShareDecision, Mode: mode, Tool: "sample_column_values", Column: qualifiedName, Decision: decision})
+
+			if !approved {
+				return &ToolResult{
+					Content: fmt.Sprintf("User declined to share sample values of %s. Do NOT request these values again; continue with the schema information you have or ask the user to describe the values.", qualifiedName),
+					IsError: false,
+				}, nil
+			}
+
+			var result strings.Builder
+			result.WriteString(fmt.Sprintf("Distinct values of %s (sample of up to %d, shared with user approval):\n", qualifiedName, limit))
+			for _, value := range values {
+				result.WriteString(fmt.Sprintf("- %s\n", dataValue(strconv.Quote(truncateString(value, maxSampleValueLen)))))
+			}
+
+			return &ToolResult{
+				Content: result.String(),
+			}, nil
+		},
 	}
-	return b
 }
@@ -1,15 +1,22 @@
 package agent
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/AliciaSchep/pgbabble/internal/testutil"
+	"github.com/AliciaSchep/pgbabble/pkg/audit"
+	"github.com/AliciaSchep/pgbabble/pkg/config"
 	"github.com/AliciaSchep/pgbabble/pkg/db"
+	"github.com/AliciaSchep/pgbabble/pkg/history"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 func TestMarshalToolsToJSON(t *testing.T) {
@@ -191,7 +198,70 @@ type MockConnection struct {
 	tables      []db.TableInfo
 	foreignKeys []db.ForeignKeyInfo
 	columns     []db.ColumnInfo
+	views       []db.ViewInfo
+	functions   []db.FunctionInfo
+	columnStats map[string][]db.ColumnStats
+	samples     map[string][]string
 	queryError  error
+	// queryRows returns the rows for a query; no rows are returned when unset
+	queryRows       func(sql string) [][]interface{}
+	readOnlyQueries []string
+	indexes         map[string][]db.IndexInfo
+	// hypotheticalPlan returns the plan with hypothetical indexes; hypopg is unavailable when unset
+	hypotheticalPlan func(sql string, createIndexStatements []string) string
+}
+
+// mockRows is a minimal pgx.Rows over in-memory values
+type mockRows struct {
+	values [][]interface{}
+	pos    int
+}
+
+func (r *mockRows) Close()                                       {}
+func (r *mockRows) Err() error                                   { return nil }
+func (r *mockRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *mockRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *mockRows) RawValues() [][]byte                          { return nil }
+func (r *mockRows) Conn() *pgx.Conn                              { return nil }
+
+func (r *mockRows) Next() bool {
+	r.pos++
+	return r.pos <= len(r.values)
+}
+
+func (r *mockRows) Values() ([]interface{}, error) {
+	return r.values[r.pos-1], nil
+}
+
+func (r *mockRows) Scan(dest ...interface{}) error {
+	for i, d := range dest {
+		switch d := d.(type) {
+		case *[]byte:
+			*d = []byte(fmt.Sprint(r.values[r.pos-1][i]))
+		case *string:
+			*d = fmt.Sprint(r.values[r.pos-1][i])
+		default:
+			return fmt.Errorf("mockRows cannot scan into %T", d)
+		}
+	}
+	return nil
+}
+
+// ResolveTableName resolves unqualified names to the first mock table with that name, else public
+func (m *MockConnection) ResolveTableName(ctx context.Context, name string) (string, string, error) {
+	qn, err := db.ParseQualifiedName(name)
+	if err != nil {
+		return "", "", err
+	}
+	if qn.Schema != "" {
+		return qn.Schema, qn.Name, nil
+	}
+	for _, table := range m.tables {
+		if table.Name == qn.Name {
+			return table.Schema, table.Name, nil
+		}
+	}
+	return "public", qn.Name, nil
 }
 
 func (m *MockConnection) ListTables(ctx context.Context) ([]db.TableInfo, error) {
@@ -227,12 +297,76 @@ func (m *MockConnection) SearchColumns(ctx context.Context, pattern string) ([]d
 	return result, nil
 }
 
+func (m *MockConnection) GetViewDefinition(ctx context.Context, schema, viewName string) (*db.ViewInfo, error) {
+	for _, view := range m.views {
+		if view.Schema == schema && view.Name == viewName {
+			return &view, nil
+		}
+	}
+	return nil, fmt.Errorf("view %s.%s not found", schema, viewName)
+}
+
+func (m *MockConnection) ListFunctions(ctx context.Context, pattern string) ([]db.FunctionInfo, error) {
+	var result []db.FunctionInfo
+	for _, fn := range m.functions {
+		if strings.Contains(strings.ToLower(fn.Name), strings.ToLower(pattern)) {
+			result = append(result, fn)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockConnection) GetColumnStats(ctx context.Context, schema, tableName string) ([]db.ColumnStats, error) {
+	return m.columnStats[schema+"."+tableName], nil
+}
+
+func (m *MockConnection) ViewDependencies(ctx context.Context, schema, viewName string) ([]db.ViewDependency, error) {
+	return nil, nil
+}
+
+func (m *MockConnection) SampleColumnValues(ctx context.Context, schema, tableName, columnName string, limit int) ([]string, error) {
+	if m.queryError != nil {
+		return nil, m.queryError
+	}
+	values := m.samples[schema+"."+tableName+"."+columnName]
+	return values[:min(len(values), limit)], nil
+}
+
+func (m *MockConnection) SourceColumns(ctx context.Context, fields []pgconn.FieldDescription) ([]string, error) {
+	return make([]string, len(fields)), nil
+}
+
 func (m *MockConnection) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
 	if m.queryError != nil {
 		return nil, m.queryError
 	}
-	// Return nil as we're not testing actual query execution here
-	return nil, nil
+	if m.queryRows != nil {
+		return &mockRows{values: m.queryRows(sql)}, nil
+	}
+	// Return no rows as we're not testing actual query execution here
+	return &mockRows{}, nil
+}
+
+func (m *MockConnection) ListIndexes(ctx context.Context, schema, tableName string) ([]db.IndexInfo, error) {
+	return m.indexes[schema+"."+tableName], nil
+}
+
+func (m *MockConnection) HypotheticalPlan(ctx context.Context, sql string, createIndexStatements []string) ([]byte, error) {
+	if m.hypotheticalPlan == nil {
+		return nil, db.ErrHypoPGUnavailable
+	}
+	return []byte(m.hypotheticalPlan(sql, createIndexStatements)), nil
+}
+
+func (m *MockConnection) QueryReadOnly(ctx context.Context, sql string, scan func(pgx.Rows) error) error {
+	if m.queryError != nil {
+		return m.queryError
+	}
+	m.readOnlyQueries = append(m.readOnlyQueries, sql)
+	if m.queryRows == nil {
+		return fmt.Errorf("QueryReadOnly not implemented in mock")
+	}
+	return scan(&mockRows{values: m.queryRows(sql)})
 }
 
 func (m *MockConnection) EnsureConnection(ctx context.Context) {
@@ -263,13 +397,13 @@ func TestCreateSchemaTools(t *testing.T) {
 		},
 	}
 
-	tools := CreateSchemaTools(mockDB, "default")
+	tools := CreateSchemaTools(mockDB, "default", nil)
 	if len(tools) == 0 {
 		t.Fatal("expected schema tools to be created")
 	}
 
 	// Verify we get the expected tools
-	expectedTools := []string{"list_tables", "describe_table", "get_relationships", "search_columns"}
+	expectedTools := []string{"list_tables", "describe_table", "get_relationships", "search_columns", "get_view_definition", "list_functions", "column_stats"}
 	toolNames := make(map[string]bool)
 	for _, tool := range tools {
 		toolNames[tool.Name] = true
@@ -286,13 +420,13 @@ func TestCreateExecutionTools(t *testing.T) {
 	mockDB := &MockConnection{}
 
 	getUserApproval := func(query string) bool { return true }
-	tools := CreateExecutionTools(mockDB, getUserApproval, "default")
+	tools := CreateExecutionTools(mockDB, getUserApproval, "default", ExecutionOptions{})
 	if len(tools) == 0 {
 		t.Fatal("expected execution tools to be created")
 	}
 
 	// Verify we get the expected tools
-	expectedTools := []string{"execute_sql", "explain_query"}
+	expectedTools := []string{"execute_sql", "explain_query", "suggest_indexes", "sample_column_values"}
 	toolNames := make(map[string]bool)
 	for _, tool := range tools {
 		toolNames[tool.Name] = true
@@ -337,6 +471,154 @@ func TestListTablesTool(t *testing.T) {
 	}
 }
 
+func TestListTablesTool_AccessMarkers(t *testing.T) {
+	mockDB := &MockConnection{
+		tables: []db.TableInfo{
+			{Schema: "public", Name: "users", Type: "table", Access: db.AccessFull},
+			{Schema: "public", Name: "salaries", Type: "table", Access: db.AccessNone},
+			{Schema: "public", Name: "employees", Type: "table", Access: db.AccessPartial},
+			{Schema: "public", Name: "tenants", Type: "table", Access: db.AccessFull, RowSecurity: true},
+		},
+	}
+
+	for _, mode := range []string{"schema-only", "default", "share-results"} {
+		t.Run(mode, func(t *testing.T) {
+			tool := createListTablesTool(mockDB, mode)
+			result, err := tool.Handler(context.Background(), map[string]interface{}{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			lines := strings.Split(result.Content, "\n")
+			expectedMarkers := map[string]string{
+				"- users ":     "",
+				"- salaries ":  "[NO ACCESS]",
+				"- employees ": "[PARTIAL ACCESS]",
+				"- tenants ":   "[RLS]",
+			}
+			for prefix, marker := range expectedMarkers {
+				found := false
+				for _, line := range lines {
+					if !strings.HasPrefix(line, prefix) {
+						continue
+					}
+					found = true
+					if marker == "" && strings.Contains(line, "[") {
+						t.Errorf("expected no access marker for %q", line)
+					}
+					if marker != "" && !strings.Contains(line, marker) {
+						t.Errorf("expected %q to contain %s", line, marker)
+					}
+				}
+				if !found {
+					t.Errorf("expected a line starting with %q, got: %s", prefix, result.Content)
+				}
+			}
+		})
+	}
+}
+
+func TestSummarizeTableAccess(t *testing.T) {
+	allReadable := []db.TableInfo{
+		{Schema: "public", Name: "users", Access: db.AccessFull},
+		{Schema: "public", Name: "orders"},
+	}
+	summary := SummarizeTableAccess(allReadable)
+	if !strings.Contains(summary, "can read all 2 tables") {
+		t.Errorf("expected all-readable summary, got: %s", summary)
+	}
+
+	mixed := []db.TableInfo{
+		{Schema: "public", Name: "users", Access: db.AccessFull},
+		{Schema: "hr", Name: "salaries", Access: db.AccessNone},
+		{Schema: "hr", Name: "employees", Access: db.AccessPartial},
+		{Schema: "public", Name: "tenants", Access: db.AccessFull, RowSecurity: true},
+	}
+	summary = SummarizeTableAccess(mixed)
+	for _, expected := range []string{
+		"can read 3 of 4 tables",
+		"NO SELECT privilege (never query these): hr.salaries",
+		"Only some columns readable (check describe_table before selecting columns, avoid SELECT *): hr.employees",
+		"Row-level security enabled (results only include rows permitted by policies): public.tenants",
+	} {
+		if !strings.Contains(summary, expected) {
+			t.Errorf("expected summary to contain '%s', got: %s", expected, summary)
+		}
+	}
+}
+
+func TestDescribeTableTool_Security(t *testing.T) {
+	mockDB := &MockConnection{
+		tables: []db.TableInfo{
+			{
+				Schema:      "public",
+				Name:        "employees",
+				Access:      db.AccessPartial,
+				RowSecurity: true,
+				Policies: []db.PolicyInfo{
+					{Name: "own_department", Command: "SELECT", Permissive: true, Roles: []string{"analyst"}, Using: "(department = current_setting('app.department'::text))"},
+				},
+				Columns: []db.ColumnInfo{
+					{Name: "id", DataType: "integer", IsPrimaryKey: true},
+					{Name: "salary", DataType: "numeric", SelectDenied: true},
+				},
+			},
+		},
+	}
+
+	tool := createDescribeTableTool(mockDB)
+	result, err := tool.Handler(context.Background(), map[string]interface{}{"table_name": "employees"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, expected := range []string{
+		"Access: PARTIAL",
+		"Row-level security: ENABLED",
+		"Policy own_department: SELECT, permissive, roles: analyst, USING ((department = current_setting('app.department'::text)))",
+		"[NO SELECT PRIVILEGE]",
+	} {
+		if !strings.Contains(result.Content, expected) {
+			t.Errorf("expected result to contain '%s', got: %s", expected, result.Content)
+		}
+	}
+
+	for _, line := range strings.Split(result.Content, "\n") {
+		if strings.HasPrefix(line, "id ") && strings.Contains(line, "NO SELECT") {
+			t.Errorf("expected id column to be selectable, got: %s", line)
+		}
+	}
+}
+
+func TestDescribeTableTool_ResolvesSearchPath(t *testing.T) {
+	mockDB := &MockConnection{
+		tables: []db.TableInfo{
+			{
+				Schema:  "sales",
+				Name:    "orders",
+				Columns: []db.ColumnInfo{{Name: "id", DataType: "integer"}},
+			},
+		},
+	}
+
+	tool := createDescribeTableTool(mockDB)
+	result, err := tool.Handler(context.Background(), map[string]interface{}{"table_name": "Orders"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(result.Content, "Table: sales.orders") {
+		t.Errorf("expected unqualified name to resolve to sales.orders, got: %s", result.Content)
+	}
+
+	result, err = tool.Handler(context.Background(), map[string]interface{}{"table_name": `"unterminated`})
+	if err == nil {
+		t.Error("expected error for malformed name")
+	}
+	if !result.IsError {
+		t.Error("expected error result for malformed name")
+	}
+}
+
 func TestDescribeTableTool(t *testing.T) {
 	mockDB := &MockConnection{
 		tables: []db.TableInfo{
@@ -486,11 +768,302 @@ func TestSearchColumnsTool(t *testing.T) {
 	}
 }
 
+func TestGetViewDefinitionTool(t *testing.T) {
+	mockDB := &MockConnection{
+		views: []db.ViewInfo{
+			{
+				Schema:      "public",
+				Name:        "active_users",
+				Type:        "view",
+				Definition:  " SELECT users.id, users.name FROM users WHERE users.active;",
+				Description: "Users who are currently active",
+			},
+		},
+	}
+
+	tool := createGetViewDefinitionTool(mockDB)
+	if tool.Name != "get_view_definition" {
+		t.Errorf("expected tool name 'get_view_definition', got '%s'", tool.Name)
+	}
+
+	ctx := context.Background()
+	result, err := tool.Handler(ctx, map[string]interface{}{"view_name": "active_users"})
+	if err != nil {
+		t.Errorf("unexpected error executing get_view_definition tool: %v", err)
+	}
+	if result.IsError {
+		t.Errorf("expected successful result, got error: %s", result.Content)
+	}
+
+	content := result.Content
+	if !strings.Contains(content, "public.active_users (view)") {
+		t.Errorf("expected result to contain view name and type, got: %s", content)
+	}
+	if !strings.Contains(content, "WHERE users.active") {
+		t.Errorf("expected result to contain view definition, got: %s", content)
+	}
+	if !strings.Contains(content, "Users who are currently active") {
+		t.Errorf("expected result to contain view description, got: %s", content)
+	}
+
+	// Test missing required parameters
+	result, err = tool.Handler(ctx, map[string]interface{}{})
+	if err == nil {
+		t.Error("expected error for missing parameters")
+	}
+	if result == nil || !result.IsError {
+		t.Error("expected error result for missing parameters")
+	}
+
+	// Test with missing view
+	result, err = tool.Handler(ctx, map[string]interface{}{"view_name": "public.nonexistent"})
+	if err == nil {
+		t.Error("expected error for nonexistent view")
+	}
+	if result == nil || !result.IsError {
+		t.Error("expected error result for nonexistent view")
+	}
+}
+
+func TestListFunctionsTool(t *testing.T) {
+	mockDB := &MockConnection{
+		functions: []db.FunctionInfo{
+			{Schema: "public", Name: "order_total", Arguments: "order_id integer", ReturnType: "numeric", Volatility: "stable", Language: "sql", Description: "Sum of order line items"},
+			{Schema: "public", Name: "normalize_email", Arguments: "email text", ReturnType: "text", Volatility: "immutable", Language: "sql"},
+			{Schema: "public", Name: "refresh_totals", Arguments: "", ReturnType: "void", Volatility: "volatile", Language: "plpgsql"},
+		},
+	}
+
+	tool := createListFunctionsTool(mockDB)
+	if tool.Name != "list_functions" {
+		t.Errorf("expected tool name 'list_functions', got '%s'", tool.Name)
+	}
+
+	ctx := context.Background()
+	result, err := tool.Handler(ctx, map[string]interface{}{})
+	if err != nil {
+		t.Errorf("unexpected error executing list_functions tool: %v", err)
+	}
+	if result.IsError {
+		t.Errorf("expected successful result, got error: %s", result.Content)
+	}
+
+	content := result.Content
+	callableIdx := strings.Index(content, "Callable from queries")
+	notCallableIdx := strings.Index(content, "NOT callable from queries")
+	if callableIdx == -1 || notCallableIdx == -1 {
+		t.Fatalf("expected callable and not-callable sections, got: %s", content)
+	}
+
+	for _, name := range []string{"public.order_total(order_id integer)", "public.normalize_email(email text)"} {
+		idx := strings.Index(content, name)
+		if idx == -1 || idx > notCallableIdx {
+			t.Errorf("expected %s to be listed as callable, got: %s", name, content)
+		}
+	}
+	if idx := strings.Index(content, "public.refresh_totals()"); idx < notCallableIdx {
+		t.Errorf("expected volatile function to be listed as not callable, got: %s", content)
+	}
+	if !strings.Contains(content, "RETURNS numeric [STABLE, sql]") {
+		t.Errorf("expected return type, volatility and language, got: %s", content)
+	}
+	if !strings.Contains(content, "Sum of order line items") {
+		t.Errorf("expected function description, got: %s", content)
+	}
+
+	// Test filtering with no matches
+	result, err = tool.Handler(ctx, map[string]interface{}{"pattern": "nonexistent"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if result.IsError || !strings.Contains(result.Content, "No user-defined functions found") {
+		t.Errorf("expected no functions message, got: %s", result.Content)
+	}
+}
+
+func TestColumnStatsTool(t *testing.T) {
+	correlation := 0.87
+	mockDB := &MockConnection{
+		columnStats: map[string][]db.ColumnStats{
+			"public.orders": {
+				{
+					Column:          "status",
+					NullFraction:    0.05,
+					AvgWidth:        8,
+					NDistinct:       3,
+					Correlation:     &correlation,
+					MostCommonVals:  "{completed,pending,shipped}",
+					MostCommonFreqs: []float64{0.6, 0.3, 0.1},
+				},
+				{
+					Column:          "id",
+					AvgWidth:        4,
+					NDistinct:       -1,
+					HistogramBounds: "{1,500,1000}",
+				},
+			},
+		},
+	}
+
+	ctx := context.Background()
+	input := map[string]interface{}{"table_name": "orders"}
+
+	tests := []struct {
+		name                string
+		mode                string
+		input               map[string]interface{}
+		expectedContains    []string
+		expectedNotContains []string
+	}{
+		{
+			name:  "schema-only shares nothing",
+			mode:  "schema-only",
+			input: input,
+			expectedContains: []string{
+				"not shared in schema-only mode",
+			},
+			expectedNotContains: []string{"status", "5.0%", "completed", "{1,500,1000}"},
+		},
+		{
+			name:  "default shares aggregate numbers only",
+			mode:  "default",
+			input: input,
+			expectedContains: []string{
+				"Column: status",
+				"Null fraction: 5.0%",
+				"Distinct values: ~3",
+				"Average width: 8 bytes",
+				"Correlation: 0.87",
+				"Column: id",
+				"all values are unique",
+			},
+			expectedNotContains: []string{"completed", "pending", "{1,500,1000}"},
+		},
+		{
+			name:  "share-results includes most common values",
+			mode:  "share-results",
+			input: input,
+			expectedContains: []string{
+				"Most common values: {completed,pending,shipped}",
+				"Most common frequencies: {60.0%,30.0%,10.0%}",
+				"Histogram bounds: {1,500,1000}",
+			},
+		},
+		{
+			name:  "single column filter",
+			mode:  "default",
+			input: map[string]interface{}{"table_name": "public.orders", "column_name": "id"},
+			expectedContains: []string{
+				"Column: id",
+			},
+			expectedNotContains: []string{"Column: status"},
+		},
+		{
+			name:  "no statistics available",
+			mode:  "default",
+			input: map[string]interface{}{"table_name": "users"},
+			expectedContains: []string{
+				"No statistics available for public.users",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := createColumnStatsTool(mockDB, tt.mode, nil)
+			result, err := tool.Handler(ctx, tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.IsError {
+				t.Fatalf("expected successful result, got error: %s", result.Content)
+			}
+
+			content := stripDataMarkers(result.Content)
+			for _, expected := range tt.expectedContains {
+				if !strings.Contains(content, expected) {
+					t.Errorf("expected result to contain '%s', got: %s", expected, content)
+				}
+			}
+			for _, notExpected := range tt.expectedNotContains {
+				if strings.Contains(content, notExpected) {
+					t.Errorf("expected result to NOT contain '%s', got: %s", notExpected, content)
+				}
+			}
+		})
+	}
+
+	// Test missing required parameters
+	tool := createColumnStatsTool(mockDB, "default", nil)
+	result, err := tool.Handler(ctx, map[string]interface{}{})
+	if err == nil {
+		t.Error("expected error for missing parameters")
+	}
+	if result == nil || !result.IsError {
+		t.Error("expected error result for missing parameters")
+	}
+}
+
+func TestColumnStatsTool_MasksValues(t *testing.T) {
+	mockDB := &MockConnection{
+		columnStats: map[string][]db.ColumnStats{
+			"public.users": {
+				{Column: "contact", TypeName: "text", MostCommonVals: `{alice@example.com,"call 555-123-4567"}`, MostCommonFreqs: []float64{0.5, 0.5}},
+				{Column: "salary", TypeName: "int4", HistogramBounds: "{1200,5600,98000}"},
+				{Column: "grid", TypeName: "_int4", MostCommonVals: "{{1,2},{3,4}}", MostCommonFreqs: []float64{0.5}},
+			},
+		},
+	}
+	masker := newTestMasker(t, config.MaskingConfig{
+		Rules: []config.MaskRule{{Column: "salary", Action: config.MaskBucket, BucketSize: 1000}},
+	})
+
+	tool := createColumnStatsTool(mockDB, "share-results", masker)
+	result, err := tool.Handler(context.Background(), map[string]interface{}{"table_name": "users"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content := stripDataMarkers(result.Content)
+
+	for _, expected := range []string{
+		`Most common values: {<email>,"call <phone>"}`,
+		`Histogram bounds: {"[1000, 2000)","[5000, 6000)","[98000, 99000)"}`,
+		"Most common values: withheld because they could not be masked",
+	} {
+		if !strings.Contains(content, expected) {
+			t.Errorf("expected result to contain %q, got: %s", expected, content)
+		}
+	}
+	for _, leaked := range []string{"alice@example.com", "555-123-4567", "5600", "{1,2}"} {
+		if strings.Contains(content, leaked) {
+			t.Errorf("expected %q to be masked, got: %s", leaked, content)
+		}
+	}
+}
+
+func TestFormatNDistinct(t *testing.T) {
+	tests := []struct {
+		input    float64
+		expected string
+	}{
+		{-1, "all values are unique"},
+		{-0.25, "~25.0% of rows are distinct (scales with table size)"},
+		{0, "unknown"},
+		{42, "~42"},
+	}
+
+	for _, tt := range tests {
+		if got := formatNDistinct(tt.input); got != tt.expected {
+			t.Errorf("formatNDistinct(%v) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
 func TestCreateExecuteSQLTool(t *testing.T) {
 	mockDB := &MockConnection{}
 
 	getUserApproval := func(query string) bool { return true }
-	tool := createExecuteSQLTool(mockDB, getUserApproval, "default")
+	tool := createExecuteSQLTool(mockDB, getUserApproval, "default", ExecutionOptions{})
 	if tool.Name != "execute_sql" {
 		t.Errorf("expected tool name 'execute_sql', got '%s'", tool.Name)
 	}
@@ -532,11 +1105,161 @@ func TestCreateExecuteSQLTool(t *testing.T) {
 	}
 }
 
+func TestExecuteSQLTool_BlocksFilteredTables(t *testing.T) {
+	mockDB := &MockConnection{
+		tables: []db.TableInfo{
+			{Schema: "public", Name: "users"},
+			{Schema: "staging", Name: "raw_events"},
+		},
+	}
+	conn := db.NewFilteredConnection(mockDB, config.ObjectFilter{ExcludeSchemas: []string{"staging"}}, config.DenyPolicy{})
+
+	approvalRequested := false
+	getUserApproval := func(query string) bool {
+		approvalRequested = true
+		return true
+	}
+
+	for _, tool := range []*Tool{createExecuteSQLTool(conn, getUserApproval, "default", ExecutionOptions{}), createExplainQueryTool(conn, getUserApproval, "default", ExecutionOptions{})} {
+		result, err := tool.Handler(context.Background(), map[string]interface{}{
+			"sql":         "SELECT * FROM users u JOIN raw_events e ON e.user_id = u.id",
+			"explanation": "Join with staging",
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tool.Name, err)
+		}
+		if !result.IsError || !strings.Contains(result.Content, "staging.raw_events") {
+			t.Errorf("%s: expected query to be blocked, got: %s", tool.Name, result.Content)
+		}
+	}
+	if approvalRequested {
+		t.Error("expected blocked query not to be shown for approval")
+	}
+}
+
+func TestExecuteSQLTool_BlocksDeniedColumns(t *testing.T) {
+	mockDB := &MockConnection{
+		tables: []db.TableInfo{
+			{Schema: "public", Name: "users", Columns: []db.ColumnInfo{{Name: "id"}, {Name: "ssn"}}},
+		},
+	}
+	conn := db.NewFilteredConnection(mockDB, config.ObjectFilter{}, config.DenyPolicy{Columns: []string{"users.ssn"}})
+
+	approvalRequested := false
+	tool := createExecuteSQLTool(conn, func(query string) bool {
+		approvalRequested = true
+		return true
+	}, "default", ExecutionOptions{})
+
+	result, err := tool.Handler(context.Background(), map[string]interface{}{
+		"sql":         "SELECT * FROM users",
+		"explanation": "All users",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, expected := range []string{"blocked by data policy", "would include denied column(s) ssn", "Do not try to work around the policy"} {
+		if !strings.Contains(result.Content, expected) {
+			t.Errorf("expected result to contain %q, got: %s", expected, result.Content)
+		}
+	}
+	if !result.IsError || approvalRequested {
+		t.Error("expected query to be blocked before approval")
+	}
+}
+
+func TestExecuteSQLTool_RecordsHistory(t *testing.T) {
+	log, err := history.Open(filepath.Join(t.TempDir(), "history"), "shop", "")
+	if err != nil {
+		t.Fatalf("history.Open failed: %v", err)
+	}
+	defer log.Close()
+	opts := ExecutionOptions{History: log}
+	ctx := context.Background()
+
+	approve := false
+	tool := createExecuteSQLTool(&MockConnection{}, func(string) bool { return approve }, "default", opts)
+	log.StartQuestion("How many users?")
+	for _, approve = range []bool{false, true} {
+		if _, err := tool.Handler(ctx, map[string]interface{}{"sql": "SELECT count(*) FROM users", "explanation": "Count users"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	log.StartReplay(2)
+	if err := RunQuery(ctx, &MockConnection{queryError: fmt.Errorf("connection reset")}, Query{SQL: "SELECT count(*) FROM users"}, "default", opts); err == nil {
+		t.Error("expected replay against a failing connection to fail")
+	}
+
+	entries := log.Recent(10)
+	var got []string
+	for _, e := range entries {
+		got = append(got, fmt.Sprintf("%s/%q/%d", e.Outcome, e.Question, e.ReplayOf))
+	}
+	expected := []string{`rejected/"How many users?"/0`, `executed/"How many users?"/0`, `failed/""/2`}
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("unexpected history: %v", got)
+	}
+	if entries[1].Rows == nil || *entries[1].Rows != 0 {
+		t.Errorf("expected the executed query's row count, got %+v", entries[1])
+	}
+}
+
+func TestExportQuery(t *testing.T) {
+	log, err := history.Open(filepath.Join(t.TempDir(), "history"), "shop", "")
+	if err != nil {
+		t.Fatalf("history.Open failed: %v", err)
+	}
+	defer log.Close()
+	ctx := context.Background()
+	conn := &MockConnection{
+		queryRows: func(sql string) [][]interface{} {
+			if strings.HasPrefix(sql, "EXPLAIN (FORMAT JSON) ") {
+				return [][]interface{}{{`[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "events", "Total Cost": 2500000, "Plan Rows": 100000000}}]`}}
+			}
+			return [][]interface{}{{int64(1)}, {int64(2)}, {int64(3)}}
+		},
+	}
+	export := func(rows pgx.Rows) (int, error) {
+		count := 0
+		for rows.Next() {
+			count++
+		}
+		return count, nil
+	}
+
+	opts := ExecutionOptions{History: log}
+	if err := ExportQuery(ctx, conn, Query{SQL: "SELECT id FROM events"}, "default", opts, export); err != nil {
+		t.Fatalf("ExportQuery failed: %v", err)
+	}
+
+	// The export is capped by cost like any other query
+	exported := false
+	opts.MaxQueryCost = 1000000
+	err = ExportQuery(ctx, conn, Query{SQL: "SELECT id FROM events"}, "default", opts, func(rows pgx.Rows) (int, error) {
+		exported = true
+		return 0, nil
+	})
+	if err == nil || exported {
+		t.Errorf("expected an export above the cost cap to be blocked, got %v", err)
+	}
+
+	if err := ExportQuery(ctx, conn, Query{SQL: "DELETE FROM events"}, "default", ExecutionOptions{}, export); err == nil {
+		t.Error("expected a non-SELECT export to be rejected")
+	}
+
+	entries := log.Recent(10)
+	if len(entries) != 2 || entries[0].Outcome != history.OutcomeExecuted || entries[0].Rows == nil || *entries[0].Rows != 3 ||
+		entries[1].Outcome != history.OutcomeBlocked {
+		t.Errorf("expected the export and the blocked export in the history, got %+v", entries)
+	}
+}
+
 func TestCreateExplainQueryTool(t *testing.T) {
 	mockDB := &MockConnection{}
 
 	getUserApproval := func(query string) bool { return true }
-	tool := createExplainQueryTool(mockDB, getUserApproval, "default")
+	tool := createExplainQueryTool(mockDB, getUserApproval, "default", ExecutionOptions{})
 	if tool.Name != "explain_query" {
 		t.Errorf("expected tool name 'explain_query', got '%s'", tool.Name)
 	}
@@ -565,6 +1288,267 @@ func TestCreateExplainQueryTool(t *testing.T) {
 	}
 }
 
+func TestExplainQueryTool_PseudonymizesIndexNames(t *testing.T) {
+	const plan = `[{"Plan": {"Node Type": "Index Scan", "Index Name": "users_ssn_idx", "Relation Name": "users", "Alias": "users", "Startup Cost": 0.3, "Total Cost": 8.3, "Plan Rows": 1, "Plan Width": 4}}]`
+	mockDB := &MockConnection{
+		queryRows: func(sql string) [][]interface{} {
+			return [][]interface{}{{plan}}
+		},
+	}
+	pseudonyms := db.NewPseudonyms()
+	conn := db.NewPseudonymConnection(mockDB, pseudonyms)
+	tool := createExplainQueryTool(conn, func(string) bool { return true }, "default", ExecutionOptions{})
+
+	result, err := tool.Handler(context.Background(), map[string]interface{}{
+		"sql":         "SELECT id FROM users WHERE ssn = '1'",
+		"explanation": "Check the plan",
+	})
+	if err != nil || result.IsError {
+		t.Fatalf("unexpected failure: %v %s", err, result.Content)
+	}
+	sent := pseudonyms.PseudonymizeText(result.Content)
+	if strings.Contains(sent, "users_ssn_idx") || !strings.Contains(sent, "using i_001") {
+		t.Errorf("expected the index name to be pseudonymized, got:\n%s", sent)
+	}
+}
+
+func TestExplainQueryTool_Analyze(t *testing.T) {
+	const estimatedPlan = `[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "users", "Alias": "users", "Startup Cost": 0, "Total Cost": 35.5, "Plan Rows": 2550, "Plan Width": 4}}]`
+	const analyzedPlan = `[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "users", "Alias": "users", "Startup Cost": 0, "Total Cost": 35.5, "Plan Rows": 2550, "Plan Width": 4,
+		"Actual Startup Time": 0.01, "Actual Total Time": 0.2, "Actual Rows": 12, "Actual Loops": 1, "Shared Hit Blocks": 3, "Shared Read Blocks": 0},
+		"Planning Time": 0.05, "Execution Time": 0.3}]`
+
+	newConn := func() *MockConnection {
+		return &MockConnection{queryRows: func(sql string) [][]interface{} {
+			if strings.HasPrefix(sql, "EXPLAIN (ANALYZE") {
+				return [][]interface{}{{analyzedPlan}}
+			}
+			return [][]interface{}{{estimatedPlan}}
+		}}
+	}
+	input := map[string]interface{}{
+		"sql":         "SELECT id FROM users",
+		"explanation": "Check the plan",
+		"analyze":     true,
+	}
+	ctx := context.Background()
+
+	t.Run("approved", func(t *testing.T) {
+		conn := newConn()
+		var prompts []string
+		tool := createExplainQueryTool(conn, func(prompt string) bool {
+			prompts = append(prompts, prompt)
+			return true
+		}, "default", ExecutionOptions{})
+
+		result, err := tool.Handler(ctx, input)
+		if err != nil || result.IsError {
+			t.Fatalf("unexpected failure: %v %v", err, result)
+		}
+		if len(prompts) != 2 || !strings.Contains(prompts[1], "EXPLAIN ANALYZE EXECUTES the query") || !strings.Contains(prompts[1], "Estimated total cost: 36") {
+			t.Fatalf("expected a separate EXPLAIN ANALYZE approval, got %q", prompts)
+		}
+		if len(conn.readOnlyQueries) != 1 || conn.readOnlyQueries[0] != "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) SELECT id FROM users" {
+			t.Errorf("expected EXPLAIN ANALYZE in a read-only transaction, got %v", conn.readOnlyQueries)
+		}
+		for _, want := range []string{"EXPLAIN ANALYZE", "rows=2550 actual rows=12", "Buffers: shared hit=3 read=0", "row estimate off by"} {
+			if !strings.Contains(result.Content, want) {
+				t.Errorf("expected %q in result:\n%s", want, result.Content)
+			}
+		}
+	})
+
+	t.Run("cost over the limit", func(t *testing.T) {
+		conn := newConn()
+		approvals := 0
+		tool := createExplainQueryTool(conn, func(prompt string) bool {
+			approvals++
+			return true
+		}, "default", ExecutionOptions{MaxAnalyzeCost: 10})
+
+		result, err := tool.Handler(ctx, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if approvals != 1 || len(conn.readOnlyQueries) != 0 {
+			t.Errorf("expected EXPLAIN ANALYZE to be refused without asking, got %d approvals and %v", approvals, conn.readOnlyQueries)
+		}
+		if !strings.Contains(result.Content, "EXPLAIN ANALYZE was refused") || !strings.Contains(result.Content, "Seq Scan on users") {
+			t.Errorf("expected the estimated plan and the refusal, got:\n%s", result.Content)
+		}
+	})
+
+	t.Run("non-SELECT statement", func(t *testing.T) {
+		conn := newConn()
+		sql := "UPDATE users SET name = 'x'"
+		if _, _, err := executeExplainQuery(ctx, conn, os.Stdout, "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "+sql, sql, true); err == nil {
+			t.Error("expected a non-SELECT statement to be rejected")
+		}
+		if len(conn.readOnlyQueries) != 0 {
+			t.Errorf("expected nothing to run, got %v", conn.readOnlyQueries)
+		}
+	})
+
+	t.Run("declined", func(t *testing.T) {
+		conn := newConn()
+		tool := createExplainQueryTool(conn, func(prompt string) bool {
+			return !strings.Contains(prompt, "EXPLAIN ANALYZE EXECUTES")
+		}, "default", ExecutionOptions{})
+
+		result, err := tool.Handler(ctx, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(conn.readOnlyQueries) != 0 || !strings.Contains(result.Content, "declined to run EXPLAIN ANALYZE") {
+			t.Errorf("expected EXPLAIN ANALYZE not to run, got %v:\n%s", conn.readOnlyQueries, result.Content)
+		}
+	})
+}
+
+func TestSampleColumnValuesTool(t *testing.T) {
+	mockDB := &MockConnection{
+		samples: map[string][]string{
+			"public.orders.status": {"completed", "pending", "shipped"},
+		},
+	}
+	ctx := context.Background()
+	input := map[string]interface{}{
+		"table_name":  "orders",
+		"column_name": "status",
+		"limit":       float64(2),
+		"explanation": "Need exact spelling of order statuses",
+	}
+
+	t.Run("approved values are shared", func(t *testing.T) {
+		var shownToUser string
+		tool := createSampleColumnValuesTool(mockDB, "default", ExecutionOptions{ConfirmShare: func(info string) bool {
+			shownToUser = info
+			return true
+		}})
+
+		result, err := tool.Handler(ctx, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.IsError {
+			t.Fatalf("expected successful result, got error: %s", result.Content)
+		}
+
+		for _, expected := range []string{"completed", "pending", "NOT been shared yet"} {
+			if !strings.Contains(shownToUser, expected) {
+				t.Errorf("expected approval prompt to contain '%s', got: %s", expected, shownToUser)
+			}
+		}
+		if strings.Contains(shownToUser, "shipped") {
+			t.Errorf("expected limit to be applied to sampled values, got: %s", shownToUser)
+		}
+		if !strings.Contains(result.Content, `"completed"`) || !strings.Contains(result.Content, `"pending"`) {
+			t.Errorf("expected approved values in result, got: %s", result.Content)
+		}
+	})
+
+	t.Run("declined values are not shared", func(t *testing.T) {
+		tool := createSampleColumnValuesTool(mockDB, "default", ExecutionOptions{ConfirmShare: func(info string) bool { return false }})
+
+		result, err := tool.Handler(ctx, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.IsError {
+			t.Error("expected non-error result when user declines")
+		}
+		if !strings.Contains(result.Content, "User declined") {
+			t.Errorf("expected declined message, got: %s", result.Content)
+		}
+		if strings.Contains(result.Content, "completed") {
+			t.Errorf("declined values leaked to LLM: %s", result.Content)
+		}
+	})
+
+	t.Run("decisions are audited", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.jsonl")
+		logger, err := audit.Open(path)
+		if err != nil {
+			t.Fatalf("audit.Open failed: %v", err)
+		}
+		for _, share := range []bool{true, false} {
+			tool := createSampleColumnValuesTool(mockDB, "default", ExecutionOptions{Audit: logger, ConfirmShare: func(info string) bool { return share }})
+			if _, err := tool.Handler(ctx, input); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		// Without a way to ask, values are never shared
+		if _, err := createSampleColumnValuesTool(mockDB, "default", ExecutionOptions{Audit: logger}).Handler(ctx, input); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		logger.Close()
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events, err := audit.ReadEvents(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("ReadEvents failed: %v", err)
+		}
+		var decisions []string
+		for _, e := range events {
+			if e.Type == audit.EventShareDecision {
+				if e.Column != "public.orders.status" || e.Tool != "sample_column_values" {
+					t.Errorf("unexpected share decision event: %+v", e)
+				}
+				decisions = append(decisions, e.Decision)
+			}
+		}
+		if fmt.Sprint(decisions) != "[approved rejected rejected]" {
+			t.Errorf("expected approved, rejected and rejected share decisions, got %v", decisions)
+		}
+	})
+
+	t.Run("schema-only mode never samples", func(t *testing.T) {
+		asked := false
+		tool := createSampleColumnValuesTool(mockDB, "schema-only", ExecutionOptions{ConfirmShare: func(info string) bool {
+			asked = true
+			return true
+		}})
+
+		result, err := tool.Handler(ctx, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if asked {
+			t.Error("expected no approval prompt in schema-only mode")
+		}
+		if strings.Contains(result.Content, "completed") {
+			t.Errorf("schema-only mode leaked values: %s", result.Content)
+		}
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		failingDB := &MockConnection{queryError: &pgconn.PgError{Severity: "ERROR", Code: "42703", Message: `column "sttaus" does not exist`}}
+		tool := createSampleColumnValuesTool(failingDB, "default", ExecutionOptions{ConfirmShare: func(info string) bool { return true }})
+
+		result, err := tool.Handler(ctx, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError || !strings.Contains(result.Content, "Column not found") {
+			t.Errorf("expected column not found error result, got: %s", result.Content)
+		}
+	})
+
+	t.Run("missing parameters", func(t *testing.T) {
+		tool := createSampleColumnValuesTool(mockDB, "default", ExecutionOptions{})
+		result, err := tool.Handler(ctx, map[string]interface{}{"table_name": "orders"})
+		if err == nil {
+			t.Error("expected error for missing column_name")
+		}
+		if result == nil || !result.IsError {
+			t.Error("expected error result for missing column_name")
+		}
+	})
+}
+
 func TestMinFunction(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -593,7 +1577,7 @@ func TestExecuteApprovedSQL(t *testing.T) {
 	ctx := context.Background()
 
 	// Test invalid query (non-SELECT) - this will fail validation
-	result, err := executeApprovedSQL(ctx, mockDB, "DELETE FROM users", "default")
+	result, err := executeApprovedSQL(ctx, mockDB, Query{SQL: "DELETE FROM users"}, "default", ExecutionOptions{})
 	if err == nil {
 		t.Error("expected error for non-SELECT query")
 	}
@@ -602,7 +1586,7 @@ func TestExecuteApprovedSQL(t *testing.T) {
 	}
 
 	// Test dangerous query pattern
-	result, err = executeApprovedSQL(ctx, mockDB, "SELECT * FROM users; DROP TABLE users;", "default")
+	result, err = executeApprovedSQL(ctx, mockDB, Query{SQL: "SELECT * FROM users; DROP TABLE users;"}, "default", ExecutionOptions{})
 	if err == nil {
 		t.Error("expected error for dangerous query")
 	}
@@ -688,7 +1672,7 @@ func TestExecuteSelectQuery_WithRealDatabase(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := executeSelectQuery(ctx, conn, tt.query, tt.mode)
+			result, err := executeSelectQuery(ctx, conn, Query{SQL: tt.query}, tt.mode, ExecutionOptions{})
 
 			if tt.wantErr {
 				if err == nil {
@@ -786,7 +1770,7 @@ func TestExecuteExplainQuery_WithRealDatabase(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := executeExplainQuery(ctx, conn, tt.query, tt.mode)
+			result, _, err := executeExplainQuery(ctx, conn, os.Stdout, "EXPLAIN (FORMAT JSON) "+tt.query, tt.query, false)
 
 			if tt.wantErr {
 				if err == nil {
@@ -871,7 +1855,7 @@ func TestExecuteApprovedSQL_WithRealDatabase(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := executeApprovedSQL(ctx, conn, tt.query, tt.mode)
+			result, err := executeApprovedSQL(ctx, conn, Query{SQL: tt.query}, tt.mode, ExecutionOptions{})
 
 			if tt.wantErr {
 				if err == nil {
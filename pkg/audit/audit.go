@@ -0,0 +1,166 @@
+// Package audit records everything pgbabble sends to and receives from the LLM provider,
+// and every query the user approves or rejects, in an append-only JSON lines file.
+package audit
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	pkgerrors "github.com/AliciaSchep/pgbabble/pkg/errors"
+)
+
+// Event types
+const (
+	EventSessionStart  = "session_start"
+	EventRequest       = "request"        // messages sent to the provider
+	EventResponse      = "response"       // message received from the provider
+	EventToolCall      = "tool_call"      // tool requested by the LLM and the result sent back
+	EventSQLDecision   = "sql_decision"   // user approved or rejected a proposed query
+	EventSQLExecuted   = "sql_executed"   // approved query that ran, with its row count or error
+	EventShareDecision = "share_decision" // user approved or declined sending sampled values to the LLM
+	EventModeChange    = "mode_change"
+)
+
+// Decisions on a proposed query
+const (
+	DecisionApproved = "approved"
+	DecisionRejected = "rejected"
+)
+
+// Event is a single audit log line. Only the fields relevant to the event type are set.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Session string    `json:"session"`
+	Type    string    `json:"type"`
+	Mode    string    `json:"mode,omitempty"`
+
+	Model            string          `json:"model,omitempty"`
+	Database         string          `json:"database,omitempty"`
+	SystemPromptHash string          `json:"system_prompt_hash,omitempty"` // sha256 of the system prompt
+	Messages         json.RawMessage `json:"messages,omitempty"`           // messages added since the previous request
+	MessageCount     int             `json:"message_count,omitempty"`      // messages in the whole request
+	Response         json.RawMessage `json:"response,omitempty"`
+
+	Tool       string          `json:"tool,omitempty"`
+	ToolInput  json.RawMessage `json:"tool_input,omitempty"`
+	ToolResult string          `json:"tool_result,omitempty"`
+	IsError    bool            `json:"is_error,omitempty"`
+
+	SQL      string `json:"sql,omitempty"`
+	Decision string `json:"decision,omitempty"`
+	Column   string `json:"column,omitempty"` // schema.table.column whose values were sampled
+	Rows     *int   `json:"rows,omitempty"`
+	Error    string `json:"error,omitempty"`
+
+	PreviousMode string `json:"previous_mode,omitempty"`
+}
+
+// Logger appends events for one session to an audit log file. A nil *Logger
+// discards events, so callers do not need to check whether auditing is enabled.
+type Logger struct {
+	mu      sync.Mutex
+	file    *os.File
+	session string
+}
+
+// Open opens the audit log for appending, creating it if needed, and starts a new session
+func Open(path string) (*Logger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to generate audit session id: %w", err)
+	}
+	return &Logger{file: file, session: hex.EncodeToString(id)}, nil
+}
+
+// Session returns the id that ties together the events of this session
+func (l *Logger) Session() string {
+	if l == nil {
+		return ""
+	}
+	return l.session
+}
+
+// Log appends an event, filling in the time and session
+func (l *Logger) Log(event Event) error {
+	if l == nil {
+		return nil
+	}
+	event.Time = time.Now().UTC()
+	event.Session = l.session
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// Record logs an event and reports a failure to the user on stderr instead of returning it,
+// so auditing problems are visible without interrupting the session
+func (l *Logger) Record(event Event) {
+	if err := l.Log(event); err != nil {
+		pkgerrors.To(os.Stderr).UserError("audit log: %v", err)
+	}
+}
+
+// Close closes the audit log file
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// HashPrompt returns the hex sha256 of a system prompt
+func HashPrompt(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+// ReadEvents reads all events from an audit log
+func ReadEvents(r io.Reader) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("invalid audit log entry on line %d: %w", line, err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return events, nil
+}
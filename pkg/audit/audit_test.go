@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogger_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+
+	logger, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if len(logger.Session()) != 16 {
+		t.Errorf("expected a 16 character session id, got %q", logger.Session())
+	}
+
+	rows := 3
+	events := []Event{
+		{Type: EventSessionStart, Mode: "default", Model: "claude", Database: "shop"},
+		{Type: EventSQLDecision, Mode: "default", SQL: "SELECT 1", Decision: DecisionApproved},
+		{Type: EventSQLExecuted, Mode: "default", SQL: "SELECT 1", Rows: &rows},
+	}
+	for _, event := range events {
+		if err := logger.Log(event); err != nil {
+			t.Fatalf("Log failed: %v", err)
+		}
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected audit log mode 0600, got %o", info.Mode().Perm())
+	}
+
+	// A second session appends to the same file
+	second, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if second.Session() == logger.Session() {
+		t.Error("expected a new session id")
+	}
+	second.Record(Event{Type: EventSessionStart, Mode: "schema-only"})
+	second.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer file.Close()
+	read, err := ReadEvents(file)
+	if err != nil {
+		t.Fatalf("ReadEvents failed: %v", err)
+	}
+	if len(read) != 4 {
+		t.Fatalf("expected 4 events, got %d", len(read))
+	}
+	if read[0].Session != logger.Session() || read[3].Session != second.Session() {
+		t.Errorf("unexpected sessions: %q, %q", read[0].Session, read[3].Session)
+	}
+	if read[0].Time.IsZero() {
+		t.Error("expected event time to be set")
+	}
+	if read[2].Rows == nil || *read[2].Rows != 3 {
+		t.Errorf("expected 3 rows, got %v", read[2].Rows)
+	}
+}
+
+func TestLogger_Nil(t *testing.T) {
+	var logger *Logger
+	if err := logger.Log(Event{Type: EventRequest}); err != nil {
+		t.Errorf("expected nil logger to discard events, got %v", err)
+	}
+	if logger.Session() != "" {
+		t.Error("expected empty session for nil logger")
+	}
+	if err := logger.Close(); err != nil {
+		t.Errorf("expected nil logger close to succeed, got %v", err)
+	}
+}
+
+func TestFilterAndSummarize(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rows := 5
+	events := []Event{
+		{Time: base, Session: "a", Type: EventSessionStart, Mode: "default", Model: "claude", Database: "shop"},
+		{Time: base.Add(time.Minute), Session: "a", Type: EventRequest, Mode: "default"},
+		{Time: base.Add(2 * time.Minute), Session: "a", Type: EventToolCall, Mode: "default", Tool: "execute_sql"},
+		{Time: base.Add(2 * time.Minute), Session: "a", Type: EventSQLDecision, Mode: "default", Decision: DecisionApproved},
+		{Time: base.Add(2 * time.Minute), Session: "a", Type: EventSQLExecuted, Mode: "default", Rows: &rows},
+		{Time: base.Add(3 * time.Minute), Session: "a", Type: EventModeChange, Mode: "share-results", PreviousMode: "default"},
+		{Time: base.Add(4 * time.Minute), Session: "a", Type: EventSQLDecision, Mode: "share-results", Decision: DecisionRejected},
+		{Time: base.Add(5 * time.Minute), Session: "a", Type: EventSQLExecuted, Mode: "share-results", Error: "syntax error"},
+		{Time: base.Add(48 * time.Hour), Session: "b", Type: EventSessionStart, Mode: "schema-only"},
+	}
+
+	summaries := Summarize(events)
+	if len(summaries) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(summaries))
+	}
+	a := summaries[0]
+	if a.Session != "a" || a.Database != "shop" || a.Model != "claude" {
+		t.Errorf("unexpected session summary: %+v", a)
+	}
+	if a.End.Sub(a.Start) != 5*time.Minute {
+		t.Errorf("expected 5 minute session, got %v", a.End.Sub(a.Start))
+	}
+	if len(a.Modes) != 2 || a.Modes[0] != "default" || a.Modes[1] != "share-results" {
+		t.Errorf("unexpected modes: %v", a.Modes)
+	}
+	if a.Requests != 1 || a.ToolCalls != 1 || a.Approved != 1 || a.Rejected != 1 || a.Executed != 1 || a.Failed != 1 || a.Rows != 5 {
+		t.Errorf("unexpected counts: %+v", a)
+	}
+
+	filtered := Filter{Since: base.Add(24 * time.Hour)}.Apply(events)
+	if len(filtered) != 1 || filtered[0].Session != "b" {
+		t.Errorf("expected only session b after since, got %v", filtered)
+	}
+	filtered = Filter{Until: base.Add(2 * time.Minute)}.Apply(events)
+	if len(filtered) != 2 {
+		t.Errorf("expected until to be exclusive, got %d events", len(filtered))
+	}
+	filtered = Filter{Session: "b"}.Apply(events)
+	if len(filtered) != 1 {
+		t.Errorf("expected 1 event for session b, got %d", len(filtered))
+	}
+}
@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"sort"
+	"time"
+)
+
+// Filter selects audit events by session and time range; zero values match everything
+type Filter struct {
+	Session string
+	Since   time.Time // inclusive
+	Until   time.Time // exclusive
+}
+
+// Matches reports whether an event passes the filter
+func (f Filter) Matches(event Event) bool {
+	if f.Session != "" && event.Session != f.Session {
+		return false
+	}
+	if !f.Since.IsZero() && event.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !event.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Apply returns the events that pass the filter
+func (f Filter) Apply(events []Event) []Event {
+	var matched []Event
+	for _, event := range events {
+		if f.Matches(event) {
+			matched = append(matched, event)
+		}
+	}
+	return matched
+}
+
+// SessionSummary counts what happened in one session
+type SessionSummary struct {
+	Session   string
+	Start     time.Time
+	End       time.Time
+	Model     string
+	Database  string
+	Modes     []string // modes in the order they were used
+	Requests  int      // requests sent to the LLM provider
+	ToolCalls int
+	Approved  int // queries approved by the user
+	Rejected  int // queries rejected by the user
+	Executed  int // queries that ran successfully
+	Failed    int // approved queries that failed
+	Rows      int // rows returned by executed queries
+}
+
+// Summarize groups events by session, ordered by session start time
+func Summarize(events []Event) []SessionSummary {
+	bySession := make(map[string]*SessionSummary)
+	for _, event := range events {
+		summary, ok := bySession[event.Session]
+		if !ok {
+			summary = &SessionSummary{Session: event.Session, Start: event.Time}
+			bySession[event.Session] = summary
+		}
+		if event.Time.Before(summary.Start) {
+			summary.Start = event.Time
+		}
+		if event.Time.After(summary.End) {
+			summary.End = event.Time
+		}
+		if event.Mode != "" && (len(summary.Modes) == 0 || summary.Modes[len(summary.Modes)-1] != event.Mode) {
+			summary.Modes = append(summary.Modes, event.Mode)
+		}
+
+		switch event.Type {
+		case EventSessionStart:
+			summary.Model = event.Model
+			summary.Database = event.Database
+		case EventRequest:
+			summary.Requests++
+		case EventToolCall:
+			summary.ToolCalls++
+		case EventSQLDecision:
+			if event.Decision == DecisionApproved {
+				summary.Approved++
+			} else {
+				summary.Rejected++
+			}
+		case EventSQLExecuted:
+			if event.Error != "" {
+				summary.Failed++
+			} else {
+				summary.Executed++
+			}
+			if event.Rows != nil {
+				summary.Rows += *event.Rows
+			}
+		}
+	}
+
+	summaries := make([]SessionSummary, 0, len(bySession))
+	for _, summary := range bySession {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Start.Before(summaries[j].Start)
+	})
+	return summaries
+}
@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/AliciaSchep/pgbabble/pkg/agent"
+	"github.com/chzyer/readline"
+)
+
+// How queries proposed while answering a one-shot question are approved. Sampled column
+// values are only sent to the LLM when someone agrees at the prompt; the other policies
+// decline them.
+const (
+	ApprovePrompt       = "prompt"        // ask on the terminal, like the interactive session
+	ApproveAutoReadOnly = "auto-readonly" // run every query; the caller must use a read-only connection
+	ApproveNever        = "never"         // run nothing, answer from the schema alone
+)
+
+// ApprovalPolicies lists the valid approval policies for Ask
+var ApprovalPolicies = []string{ApprovePrompt, ApproveAutoReadOnly, ApproveNever}
+
+// AskResult is the outcome of a one-shot question
+type AskResult struct {
+	Answer   string                // the assistant's final response
+	Results  []*agent.StoredResult // results of the queries executed, in order
+	Proposed int                   // SQL queries the LLM asked to execute, including ones not run
+}
+
+// Ask answers a single question with one agent turn and no interactive prompt. Progress
+// and diagnostics are printed as in the interactive session; the answer and the query
+// results are returned for the caller to write out.
+func (s *Session) Ask(ctx context.Context, question, approval string) (*AskResult, error) {
+	if !slices.Contains(ApprovalPolicies, approval) {
+		return nil, fmt.Errorf("invalid approval policy: %s (must be: %s)", approval, strings.Join(ApprovalPolicies, ", "))
+	}
+	s.approval = approval
+
+	if approval == ApprovePrompt {
+		// Prompt on the session's output, which the caller keeps apart from the results
+		rl, err := readline.NewEx(&readline.Config{Stdout: s.out, Stderr: s.out})
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize prompt: %w", err)
+		}
+		defer rl.Close()
+		s.rl = rl
+	}
+
+	s.initializeAgent(ctx)
+	if !s.agentReady {
+		return nil, errors.New("LLM agent not available: set the ANTHROPIC_API_KEY environment variable")
+	}
+
+	answer, err := s.sendMessage(ctx, question)
+	if err != nil {
+		return nil, err
+	}
+	return &AskResult{Answer: answer, Results: s.execOptions.Results.List(), Proposed: s.proposed}, nil
+}
@@ -0,0 +1,135 @@
+package chat
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/AliciaSchep/pgbabble/pkg/agent"
+	"github.com/AliciaSchep/pgbabble/pkg/display"
+	"github.com/chzyer/readline"
+)
+
+// Step is one line of a script: a natural-language prompt or a slash command
+type Step struct {
+	Number int // steps are numbered from 1, skipping blank and comment lines
+	Line   int // line in the script
+	Text   string
+}
+
+// ParseScript reads a script of prompts and slash commands, one per line. Blank lines and
+// lines starting with # are skipped.
+func ParseScript(r io.Reader) ([]Step, error) {
+	var steps []Step
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		steps = append(steps, Step{Number: len(steps) + 1, Line: line, Text: text})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+	return steps, nil
+}
+
+// RunScript runs the steps in order as the interactive session would, approving proposed
+// queries by the approval policy. The results of each step's queries are saved as CSV files
+// in outputDir, named after the step: step-003.csv, then step-003-2.csv and so on when a
+// step runs more than one query. The run stops at the first step that fails or at /quit.
+func (s *Session) RunScript(ctx context.Context, steps []Step, approval, outputDir string) error {
+	if !slices.Contains(ApprovalPolicies, approval) {
+		return fmt.Errorf("invalid approval policy: %s (must be: %s)", approval, strings.Join(ApprovalPolicies, ", "))
+	}
+	s.approval = approval
+
+	if approval == ApprovePrompt {
+		rl, err := readline.NewEx(&readline.Config{})
+		if err != nil {
+			return fmt.Errorf("failed to initialize prompt: %w", err)
+		}
+		defer rl.Close()
+		s.rl = rl
+	}
+
+	for _, step := range steps {
+		if !strings.HasPrefix(step.Text, "/") {
+			s.initializeAgent(ctx)
+			break
+		}
+	}
+
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "▶️  Step %d: %s\n", step.Number, step.Text)
+
+		// Collect the step's results as they are added; the store itself only keeps the
+		// last few, which a step with many queries could exceed
+		stepResults := s.execOptions.Results.Record()
+		stop, err := s.runStep(ctx, step.Text)
+		results := stepResults()
+		if err != nil {
+			return fmt.Errorf("step %d (line %d) failed: %w", step.Number, step.Line, err)
+		}
+		if err := s.saveStepResults(step, results, outputDir); err != nil {
+			return err
+		}
+		if stop {
+			break
+		}
+	}
+	return nil
+}
+
+// runStep runs a prompt or slash command and reports whether the script should stop
+func (s *Session) runStep(ctx context.Context, text string) (bool, error) {
+	if strings.HasPrefix(text, "/") {
+		switch strings.Fields(text)[0] {
+		case "/quit", "/exit", "/q":
+			return true, nil
+		}
+		return false, s.handleCommand(ctx, text)
+	}
+
+	if !s.agentReady {
+		return false, errors.New("LLM agent not available: set the ANTHROPIC_API_KEY environment variable")
+	}
+	response, err := s.sendMessage(ctx, text)
+	if err != nil {
+		return false, err
+	}
+	s.printResponse(response)
+	return false, nil
+}
+
+// saveStepResults writes a step's results to CSV files named after the step
+func (s *Session) saveStepResults(step Step, results []*agent.StoredResult, outputDir string) error {
+	for i, r := range results {
+		name := fmt.Sprintf("step-%03d.csv", step.Number)
+		if i > 0 {
+			name = fmt.Sprintf("step-%03d-%d.csv", step.Number, i+1)
+		}
+		if err := os.MkdirAll(outputDir, 0o755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+		path := filepath.Join(outputDir, name)
+		if err := display.SaveCSV(r.ColumnNames, r.Rows, path); err != nil {
+			return fmt.Errorf("step %d: %w", step.Number, err)
+		}
+		fmt.Fprintf(s.out, "💾 Step %d: result #%d (%d rows) saved to %s\n\n", step.Number, r.ID, len(r.Rows), path)
+	}
+	return nil
+}
@@ -4,27 +4,46 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/AliciaSchep/pgbabble/pkg/agent"
+	"github.com/AliciaSchep/pgbabble/pkg/audit"
 	"github.com/AliciaSchep/pgbabble/pkg/db"
 	"github.com/AliciaSchep/pgbabble/pkg/display"
 	pkgerrors "github.com/AliciaSchep/pgbabble/pkg/errors"
+	"github.com/AliciaSchep/pgbabble/pkg/history"
+	"github.com/AliciaSchep/pgbabble/pkg/library"
 	"github.com/chzyer/readline"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 // Session represents an interactive chat session
 type Session struct {
-	conn       db.Connection
-	mode       string
-	model      string
-	rl         *readline.Instance
-	agent      *agent.Agent
-	agentReady bool
+	conn        db.Connection
+	mode        string
+	model       string
+	execOptions agent.ExecutionOptions
+	pseudonyms  *db.Pseudonyms
+	toolConn    db.Connection // connection used by the LLM tools
+	audit       *audit.Logger
+	library     *library.Library
+	rl          *readline.Instance
+	agent       *agent.Agent
+	agentReady  bool
+	out         io.Writer // progress, results and messages for the user
+
+	// One-shot questions (Ask)
+	approval string // how proposed queries are approved; empty means ask at the interactive prompt
+	proposed int    // SQL queries the LLM asked to execute
 
 	// Signal handling for operation cancellation
 	currentOpCancel context.CancelFunc
@@ -34,20 +53,56 @@ type Session struct {
 // NewSession creates a new chat session
 func NewSession(conn db.Connection, mode string, model string) *Session {
 	return &Session{
-		conn:       conn,
-		mode:       mode,
-		model:      model,
-		agentReady: false,
+		conn:        conn,
+		mode:        mode,
+		model:       model,
+		execOptions: agent.ExecutionOptions{Results: agent.NewResultStore(agent.DefaultResultHistory), Output: os.Stdout},
+		agentReady:  false,
+		out:         os.Stdout,
 	}
 }
 
+// SetOutput sets where the session prints progress, results and messages for the user,
+// stdout by default; call before Start
+func (s *Session) SetOutput(w io.Writer) {
+	s.out = w
+	s.execOptions.Output = w
+}
+
+// SetExecutionOptions configures the SQL execution tools; call before Start. The session's
+// result store and output are kept unless opts sets them.
+func (s *Session) SetExecutionOptions(opts agent.ExecutionOptions) {
+	if opts.Results == nil {
+		opts.Results = s.execOptions.Results
+	}
+	if opts.Output == nil {
+		opts.Output = s.out
+	}
+	s.execOptions = opts
+}
+
+// SetPseudonyms hides schema, table and column names from the LLM behind pseudonyms; call before Start
+func (s *Session) SetPseudonyms(p *db.Pseudonyms) {
+	s.pseudonyms = p
+}
+
+// SetAuditLog records LLM traffic, query decisions and mode changes; call before Start
+func (s *Session) SetAuditLog(l *audit.Logger) {
+	s.audit = l
+}
+
+// SetQueryLibrary enables /savequery, /queries and /run with a saved query library; call before Start
+func (s *Session) SetQueryLibrary(l *library.Library) {
+	s.library = l
+}
+
 // Start begins the interactive chat session
 func (s *Session) Start(ctx context.Context) error {
 	// Set up signal handling for operation cancellation
 	s.setupSignalHandling()
 	// Configure readline
 	rl, err := readline.NewEx(&readline.Config{
-		Prompt:      "pgbabble> ",
+		Prompt:      s.prompt(),
 		HistoryFile: os.ExpandEnv("$HOME/.pgbabble_history"),
 	})
 	if err != nil {
@@ -55,14 +110,14 @@ func (s *Session) Start(ctx context.Context) error {
 	}
 	defer func() {
 		if err := rl.Close(); err != nil {
-			pkgerrors.ConnectionWarning("failed to close readline: %v", err)
+			pkgerrors.To(s.out).ConnectionWarning("failed to close readline: %v", err)
 		}
 	}()
 
 	s.rl = rl
 
 	// Initialize agent if API key is available
-	s.initializeAgent()
+	s.initializeAgent(ctx)
 
 	// Main chat loop
 	for {
@@ -88,7 +143,7 @@ func (s *Session) Start(ctx context.Context) error {
 			// Create a context that can be cancelled by Ctrl+C
 			cmdCtx := s.createOperationContext(ctx)
 			if err := s.handleCommand(cmdCtx, line); err != nil {
-				pkgerrors.UserError("%v", err)
+				pkgerrors.To(s.out).UserError("%v", err)
 			}
 			s.clearCurrentOperation()
 			continue
@@ -98,12 +153,12 @@ func (s *Session) Start(ctx context.Context) error {
 		// Create a context that can be cancelled by Ctrl+C
 		queryCtx := s.createOperationContext(ctx)
 		if err := s.handleQuery(queryCtx, line); err != nil {
-			pkgerrors.UserError("%v", err)
+			pkgerrors.To(s.out).UserError("%v", err)
 		}
 		s.clearCurrentOperation()
 	}
 
-	fmt.Println("Goodbye!")
+	fmt.Fprintln(s.out, "Goodbye!")
 	return nil
 }
 
@@ -185,39 +240,89 @@ func (s *Session) handleCommand(ctx context.Context, cmd string) error {
 		return s.describeTable(ctx, parts[1])
 
 	case "/mode", "/m":
-		fmt.Printf("Current mode: %s\n", s.mode)
-		switch s.mode {
-		case "default":
-			fmt.Println("Default mode: EXPLAIN sharing allowed, table size info shared, query row counts shared, but no actual query result data")
-		case "schema-only":
-			fmt.Println("Schema-only mode: No EXPLAIN sharing, no table size info, no query result data - maximum privacy")
-		case "share-results":
-			fmt.Println("Share-results mode: Full data sharing including EXPLAIN results, table sizes, and actual query result data")
-		}
-		fmt.Println()
-		fmt.Println("💡 To change modes, exit pgbabble and restart with the --mode flag:")
-		fmt.Println("   pgbabble --mode schema-only <connection>")
-		fmt.Println("   pgbabble --mode share-results <connection>")
+		if len(parts) > 1 {
+			return s.switchMode(parts[1])
+		}
+		fmt.Fprintf(s.out, "Current mode: %s\n", s.mode)
+		s.describeMode(s.mode)
+		fmt.Fprintln(s.out)
+		fmt.Fprintf(s.out, "💡 To change modes, use /mode <mode> with one of: %s\n", strings.Join(agent.Modes, ", "))
 		return nil
 
 	case "/clear", "/c":
 		if s.agentReady {
 			s.agent.ClearConversation()
-			fmt.Println("🧹 Conversation history cleared")
+			s.execOptions.Corrections.Reset()
+			fmt.Fprintln(s.out, "🧹 Conversation history cleared")
 		} else {
-			fmt.Println("ℹ️  No conversation to clear")
+			fmt.Fprintln(s.out, "ℹ️  No conversation to clear")
 		}
 		return nil
 
 	case "/save":
-		var filename string
-		if len(parts) > 1 {
-			filename = parts[1]
+		// /save [--format csv|json|ndjson|parquet] [id] [filename]; a single argument that is not
+		// a number is a filename
+		format, args, err := parseSaveFormat(parts[1:])
+		if err != nil {
+			return err
+		}
+		var id, filename string
+		if len(args) > 0 && isResultID(args[0]) {
+			id, args = args[0], args[1:]
 		}
-		return s.saveLastResults(ctx, filename)
+		if len(args) > 0 {
+			filename = args[0]
+		}
+		return s.saveResults(ctx, id, filename, format)
 
 	case "/browse", "/b":
-		return s.browseLastResults(ctx)
+		var id string
+		if len(parts) > 1 {
+			id = parts[1]
+		}
+		return s.browseResults(ctx, id)
+
+	case "/results", "/r":
+		s.listResults()
+		return nil
+
+	case "/history":
+		if len(parts) > 1 && parts[1] == "search" {
+			text := strings.Join(parts[2:], " ")
+			if text == "" {
+				return fmt.Errorf("usage: /history search <text>")
+			}
+			s.showHistory(s.execOptions.History.Search(text), fmt.Sprintf("matching %q", text))
+			return nil
+		}
+		s.showHistory(s.execOptions.History.Recent(historyListSize), "")
+		return nil
+
+	case "/replay":
+		if len(parts) < 2 {
+			return fmt.Errorf("usage: /replay <id>")
+		}
+		return s.replayQuery(ctx, parts[1])
+
+	case "/savequery":
+		if len(parts) != 2 {
+			return fmt.Errorf("usage: /savequery <name>")
+		}
+		return s.saveQuery(parts[1])
+
+	case "/queries":
+		s.listQueries()
+		return nil
+
+	case "/run":
+		if len(parts) < 2 {
+			return fmt.Errorf("usage: /run <name> [key=value ...]")
+		}
+		args := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cmd), parts[0]))
+		return s.runSavedQuery(ctx, parts[1], strings.TrimSpace(strings.TrimPrefix(args, parts[1])))
+
+	case "/optimize":
+		return s.optimizeQuery(ctx, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cmd), parts[0])))
 
 	default:
 		return fmt.Errorf("unknown command: %s (type /help for available commands)", parts[0])
@@ -226,115 +331,289 @@ func (s *Session) handleCommand(ctx context.Context, cmd string) error {
 	return nil
 }
 
+// describeMode prints what a mode shares with the LLM
+func (s *Session) describeMode(mode string) {
+	switch mode {
+	case "default":
+		fmt.Fprintln(s.out, "Default mode: EXPLAIN sharing allowed, table size info shared, query row counts shared, but no actual query result data")
+	case "schema-only":
+		fmt.Fprintln(s.out, "Schema-only mode: No EXPLAIN sharing, no table size info, no query result data - maximum privacy")
+	case "aggregate-only":
+		fmt.Fprintln(s.out, "Aggregate-only mode: EXPLAIN and table size info shared; only aggregated query results with a count(*) per group are shared, and groups below the minimum size are suppressed")
+	case "share-results":
+		fmt.Fprintln(s.out, "Share-results mode: Full data sharing including EXPLAIN results, table sizes, and actual query result data")
+	}
+}
+
+// switchMode changes the privacy mode for the rest of the session. Switching to a mode
+// that shares more data with the LLM needs confirmation and only applies to new queries.
+func (s *Session) switchMode(mode string) error {
+	if !agent.IsValidMode(mode) {
+		return fmt.Errorf("invalid mode: %s (must be: %s)", mode, strings.Join(agent.Modes, ", "))
+	}
+	if mode == s.mode {
+		fmt.Fprintf(s.out, "Already in %s mode\n", mode)
+		return nil
+	}
+
+	previous := s.mode
+	if agent.SharesMoreThan(mode, previous) {
+		fmt.Fprintf(s.out, "⚠️  %s mode shares more data with the LLM than %s mode:\n", mode, previous)
+		s.describeMode(mode)
+		fmt.Fprintln(s.out, "Results of earlier queries will not be shared.")
+		if !s.confirm(fmt.Sprintf("Switch to %s mode? (y/yes/n/no): ", mode)) {
+			fmt.Fprintf(s.out, "Mode unchanged: %s\n", previous)
+			return nil
+		}
+	}
+
+	s.mode = mode
+	s.audit.Record(audit.Event{Type: audit.EventModeChange, Mode: mode, PreviousMode: previous})
+	if s.agentReady {
+		s.agent.SetMode(mode, s.buildTools())
+	}
+	if s.rl != nil {
+		s.rl.SetPrompt(s.prompt())
+	}
+
+	fmt.Fprintf(s.out, "✅ Switched from %s to %s mode\n", previous, mode)
+	if agent.SharesMoreThan(previous, mode) {
+		fmt.Fprintln(s.out, "💡 Anything already shared earlier in this conversation stays in its history; use /clear to drop it")
+	}
+	return nil
+}
+
 // handleQuery processes natural language queries using the LLM agent
 func (s *Session) handleQuery(ctx context.Context, query string) error {
 	if !s.agentReady {
-		fmt.Println("❌ LLM agent not available")
-		fmt.Println("💡 To enable AI features, set your ANTHROPIC_API_KEY environment variable")
-		fmt.Println("   You can get an API key from https://console.anthropic.com/")
-		fmt.Println()
-		fmt.Println("🔍 In the meantime, you can explore the database using:")
-		fmt.Println("   /schema   - View database schema")
-		fmt.Println("   /tables   - List all tables")
-		fmt.Println("   /describe <table> - Describe a specific table")
+		fmt.Fprintln(s.out, "❌ LLM agent not available")
+		fmt.Fprintln(s.out, "💡 To enable AI features, set your ANTHROPIC_API_KEY environment variable")
+		fmt.Fprintln(s.out, "   You can get an API key from https://console.anthropic.com/")
+		fmt.Fprintln(s.out)
+		fmt.Fprintln(s.out, "🔍 In the meantime, you can explore the database using:")
+		fmt.Fprintln(s.out, "   /schema   - View database schema")
+		fmt.Fprintln(s.out, "   /tables   - List all tables")
+		fmt.Fprintln(s.out, "   /describe <table> - Describe a specific table")
 		return nil
 	}
 
-	fmt.Printf("🤔 Processing: %s\n", query)
-	fmt.Println()
+	fmt.Fprintf(s.out, "🤔 Processing: %s\n", query)
+	fmt.Fprintln(s.out)
 
-	// Send query to LLM agent
-	response, err := s.agent.SendMessage(ctx, query)
+	response, err := s.sendMessage(ctx, query)
 	if err != nil {
 		// Check if this was a user cancellation (Ctrl+C)
 		if errors.Is(err, context.Canceled) || ctx.Err() == context.Canceled {
-			fmt.Println("⏹️  Query cancelled by user")
+			fmt.Fprintln(s.out, "⏹️  Query cancelled by user")
 			return nil
 		}
 		// Other API errors
-		pkgerrors.APIError("AI service", err)
+		pkgerrors.To(s.out).APIError("AI service", err)
 		return nil
 	}
 
-	// Display the response
-	fmt.Println("🤖 AI Response:")
-	fmt.Println(strings.Repeat("=", 50))
-	fmt.Println(response)
-	fmt.Println()
-
+	s.printResponse(response)
 	return nil
 }
 
+// sendMessage starts a new user turn and sends the message to the LLM agent. Queries
+// proposed during the turn are recorded in the history with the message as their question,
+// and a correction left pending by an earlier turn no longer applies.
+func (s *Session) sendMessage(ctx context.Context, message string) (string, error) {
+	s.execOptions.History.StartQuestion(message)
+	s.execOptions.Corrections.Reset()
+	return s.agent.SendMessage(ctx, message)
+}
+
+// printResponse displays the LLM's answer
+func (s *Session) printResponse(response string) {
+	fmt.Fprintln(s.out, "🤖 AI Response:")
+	fmt.Fprintln(s.out, strings.Repeat("=", 50))
+	fmt.Fprintln(s.out, response)
+	fmt.Fprintln(s.out)
+}
+
 // initializeAgent sets up the LLM agent with schema tools
-func (s *Session) initializeAgent() {
+func (s *Session) initializeAgent(ctx context.Context) {
 	agentClient, err := agent.NewAgent("", s.mode, s.model)
 	if err != nil {
-		pkgerrors.UserInfo("LLM features not available: %v", err)
-		fmt.Println("   Set ANTHROPIC_API_KEY environment variable to enable AI features")
-		fmt.Println()
+		pkgerrors.To(s.out).UserInfo("LLM features not available: %v", err)
+		fmt.Fprintln(s.out, "   Set ANTHROPIC_API_KEY environment variable to enable AI features")
+		fmt.Fprintln(s.out)
 		return
 	}
 
-	// Add schema inspection tools
-	schemaTools := agent.CreateSchemaTools(s.conn, s.mode)
-	for _, tool := range schemaTools {
-		toolDef := agent.ConvertToolToDefinition(tool)
-		agentClient.AddTool(toolDef)
+	// Tools see the real names; the agent swaps them for pseudonyms in what it sends to the LLM
+	toolConn := s.conn
+	if s.pseudonyms != nil {
+		if err := s.pseudonyms.Load(ctx, s.conn); err != nil {
+			pkgerrors.To(s.out).UserError("LLM features not available: failed to load identifiers to pseudonymize: %v", err)
+			fmt.Fprintln(s.out)
+			return
+		}
+		toolConn = db.NewPseudonymConnection(s.conn, s.pseudonyms)
+		agentClient.SetPseudonyms(s.pseudonyms)
 	}
 
-	// Add SQL execution tools with user approval callback
-	executionTools := agent.CreateExecutionTools(s.conn, s.getUserApproval, s.mode)
-	for _, tool := range executionTools {
-		toolDef := agent.ConvertToolToDefinition(tool)
+	s.toolConn = toolConn
+	agentClient.SetOutput(s.out)
+	agentClient.SetAuditLog(s.audit)
+	for _, toolDef := range s.buildTools() {
 		agentClient.AddTool(toolDef)
 	}
 
+	// Tell the agent up front which objects the connected role can read
+	if tables, err := s.conn.ListTables(ctx); err == nil {
+		agentClient.SetDatabaseContext(agent.SummarizeTableAccess(tables))
+	} else {
+		pkgerrors.To(s.out).ConnectionWarning("failed to check table privileges: %v", err)
+	}
+
 	s.agent = agentClient
 	s.agentReady = true
-	fmt.Println("✅ AI assistant ready with database schema tools!")
-	fmt.Println("💡 I can inspect your database structure and generate custom SQL queries")
-	fmt.Println()
+	fmt.Fprintln(s.out, "✅ AI assistant ready with database schema tools!")
+	fmt.Fprintln(s.out, "💡 I can inspect your database structure and generate custom SQL queries")
+	fmt.Fprintln(s.out)
+}
+
+// buildTools creates the schema and SQL execution tools for the current mode
+func (s *Session) buildTools() []agent.ToolDefinition {
+	var tools []agent.ToolDefinition
+	opts := s.execOptions
+	opts.Audit = s.audit
+	opts.ConfirmShare = s.getShareApproval
+
+	// Add schema inspection tools
+	for _, tool := range agent.CreateSchemaTools(s.toolConn, s.mode, opts.Masker) {
+		tools = append(tools, agent.ConvertToolToDefinition(tool))
+	}
+
+	// Add SQL execution tools with user approval callback
+	for _, tool := range agent.CreateExecutionTools(s.toolConn, s.getUserApproval, s.mode, opts) {
+		tools = append(tools, agent.ConvertToolToDefinition(tool))
+	}
+	return tools
 }
 
+// prompt returns the readline prompt, which shows the current mode
+func (s *Session) prompt() string {
+	return fmt.Sprintf("pgbabble [%s]> ", s.mode)
+}
+
+// approvalRequest describes something the user is asked to approve
+type approvalRequest struct {
+	heading  string
+	question string
+	declined string // shown when the approval policy declines without asking
+	// readOnly is set for requests that only read the database, which --approve=auto-readonly
+	// approves because the connection cannot change anything
+	readOnly bool
+}
+
+var (
+	queryApproval = approvalRequest{
+		heading:  "🔍 SQL Query Ready for Execution:",
+		question: "Execute this query? (y/yes/n/no): ",
+		declined: "Not executed",
+		readOnly: true,
+	}
+	// Sharing sends data that was already fetched off this machine. A read-only connection
+	// says nothing about where the data may go, so only a person may approve it.
+	shareApproval = approvalRequest{
+		heading:  "📤 Values Ready to Share with the LLM:",
+		question: "Send these values to the LLM? (y/yes/n/no): ",
+		declined: "Not shared",
+	}
+)
+
 // getUserApproval prompts the user to approve a SQL query execution
 func (s *Session) getUserApproval(queryInfo string) bool {
-	fmt.Println("\n🔍 SQL Query Ready for Execution:")
-	fmt.Println(strings.Repeat("=", 50))
-	fmt.Println(queryInfo)
-	fmt.Println(strings.Repeat("=", 50))
+	s.proposed++
+	return s.requestApproval(queryApproval, queryInfo)
+}
+
+// requestApproval shows what is to be approved and applies the approval policy, asking
+// on the terminal unless the policy decides
+func (s *Session) requestApproval(req approvalRequest, info string) bool {
+	fmt.Fprintln(s.out, "\n"+req.heading)
+	fmt.Fprintln(s.out, strings.Repeat("=", 50))
+	fmt.Fprintln(s.out, info)
+	fmt.Fprintln(s.out, strings.Repeat("=", 50))
+
+	switch {
+	case s.approval == ApproveAutoReadOnly && req.readOnly:
+		fmt.Fprintln(s.out, "✅ Approved automatically (read-only connection)")
+		return true
+	case s.approval == ApproveAutoReadOnly || s.approval == ApproveNever:
+		fmt.Fprintf(s.out, "⏭️  %s (--approve=%s)\n", req.declined, s.approval)
+		return false
+	}
+
+	return s.confirm(req.question)
+}
+
+// approveCommandQuery decides whether a query run by a slash command may execute. Typed at
+// the interactive prompt the command is the approval; in a script the query follows the
+// approval policy like the queries the LLM proposes.
+func (s *Session) approveCommandQuery(queryInfo string) bool {
+	if s.approval == "" {
+		return true
+	}
+	return s.getUserApproval(queryInfo)
+}
+
+// getShareApproval asks the user whether sampled values may be sent to the LLM. The
+// values were already fetched; declining keeps them on this machine.
+func (s *Session) getShareApproval(preview string) bool {
+	return s.requestApproval(shareApproval, preview)
+}
+
+// confirm asks a yes/no question; anything other than y/yes (or no terminal) is a no
+func (s *Session) confirm(question string) bool {
+	if s.rl == nil {
+		return false
+	}
 
 	// Change the readline prompt temporarily for this question
-	s.rl.SetPrompt("Execute this query? (y/yes/n/no): ")
+	s.rl.SetPrompt(question)
 
 	response, err := s.rl.Readline()
+
+	// Reset prompt back to normal
+	s.rl.SetPrompt(s.prompt())
+
 	if err != nil {
-		pkgerrors.UserError("error reading input: %v", err)
-		// Reset prompt back to normal
-		s.rl.SetPrompt("pgbabble> ")
+		pkgerrors.To(s.out).UserError("error reading input: %v", err)
 		return false
 	}
 
-	// Reset prompt back to normal
-	s.rl.SetPrompt("pgbabble> ")
-
 	response = strings.ToLower(strings.TrimSpace(response))
 	return response == "y" || response == "yes"
 }
 
 // showHelp displays available commands
 func (s *Session) showHelp() {
-	fmt.Println("Available commands:")
-	fmt.Println("  /help, /h          Show this help message")
-	fmt.Println("  /quit, /exit, /q   Exit pgbabble")
-	fmt.Println("  /schema, /s        Show database schema overview")
-	fmt.Println("  /tables, /t        List all tables and views")
-	fmt.Println("  /describe <table>  Describe a specific table")
-	fmt.Println("  /mode, /m          Show current data exposure mode")
-	fmt.Println("  /clear, /c         Clear conversation history")
-	fmt.Println("  /save [filename]   Save last query results to CSV file")
-	fmt.Println("  /browse, /b        Browse last query results in less pager")
-	fmt.Println()
-	fmt.Println("Or just type a natural language question about your data!")
+	fmt.Fprintln(s.out, "Available commands:")
+	fmt.Fprintln(s.out, "  /help, /h          Show this help message")
+	fmt.Fprintln(s.out, "  /quit, /exit, /q   Exit pgbabble")
+	fmt.Fprintln(s.out, "  /schema, /s        Show database schema overview")
+	fmt.Fprintln(s.out, "  /tables, /t        List all tables and views")
+	fmt.Fprintln(s.out, "  /describe <table>  Describe a specific table")
+	fmt.Fprintln(s.out, "  /mode, /m [mode]   Show or switch the data exposure mode")
+	fmt.Fprintln(s.out, "  /clear, /c         Clear conversation history")
+	fmt.Fprintln(s.out, "  /results, /r       List recent query results with their ids")
+	fmt.Fprintln(s.out, "  /save [id] [file]  Save query results to a file (default: last result, as CSV)")
+	fmt.Fprintln(s.out, "  /save --format csv|json|ndjson|parquet [id] [file]  Save in another format (also chosen by the file extension)")
+	fmt.Fprintln(s.out, "  /browse, /b [id]   Browse query results in less pager (default: last result)")
+	fmt.Fprintln(s.out, "  /history           Show recently executed and proposed queries")
+	fmt.Fprintln(s.out, "  /history search <text>  Search past questions and queries")
+	fmt.Fprintln(s.out, "  /replay <id>       Re-run a query from the history without the LLM")
+	fmt.Fprintln(s.out, "  /savequery <name>  Save the last executed query to the query library")
+	fmt.Fprintln(s.out, "  /queries           List saved queries")
+	fmt.Fprintln(s.out, "  /run <name> [key=value ...]  Run a saved query with parameter values")
+	fmt.Fprintln(s.out, "  /optimize [sql]    Suggest indexes for a query (default: the last query run)")
+	fmt.Fprintln(s.out)
+	fmt.Fprintln(s.out, "Or just type a natural language question about your data!")
 }
 
 // showSchema displays a database schema overview
@@ -345,12 +624,12 @@ func (s *Session) showSchema(ctx context.Context) error {
 	}
 
 	if len(tables) == 0 {
-		fmt.Println("No tables found in the database.")
+		fmt.Fprintln(s.out, "No tables found in the database.")
 		return nil
 	}
 
-	fmt.Println("Database Schema Overview:")
-	fmt.Println("========================")
+	fmt.Fprintln(s.out, "Database Schema Overview:")
+	fmt.Fprintln(s.out, "========================")
 
 	// Group by schema
 	schemaMap := make(map[string][]db.TableInfo)
@@ -359,11 +638,11 @@ func (s *Session) showSchema(ctx context.Context) error {
 	}
 
 	for schema, schemaTables := range schemaMap {
-		fmt.Printf("\nSchema: %s\n", schema)
-		fmt.Println(strings.Repeat("-", len(schema)+8))
+		fmt.Fprintf(s.out, "\nSchema: %s\n", schema)
+		fmt.Fprintln(s.out, strings.Repeat("-", len(schema)+8))
 
 		for _, table := range schemaTables {
-			fmt.Printf("  %s (%s)\n", table.Name, table.Type)
+			fmt.Fprintf(s.out, "  %s (%s)\n", table.Name, table.Type)
 		}
 	}
 
@@ -378,15 +657,15 @@ func (s *Session) listTables(ctx context.Context) error {
 	}
 
 	if len(tables) == 0 {
-		fmt.Println("No tables found in the database.")
+		fmt.Fprintln(s.out, "No tables found in the database.")
 		return nil
 	}
 
-	fmt.Println("Tables and Views:")
-	fmt.Println("=================")
+	fmt.Fprintln(s.out, "Tables and Views:")
+	fmt.Fprintln(s.out, "=================")
 
 	for _, table := range tables {
-		fmt.Printf("%-20s %-10s %s\n", table.Name, table.Type, table.Schema)
+		fmt.Fprintf(s.out, "%-20s %-10s %s\n", table.Name, table.Type, table.Schema)
 	}
 
 	return nil
@@ -394,14 +673,10 @@ func (s *Session) listTables(ctx context.Context) error {
 
 // describeTable shows detailed information about a table
 func (s *Session) describeTable(ctx context.Context, tableName string) error {
-	// Parse schema.table if provided
-	schema := "public"
-	if strings.Contains(tableName, ".") {
-		parts := strings.Split(tableName, ".")
-		if len(parts) == 2 {
-			schema = parts[0]
-			tableName = parts[1]
-		}
+	// Resolve schema.table against the search_path
+	schema, tableName, err := s.conn.ResolveTableName(ctx, tableName)
+	if err != nil {
+		return fmt.Errorf("failed to describe table: %w", err)
 	}
 
 	table, err := s.conn.DescribeTable(ctx, schema, tableName)
@@ -409,21 +684,30 @@ func (s *Session) describeTable(ctx context.Context, tableName string) error {
 		return fmt.Errorf("failed to describe table: %w", err)
 	}
 
-	fmt.Printf("Table: %s.%s (%s)\n", table.Schema, table.Name, table.Type)
+	fmt.Fprintf(s.out, "Table: %s.%s (%s)\n", table.Schema, table.Name, table.Type)
 	if table.Description != "" {
-		fmt.Printf("Description: %s\n", table.Description)
+		fmt.Fprintf(s.out, "Description: %s\n", table.Description)
 	}
-	fmt.Println()
+	switch table.Access {
+	case db.AccessNone:
+		fmt.Fprintln(s.out, "Access: no SELECT privilege")
+	case db.AccessPartial:
+		fmt.Fprintln(s.out, "Access: only some columns can be selected")
+	}
+	if table.RowSecurity {
+		fmt.Fprintf(s.out, "Row-level security: enabled (%d policies)\n", len(table.Policies))
+	}
+	fmt.Fprintln(s.out)
 
 	if len(table.Columns) == 0 {
-		fmt.Println("No columns found.")
+		fmt.Fprintln(s.out, "No columns found.")
 		return nil
 	}
 
-	fmt.Println("Columns:")
-	fmt.Println("========")
-	fmt.Printf("%-20s %-15s %-8s %-8s %s\n", "Name", "Type", "Nullable", "Key", "Default")
-	fmt.Println(strings.Repeat("-", 70))
+	fmt.Fprintln(s.out, "Columns:")
+	fmt.Fprintln(s.out, "========")
+	fmt.Fprintf(s.out, "%-20s %-15s %-8s %-8s %s\n", "Name", "Type", "Nullable", "Key", "Default")
+	fmt.Fprintln(s.out, strings.Repeat("-", 70))
 
 	for _, col := range table.Columns {
 		nullable := "YES"
@@ -441,7 +725,7 @@ func (s *Session) describeTable(ctx context.Context, tableName string) error {
 			defaultVal = "(none)"
 		}
 
-		fmt.Printf("%-20s %-15s %-8s %-8s %s\n",
+		fmt.Fprintf(s.out, "%-20s %-15s %-8s %-8s %s\n",
 			col.Name, col.DataType, nullable, key, defaultVal)
 	}
 
@@ -452,10 +736,10 @@ func (s *Session) describeTable(ctx context.Context, tableName string) error {
 	}
 
 	if len(foreignKeys) > 0 {
-		fmt.Println("\nForeign Keys:")
-		fmt.Println("=============")
+		fmt.Fprintln(s.out, "\nForeign Keys:")
+		fmt.Fprintln(s.out, "=============")
 		for _, fk := range foreignKeys {
-			fmt.Printf("%s -> %s.%s.%s\n",
+			fmt.Fprintf(s.out, "%s -> %s.%s.%s\n",
 				fk.ColumnName, fk.ForeignTableSchema, fk.ForeignTableName, fk.ForeignColumnName)
 		}
 	}
@@ -463,68 +747,417 @@ func (s *Session) describeTable(ctx context.Context, tableName string) error {
 	return nil
 }
 
-// browseLastResults opens the last query results in less for browsing
-func (s *Session) browseLastResults(ctx context.Context) error {
-	if agent.LastQueryResult == nil {
-		fmt.Println("❌ No query results available to browse")
-		fmt.Println("💡 Run a query first, then use /browse to view all results")
+// result finds a stored result by the id given to a command, or the most recent one when
+// arg is empty. It prints why nothing was found and returns nil in that case.
+func (s *Session) result(arg, command string) *agent.StoredResult {
+	results := s.execOptions.Results
+	if arg == "" {
+		last := results.Last()
+		if last == nil {
+			fmt.Fprintln(s.out, "❌ No query results available")
+			fmt.Fprintf(s.out, "💡 Run a query first, then use %s\n", command)
+		}
+		return last
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	if err != nil {
+		fmt.Fprintf(s.out, "❌ Invalid result id: %s\n", arg)
+		return nil
+	}
+	r, ok := results.Get(id)
+	if !ok {
+		fmt.Fprintf(s.out, "❌ No result #%d\n", id)
+		fmt.Fprintln(s.out, "💡 Use /results to list the available results")
 		return nil
 	}
+	return r
+}
+
+// isResultID reports whether a command argument is a result id rather than a filename
+func isResultID(arg string) bool {
+	_, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	return err == nil
+}
+
+// listResults prints the stored query results
+func (s *Session) listResults() {
+	results := s.execOptions.Results.List()
+	if len(results) == 0 {
+		fmt.Fprintln(s.out, "No query results yet")
+		return
+	}
 
-	if len(agent.LastQueryResult.AllRows) == 0 {
-		fmt.Println("❌ Last query returned no results to browse")
+	fmt.Fprintln(s.out, "Query results:")
+	for _, r := range results {
+		rows := fmt.Sprintf("%d rows", len(r.Rows))
+		if r.Truncated {
+			rows += "+"
+		}
+		fmt.Fprintf(s.out, "  #%-3d %s  %-11s %-10v %s\n", r.ID, r.ExecutedAt.Format("15:04:05"), rows,
+			r.Duration.Round(time.Millisecond), truncateSQL(r.SQL, 60))
+	}
+	fmt.Fprintln(s.out, "💡 Use /browse <id> or /save <id> [filename] to open or export a result")
+}
+
+// truncateSQL shortens a query to one line for listings
+func truncateSQL(sql string, maxLen int) string {
+	sql = strings.Join(strings.Fields(sql), " ")
+	if len([]rune(sql)) <= maxLen {
+		return sql
+	}
+	return string([]rune(sql)[:maxLen-3]) + "..."
+}
+
+// browseResults opens a query result, by default the last one, in less for browsing
+func (s *Session) browseResults(ctx context.Context, id string) error {
+	r := s.result(id, "/browse to view all results")
+	if r == nil {
+		return nil
+	}
+
+	if len(r.Rows) == 0 {
+		fmt.Fprintf(s.out, "❌ Result #%d has no rows to browse\n", r.ID)
 		return nil
 	}
 
 	// Check if less is available
 	if !display.CheckLessAvailable() {
-		fmt.Println("❌ 'less' command not found on this system")
-		fmt.Println("💡 All available results are already shown above")
+		fmt.Fprintln(s.out, "❌ 'less' command not found on this system")
+		fmt.Fprintln(s.out, "💡 All available results are already shown above")
 		return nil
 	}
 
 	// Generate the full table content
-	title := fmt.Sprintf("Query Results (%d rows)", len(agent.LastQueryResult.AllRows))
+	title := fmt.Sprintf("Query Results #%d (%d rows)", r.ID, len(r.Rows))
 	content := display.GenerateFullTableContent(
-		agent.LastQueryResult.ColumnNames,
-		agent.LastQueryResult.AllRows,
+		r.ColumnNames,
+		r.Rows,
 		title,
 	)
 
 	// Add query info to the top
-	fullContent := fmt.Sprintf("Query: %s\n\n%s", agent.LastQueryResult.QueryText, content)
+	fullContent := fmt.Sprintf("Query: %s\n\n%s", r.SQL, content)
 
 	// Open in less
-	return display.PageWithContext(ctx, title, fullContent)
+	return display.PageWithContext(ctx, s.out, title, fullContent)
+}
+
+// parseSaveFormat takes a --format option out of /save's arguments
+func parseSaveFormat(args []string) (string, []string, error) {
+	var format string
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--format":
+			if i+1 == len(args) {
+				return "", nil, fmt.Errorf("usage: /save [--format %s] [id] [file]", strings.Join(display.ExportFormats, "|"))
+			}
+			i++
+			format = args[i]
+		case strings.HasPrefix(args[i], "--format="):
+			format = strings.TrimPrefix(args[i], "--format=")
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	if format != "" && !slices.Contains(display.ExportFormats, format) {
+		return "", nil, fmt.Errorf("unknown format: %s (must be: %s)", format, strings.Join(display.ExportFormats, ", "))
+	}
+	return format, rest, nil
 }
 
-// saveLastResults saves the last query results to a CSV file
-func (s *Session) saveLastResults(ctx context.Context, filename string) error {
-	if agent.LastQueryResult == nil {
-		fmt.Println("❌ No query results available to save")
-		fmt.Println("💡 Run a query first, then use /save to export results")
+// saveResults saves a query result, by default the last one, to a file. Without a format
+// it is taken from the file extension, and CSV is the default.
+func (s *Session) saveResults(ctx context.Context, id, filename, format string) error {
+	r := s.result(id, "/save to export results")
+	if r == nil {
 		return nil
 	}
 
-	if len(agent.LastQueryResult.AllRows) == 0 {
-		fmt.Println("❌ Last query returned no results to save")
+	if len(r.Rows) == 0 {
+		fmt.Fprintf(s.out, "❌ Result #%d has no rows to save\n", r.ID)
 		return nil
 	}
 
-	// Save to CSV
-	savedPath, err := display.SaveQueryResultToCSV(
-		agent.LastQueryResult.ColumnNames,
-		agent.LastQueryResult.AllRows,
-		filename,
-	)
+	if format == "" {
+		format = display.FormatFromFilename(filename)
+	}
+	if format == display.FormatParquet {
+		return s.streamParquet(ctx, r, filename)
+	}
+
+	columns := make([]display.ExportColumn, len(r.ColumnNames))
+	for i, name := range r.ColumnNames {
+		columns[i] = display.ExportColumn{Name: name, TypeModifier: -1}
+		if i < len(r.ColumnTypes) {
+			columns[i].Type = r.ColumnTypes[i]
+		}
+		if i < len(r.ColumnTypeMods) {
+			columns[i].TypeModifier = r.ColumnTypeMods[i]
+		}
+	}
+
+	savedPath, err := display.SaveTypedQueryResult(columns, r.Rows, filename, format)
+	if err != nil {
+		return fmt.Errorf("failed to save results: %w", err)
+	}
+
+	fmt.Fprintf(s.out, "✅ Result #%d saved to: %s\n", r.ID, savedPath)
+	fmt.Fprintf(s.out, "📊 Exported %d rows with %d columns\n",
+		len(r.Rows),
+		len(r.ColumnNames))
+
+	return nil
+}
+
+// streamParquet saves a result to Parquet by running its query again and writing rows as
+// they arrive, so the file holds every row rather than the ones kept in memory. The query
+// is approved, checked and recorded like a /replay.
+func (s *Session) streamParquet(ctx context.Context, r *agent.StoredResult, filename string) error {
+	fmt.Fprintf(s.out, "⏳ Exporting every row of result #%d to Parquet runs its query again:\n%s\n\n", r.ID, r.SQL)
+	if !s.approveCommandQuery(fmt.Sprintf("Export of result #%d to Parquet: %s\n\n%s", r.ID, r.Explanation, r.SQL)) {
+		fmt.Fprintln(s.out, "Not exported")
+		return nil
+	}
+
+	var savedPath string
+	var rowCount, columnCount int
+	opts := s.execOptions
+	opts.Audit = s.audit
+	err := agent.ExportQuery(ctx, s.conn, agent.Query{SQL: r.SQL, Params: r.Params, Explanation: r.Explanation}, s.mode, opts,
+		func(rows pgx.Rows) (int, error) {
+			// Parquet's schema comes from the Postgres types
+			fields := rows.FieldDescriptions()
+			columns := make([]display.ExportColumn, len(fields))
+			typeMap := pgtype.NewMap()
+			for i, fd := range fields {
+				columns[i] = display.ExportColumn{Name: fd.Name, TypeModifier: fd.TypeModifier}
+				if dataType, ok := typeMap.TypeForOID(fd.DataTypeOID); ok {
+					columns[i].Type = dataType.Name
+				}
+			}
+			columnCount = len(columns)
+
+			var err error
+			savedPath, rowCount, err = display.StreamParquetResult(columns, filename, func() ([]interface{}, error) {
+				if !rows.Next() {
+					return nil, rows.Err()
+				}
+				return rows.Values()
+			})
+			return rowCount, err
+		})
+	if err != nil {
+		return fmt.Errorf("failed to save results: %w", err)
+	}
+
+	fmt.Fprintf(s.out, "✅ Result #%d saved to: %s\n", r.ID, savedPath)
+	fmt.Fprintf(s.out, "📊 Exported %d rows with %d columns\n", rowCount, columnCount)
+
+	return nil
+}
+
+// optimizeQuery shows index suggestions for a query, or for the last query run when sql is empty.
+// The suggested statements are only displayed, never executed.
+func (s *Session) optimizeQuery(ctx context.Context, sql string) error {
+	if sql == "" {
+		last := s.execOptions.Results.Last()
+		if last == nil {
+			fmt.Fprintln(s.out, "❌ No query to optimize")
+			fmt.Fprintln(s.out, "💡 Run a query first, or use /optimize <sql>")
+			return nil
+		}
+		sql = last.SQL
+	}
+
+	advice, err := agent.AdviseIndexes(ctx, s.conn, sql)
+	explainSQL := "EXPLAIN (FORMAT JSON) " + sql
+	if err != nil {
+		s.audit.Record(audit.Event{Type: audit.EventSQLExecuted, Mode: s.mode, Tool: "optimize", SQL: explainSQL, Error: err.Error()})
+		return fmt.Errorf("index analysis failed: %w", err)
+	}
+	s.audit.Record(audit.Event{Type: audit.EventSQLExecuted, Mode: s.mode, Tool: "optimize", SQL: explainSQL})
+
+	fmt.Fprintln(s.out, "🔎 Index Suggestions:")
+	fmt.Fprintln(s.out, strings.Repeat("=", 50))
+	fmt.Fprintf(s.out, "Query:\n%s\n\n", sql)
+	fmt.Fprint(s.out, advice.Report())
+	return nil
+}
+
+// historyListSize is how many entries /history shows
+const historyListSize = 20
+
+// showHistory prints history entries, oldest first
+func (s *Session) showHistory(entries []history.Entry, matching string) {
+	if s.execOptions.History == nil {
+		fmt.Fprintln(s.out, "ℹ️  Query history is disabled")
+		return
+	}
+	if len(entries) == 0 {
+		if matching != "" {
+			fmt.Fprintf(s.out, "No queries in the history %s\n", matching)
+		} else {
+			fmt.Fprintln(s.out, "No queries in the history yet")
+		}
+		return
+	}
+
+	for _, e := range entries {
+		details := []string{e.Time.Local().Format("2006-01-02 15:04"), e.Outcome}
+		if e.Rows != nil {
+			details = append(details, fmt.Sprintf("%d rows", *e.Rows))
+		}
+		if e.Duration > 0 {
+			details = append(details, e.Duration.Round(time.Millisecond).String())
+		}
+		if e.Database != "" {
+			details = append(details, e.Database)
+		}
+		if e.ReplayOf > 0 {
+			details = append(details, fmt.Sprintf("replay of #%d", e.ReplayOf))
+		}
+		fmt.Fprintf(s.out, "#%-4d %s\n", e.ID, strings.Join(details, "  "))
+		if e.Question != "" {
+			fmt.Fprintf(s.out, "      Q: %s\n", truncateSQL(e.Question, 100))
+		}
+		fmt.Fprintf(s.out, "      %s\n", truncateSQL(e.SQL, 100))
+	}
+	fmt.Fprintln(s.out, "💡 Use /replay <id> to run a query again")
+}
+
+// replayQuery re-runs a query from the history directly, without the LLM
+func (s *Session) replayQuery(ctx context.Context, arg string) error {
+	id, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
 	if err != nil {
-		return fmt.Errorf("failed to save CSV file: %w", err)
+		return fmt.Errorf("invalid history id: %s", arg)
+	}
+	entry, ok := s.execOptions.History.Get(id)
+	if !ok {
+		return fmt.Errorf("no query #%d in the history (use /history to list queries)", id)
+	}
+
+	fmt.Fprintf(s.out, "🔁 Replaying #%d:\n%s\n\n", id, entry.SQL)
+	if !s.approveCommandQuery(fmt.Sprintf("Replay of #%d: %s\n\n%s", id, entry.Question, entry.SQL)) {
+		return nil
+	}
+	opts := s.execOptions
+	opts.Audit = s.audit
+	opts.History.StartReplay(id)
+	if err := agent.RunQuery(ctx, s.conn, agent.Query{SQL: entry.SQL, Params: entry.Params, Explanation: entry.Question}, s.mode, opts); err != nil {
+		return fmt.Errorf("replay of #%d failed: %w", id, err)
 	}
+	return nil
+}
 
-	fmt.Printf("✅ Results saved to: %s\n", savedPath)
-	fmt.Printf("📊 Exported %d rows with %d columns\n",
-		len(agent.LastQueryResult.AllRows),
-		len(agent.LastQueryResult.ColumnNames))
+// saveQuery saves the last executed query, with its explanation, to the query library
+func (s *Session) saveQuery(name string) error {
+	if s.library == nil {
+		return fmt.Errorf("no query library is configured")
+	}
+	if err := library.ValidateName(name); err != nil {
+		return err
+	}
+	last := s.execOptions.Results.Last()
+	if last == nil {
+		fmt.Fprintln(s.out, "❌ No executed query to save")
+		fmt.Fprintln(s.out, "💡 Run a query first, then use /savequery <name>")
+		return nil
+	}
+	if _, exists := s.library.Get(name); exists && !s.confirm(fmt.Sprintf("A saved query named %s exists. Replace it? (y/yes/n/no): ", name)) {
+		fmt.Fprintln(s.out, "Not saved")
+		return nil
+	}
 
+	q := library.SavedQuery{Name: name, Description: last.Explanation, SQL: last.SQL}
+	if len(last.Params) > 0 {
+		q.Params = s.paramNames(last.SQL, len(last.Params))
+	}
+	if err := s.library.Save(q); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(s.out, "✅ Saved query %s to %s\n", name, s.library.Path())
+	if len(q.Params) == 0 {
+		fmt.Fprintln(s.out, "💡 To parameterize it, replace literal values with $1, $2, ... and name them in its \"-- params:\" line")
+	}
+	return nil
+}
+
+// paramNames reuses the parameter names of a saved query with the same SQL, for results of /run,
+// and otherwise names the parameters p1, p2, ...
+func (s *Session) paramNames(sql string, n int) []string {
+	for _, q := range s.library.List() {
+		if q.SQL == sql && len(q.Params) == n {
+			return q.Params
+		}
+	}
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("p%d", i+1)
+	}
+	return names
+}
+
+// listQueries prints the saved queries
+func (s *Session) listQueries() {
+	if s.library == nil {
+		fmt.Fprintln(s.out, "ℹ️  No query library is configured")
+		return
+	}
+	queries := s.library.List()
+	if len(queries) == 0 {
+		fmt.Fprintf(s.out, "No saved queries in %s\n", s.library.Path())
+		fmt.Fprintln(s.out, "💡 Use /savequery <name> to save the last executed query")
+		return
+	}
+
+	fmt.Fprintf(s.out, "Saved queries (%s):\n", s.library.Path())
+	for _, q := range queries {
+		usage := q.Name
+		for _, param := range q.Params {
+			usage += " " + param + "=..."
+		}
+		fmt.Fprintf(s.out, "  %s\n", usage)
+		if q.Description != "" {
+			fmt.Fprintf(s.out, "      %s\n", q.Description)
+		}
+	}
+}
+
+// runSavedQuery runs a query from the library with its parameters bound as $1, $2, ...
+func (s *Session) runSavedQuery(ctx context.Context, name, args string) error {
+	if s.library == nil {
+		return fmt.Errorf("no query library is configured")
+	}
+	q, ok := s.library.Get(name)
+	if !ok {
+		return fmt.Errorf("no saved query named %s (use /queries to list them)", name)
+	}
+	values, err := library.ParseAssignments(args)
+	if err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	params, err := q.Bind(values)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(s.out, "▶️  Running %s:\n%s\n", name, q.SQL)
+	for i, param := range q.Params {
+		fmt.Fprintf(s.out, "   $%d (%s) = %q\n", i+1, param, params[i])
+	}
+	fmt.Fprintln(s.out)
+	if !s.approveCommandQuery(fmt.Sprintf("Saved query %s: %s\n\n%s", name, q.Description, q.SQL)) {
+		return nil
+	}
+
+	opts := s.execOptions
+	opts.Audit = s.audit
+	opts.History.StartQuestion("")
+	if err := agent.RunQuery(ctx, s.conn, agent.Query{SQL: q.SQL, Params: params, Explanation: q.Description}, s.mode, opts); err != nil {
+		return fmt.Errorf("saved query %s failed: %w", name, err)
+	}
 	return nil
 }
@@ -3,12 +3,18 @@ package chat
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/AliciaSchep/pgbabble/pkg/agent"
 	"github.com/AliciaSchep/pgbabble/pkg/db"
+	"github.com/AliciaSchep/pgbabble/pkg/library"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/parquet-go/parquet-go"
 )
 
 // MockDBConnection implements db.Connection for testing
@@ -16,7 +22,34 @@ type MockDBConnection struct {
 	tables       []db.TableInfo
 	tableDetails map[string]*db.TableInfo
 	foreignKeys  map[string][]db.ForeignKeyInfo
-	shouldFail   string // Which method should fail
+	shouldFail   string                   // Which method should fail
+	queryArgs    map[string][]interface{} // arguments of each query sent, by SQL
+	// queryRows returns the rows of a query; Query fails when unset
+	queryRows func(sql string) *mockRows
+}
+
+// mockRows is a minimal pgx.Rows over in-memory values
+type mockRows struct {
+	fields []pgconn.FieldDescription
+	values [][]interface{}
+	pos    int
+}
+
+func (r *mockRows) Close()                                       {}
+func (r *mockRows) Err() error                                   { return nil }
+func (r *mockRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *mockRows) FieldDescriptions() []pgconn.FieldDescription { return r.fields }
+func (r *mockRows) RawValues() [][]byte                          { return nil }
+func (r *mockRows) Conn() *pgx.Conn                              { return nil }
+func (r *mockRows) Scan(dest ...interface{}) error               { return fmt.Errorf("mockRows cannot scan") }
+
+func (r *mockRows) Next() bool {
+	r.pos++
+	return r.pos <= len(r.values)
+}
+
+func (r *mockRows) Values() ([]interface{}, error) {
+	return r.values[r.pos-1], nil
 }
 
 func NewMockDBConnection() *MockDBConnection {
@@ -69,6 +102,20 @@ func NewMockDBConnection() *MockDBConnection {
 	}
 }
 
+func (m *MockDBConnection) ResolveTableName(ctx context.Context, name string) (string, string, error) {
+	if m.shouldFail == "ResolveTableName" {
+		return "", "", fmt.Errorf("mock database error: ResolveTableName failed")
+	}
+	qn, err := db.ParseQualifiedName(name)
+	if err != nil {
+		return "", "", err
+	}
+	if qn.Schema == "" {
+		qn.Schema = "public"
+	}
+	return qn.Schema, qn.Name, nil
+}
+
 func (m *MockDBConnection) ListTables(ctx context.Context) ([]db.TableInfo, error) {
 	if m.shouldFail == "ListTables" {
 		return nil, fmt.Errorf("mock database error: ListTables failed")
@@ -120,15 +167,76 @@ func (m *MockDBConnection) SearchColumns(ctx context.Context, pattern string) ([
 	return results, nil
 }
 
+// GetViewDefinition implements the GetViewDefinition method for the db.Connection interface
+func (m *MockDBConnection) GetViewDefinition(ctx context.Context, schema, viewName string) (*db.ViewInfo, error) {
+	if m.shouldFail == "GetViewDefinition" {
+		return nil, fmt.Errorf("mock database error: GetViewDefinition failed")
+	}
+	return nil, fmt.Errorf("view %s.%s not found", schema, viewName)
+}
+
+// ViewDependencies implements the ViewDependencies method for the db.Connection interface
+func (m *MockDBConnection) ViewDependencies(ctx context.Context, schema, viewName string) ([]db.ViewDependency, error) {
+	if m.shouldFail == "ViewDependencies" {
+		return nil, fmt.Errorf("mock database error: ViewDependencies failed")
+	}
+	return nil, nil
+}
+
+// ListFunctions implements the ListFunctions method for the db.Connection interface
+func (m *MockDBConnection) ListFunctions(ctx context.Context, pattern string) ([]db.FunctionInfo, error) {
+	if m.shouldFail == "ListFunctions" {
+		return nil, fmt.Errorf("mock database error: ListFunctions failed")
+	}
+	return []db.FunctionInfo{}, nil
+}
+
+// GetColumnStats implements the GetColumnStats method for the db.Connection interface
+func (m *MockDBConnection) GetColumnStats(ctx context.Context, schema, tableName string) ([]db.ColumnStats, error) {
+	if m.shouldFail == "GetColumnStats" {
+		return nil, fmt.Errorf("mock database error: GetColumnStats failed")
+	}
+	return []db.ColumnStats{}, nil
+}
+
+// SampleColumnValues implements the SampleColumnValues method for the db.Connection interface
+func (m *MockDBConnection) SampleColumnValues(ctx context.Context, schema, tableName, columnName string, limit int) ([]string, error) {
+	if m.shouldFail == "SampleColumnValues" {
+		return nil, fmt.Errorf("mock database error: SampleColumnValues failed")
+	}
+	return []string{}, nil
+}
+
+func (m *MockDBConnection) SourceColumns(ctx context.Context, fields []pgconn.FieldDescription) ([]string, error) {
+	return make([]string, len(fields)), nil
+}
+
 // Query implements the Query method for the db.Connection interface
 func (m *MockDBConnection) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
 	if m.shouldFail == "Query" {
 		return nil, fmt.Errorf("mock database error: Query failed")
 	}
-	// Mock implementation - just return nil for now since we don't need it in these tests
+	if m.queryArgs != nil {
+		m.queryArgs[sql] = args
+	}
+	if m.queryRows != nil {
+		return m.queryRows(sql), nil
+	}
 	return nil, fmt.Errorf("Query method not implemented in mock")
 }
 
+func (m *MockDBConnection) ListIndexes(ctx context.Context, schema, tableName string) ([]db.IndexInfo, error) {
+	return nil, nil
+}
+
+func (m *MockDBConnection) HypotheticalPlan(ctx context.Context, sql string, createIndexStatements []string) ([]byte, error) {
+	return nil, db.ErrHypoPGUnavailable
+}
+
+func (m *MockDBConnection) QueryReadOnly(ctx context.Context, sql string, scan func(pgx.Rows) error) error {
+	return fmt.Errorf("QueryReadOnly method not implemented in mock")
+}
+
 // EnsureConnection implements the EnsureConnection method for the db.Connection interface
 func (m *MockDBConnection) EnsureConnection(ctx context.Context) {
 	// Mock implementation - do nothing
@@ -157,7 +265,7 @@ func TestNewSession(t *testing.T) {
 }
 
 func TestSession_ModeSpecificBehavior(t *testing.T) {
-	modes := []string{"default", "schema-only", "share-results"}
+	modes := []string{"default", "schema-only", "aggregate-only", "share-results"}
 
 	for _, mode := range modes {
 		t.Run("mode_"+mode, func(t *testing.T) {
@@ -175,6 +283,44 @@ func TestSession_ModeSpecificBehavior(t *testing.T) {
 	}
 }
 
+func TestSession_SwitchMode(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("more private mode switches immediately", func(t *testing.T) {
+		session := NewSession(nil, "share-results", agent.DefaultModel)
+		if err := session.handleCommand(ctx, "/mode schema-only"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if session.mode != "schema-only" {
+			t.Errorf("Expected schema-only mode, got %s", session.mode)
+		}
+		if session.prompt() != "pgbabble [schema-only]> " {
+			t.Errorf("Expected prompt to show the mode, got %q", session.prompt())
+		}
+	})
+
+	t.Run("sharing more data needs confirmation", func(t *testing.T) {
+		// Without a terminal the confirmation is declined
+		session := NewSession(nil, "default", agent.DefaultModel)
+		if err := session.handleCommand(ctx, "/m share-results"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if session.mode != "default" {
+			t.Errorf("Expected mode to stay default without confirmation, got %s", session.mode)
+		}
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		session := NewSession(nil, "default", agent.DefaultModel)
+		if err := session.handleCommand(ctx, "/mode everything"); err == nil {
+			t.Error("Expected error for invalid mode")
+		}
+		if session.mode != "default" {
+			t.Errorf("Expected mode to be unchanged, got %s", session.mode)
+		}
+	})
+}
+
 func TestSession_HandleCommand_UnknownCommand(t *testing.T) {
 	session := NewSession(nil, "default", agent.DefaultModel)
 	ctx := context.Background()
@@ -203,6 +349,29 @@ func TestSession_HandleCommand_Help(t *testing.T) {
 	}
 }
 
+func TestSession_SetOutput(t *testing.T) {
+	session := NewSession(NewMockDBConnection(), "default", agent.DefaultModel)
+	var out strings.Builder
+	session.SetOutput(&out)
+	ctx := context.Background()
+
+	if err := session.handleCommand(ctx, "/help"); err != nil {
+		t.Fatalf("handleCommand /help failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "/quit") {
+		t.Errorf("expected the help to be written to the session's output, got %q", out.String())
+	}
+
+	// Queries run by the session print through the same writer
+	out.Reset()
+	if err := session.RunScript(ctx, []Step{{Number: 1, Line: 1, Text: "/tables"}}, ApproveNever, t.TempDir()); err != nil {
+		t.Fatalf("RunScript failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Step 1: /tables") {
+		t.Errorf("expected the script's progress to be written to the session's output, got %q", out.String())
+	}
+}
+
 func TestSession_HandleCommand_ClearWhenNotReady(t *testing.T) {
 	session := NewSession(nil, "default", agent.DefaultModel)
 	session.agentReady = false
@@ -389,7 +558,7 @@ func TestSession_StateManagement(t *testing.T) {
 }
 
 func TestSession_ModeValidation(t *testing.T) {
-	validModes := []string{"default", "schema-only", "share-results"}
+	validModes := []string{"default", "schema-only", "aggregate-only", "share-results"}
 	invalidModes := []string{"", "invalid", "old-mode", "unknown"}
 
 	for _, mode := range validModes {
@@ -496,6 +665,9 @@ func TestSession_InitializationWorkflow(t *testing.T) {
 }
 
 func TestSession_TableNameParsing(t *testing.T) {
+	mockDB := NewMockDBConnection()
+	ctx := context.Background()
+
 	tests := []struct {
 		input          string
 		expectedSchema string
@@ -505,20 +677,16 @@ func TestSession_TableNameParsing(t *testing.T) {
 		{"public.users", "public", "users"},
 		{"schema1.table1", "schema1", "table1"},
 		{"some_schema.some_table", "some_schema", "some_table"},
+		{"Sales.Orders", "sales", "orders"},
+		{`"Sales"."Order.Items"`, "Sales", "Order.Items"},
 	}
 
 	for _, tt := range tests {
 		t.Run("parse_"+tt.input, func(t *testing.T) {
-			// Simulate the parsing logic from describeTable
-			schema := "public" // default
-			tableName := tt.input
-
-			if strings.Contains(tableName, ".") {
-				parts := strings.Split(tableName, ".")
-				if len(parts) == 2 {
-					schema = parts[0]
-					tableName = parts[1]
-				}
+			// describeTable resolves names through the connection
+			schema, tableName, err := mockDB.ResolveTableName(ctx, tt.input)
+			if err != nil {
+				t.Fatalf("ResolveTableName failed: %v", err)
 			}
 
 			if schema != tt.expectedSchema {
@@ -567,11 +735,11 @@ func TestSession_DatabaseMethods_ErrorHandling(t *testing.T) {
 		_ = session.describeTable(ctx, "users") // Expected to panic, return value irrelevant
 	})
 
-	t.Run("browseLastResults_with_no_results", func(t *testing.T) {
+	t.Run("browseResults_with_no_results", func(t *testing.T) {
 		// This should handle the case when no results are available
-		err := session.browseLastResults(ctx)
+		err := session.browseResults(ctx, "")
 		if err != nil {
-			t.Errorf("browseLastResults should handle no results gracefully: %v", err)
+			t.Errorf("browseResults should handle no results gracefully: %v", err)
 		}
 	})
 }
@@ -677,6 +845,17 @@ func TestSession_DescribeTable_WithMockDB(t *testing.T) {
 		}
 	})
 
+	t.Run("mock_resolve_error", func(t *testing.T) {
+		errorMockDB := NewMockDBConnection()
+		errorMockDB.shouldFail = "ResolveTableName"
+		errorSession := NewSession(errorMockDB, "default", agent.DefaultModel)
+
+		err := errorSession.describeTable(ctx, "users")
+		if err == nil || !strings.Contains(err.Error(), "failed to describe table") {
+			t.Errorf("Expected 'failed to describe table' error, got: %v", err)
+		}
+	})
+
 	t.Run("mock_foreign_keys_error", func(t *testing.T) {
 		errorMockDB := NewMockDBConnection()
 		errorMockDB.shouldFail = "GetForeignKeys"
@@ -801,3 +980,321 @@ func TestSession_SignalHandling(t *testing.T) {
 
 	t.Log("Signal handling test passed - operation cancellation works correctly")
 }
+
+func TestSession_ResultCommands(t *testing.T) {
+	session := NewSession(nil, "default", agent.DefaultModel)
+	other := NewSession(nil, "default", agent.DefaultModel)
+	ctx := context.Background()
+
+	results := session.execOptions.Results
+	results.Add(&agent.StoredResult{SQL: "SELECT 1 AS a", ColumnNames: []string{"a"}, Rows: [][]interface{}{{1}}})
+	results.Add(&agent.StoredResult{SQL: "SELECT 2 AS b", ColumnNames: []string{"b"}, Rows: [][]interface{}{{2}}})
+
+	if other.execOptions.Results.Last() != nil {
+		t.Error("expected sessions not to share query results")
+	}
+
+	// Setting execution options keeps the session's results
+	session.SetExecutionOptions(agent.ExecutionOptions{MinGroupSize: 5})
+	if session.execOptions.Results != results {
+		t.Error("expected SetExecutionOptions to keep the result store")
+	}
+
+	if err := session.handleCommand(ctx, "/results"); err != nil {
+		t.Errorf("/results failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		cmd    string
+		file   string
+		prefix string
+	}{
+		{"/save 1 " + filepath.Join(dir, "first.csv"), "first.csv", "a\n"},
+		{"/save " + filepath.Join(dir, "last.csv"), "last.csv", "b\n"},
+		{"/save " + filepath.Join(dir, "last.json"), "last.json", "[\n  {\"b\":"},
+		{"/save --format ndjson 1 " + filepath.Join(dir, "first"), "first.ndjson", "{\"a\":"},
+	} {
+		if err := session.handleCommand(ctx, tt.cmd); err != nil {
+			t.Fatalf("%s failed: %v", tt.cmd, err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, tt.file))
+		if err != nil {
+			t.Fatalf("expected %s to be written: %v", tt.file, err)
+		}
+		if !strings.HasPrefix(string(data), tt.prefix) {
+			t.Errorf("expected %s to start with %q, got %q", tt.file, tt.prefix, data)
+		}
+	}
+
+	if err := session.handleCommand(ctx, "/save 1 --format=xml"); err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Errorf("expected unknown format error, got %v", err)
+	}
+	if err := session.handleCommand(ctx, "/save 7 "+filepath.Join(dir, "missing.csv")); err != nil {
+		t.Errorf("expected unknown result id to be reported, not fail: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing.csv")); err == nil {
+		t.Error("expected nothing to be saved for an unknown result id")
+	}
+}
+
+func TestSession_SaveParquetStreamsAllRows(t *testing.T) {
+	// More rows than the stored result holds, as when the row limit truncated it
+	const total = 25000
+	values := make([][]interface{}, total)
+	for i := range values {
+		values[i] = []interface{}{int32(i)}
+	}
+	conn := &MockDBConnection{
+		queryArgs: make(map[string][]interface{}),
+		queryRows: func(sql string) *mockRows {
+			return &mockRows{
+				fields: []pgconn.FieldDescription{{Name: "n", DataTypeOID: pgtype.Int4OID, TypeModifier: -1}},
+				values: values,
+			}
+		},
+	}
+	session := NewSession(conn, "default", agent.DefaultModel)
+	ctx := context.Background()
+
+	session.execOptions.Results.Add(&agent.StoredResult{
+		SQL:         "SELECT n FROM numbers WHERE n < $1",
+		Params:      []string{"25000"},
+		ColumnNames: []string{"n"},
+		Rows:        [][]interface{}{{int32(0)}},
+		Truncated:   true,
+	})
+
+	file := filepath.Join(t.TempDir(), "numbers.parquet")
+	if err := session.handleCommand(ctx, "/save "+file); err != nil {
+		t.Fatalf("/save failed: %v", err)
+	}
+
+	if args := conn.queryArgs["SELECT n FROM numbers WHERE n < $1"]; len(args) != 1 || args[0] != "25000" {
+		t.Errorf("expected the query to be re-run with its parameters, got %v", args)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("expected %s to be written: %v", file, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pf, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", file, err)
+	}
+	if pf.NumRows() != total {
+		t.Errorf("expected all %d rows to be exported, got %d", total, pf.NumRows())
+	}
+
+	// The export runs the query again, so it follows the approval policy
+	session.approval = ApproveNever
+	declined := filepath.Join(t.TempDir(), "declined.parquet")
+	if err := session.handleCommand(ctx, "/save "+declined); err != nil {
+		t.Fatalf("/save failed: %v", err)
+	}
+	if _, err := os.Stat(declined); err == nil {
+		t.Error("expected nothing to be exported under --approve=never")
+	}
+	session.approval = ""
+
+	// A failing re-run is reported and nothing is written
+	conn.queryRows = nil
+	if err := session.handleCommand(ctx, "/save "+filepath.Join(t.TempDir(), "failed.parquet")); err == nil {
+		t.Error("expected a failed re-run to be reported")
+	}
+}
+
+func TestSession_QueryLibrary(t *testing.T) {
+	conn := &MockDBConnection{
+		queryArgs: make(map[string][]interface{}),
+		queryRows: func(sql string) *mockRows {
+			return &mockRows{fields: []pgconn.FieldDescription{{Name: "id", DataTypeOID: pgtype.Int4OID, TypeModifier: -1}}}
+		},
+	}
+	session := NewSession(conn, "default", agent.DefaultModel)
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "queries.sql")
+	lib, err := library.Load(path)
+	if err != nil {
+		t.Fatalf("library.Load failed: %v", err)
+	}
+	session.SetQueryLibrary(lib)
+
+	session.execOptions.Results.Add(&agent.StoredResult{SQL: "SELECT count(*) FROM orders", Explanation: "Count all orders"})
+	if err := session.handleCommand(ctx, "/savequery order_count"); err != nil {
+		t.Fatalf("/savequery failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected the library to be written: %v", err)
+	}
+	if want := "-- name: order_count\n-- description: Count all orders\nSELECT count(*) FROM orders;\n"; string(data) != want {
+		t.Errorf("unexpected library file:\n%s", data)
+	}
+
+	// A parameterized query edited into the file by hand
+	content := string(data) + "\n-- name: orders_since\n-- params: since, region\nSELECT * FROM orders WHERE placed_at >= $1 AND region = $2;\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	lib, err = library.Load(path)
+	if err != nil {
+		t.Fatalf("library.Load failed: %v", err)
+	}
+	session.SetQueryLibrary(lib)
+
+	if err := session.handleCommand(ctx, `/run orders_since since=2024-01-01 region="North America"`); err != nil {
+		t.Fatalf("/run failed: %v", err)
+	}
+	args := conn.queryArgs["SELECT * FROM orders WHERE placed_at >= $1 AND region = $2"]
+	if fmt.Sprint(args) != "[2024-01-01 North America]" {
+		t.Errorf("expected parameters to be bound as query arguments, got %v", args)
+	}
+
+	if err := session.handleCommand(ctx, "/run orders_since since=2024-01-01"); err == nil || !strings.Contains(err.Error(), "missing value for region") {
+		t.Errorf("expected missing parameter error, got %v", err)
+	}
+	if err := session.handleCommand(ctx, "/run nope"); err == nil {
+		t.Error("expected error for unknown saved query")
+	}
+}
+
+func TestSession_ApprovalPolicy(t *testing.T) {
+	session := NewSession(NewMockDBConnection(), "default", agent.DefaultModel)
+
+	session.approval = ApproveAutoReadOnly
+	if !session.getUserApproval("SELECT 1") {
+		t.Error("expected auto-readonly to approve without asking")
+	}
+	session.approval = ApproveNever
+	if session.getUserApproval("SELECT 1") {
+		t.Error("expected never to reject")
+	}
+	session.approval = ApprovePrompt
+	if session.getUserApproval("SELECT 1") {
+		t.Error("expected prompt without a terminal to reject")
+	}
+	if session.proposed != 3 {
+		t.Errorf("expected 3 proposed queries, got %d", session.proposed)
+	}
+
+	// Sharing sampled values is never approved automatically, nor counted as a query
+	for _, approval := range ApprovalPolicies {
+		session.approval = approval
+		if session.getShareApproval("status: shipped") {
+			t.Errorf("expected %s to decline sharing sampled values", approval)
+		}
+	}
+	if session.proposed != 3 {
+		t.Errorf("expected share requests not to count as proposed queries, got %d", session.proposed)
+	}
+
+	if _, err := session.Ask(context.Background(), "how many users?", "always"); err == nil || !strings.Contains(err.Error(), "invalid approval policy") {
+		t.Errorf("expected invalid approval policy error, got %v", err)
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	script := `# Weekly review
+/describe orders
+
+how many orders were placed last week?
+   /tables   
+`
+	steps, err := ParseScript(strings.NewReader(script))
+	if err != nil {
+		t.Fatalf("ParseScript failed: %v", err)
+	}
+	want := []Step{
+		{Number: 1, Line: 2, Text: "/describe orders"},
+		{Number: 2, Line: 4, Text: "how many orders were placed last week?"},
+		{Number: 3, Line: 5, Text: "/tables"},
+	}
+	if fmt.Sprint(steps) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, steps)
+	}
+}
+
+func TestSession_RunScript(t *testing.T) {
+	session := NewSession(NewMockDBConnection(), "default", agent.DefaultModel)
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "out")
+
+	steps := []Step{
+		{Number: 1, Line: 1, Text: "/tables"},
+		{Number: 2, Line: 2, Text: "/quit"},
+		{Number: 3, Line: 3, Text: "/describe missing_table"},
+	}
+	if err := session.RunScript(ctx, steps, ApproveNever, dir); err != nil {
+		t.Fatalf("expected the script to stop at /quit, got %v", err)
+	}
+
+	err := session.RunScript(ctx, []Step{{Number: 1, Line: 4, Text: "/describe missing_table"}}, ApproveNever, dir)
+	if err == nil || !strings.Contains(err.Error(), "step 1 (line 4) failed") {
+		t.Errorf("expected the failing step to be reported, got %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected no output directory without results, got %v", err)
+	}
+
+	// Saved queries follow the approval policy like queries proposed by the LLM
+	conn := &MockDBConnection{queryArgs: make(map[string][]interface{})}
+	scripted := NewSession(conn, "default", agent.DefaultModel)
+	lib, err := library.Load(filepath.Join(t.TempDir(), "queries.sql"))
+	if err != nil {
+		t.Fatalf("library.Load failed: %v", err)
+	}
+	if err := lib.Save(library.SavedQuery{Name: "order_count", SQL: "SELECT count(*) FROM orders"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	scripted.SetQueryLibrary(lib)
+	if err := scripted.RunScript(ctx, []Step{{Number: 1, Line: 1, Text: "/run order_count"}}, ApproveNever, dir); err != nil {
+		t.Fatalf("RunScript failed: %v", err)
+	}
+	if len(conn.queryArgs) != 0 {
+		t.Errorf("expected /run not to execute under --approve=never, got %v", conn.queryArgs)
+	}
+	conn.queryRows = func(sql string) *mockRows {
+		return &mockRows{
+			fields: []pgconn.FieldDescription{{Name: "count", DataTypeOID: pgtype.Int8OID, TypeModifier: -1}},
+			values: [][]interface{}{{int64(3)}},
+		}
+	}
+	if err := scripted.RunScript(ctx, []Step{{Number: 1, Line: 1, Text: "/run order_count"}}, ApproveAutoReadOnly, dir); err != nil {
+		t.Fatalf("RunScript failed: %v", err)
+	}
+	if _, ok := conn.queryArgs["SELECT count(*) FROM orders"]; !ok {
+		t.Errorf("expected /run to execute under --approve=auto-readonly, got %v", conn.queryArgs)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "step-001.csv")); err != nil || string(data) != "count\n3\n" {
+		t.Errorf("expected the step's result to be saved, got %q (%v)", data, err)
+	}
+
+	// A query that fails stops the script
+	conn.queryRows = nil
+	steps = []Step{{Number: 1, Line: 1, Text: "/run order_count"}, {Number: 2, Line: 2, Text: "/replay 1"}}
+	err = scripted.RunScript(ctx, steps, ApproveAutoReadOnly, dir)
+	if err == nil || !strings.Contains(err.Error(), "step 1 (line 1) failed: saved query order_count failed") {
+		t.Errorf("expected the failed query to stop the script, got %v", err)
+	}
+
+	// Every result of a step is saved, even when there are more than the store keeps
+	session.execOptions.Results = agent.NewResultStore(1)
+	stepResults := session.execOptions.Results.Record()
+	session.execOptions.Results.Add(&agent.StoredResult{ColumnNames: []string{"n"}, Rows: [][]interface{}{{1}}})
+	session.execOptions.Results.Add(&agent.StoredResult{ColumnNames: []string{"n"}, Rows: [][]interface{}{{2}}})
+	if err := session.saveStepResults(Step{Number: 7}, stepResults(), dir); err != nil {
+		t.Fatalf("saveStepResults failed: %v", err)
+	}
+	for name, want := range map[string]string{"step-007.csv": "n\n1\n", "step-007-2.csv": "n\n2\n"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s: expected %q, got %q (%v)", name, want, data, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AppConfig holds settings loaded from the pgbabble config file
+type AppConfig struct {
+	Filters    ObjectFilter  `json:"filters"`
+	PolicyFile string        `json:"policy_file,omitempty"` // deny policy, see DenyPolicy
+	Masking    MaskingConfig `json:"masking"`
+	// Pseudonymize replaces schema, table and column names sent to the LLM with pseudonyms
+	Pseudonymize bool `json:"pseudonymize,omitempty"`
+	// AuditLog is the JSON lines file recording everything exchanged with the LLM; empty disables it
+	AuditLog string `json:"audit_log,omitempty"`
+	// SelfCorrect lets the LLM immediately propose a fix when a query fails with a
+	// syntax error or an unknown table or column
+	SelfCorrect bool `json:"self_correct,omitempty"`
+	// MaxCorrections limits automatic correction rounds per failed query; 0 uses the default
+	MaxCorrections int `json:"max_corrections,omitempty"`
+	// MaxAnalyzeCost is the highest estimated plan cost EXPLAIN ANALYZE may run for; 0 uses the default
+	MaxAnalyzeCost float64 `json:"max_analyze_cost,omitempty"`
+	// CostWarning is the estimated plan cost above which the approval prompt warns; 0 uses the default
+	CostWarning float64 `json:"cost_warning,omitempty"`
+	// MaxQueryCost blocks queries with a higher estimated plan cost; 0 disables the cap
+	MaxQueryCost float64 `json:"max_query_cost,omitempty"`
+	// ResultHistory is how many query results a session keeps for /browse and /save; 0 uses the default
+	ResultHistory int `json:"result_history,omitempty"`
+	// HistoryFile is the structured query history; empty uses the default location
+	HistoryFile string `json:"history_file,omitempty"`
+	// NoHistory turns off the query history
+	NoHistory bool `json:"no_history,omitempty"`
+	// EncryptHistory encrypts the query history with the passphrase in PGBABBLE_HISTORY_KEY
+	EncryptHistory bool `json:"encrypt_history,omitempty"`
+	// QueriesFile is the saved query library; empty uses the default location
+	QueriesFile string `json:"queries_file,omitempty"`
+}
+
+// DefaultAppConfigPath returns the config file location used when --config is not given
+func DefaultAppConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pgbabble", "config.json")
+}
+
+// LoadAppConfig reads a JSON config file. An empty path loads the default
+// location, which may be missing; an explicitly given path must exist.
+func LoadAppConfig(path string) (*AppConfig, error) {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultAppConfigPath()
+		if path == "" {
+			return &AppConfig{}, nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return &AppConfig{}, nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var cfg AppConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if err := cfg.Filters.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid filters in config file %s: %w", path, err)
+	}
+	if err := cfg.Masking.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid masking in config file %s: %w", path, err)
+	}
+	return &cfg, nil
+}
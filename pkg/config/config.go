@@ -16,6 +16,7 @@ type DBConfig struct {
 	User     string
 	Password string
 	SSLMode  string
+	ReadOnly bool // run every transaction read-only (default_transaction_read_only)
 }
 
 // NewDBConfigFromURI parses a PostgreSQL URI and returns a DBConfig
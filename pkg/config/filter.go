@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ObjectFilter limits which schemas and tables are exposed to the LLM.
+// Patterns are globs (*, ?, [...]). Table patterns containing a dot are matched
+// against "schema.table", others against the bare table name.
+type ObjectFilter struct {
+	IncludeSchemas []string `json:"include_schemas,omitempty"`
+	ExcludeSchemas []string `json:"exclude_schemas,omitempty"`
+	IncludeTables  []string `json:"include_tables,omitempty"`
+	ExcludeTables  []string `json:"exclude_tables,omitempty"`
+}
+
+// systemSchemas are not subject to include patterns; they are only hidden when excluded explicitly
+var systemSchemas = map[string]bool{
+	"pg_catalog":         true,
+	"information_schema": true,
+}
+
+// IsEmpty reports whether the filter allows everything
+func (f ObjectFilter) IsEmpty() bool {
+	return len(f.IncludeSchemas) == 0 && len(f.ExcludeSchemas) == 0 &&
+		len(f.IncludeTables) == 0 && len(f.ExcludeTables) == 0
+}
+
+// String summarizes the filter patterns for display
+func (f ObjectFilter) String() string {
+	var parts []string
+	for _, p := range []struct {
+		label    string
+		patterns []string
+	}{
+		{"include schemas", f.IncludeSchemas},
+		{"exclude schemas", f.ExcludeSchemas},
+		{"include tables", f.IncludeTables},
+		{"exclude tables", f.ExcludeTables},
+	} {
+		if len(p.patterns) > 0 {
+			parts = append(parts, fmt.Sprintf("%s %s", p.label, strings.Join(p.patterns, ", ")))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Merge returns a filter with the patterns of both filters
+func (f ObjectFilter) Merge(other ObjectFilter) ObjectFilter {
+	return ObjectFilter{
+		IncludeSchemas: append(append([]string{}, f.IncludeSchemas...), other.IncludeSchemas...),
+		ExcludeSchemas: append(append([]string{}, f.ExcludeSchemas...), other.ExcludeSchemas...),
+		IncludeTables:  append(append([]string{}, f.IncludeTables...), other.IncludeTables...),
+		ExcludeTables:  append(append([]string{}, f.ExcludeTables...), other.ExcludeTables...),
+	}
+}
+
+// Validate checks that all patterns are well-formed globs
+func (f ObjectFilter) Validate() error {
+	for _, patterns := range [][]string{f.IncludeSchemas, f.ExcludeSchemas, f.IncludeTables, f.ExcludeTables} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// AllowsSchema reports whether objects in the schema may be exposed
+func (f ObjectFilter) AllowsSchema(schema string) bool {
+	if matchesAny(f.ExcludeSchemas, schema) {
+		return false
+	}
+	if len(f.IncludeSchemas) > 0 && !systemSchemas[schema] {
+		return matchesAny(f.IncludeSchemas, schema)
+	}
+	return true
+}
+
+// AllowsTable reports whether the table may be exposed
+func (f ObjectFilter) AllowsTable(schema, table string) bool {
+	if !f.AllowsSchema(schema) {
+		return false
+	}
+	if matchesAnyTable(f.ExcludeTables, schema, table) {
+		return false
+	}
+	if len(f.IncludeTables) > 0 && !systemSchemas[schema] {
+		return matchesAnyTable(f.IncludeTables, schema, table)
+	}
+	return true
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyTable(patterns []string, schema, table string) bool {
+	for _, pattern := range patterns {
+		name := table
+		if strings.Contains(pattern, ".") {
+			name = schema + "." + table
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
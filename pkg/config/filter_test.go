@@ -0,0 +1,107 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestObjectFilter_AllowsTable(t *testing.T) {
+	filter := ObjectFilter{
+		IncludeSchemas: []string{"public", "sales*"},
+		ExcludeSchemas: []string{"sales_archive"},
+		ExcludeTables:  []string{"*_tmp", "public.audit_log"},
+	}
+
+	tests := []struct {
+		schema   string
+		table    string
+		expected bool
+	}{
+		{"public", "users", true},
+		{"sales_eu", "orders", true},
+		{"staging", "orders", false},
+		{"sales_archive", "orders", false},
+		{"public", "orders_tmp", false},
+		{"public", "audit_log", false},
+		{"sales_eu", "audit_log", true},
+		{"pg_catalog", "pg_class", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.schema+"."+tt.table, func(t *testing.T) {
+			if got := filter.AllowsTable(tt.schema, tt.table); got != tt.expected {
+				t.Errorf("Expected AllowsTable(%s, %s) = %v, got %v", tt.schema, tt.table, tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestObjectFilter_IncludeTables(t *testing.T) {
+	filter := ObjectFilter{IncludeTables: []string{"dim_*", "public.facts"}}
+
+	if !filter.AllowsTable("analytics", "dim_date") {
+		t.Error("Expected dim_date to match include pattern")
+	}
+	if !filter.AllowsTable("public", "facts") {
+		t.Error("Expected public.facts to match include pattern")
+	}
+	if filter.AllowsTable("analytics", "facts") {
+		t.Error("Expected analytics.facts not to match schema-qualified include pattern")
+	}
+}
+
+func TestObjectFilter_EmptyAndMerge(t *testing.T) {
+	var filter ObjectFilter
+	if !filter.IsEmpty() || !filter.AllowsTable("anything", "at_all") {
+		t.Error("Expected empty filter to allow everything")
+	}
+
+	merged := ObjectFilter{ExcludeSchemas: []string{"staging"}}.Merge(ObjectFilter{ExcludeSchemas: []string{"archive"}})
+	if merged.AllowsSchema("staging") || merged.AllowsSchema("archive") || !merged.AllowsSchema("public") {
+		t.Errorf("Expected merged filter to exclude both schemas, got %+v", merged)
+	}
+	if merged.String() != "exclude schemas staging, archive" {
+		t.Errorf("Unexpected summary: %s", merged.String())
+	}
+}
+
+func TestObjectFilter_Validate(t *testing.T) {
+	if err := (ObjectFilter{ExcludeTables: []string{"[invalid"}}).Validate(); err == nil {
+		t.Error("Expected error for malformed glob pattern")
+	}
+	if err := (ObjectFilter{ExcludeTables: []string{"stg_*"}}).Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestLoadAppConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	content := `{"filters": {"include_schemas": ["public"], "exclude_tables": ["*_archive"]}}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := LoadAppConfig(path)
+	if err != nil {
+		t.Fatalf("LoadAppConfig failed: %v", err)
+	}
+	if len(cfg.Filters.IncludeSchemas) != 1 || cfg.Filters.IncludeSchemas[0] != "public" {
+		t.Errorf("Unexpected include schemas: %v", cfg.Filters.IncludeSchemas)
+	}
+	if cfg.Filters.AllowsTable("public", "orders_archive") {
+		t.Error("Expected exclude pattern from config file to apply")
+	}
+
+	if _, err := LoadAppConfig(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected error for missing explicit config file")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"filters": `), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if _, err := LoadAppConfig(path); err == nil {
+		t.Error("Expected error for malformed config file")
+	}
+}
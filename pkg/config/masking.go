@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"path"
+)
+
+// Masking actions applied to result values before they are shared with the LLM
+const (
+	MaskHash        = "hash"        // keyed hash, equal values stay equal within a session
+	MaskTruncate    = "truncate"    // keep the first Length characters
+	MaskPlaceholder = "placeholder" // replace with the column type, e.g. <text>
+	MaskMonth       = "month"       // generalize dates and timestamps to YYYY-MM
+	MaskBucket      = "bucket"      // replace numbers with the [low, high) bucket of BucketSize
+)
+
+// MaskRule masks the columns whose name and/or Postgres type match the glob patterns
+type MaskRule struct {
+	Column     string  `json:"column,omitempty"` // column name pattern, case-insensitive
+	Type       string  `json:"type,omitempty"`   // type name pattern, e.g. "timestamp*" or "int[248]"
+	Action     string  `json:"action"`
+	Length     int     `json:"length,omitempty"`      // for truncate (default 3)
+	BucketSize float64 `json:"bucket_size,omitempty"` // for bucket (default 10)
+}
+
+// MaskingConfig configures masking of query results shared with the LLM
+type MaskingConfig struct {
+	Rules []MaskRule `json:"rules,omitempty"`
+	// DisableDetectors turns off the built-in email, phone, credit card and IP detectors
+	DisableDetectors bool `json:"disable_detectors,omitempty"`
+}
+
+// Validate checks that every rule has a pattern, a known action and valid globs
+func (m MaskingConfig) Validate() error {
+	for i, rule := range m.Rules {
+		if rule.Column == "" && rule.Type == "" {
+			return fmt.Errorf("masking rule %d: column or type pattern is required", i+1)
+		}
+		for _, pattern := range []string{rule.Column, rule.Type} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("masking rule %d: invalid pattern %q: %w", i+1, pattern, err)
+			}
+		}
+		switch rule.Action {
+		case MaskHash, MaskTruncate, MaskPlaceholder, MaskMonth, MaskBucket:
+		default:
+			return fmt.Errorf("masking rule %d: unknown action %q (must be: hash, truncate, placeholder, month, bucket)", i+1, rule.Action)
+		}
+		if rule.Length < 0 || rule.BucketSize < 0 {
+			return fmt.Errorf("masking rule %d: length and bucket_size must be positive", i+1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package config
+
+import "testing"
+
+func TestMaskingConfig_Validate(t *testing.T) {
+	valid := MaskingConfig{Rules: []MaskRule{
+		{Column: "email", Action: MaskHash},
+		{Type: "timestamp*", Action: MaskMonth},
+	}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	invalid := []MaskingConfig{
+		{Rules: []MaskRule{{Action: MaskHash}}},
+		{Rules: []MaskRule{{Column: "email", Action: "encrypt"}}},
+		{Rules: []MaskRule{{Column: "[bad", Action: MaskHash}}},
+		{Rules: []MaskRule{{Column: "salary", Action: MaskBucket, BucketSize: -5}}},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected error validating %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// DenyPolicy lists tables and columns that must never be queried, in any mode.
+// Table patterns match "table" or "schema.table"; column patterns match
+// "column", "table.column" or "schema.table.column". All parts are globs.
+type DenyPolicy struct {
+	Tables  []string `json:"tables,omitempty"`
+	Columns []string `json:"columns,omitempty"`
+}
+
+// LoadDenyPolicy reads a JSON deny policy file
+func LoadDenyPolicy(policyPath string) (*DenyPolicy, error) {
+	data, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var policy DenyPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file %s: %w", policyPath, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", policyPath, err)
+	}
+	return &policy, nil
+}
+
+// IsEmpty reports whether the policy denies nothing
+func (p DenyPolicy) IsEmpty() bool {
+	return len(p.Tables) == 0 && len(p.Columns) == 0
+}
+
+// Validate checks that all patterns are well-formed globs with the expected number of parts
+func (p DenyPolicy) Validate() error {
+	for _, pattern := range p.Tables {
+		if err := validatePattern(pattern, 2); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range p.Columns {
+		if err := validatePattern(pattern, 3); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validatePattern(pattern string, maxParts int) error {
+	parts := strings.Split(pattern, ".")
+	if len(parts) > maxParts {
+		return fmt.Errorf("invalid pattern %q: too many parts", pattern)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return fmt.Errorf("invalid pattern %q: empty part", pattern)
+		}
+		if _, err := path.Match(part, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// DeniesTable reports whether the whole table is denied
+func (p DenyPolicy) DeniesTable(schema, table string) bool {
+	for _, pattern := range p.Tables {
+		if matchParts(pattern, schema, table) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeniesColumn reports whether the column (or its whole table) is denied
+func (p DenyPolicy) DeniesColumn(schema, table, column string) bool {
+	if p.DeniesTable(schema, table) {
+		return true
+	}
+	for _, pattern := range p.Columns {
+		if matchParts(pattern, schema, table, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchParts matches a dotted pattern against the trailing parts of a name
+func matchParts(pattern string, names ...string) bool {
+	parts := strings.Split(pattern, ".")
+	if len(parts) > len(names) {
+		return false
+	}
+	names = names[len(names)-len(parts):]
+	for i, part := range parts {
+		if ok, _ := path.Match(part, names[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
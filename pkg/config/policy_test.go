@@ -0,0 +1,84 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDenyPolicy_Matching(t *testing.T) {
+	policy := DenyPolicy{
+		Tables:  []string{"payment_methods", "billing.card_*"},
+		Columns: []string{"users.ssn", "*.password_hash", "hr.employees.salary", "secret_*"},
+	}
+
+	tableTests := []struct {
+		schema   string
+		table    string
+		expected bool
+	}{
+		{"public", "payment_methods", true},
+		{"billing", "card_tokens", true},
+		{"public", "card_tokens", false},
+		{"public", "users", false},
+	}
+	for _, tt := range tableTests {
+		if got := policy.DeniesTable(tt.schema, tt.table); got != tt.expected {
+			t.Errorf("DeniesTable(%s, %s) = %v, expected %v", tt.schema, tt.table, got, tt.expected)
+		}
+	}
+
+	columnTests := []struct {
+		schema   string
+		table    string
+		column   string
+		expected bool
+	}{
+		{"public", "users", "ssn", true},
+		{"public", "users", "email", false},
+		{"public", "accounts", "password_hash", true},
+		{"hr", "employees", "salary", true},
+		{"public", "employees", "salary", false},
+		{"public", "orders", "secret_note", true},
+		{"public", "payment_methods", "id", true},
+	}
+	for _, tt := range columnTests {
+		if got := policy.DeniesColumn(tt.schema, tt.table, tt.column); got != tt.expected {
+			t.Errorf("DeniesColumn(%s, %s, %s) = %v, expected %v", tt.schema, tt.table, tt.column, got, tt.expected)
+		}
+	}
+}
+
+func TestDenyPolicy_Validate(t *testing.T) {
+	invalid := []DenyPolicy{
+		{Tables: []string{"a.b.c"}},
+		{Columns: []string{"a.b.c.d"}},
+		{Columns: []string{"users."}},
+		{Tables: []string{"[bad"}},
+	}
+	for _, policy := range invalid {
+		if err := policy.Validate(); err == nil {
+			t.Errorf("Expected error validating %+v", policy)
+		}
+	}
+}
+
+func TestLoadDenyPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	content := `{"tables": ["payment_methods"], "columns": ["users.ssn"]}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+
+	policy, err := LoadDenyPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadDenyPolicy failed: %v", err)
+	}
+	if policy.IsEmpty() || !policy.DeniesColumn("public", "users", "ssn") {
+		t.Errorf("Unexpected policy: %+v", policy)
+	}
+
+	if _, err := LoadDenyPolicy(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected error for missing policy file")
+	}
+}
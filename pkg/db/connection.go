@@ -38,6 +38,10 @@ func Connect(ctx context.Context, cfg *config.DBConfig) (*ConnectionImpl, error)
 	poolConfig.MinConns = 1 // Keep at least one connection alive
 	poolConfig.MaxConnLifetime = time.Hour
 	poolConfig.MaxConnIdleTime = 30 * time.Minute
+	if cfg.ReadOnly {
+		// Postgres rejects writes in every transaction, including ones the query opens itself
+		poolConfig.ConnConfig.RuntimeParams["default_transaction_read_only"] = "on"
+	}
 
 	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
@@ -70,6 +74,34 @@ func (c *ConnectionImpl) Query(ctx context.Context, sql string, args ...interfac
 	return c.pool.Query(ctx, sql, args...)
 }
 
+// QueryReadOnly runs a query in a read-only transaction that is always rolled back
+func (c *ConnectionImpl) QueryReadOnly(ctx context.Context, sql string, scan func(pgx.Rows) error) error {
+	tx, err := c.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	// Roll back even if ctx was cancelled, so the connection goes back to the pool clean
+	defer func() { _ = tx.Rollback(context.Background()) }()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := max(time.Until(deadline).Milliseconds(), 1)
+		if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout)); err != nil {
+			return err
+		}
+	}
+
+	rows, err := tx.Query(ctx, sql)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if err := scan(rows); err != nil {
+		return err
+	}
+	rows.Close()
+	return rows.Err()
+}
+
 // QueryRow executes a query that returns at most one row
 func (c *ConnectionImpl) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
 	return c.pool.QueryRow(ctx, sql, args...)
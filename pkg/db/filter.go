@@ -0,0 +1,510 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/AliciaSchep/pgbabble/pkg/config"
+	"github.com/AliciaSchep/pgbabble/pkg/sqlparse"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// FilteredConnection wraps a Connection and hides schemas and tables excluded by an
+// ObjectFilter, and tables and columns denied by a DenyPolicy, from every schema
+// operation and from queries
+type FilteredConnection struct {
+	inner  Connection
+	filter config.ObjectFilter
+	policy config.DenyPolicy
+}
+
+// PolicyViolationError explains why a query was blocked by the deny policy
+type PolicyViolationError struct {
+	Reasons []string
+}
+
+func (e *PolicyViolationError) Error() string {
+	return "blocked by data policy: " + strings.Join(e.Reasons, "; ")
+}
+
+// Ensure that FilteredConnection implements the interfaces
+var (
+	_ Connection     = (*FilteredConnection)(nil)
+	_ QueryValidator = (*FilteredConnection)(nil)
+)
+
+// NewFilteredConnection creates a connection that only exposes objects allowed by filter and policy
+func NewFilteredConnection(inner Connection, filter config.ObjectFilter, policy config.DenyPolicy) *FilteredConnection {
+	return &FilteredConnection{inner: inner, filter: filter, policy: policy}
+}
+
+func excludedError(schema, name string) error {
+	return fmt.Errorf("%s.%s is excluded by the configured schema/table filters", schema, name)
+}
+
+// visible reports whether a table passes both the filter and the deny policy
+func (f *FilteredConnection) visible(schema, tableName string) bool {
+	return f.filter.AllowsTable(schema, tableName) && !f.policy.DeniesTable(schema, tableName)
+}
+
+// checkTable returns an error when a table is excluded or denied
+func (f *FilteredConnection) checkTable(schema, tableName string) error {
+	if !f.filter.AllowsTable(schema, tableName) {
+		return excludedError(schema, tableName)
+	}
+	if f.policy.DeniesTable(schema, tableName) {
+		return &PolicyViolationError{Reasons: []string{fmt.Sprintf("table %s.%s is denied", schema, tableName)}}
+	}
+	return nil
+}
+
+// checkViewDependencies returns an error when a view reads an excluded relation or a
+// denied table or column, directly or through other views, so that it cannot be used to
+// get around the filters. Plain tables have no dependencies.
+func (f *FilteredConnection) checkViewDependencies(ctx context.Context, schema, viewName string) error {
+	if f.filter.IsEmpty() && f.policy.IsEmpty() {
+		return nil
+	}
+	dependencies, err := f.inner.ViewDependencies(ctx, schema, viewName)
+	if err != nil {
+		return fmt.Errorf("could not check what %s.%s reads: %w", schema, viewName, err)
+	}
+
+	var reasons []string
+	for _, dep := range dependencies {
+		switch {
+		case !f.filter.AllowsTable(dep.Schema, dep.Table):
+			return fmt.Errorf("view %s.%s reads %s.%s, which is excluded by the configured schema/table filters", schema, viewName, dep.Schema, dep.Table)
+		case f.policy.DeniesTable(dep.Schema, dep.Table):
+			reasons = append(reasons, fmt.Sprintf("view %s.%s reads denied table %s.%s", schema, viewName, dep.Schema, dep.Table))
+		case dep.Column != "" && f.policy.DeniesColumn(dep.Schema, dep.Table, dep.Column):
+			reasons = append(reasons, fmt.Sprintf("view %s.%s reads denied column %s.%s.%s", schema, viewName, dep.Schema, dep.Table, dep.Column))
+		}
+	}
+	if len(reasons) > 0 {
+		return &PolicyViolationError{Reasons: reasons}
+	}
+	return nil
+}
+
+// ResolveTableName resolves a name and rejects it if the relation is excluded
+func (f *FilteredConnection) ResolveTableName(ctx context.Context, name string) (string, string, error) {
+	schema, tableName, err := f.inner.ResolveTableName(ctx, name)
+	if err != nil {
+		return "", "", err
+	}
+	if err := f.checkTable(schema, tableName); err != nil {
+		return "", "", err
+	}
+	return schema, tableName, nil
+}
+
+// ListTables returns only the allowed tables
+func (f *FilteredConnection) ListTables(ctx context.Context) ([]TableInfo, error) {
+	tables, err := f.inner.ListTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var allowed []TableInfo
+	for _, table := range tables {
+		if f.visible(table.Schema, table.Name) {
+			allowed = append(allowed, table)
+		}
+	}
+	return allowed, nil
+}
+
+// DescribeTable describes an allowed table without its denied columns
+func (f *FilteredConnection) DescribeTable(ctx context.Context, schema, tableName string) (*TableInfo, error) {
+	if err := f.checkTable(schema, tableName); err != nil {
+		return nil, err
+	}
+	table, err := f.inner.DescribeTable(ctx, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]ColumnInfo, 0, len(table.Columns))
+	for _, col := range table.Columns {
+		if !f.policy.DeniesColumn(table.Schema, table.Name, col.Name) {
+			columns = append(columns, col)
+		}
+	}
+	table.Columns = columns
+	return table, nil
+}
+
+// GetForeignKeys returns relationships between allowed tables only
+func (f *FilteredConnection) GetForeignKeys(ctx context.Context, schema, tableName string) ([]ForeignKeyInfo, error) {
+	if err := f.checkTable(schema, tableName); err != nil {
+		return nil, err
+	}
+	foreignKeys, err := f.inner.GetForeignKeys(ctx, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	var allowed []ForeignKeyInfo
+	for _, fk := range foreignKeys {
+		if f.visible(fk.TableSchema, fk.TableName) && f.visible(fk.ForeignTableSchema, fk.ForeignTableName) &&
+			!f.policy.DeniesColumn(fk.TableSchema, fk.TableName, fk.ColumnName) &&
+			!f.policy.DeniesColumn(fk.ForeignTableSchema, fk.ForeignTableName, fk.ForeignColumnName) {
+			allowed = append(allowed, fk)
+		}
+	}
+	return allowed, nil
+}
+
+// ListIndexes hides indexes of hidden tables and indexes on denied columns
+func (f *FilteredConnection) ListIndexes(ctx context.Context, schema, tableName string) ([]IndexInfo, error) {
+	if err := f.checkTable(schema, tableName); err != nil {
+		return nil, err
+	}
+	indexes, err := f.inner.ListIndexes(ctx, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	var allowed []IndexInfo
+	for _, idx := range indexes {
+		denied := false
+		for _, column := range idx.Columns {
+			denied = denied || f.policy.DeniesColumn(schema, tableName, column)
+		}
+		if !denied {
+			allowed = append(allowed, idx)
+		}
+	}
+	return allowed, nil
+}
+
+// SearchColumns returns matching columns of allowed tables
+func (f *FilteredConnection) SearchColumns(ctx context.Context, pattern string) ([]ColumnInfo, error) {
+	columns, err := f.inner.SearchColumns(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	var allowed []ColumnInfo
+	for _, col := range columns {
+		if f.filter.AllowsTable(col.TableSchema, col.TableName) && !f.policy.DeniesColumn(col.TableSchema, col.TableName, col.Name) {
+			allowed = append(allowed, col)
+		}
+	}
+	return allowed, nil
+}
+
+// GetViewDefinition returns the definition of an allowed view that only reads allowed objects
+func (f *FilteredConnection) GetViewDefinition(ctx context.Context, schema, viewName string) (*ViewInfo, error) {
+	if err := f.checkTable(schema, viewName); err != nil {
+		return nil, err
+	}
+	if err := f.checkViewDependencies(ctx, schema, viewName); err != nil {
+		return nil, err
+	}
+	return f.inner.GetViewDefinition(ctx, schema, viewName)
+}
+
+// ViewDependencies returns the dependencies of an allowed view
+func (f *FilteredConnection) ViewDependencies(ctx context.Context, schema, viewName string) ([]ViewDependency, error) {
+	if err := f.checkTable(schema, viewName); err != nil {
+		return nil, err
+	}
+	return f.inner.ViewDependencies(ctx, schema, viewName)
+}
+
+// ListFunctions returns functions in allowed schemas
+func (f *FilteredConnection) ListFunctions(ctx context.Context, pattern string) ([]FunctionInfo, error) {
+	functions, err := f.inner.ListFunctions(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	var allowed []FunctionInfo
+	for _, fn := range functions {
+		if f.filter.AllowsSchema(fn.Schema) {
+			allowed = append(allowed, fn)
+		}
+	}
+	return allowed, nil
+}
+
+// GetColumnStats returns statistics for the allowed columns of an allowed table
+func (f *FilteredConnection) GetColumnStats(ctx context.Context, schema, tableName string) ([]ColumnStats, error) {
+	if err := f.checkTable(schema, tableName); err != nil {
+		return nil, err
+	}
+	if err := f.checkViewDependencies(ctx, schema, tableName); err != nil {
+		return nil, err
+	}
+	stats, err := f.inner.GetColumnStats(ctx, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	var allowed []ColumnStats
+	for _, stat := range stats {
+		if !f.policy.DeniesColumn(schema, tableName, stat.Column) {
+			allowed = append(allowed, stat)
+		}
+	}
+	return allowed, nil
+}
+
+// SampleColumnValues samples an allowed column of an allowed table
+func (f *FilteredConnection) SampleColumnValues(ctx context.Context, schema, tableName, columnName string, limit int) ([]string, error) {
+	if err := f.checkTable(schema, tableName); err != nil {
+		return nil, err
+	}
+	if f.policy.DeniesColumn(schema, tableName, columnName) {
+		return nil, &PolicyViolationError{Reasons: []string{fmt.Sprintf("column %s.%s.%s is denied", schema, tableName, columnName)}}
+	}
+	if err := f.checkViewDependencies(ctx, schema, tableName); err != nil {
+		return nil, err
+	}
+	return f.inner.SampleColumnValues(ctx, schema, tableName, columnName, limit)
+}
+
+// SourceColumns delegates to the wrapped connection; it only names columns of results the
+// filters already allowed
+func (f *FilteredConnection) SourceColumns(ctx context.Context, fields []pgconn.FieldDescription) ([]string, error) {
+	return f.inner.SourceColumns(ctx, fields)
+}
+
+// Query runs a query after checking that it only references allowed relations
+func (f *FilteredConnection) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if err := f.ValidateQuery(ctx, sql); err != nil {
+		return nil, err
+	}
+	return f.inner.Query(ctx, sql, args...)
+}
+
+// HypotheticalPlan plans a query with hypothetical indexes after checking that it only references allowed relations
+func (f *FilteredConnection) HypotheticalPlan(ctx context.Context, sql string, createIndexStatements []string) ([]byte, error) {
+	if err := f.ValidateQuery(ctx, sql); err != nil {
+		return nil, err
+	}
+	return f.inner.HypotheticalPlan(ctx, sql, createIndexStatements)
+}
+
+// QueryReadOnly runs a read-only query after checking that it only references allowed relations
+func (f *FilteredConnection) QueryReadOnly(ctx context.Context, sql string, scan func(pgx.Rows) error) error {
+	if err := f.ValidateQuery(ctx, sql); err != nil {
+		return err
+	}
+	return f.inner.QueryReadOnly(ctx, sql, scan)
+}
+
+// EnsureConnection delegates to the wrapped connection
+func (f *FilteredConnection) EnsureConnection(ctx context.Context) {
+	f.inner.EnsureConnection(ctx)
+}
+
+// scopedTable is a table referenced by a query, resolved to its schema
+type scopedTable struct {
+	schema        string
+	name          string
+	alias         string
+	columnAliases []string
+}
+
+// uncheckedSQLFunctions run SQL passed as a string, or read tables and cursors named in one,
+// so the relations they read cannot be checked against the filters and the deny policy
+var uncheckedSQLFunctions = map[string]bool{
+	"query_to_xml": true, "query_to_xml_and_xmlschema": true, "query_to_xmlschema": true,
+	"table_to_xml": true, "table_to_xml_and_xmlschema": true, "table_to_xmlschema": true,
+	"cursor_to_xml": true, "cursor_to_xmlschema": true,
+	"schema_to_xml": true, "schema_to_xml_and_xmlschema": true, "schema_to_xmlschema": true,
+	"database_to_xml": true, "database_to_xml_and_xmlschema": true, "database_to_xmlschema": true,
+	"ts_stat": true, "dblink": true, "dblink_exec": true, "dblink_open": true, "dblink_send_query": true,
+}
+
+// statisticsCatalogs expose sampled column values of every table
+var statisticsCatalogs = map[string]bool{
+	"pg_stats": true, "pg_statistic": true, "pg_stats_ext": true, "pg_stats_ext_exprs": true,
+	"pg_statistic_ext_data": true,
+}
+
+// checkUncheckable rejects functions and catalogs that read data the filters cannot see
+func checkUncheckable(analysis *sqlparse.Analysis) error {
+	for _, fn := range analysis.Functions {
+		if uncheckedSQLFunctions[fn.Name] {
+			return fmt.Errorf("query calls %s, which reads relations named in a string that cannot be checked against the configured filters and data policy", fn.Name)
+		}
+	}
+	for _, ref := range analysis.Tables {
+		if (ref.Schema == "" || ref.Schema == "pg_catalog") && statisticsCatalogs[ref.Name] {
+			return fmt.Errorf("query reads pg_catalog.%s, which exposes column values that cannot be checked against the configured filters and data policy; use the column_stats tool instead", ref.Name)
+		}
+	}
+	return nil
+}
+
+// ValidateQuery rejects queries that reference excluded relations or denied tables
+// and columns, or views that read them. Unqualified names are resolved against the search_path the same way
+// Postgres would; denied columns are caught through aliases, * and whole-row references.
+func (f *FilteredConnection) ValidateQuery(ctx context.Context, sql string) error {
+	analysis, err := sqlparse.Analyze(sql)
+	if err != nil {
+		return fmt.Errorf("could not parse query to check referenced tables: %w", err)
+	}
+	if err := checkUncheckable(analysis); err != nil {
+		return err
+	}
+
+	var excluded []string
+	var scope []scopedTable
+	for _, ref := range analysis.Tables {
+		schema, name := ref.Schema, ref.Name
+		if schema == "" {
+			resolvedSchema, resolvedName, err := f.inner.ResolveTableName(ctx, QualifiedName{Name: name}.String())
+			if errors.Is(err, ErrRelationNotFound) {
+				// Unknown relations fail in the database anyway
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("could not resolve %s to check it against the configured filters: %w", name, err)
+			}
+			schema, name = resolvedSchema, resolvedName
+		}
+		if !f.filter.AllowsTable(schema, name) {
+			excluded = append(excluded, schema+"."+name)
+		}
+		scope = append(scope, scopedTable{schema: schema, name: name, alias: ref.Alias, columnAliases: ref.ColumnAliases})
+	}
+
+	if len(excluded) > 0 {
+		return fmt.Errorf("query references tables excluded by the configured schema/table filters: %s", strings.Join(excluded, ", "))
+	}
+
+	// Views must not read what the query itself could not
+	checked := make(map[string]bool)
+	for _, t := range scope {
+		relation := t.schema + "." + t.name
+		if checked[relation] {
+			continue
+		}
+		checked[relation] = true
+		if err := f.checkViewDependencies(ctx, t.schema, t.name); err != nil {
+			return err
+		}
+	}
+
+	if f.policy.IsEmpty() {
+		return nil
+	}
+	return f.checkPolicy(ctx, analysis, scope)
+}
+
+// checkPolicy applies the deny policy to the tables, columns and * entries of a query
+func (f *FilteredConnection) checkPolicy(ctx context.Context, analysis *sqlparse.Analysis, scope []scopedTable) error {
+	var reasons []string
+	seen := make(map[string]bool)
+	addReason := func(reason string) {
+		if !seen[reason] {
+			seen[reason] = true
+			reasons = append(reasons, reason)
+		}
+	}
+
+	for _, t := range scope {
+		if f.policy.DeniesTable(t.schema, t.name) {
+			addReason(fmt.Sprintf("table %s.%s is denied", t.schema, t.name))
+		}
+	}
+
+	// matching returns the tables a qualifier refers to, or all tables when it is unknown
+	matching := func(qualifier string) []scopedTable {
+		if qualifier == "" {
+			return scope
+		}
+		var matches []scopedTable
+		for _, t := range scope {
+			if t.alias == qualifier || (t.alias == "" && t.name == qualifier) {
+				matches = append(matches, t)
+			}
+		}
+		if len(matches) == 0 {
+			// Qualifier of a subquery or CTE: it may expose any table's columns
+			return scope
+		}
+		return matches
+	}
+
+	// Selecting every column of a table includes its denied columns
+	deniedColumnsOf := func(t scopedTable) ([]string, error) {
+		table, err := f.inner.DescribeTable(ctx, t.schema, t.name)
+		if err != nil {
+			return nil, err
+		}
+		var denied []string
+		for _, col := range table.Columns {
+			if f.policy.DeniesColumn(t.schema, t.name, col.Name) {
+				denied = append(denied, col.Name)
+			}
+		}
+		return denied, nil
+	}
+	checkAllColumns := func(t scopedTable, what string) {
+		denied, err := deniedColumnsOf(t)
+		if err != nil {
+			addReason(fmt.Sprintf("could not check the columns %s on %s.%s would include: %v", what, t.schema, t.name, err))
+			return
+		}
+		if len(denied) > 0 {
+			addReason(fmt.Sprintf("%s on %s.%s would include denied column(s) %s; list the allowed columns explicitly",
+				what, t.schema, t.name, strings.Join(denied, ", ")))
+		}
+	}
+
+	for _, star := range analysis.Stars {
+		what := "SELECT *"
+		if star.Qualifier != "" {
+			what = fmt.Sprintf("SELECT %s.*", star.Qualifier)
+		}
+		for _, t := range matching(star.Qualifier) {
+			checkAllColumns(t, what)
+		}
+	}
+
+	// sourceColumn maps a name from an alias column list back to the column it renames
+	sourceColumn := func(t scopedTable, name string) (string, error) {
+		for k, alias := range t.columnAliases {
+			if alias != name {
+				continue
+			}
+			table, err := f.inner.DescribeTable(ctx, t.schema, t.name)
+			if err != nil {
+				return "", err
+			}
+			if k >= len(table.Columns) {
+				return "", fmt.Errorf("%s.%s has only %d columns", t.schema, t.name, len(table.Columns))
+			}
+			return table.Columns[k].Name, nil
+		}
+		return name, nil
+	}
+
+	for _, col := range analysis.Columns {
+		for _, t := range matching(col.Qualifier) {
+			name, err := sourceColumn(t, col.Name)
+			if err != nil {
+				addReason(fmt.Sprintf("could not resolve column alias %s of %s.%s: %v", col.Name, t.schema, t.name, err))
+				continue
+			}
+			if f.policy.DeniesColumn(t.schema, t.name, name) {
+				addReason(fmt.Sprintf("column %s.%s.%s is denied", t.schema, t.name, name))
+			}
+		}
+		// A bare table name or alias in an expression is a whole-row reference
+		if col.Qualifier == "" {
+			for _, t := range scope {
+				if t.alias == col.Name || (t.alias == "" && t.name == col.Name) {
+					checkAllColumns(t, fmt.Sprintf("whole-row reference %s", col.Name))
+				}
+			}
+		}
+	}
+
+	if len(reasons) > 0 {
+		return &PolicyViolationError{Reasons: reasons}
+	}
+	return nil
+}
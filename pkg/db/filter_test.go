@@ -0,0 +1,414 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/AliciaSchep/pgbabble/pkg/config"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// stubConnection is a minimal in-memory Connection for wrapper tests
+type stubConnection struct {
+	tables  []TableInfo
+	views   map[string][]ViewDependency // dependencies by schema.view
+	queried []string
+
+	// resolveErr and describeErr make lookups fail, as when the database is unreachable
+	resolveErr  error
+	describeErr error
+}
+
+func (s *stubConnection) ResolveTableName(ctx context.Context, name string) (string, string, error) {
+	if s.resolveErr != nil {
+		return "", "", s.resolveErr
+	}
+	qn, err := ParseQualifiedName(name)
+	if err != nil {
+		return "", "", err
+	}
+	if qn.Schema != "" {
+		return qn.Schema, qn.Name, nil
+	}
+	for _, table := range s.tables {
+		if table.Name == qn.Name {
+			return table.Schema, table.Name, nil
+		}
+	}
+	return "", "", fmt.Errorf("%w: %s", ErrRelationNotFound, qn.Name)
+}
+
+func (s *stubConnection) ListTables(ctx context.Context) ([]TableInfo, error) {
+	return s.tables, nil
+}
+
+func (s *stubConnection) DescribeTable(ctx context.Context, schema, tableName string) (*TableInfo, error) {
+	if s.describeErr != nil {
+		return nil, s.describeErr
+	}
+	for _, table := range s.tables {
+		if table.Schema == schema && table.Name == tableName {
+			return &table, nil
+		}
+	}
+	return nil, fmt.Errorf("table %s.%s not found", schema, tableName)
+}
+
+func (s *stubConnection) GetForeignKeys(ctx context.Context, schema, tableName string) ([]ForeignKeyInfo, error) {
+	return []ForeignKeyInfo{
+		{TableSchema: schema, TableName: tableName, ForeignTableSchema: "public", ForeignTableName: "users"},
+		{TableSchema: schema, TableName: tableName, ForeignTableSchema: "staging", ForeignTableName: "raw_users"},
+	}, nil
+}
+
+func (s *stubConnection) SearchColumns(ctx context.Context, pattern string) ([]ColumnInfo, error) {
+	return []ColumnInfo{
+		{Name: "id", TableSchema: "public", TableName: "users"},
+		{Name: "id", TableSchema: "staging", TableName: "raw_users"},
+	}, nil
+}
+
+func (s *stubConnection) GetViewDefinition(ctx context.Context, schema, viewName string) (*ViewInfo, error) {
+	return &ViewInfo{Schema: schema, Name: viewName}, nil
+}
+
+func (s *stubConnection) ViewDependencies(ctx context.Context, schema, viewName string) ([]ViewDependency, error) {
+	return s.views[schema+"."+viewName], nil
+}
+
+func (s *stubConnection) ListFunctions(ctx context.Context, pattern string) ([]FunctionInfo, error) {
+	return []FunctionInfo{{Schema: "public", Name: "f", ArgumentNames: []string{"since"}}, {Schema: "staging", Name: "g"}}, nil
+}
+
+func (s *stubConnection) GetColumnStats(ctx context.Context, schema, tableName string) ([]ColumnStats, error) {
+	return nil, nil
+}
+
+func (s *stubConnection) SampleColumnValues(ctx context.Context, schema, tableName, columnName string, limit int) ([]string, error) {
+	return nil, nil
+}
+
+func (s *stubConnection) SourceColumns(ctx context.Context, fields []pgconn.FieldDescription) ([]string, error) {
+	return make([]string, len(fields)), nil
+}
+
+func (s *stubConnection) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	s.queried = append(s.queried, sql)
+	return nil, nil
+}
+
+func (s *stubConnection) ListIndexes(ctx context.Context, schema, tableName string) ([]IndexInfo, error) {
+	return []IndexInfo{
+		{Name: tableName + "_pkey", TableName: tableName, Columns: []string{"id"}, IsPrimary: true},
+		{Name: tableName + "_ssn_idx", TableName: tableName, Columns: []string{"ssn"}},
+	}, nil
+}
+
+func (s *stubConnection) HypotheticalPlan(ctx context.Context, sql string, createIndexStatements []string) ([]byte, error) {
+	s.queried = append(s.queried, sql)
+	return nil, ErrHypoPGUnavailable
+}
+
+func (s *stubConnection) QueryReadOnly(ctx context.Context, sql string, scan func(pgx.Rows) error) error {
+	s.queried = append(s.queried, sql)
+	return nil
+}
+
+func (s *stubConnection) EnsureConnection(ctx context.Context) {}
+
+func newFilteredStub() (*FilteredConnection, *stubConnection) {
+	stub := &stubConnection{
+		tables: []TableInfo{
+			{Schema: "public", Name: "users"},
+			{Schema: "public", Name: "orders"},
+			{Schema: "staging", Name: "raw_users"},
+		},
+	}
+	filter := config.ObjectFilter{ExcludeSchemas: []string{"staging"}}
+	return NewFilteredConnection(stub, filter, config.DenyPolicy{}), stub
+}
+
+func TestFilteredConnection_SchemaOperations(t *testing.T) {
+	conn, _ := newFilteredStub()
+	ctx := context.Background()
+
+	tables, _ := conn.ListTables(ctx)
+	if len(tables) != 2 {
+		t.Errorf("Expected 2 visible tables, got %+v", tables)
+	}
+
+	if _, err := conn.DescribeTable(ctx, "staging", "raw_users"); err == nil {
+		t.Error("Expected error describing excluded table")
+	}
+	if _, _, err := conn.ResolveTableName(ctx, "raw_users"); err == nil {
+		t.Error("Expected error resolving excluded table")
+	}
+
+	fks, _ := conn.GetForeignKeys(ctx, "public", "orders")
+	if len(fks) != 1 || fks[0].ForeignTableName != "users" {
+		t.Errorf("Expected only relationships to visible tables, got %+v", fks)
+	}
+
+	columns, _ := conn.SearchColumns(ctx, "id")
+	if len(columns) != 1 || columns[0].TableSchema != "public" {
+		t.Errorf("Expected only columns of visible tables, got %+v", columns)
+	}
+
+	functions, _ := conn.ListFunctions(ctx, "")
+	if len(functions) != 1 || functions[0].Schema != "public" {
+		t.Errorf("Expected only functions in visible schemas, got %+v", functions)
+	}
+}
+
+func TestFilteredConnection_ValidateQuery(t *testing.T) {
+	conn, stub := newFilteredStub()
+	ctx := context.Background()
+
+	tests := []struct {
+		sql     string
+		blocked bool
+	}{
+		{"SELECT * FROM users u JOIN orders o ON o.user_id = u.id", false},
+		{"SELECT * FROM staging.raw_users", true},
+		{"SELECT * FROM raw_users", true},
+		{"SELECT id FROM users WHERE id IN (SELECT id FROM STAGING.RAW_USERS)", true},
+		{"SELECT * FROM (staging.raw_users e JOIN public.users u ON true)", true},
+		{"WITH raw_users AS (SELECT * FROM users) SELECT * FROM raw_users", false},
+		{"SELECT * FROM (TABLE raw_users) t", true},
+		{"SELECT * FROM raw_users, (WITH raw_users AS (SELECT 1 AS a) SELECT a FROM raw_users) s", true},
+		{"SELECT 'staging.raw_users' FROM users", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			err := conn.ValidateQuery(ctx, tt.sql)
+			if tt.blocked && (err == nil || !strings.Contains(err.Error(), "staging.raw_users")) {
+				t.Errorf("Expected query to be blocked, got %v", err)
+			}
+			if !tt.blocked && err != nil {
+				t.Errorf("Expected query to be allowed, got %v", err)
+			}
+		})
+	}
+
+	if _, err := conn.Query(ctx, "SELECT * FROM staging.raw_users"); err == nil {
+		t.Error("Expected Query to reject excluded table")
+	}
+	scan := func(pgx.Rows) error { return nil }
+	if err := conn.QueryReadOnly(ctx, "EXPLAIN (ANALYZE, FORMAT JSON) SELECT * FROM staging.raw_users", scan); err == nil {
+		t.Error("Expected QueryReadOnly to reject excluded table")
+	}
+	if len(stub.queried) != 0 {
+		t.Errorf("Expected blocked query not to reach the database, got %v", stub.queried)
+	}
+}
+
+func newPolicyStub() *FilteredConnection {
+	stub := &stubConnection{
+		tables: []TableInfo{
+			{Schema: "public", Name: "users", Columns: []ColumnInfo{{Name: "id"}, {Name: "email"}, {Name: "ssn"}}},
+			{Schema: "public", Name: "orders", Columns: []ColumnInfo{{Name: "id"}, {Name: "user_id"}}},
+			{Schema: "public", Name: "payment_methods", Columns: []ColumnInfo{{Name: "id"}}},
+		},
+	}
+	policy := config.DenyPolicy{Tables: []string{"payment_methods"}, Columns: []string{"users.ssn"}}
+	return NewFilteredConnection(stub, config.ObjectFilter{}, policy)
+}
+
+func TestFilteredConnection_DenyPolicyHidesObjects(t *testing.T) {
+	conn := newPolicyStub()
+	ctx := context.Background()
+
+	tables, _ := conn.ListTables(ctx)
+	for _, table := range tables {
+		if table.Name == "payment_methods" {
+			t.Error("Expected denied table to be hidden from ListTables")
+		}
+	}
+
+	table, err := conn.DescribeTable(ctx, "public", "users")
+	if err != nil {
+		t.Fatalf("DescribeTable failed: %v", err)
+	}
+	for _, col := range table.Columns {
+		if col.Name == "ssn" {
+			t.Error("Expected denied column to be hidden from DescribeTable")
+		}
+	}
+	if len(table.Columns) != 2 {
+		t.Errorf("Expected 2 visible columns, got %+v", table.Columns)
+	}
+
+	_, err = conn.DescribeTable(ctx, "public", "payment_methods")
+	var violation *PolicyViolationError
+	if !errors.As(err, &violation) {
+		t.Errorf("Expected policy violation describing denied table, got %v", err)
+	}
+
+	if _, err := conn.SampleColumnValues(ctx, "public", "users", "ssn", 5); !errors.As(err, &violation) {
+		t.Errorf("Expected policy violation sampling denied column, got %v", err)
+	}
+
+	indexes, err := conn.ListIndexes(ctx, "public", "users")
+	if err != nil {
+		t.Fatalf("ListIndexes failed: %v", err)
+	}
+	if len(indexes) != 1 || indexes[0].Name != "users_pkey" {
+		t.Errorf("Expected index on denied column to be hidden, got %+v", indexes)
+	}
+	if _, err := conn.ListIndexes(ctx, "public", "payment_methods"); !errors.As(err, &violation) {
+		t.Errorf("Expected policy violation listing indexes of denied table, got %v", err)
+	}
+}
+
+func TestFilteredConnection_DenyPolicyQueries(t *testing.T) {
+	conn := newPolicyStub()
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		sql     string
+		blocked string
+	}{
+		{"allowed columns", "SELECT id, email FROM users", ""},
+		{"denied column", "SELECT ssn FROM users", "column public.users.ssn is denied"},
+		{"denied column through alias", "SELECT u.ssn AS x FROM users u", "column public.users.ssn is denied"},
+		{"denied column in where", "SELECT id FROM users WHERE ssn LIKE '123%'", "column public.users.ssn is denied"},
+		{"select star", "SELECT * FROM users", "SELECT * on public.users would include denied column(s) ssn"},
+		{"qualified star", "SELECT o.*, u.* FROM orders o JOIN users u ON u.id = o.user_id", "SELECT u.* on public.users"},
+		{"star on allowed table", "SELECT o.*, u.email FROM orders o JOIN users u ON u.id = o.user_id", ""},
+		{"star through subquery", "SELECT * FROM (SELECT * FROM users) s", "SELECT * on public.users"},
+		{"whole-row reference", "SELECT row_to_json(u) FROM users u", "whole-row reference u"},
+		{"denied table", "SELECT count(*) FROM payment_methods", "table public.payment_methods is denied"},
+		{"string literal", "SELECT id FROM users WHERE email = 'ssn'", ""},
+		{"output alias", "SELECT email AS ssn FROM users", ""},
+		{"denied table in parenthesized join", "SELECT * FROM (payment_methods CROSS JOIN users) j", "table public.payment_methods is denied"},
+		{"denied table in TABLE command", "SELECT * FROM (TABLE payment_methods) t", "table public.payment_methods is denied"},
+		{"denied table shadowed by a nested cte", "SELECT * FROM payment_methods, (WITH payment_methods AS (SELECT 1 AS a) SELECT a FROM payment_methods) s", "table public.payment_methods is denied"},
+		{"alias column list", "SELECT u.x FROM users u(id, email, x)", "column public.users.ssn is denied"},
+		{"alias column list on allowed column", "SELECT u.x FROM users u(id, x)", ""},
+		{"unresolvable alias column list", "SELECT u.x FROM users u(id, email, ssn, x)", "could not resolve column alias x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := conn.ValidateQuery(ctx, tt.sql)
+			if tt.blocked == "" {
+				if err != nil {
+					t.Errorf("Expected query to be allowed, got %v", err)
+				}
+				return
+			}
+			var violation *PolicyViolationError
+			if !errors.As(err, &violation) {
+				t.Fatalf("Expected policy violation, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.blocked) {
+				t.Errorf("Expected reason containing %q, got %v", tt.blocked, err)
+			}
+		})
+	}
+}
+
+func TestFilteredConnection_LookupFailures(t *testing.T) {
+	ctx := context.Background()
+
+	// Unknown relations are left for the database to reject
+	conn := newPolicyStub()
+	if err := conn.ValidateQuery(ctx, "SELECT * FROM no_such_table"); err != nil {
+		t.Errorf("Expected an unknown relation to be allowed, got %v", err)
+	}
+
+	// Any other failure to resolve a name rejects the query
+	conn = newPolicyStub()
+	conn.inner.(*stubConnection).resolveErr = errors.New("connection reset")
+	if err := conn.ValidateQuery(ctx, "SELECT id FROM users"); err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("Expected a failed lookup to reject the query, got %v", err)
+	}
+
+	// Columns that cannot be listed might be denied
+	conn = newPolicyStub()
+	conn.inner.(*stubConnection).describeErr = errors.New("connection reset")
+	for _, sql := range []string{"SELECT * FROM users", "SELECT row_to_json(u) FROM users u"} {
+		err := conn.ValidateQuery(ctx, sql)
+		var violation *PolicyViolationError
+		if !errors.As(err, &violation) || !strings.Contains(err.Error(), "could not check the columns") {
+			t.Errorf("%s: expected a failed describe to reject the query, got %v", sql, err)
+		}
+	}
+}
+
+func TestFilteredConnection_UncheckableQueries(t *testing.T) {
+	conn := newPolicyStub()
+	ctx := context.Background()
+
+	for _, sql := range []string{
+		"SELECT query_to_xml('select ssn from users', true, false, '')",
+		"SELECT * FROM pg_catalog.table_to_xml('users', true, false, '') x",
+		"SELECT most_common_vals FROM pg_stats WHERE tablename = 'users'",
+		"SELECT * FROM users WHERE id IN (SELECT 1 FROM payment_methods, )",
+		"SELECT * FROM users JOIN",
+	} {
+		t.Run(sql, func(t *testing.T) {
+			if err := conn.ValidateQuery(ctx, sql); err == nil {
+				t.Errorf("Expected query to be blocked")
+			}
+		})
+	}
+}
+
+func TestFilteredConnection_Views(t *testing.T) {
+	stub := &stubConnection{
+		tables: []TableInfo{
+			{Schema: "public", Name: "users", Columns: []ColumnInfo{{Name: "id"}, {Name: "email"}, {Name: "ssn"}}},
+			{Schema: "public", Name: "user_emails", Type: "view"},
+			{Schema: "public", Name: "user_ssns", Type: "view"},
+			{Schema: "public", Name: "card_counts", Type: "view"},
+			{Schema: "public", Name: "raw_copy", Type: "view"},
+		},
+		views: map[string][]ViewDependency{
+			"public.user_emails": {{Schema: "public", Table: "users", Column: "id"}, {Schema: "public", Table: "users", Column: "email"}},
+			// Dependencies are reported through nested views, so this may be a view over a view
+			"public.user_ssns":   {{Schema: "public", Table: "users", Column: "ssn"}, {Schema: "public", Table: "user_emails"}},
+			"public.card_counts": {{Schema: "public", Table: "payment_methods"}},
+			"public.raw_copy":    {{Schema: "staging", Table: "raw_users", Column: "id"}},
+		},
+	}
+	filter := config.ObjectFilter{ExcludeSchemas: []string{"staging"}}
+	policy := config.DenyPolicy{Tables: []string{"payment_methods"}, Columns: []string{"users.ssn"}}
+	conn := NewFilteredConnection(stub, filter, policy)
+	ctx := context.Background()
+
+	tests := []struct {
+		view    string
+		blocked string
+	}{
+		{"user_emails", ""},
+		{"user_ssns", "view public.user_ssns reads denied column public.users.ssn"},
+		{"card_counts", "view public.card_counts reads denied table public.payment_methods"},
+		{"raw_copy", "view public.raw_copy reads staging.raw_users, which is excluded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.view, func(t *testing.T) {
+			queryErr := conn.ValidateQuery(ctx, "SELECT count(*) FROM "+tt.view)
+			_, definitionErr := conn.GetViewDefinition(ctx, "public", tt.view)
+			_, sampleErr := conn.SampleColumnValues(ctx, "public", tt.view, "id", 5)
+			for what, err := range map[string]error{"query": queryErr, "definition": definitionErr, "sample": sampleErr} {
+				if tt.blocked == "" && err != nil {
+					t.Errorf("Expected %s of %s to be allowed, got %v", what, tt.view, err)
+				}
+				if tt.blocked != "" && (err == nil || !strings.Contains(err.Error(), tt.blocked)) {
+					t.Errorf("Expected %s of %s to be blocked with %q, got %v", what, tt.view, tt.blocked, err)
+				}
+			}
+		})
+	}
+
+	if len(stub.queried) != 0 {
+		t.Errorf("Expected no queries to reach the database, got %v", stub.queried)
+	}
+}
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/AliciaSchep/pgbabble/pkg/sqlparse"
+	"github.com/jackc/pgx/v5"
+)
+
+// QualifiedName is a relation name split into its schema and object parts.
+// Schema is empty when the name was not schema-qualified.
+type QualifiedName struct {
+	Schema string
+	Name   string
+}
+
+// String returns the name in a form Postgres will parse back to the same identifiers
+func (q QualifiedName) String() string {
+	if q.Schema == "" {
+		return QuoteIdentifier(q.Name)
+	}
+	return QuoteIdentifier(q.Schema) + "." + QuoteIdentifier(q.Name)
+}
+
+// QuoteIdentifier quotes an identifier only when Postgres would otherwise change or reject it
+func QuoteIdentifier(ident string) string {
+	if ident == "" {
+		return `""`
+	}
+	if sqlparse.IsReservedKeyword(ident) {
+		return pgx.Identifier{ident}.Sanitize()
+	}
+	for i, r := range ident {
+		plain := (r >= 'a' && r <= 'z') || r == '_' || (i > 0 && ((r >= '0' && r <= '9') || r == '$'))
+		if !plain {
+			return pgx.Identifier{ident}.Sanitize()
+		}
+	}
+	return ident
+}
+
+// ParseIdentifierList splits a dotted identifier chain following Postgres rules:
+// unquoted parts are folded to lower case, quoted parts keep their case and may
+// contain dots, and a doubled quote inside a quoted part stands for one quote.
+func ParseIdentifierList(input string) ([]string, error) {
+	var parts []string
+	s := strings.TrimSpace(input)
+	if s == "" {
+		return nil, fmt.Errorf("empty identifier")
+	}
+
+	i := 0
+	for {
+		// Skip whitespace before a part
+		for i < len(s) && isIdentSpace(s[i]) {
+			i++
+		}
+		if i >= len(s) {
+			return nil, fmt.Errorf("invalid name %q: missing identifier after '.'", input)
+		}
+
+		var part strings.Builder
+		if s[i] == '"' {
+			i++
+			closed := false
+			for i < len(s) {
+				if s[i] == '"' {
+					if i+1 < len(s) && s[i+1] == '"' {
+						part.WriteByte('"')
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				part.WriteByte(s[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("invalid name %q: unterminated quoted identifier", input)
+			}
+			if part.Len() == 0 {
+				return nil, fmt.Errorf("invalid name %q: zero-length quoted identifier", input)
+			}
+		} else {
+			for i < len(s) && s[i] != '.' && s[i] != '"' && !isIdentSpace(s[i]) {
+				part.WriteByte(foldIdentByte(s[i]))
+				i++
+			}
+			if part.Len() == 0 {
+				return nil, fmt.Errorf("invalid name %q: empty identifier", input)
+			}
+		}
+		parts = append(parts, part.String())
+
+		// Skip whitespace after a part; expect '.' or end of input
+		for i < len(s) && isIdentSpace(s[i]) {
+			i++
+		}
+		if i >= len(s) {
+			return parts, nil
+		}
+		if s[i] != '.' {
+			return nil, fmt.Errorf("invalid name %q: unexpected character %q", input, s[i])
+		}
+		i++
+	}
+}
+
+// ParseQualifiedName parses "name" or "schema.name" (each part quoted or unquoted)
+func ParseQualifiedName(input string) (QualifiedName, error) {
+	parts, err := ParseIdentifierList(input)
+	if err != nil {
+		return QualifiedName{}, err
+	}
+	switch len(parts) {
+	case 1:
+		return QualifiedName{Name: parts[0]}, nil
+	case 2:
+		return QualifiedName{Schema: parts[0], Name: parts[1]}, nil
+	default:
+		return QualifiedName{}, fmt.Errorf("invalid name %q: expected name or schema.name", input)
+	}
+}
+
+// ErrRelationNotFound is wrapped by ResolveTableName errors for names that match no relation
+var ErrRelationNotFound = errors.New("relation not found")
+
+// ResolveTableName parses a possibly qualified relation name and, when no schema is
+// given, finds the schema the relation resolves to on the session's search_path
+func (c *ConnectionImpl) ResolveTableName(ctx context.Context, name string) (string, string, error) {
+	qn, err := ParseQualifiedName(name)
+	if err != nil {
+		return "", "", err
+	}
+	if qn.Schema != "" {
+		return qn.Schema, qn.Name, nil
+	}
+
+	query := `
+		SELECT n.nspname, c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.oid = to_regclass($1::text)
+	`
+	var schema, table string
+	err = c.QueryRow(ctx, query, qn.String()).Scan(&schema, &table)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var searchPath string
+		if spErr := c.QueryRow(ctx, "SELECT current_setting('search_path')").Scan(&searchPath); spErr != nil {
+			return "", "", fmt.Errorf("%w: %s is not on the search_path", ErrRelationNotFound, qn.Name)
+		}
+		return "", "", fmt.Errorf("%w: %s is not on the search_path (%s)", ErrRelationNotFound, qn.Name, searchPath)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve %s: %w", qn.Name, err)
+	}
+	return schema, table, nil
+}
+
+func isIdentSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
+
+// foldIdentByte lower-cases ASCII letters the way Postgres folds unquoted identifiers
+func foldIdentByte(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + ('a' - 'A')
+	}
+	return b
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestParseQualifiedName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected QualifiedName
+	}{
+		{"users", QualifiedName{Name: "users"}},
+		{"public.users", QualifiedName{Schema: "public", Name: "users"}},
+		{"Sales.Orders", QualifiedName{Schema: "sales", Name: "orders"}},
+		{`"Sales"."Orders"`, QualifiedName{Schema: "Sales", Name: "Orders"}},
+		{`"order.items"`, QualifiedName{Name: "order.items"}},
+		{`analytics."Order.Items"`, QualifiedName{Schema: "analytics", Name: "Order.Items"}},
+		{`"say ""hi"""`, QualifiedName{Name: `say "hi"`}},
+		{` public . users `, QualifiedName{Schema: "public", Name: "users"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseQualifiedName(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseQualifiedName_Invalid(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"public.",
+		".users",
+		`"unterminated`,
+		`""`,
+		"a.b.c",
+		`public."users"x`,
+	} {
+		t.Run(input, func(t *testing.T) {
+			if _, err := ParseQualifiedName(input); err == nil {
+				t.Errorf("Expected error parsing %q", input)
+			}
+		})
+	}
+}
+
+func TestQualifiedName_String(t *testing.T) {
+	tests := []struct {
+		name     QualifiedName
+		expected string
+	}{
+		{QualifiedName{Name: "users"}, "users"},
+		{QualifiedName{Schema: "public", Name: "users"}, "public.users"},
+		{QualifiedName{Schema: "Sales", Name: "order.items"}, `"Sales"."order.items"`},
+		{QualifiedName{Name: `say "hi"`}, `"say ""hi"""`},
+		{QualifiedName{Schema: "public", Name: "order"}, `public."order"`},
+	}
+
+	for _, tt := range tests {
+		if got := tt.name.String(); got != tt.expected {
+			t.Errorf("Expected %s, got %s", tt.expected, got)
+		}
+		// Round trip through the parser
+		parsed, err := ParseQualifiedName(tt.name.String())
+		if err != nil || parsed != tt.name {
+			t.Errorf("Round trip of %+v gave %+v (err %v)", tt.name, parsed, err)
+		}
+	}
+}
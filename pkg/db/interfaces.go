@@ -4,21 +4,51 @@ import (
 	"context"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 // Connection interface defines all database operations available to other packages
 // This allows for dependency injection and easier testing with mocks
 type Connection interface {
 	// Schema operations
+	ResolveTableName(ctx context.Context, name string) (schema, tableName string, err error)
 	ListTables(ctx context.Context) ([]TableInfo, error)
 	DescribeTable(ctx context.Context, schema, tableName string) (*TableInfo, error)
 	GetForeignKeys(ctx context.Context, schema, tableName string) ([]ForeignKeyInfo, error)
+	ListIndexes(ctx context.Context, schema, tableName string) ([]IndexInfo, error)
 	SearchColumns(ctx context.Context, pattern string) ([]ColumnInfo, error)
+	GetViewDefinition(ctx context.Context, schema, viewName string) (*ViewInfo, error)
+	ViewDependencies(ctx context.Context, schema, viewName string) ([]ViewDependency, error)
+	ListFunctions(ctx context.Context, pattern string) ([]FunctionInfo, error)
+	GetColumnStats(ctx context.Context, schema, tableName string) ([]ColumnStats, error)
+	SampleColumnValues(ctx context.Context, schema, tableName, columnName string, limit int) ([]string, error)
+	// SourceColumns returns the table column each result field reads directly, empty for
+	// computed fields
+	SourceColumns(ctx context.Context, fields []pgconn.FieldDescription) ([]string, error)
 
 	// Query operations
 	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	// QueryReadOnly runs a query in a read-only transaction that is always rolled back,
+	// passing its rows to scan. A deadline on ctx also becomes the statement_timeout.
+	QueryReadOnly(ctx context.Context, sql string, scan func(pgx.Rows) error) error
+	// HypotheticalPlan returns the EXPLAIN (FORMAT JSON) plan of a query as if the given
+	// CREATE INDEX statements had been run, using the hypopg extension. It returns
+	// ErrHypoPGUnavailable when hypopg is not installed.
+	HypotheticalPlan(ctx context.Context, sql string, createIndexStatements []string) ([]byte, error)
 	EnsureConnection(ctx context.Context)
 }
 
+// QueryValidator is implemented by connections that restrict which objects a query may
+// reference; tools call it before asking the user to approve a query
+type QueryValidator interface {
+	ValidateQuery(ctx context.Context, sql string) error
+}
+
+// IdentifierRecorder is implemented by connections that pseudonymize identifiers; tools
+// call it with object names they read from query plans rather than from schema operations
+type IdentifierRecorder interface {
+	RecordIdentifiers(kind IdentifierKind, names ...string)
+}
+
 // Ensure that the concrete Connection struct implements the interface
 var _ Connection = (*ConnectionImpl)(nil)
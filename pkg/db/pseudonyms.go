@@ -0,0 +1,376 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/AliciaSchep/pgbabble/pkg/sqlparse"
+)
+
+// IdentifierKind is the kind of object an identifier names; it prefixes the pseudonym
+type IdentifierKind string
+
+// Kinds of identifiers, e.g. s_001.t_017.c_004
+const (
+	IdentifierSchema   IdentifierKind = "s_"
+	IdentifierTable    IdentifierKind = "t_"
+	IdentifierColumn   IdentifierKind = "c_"
+	IdentifierIndex    IdentifierKind = "i_"
+	IdentifierFunction IdentifierKind = "f_"
+	IdentifierArgument IdentifierKind = "a_"
+)
+
+var (
+	pseudonymPattern = regexp.MustCompile(`\b[stcifa]_\d{3,}\b`)
+	// identifierPattern matches a double quoted identifier or a bare word
+	identifierPattern = regexp.MustCompile(`"(?:[^"]|"")+"|[\pL_][\pL\pN_$]*`)
+)
+
+// Pseudonyms maps schema, table, column, index, function and argument identifiers to
+// pseudonyms so that the names themselves are never sent to the LLM. Each real identifier
+// has exactly one pseudonym, so a pseudonym translates back to the same name wherever it is used.
+// All methods are safe to call on a nil *Pseudonyms, which leaves text unchanged.
+type Pseudonyms struct {
+	mu       sync.RWMutex
+	toPseudo map[string]string      // real identifier -> pseudonym
+	toReal   map[string]string      // pseudonym -> real identifier
+	folded   map[string]string      // lower-cased real identifier -> pseudonym
+	counts   map[IdentifierKind]int // last number assigned per kind
+}
+
+// NewPseudonyms creates an empty identifier mapping
+func NewPseudonyms() *Pseudonyms {
+	return &Pseudonyms{
+		toPseudo: make(map[string]string),
+		toReal:   make(map[string]string),
+		folded:   make(map[string]string),
+		counts:   make(map[IdentifierKind]int),
+	}
+}
+
+// Load assigns pseudonyms to every schema, table, column and function visible through conn.
+// Names are sorted first so an unchanged database gets the same pseudonyms in every session.
+// Names that appear later, such as index names or tables created during the session, are
+// assigned pseudonyms by Add when they are first seen.
+func (p *Pseudonyms) Load(ctx context.Context, conn Connection) error {
+	tables, err := conn.ListTables(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	columns, err := conn.SearchColumns(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to list columns: %w", err)
+	}
+	functions, err := conn.ListFunctions(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to list functions: %w", err)
+	}
+
+	schemaNames := make(map[string]bool)
+	tableNames := make(map[string]bool)
+	columnNames := make(map[string]bool)
+	for _, table := range tables {
+		schemaNames[table.Schema] = true
+		tableNames[table.Name] = true
+	}
+	for _, col := range columns {
+		columnNames[col.Name] = true
+	}
+	functionNames := make(map[string]bool)
+	argumentNames := make(map[string]bool)
+	for _, fn := range functions {
+		functionNames[fn.Name] = true
+		for _, arg := range fn.ArgumentNames {
+			argumentNames[arg] = true
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, name := range sortedKeys(schemaNames) {
+		p.assign(IdentifierSchema, name)
+	}
+	for _, name := range sortedKeys(tableNames) {
+		p.assign(IdentifierTable, name)
+	}
+	for _, name := range sortedKeys(columnNames) {
+		p.assign(IdentifierColumn, name)
+	}
+	for _, name := range sortedKeys(functionNames) {
+		p.assign(IdentifierFunction, name)
+	}
+	for _, name := range sortedKeys(argumentNames) {
+		p.assign(IdentifierArgument, name)
+	}
+	return nil
+}
+
+// Add assigns pseudonyms to names that do not have one yet
+func (p *Pseudonyms) Add(kind IdentifierKind, names ...string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, name := range names {
+		if name != "" {
+			p.assign(kind, name)
+		}
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// assign returns the pseudonym of name, creating one of the given kind if needed; p.mu must be held
+func (p *Pseudonyms) assign(kind IdentifierKind, name string) string {
+	if pseudo, ok := p.toPseudo[name]; ok {
+		return pseudo
+	}
+	p.counts[kind]++
+	pseudo := fmt.Sprintf("%s%03d", kind, p.counts[kind])
+	p.toPseudo[name] = pseudo
+	p.toReal[pseudo] = name
+	if _, ok := p.folded[strings.ToLower(name)]; !ok {
+		p.folded[strings.ToLower(name)] = pseudo
+	}
+	return pseudo
+}
+
+// Real returns the identifier a pseudonym stands for
+func (p *Pseudonyms) Real(pseudonym string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	name, ok := p.toReal[strings.ToLower(pseudonym)]
+	return name, ok
+}
+
+// PseudonymizeText replaces known identifiers in tool output sent to the LLM.
+// Bare words must match exactly so that prose such as column headers is left alone.
+func (p *Pseudonyms) PseudonymizeText(text string) string {
+	return p.pseudonymize(text, false)
+}
+
+// PseudonymizeMessage replaces known identifiers in a message typed by the user,
+// ignoring case since users rarely type names exactly
+func (p *Pseudonyms) PseudonymizeMessage(text string) string {
+	return p.pseudonymize(text, true)
+}
+
+func (p *Pseudonyms) pseudonymize(text string, foldCase bool) string {
+	if p == nil {
+		return text
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var replace func(string) string
+	replace = func(word string) string {
+		if strings.HasPrefix(word, `"`) {
+			inner := word[1 : len(word)-1]
+			if pseudo, ok := p.toPseudo[strings.ReplaceAll(inner, `""`, `"`)]; ok {
+				return `"` + pseudo + `"`
+			}
+			// Quoted prose rather than an identifier: check each word inside
+			return `"` + identifierPattern.ReplaceAllStringFunc(inner, replace) + `"`
+		}
+		if pseudo, ok := p.toPseudo[word]; ok {
+			return pseudo
+		}
+		if foldCase {
+			if pseudo, ok := p.folded[strings.ToLower(word)]; ok {
+				return pseudo
+			}
+		}
+		return word
+	}
+	return identifierPattern.ReplaceAllStringFunc(text, replace)
+}
+
+// Restore replaces pseudonyms in text shown to the user with the real identifiers
+func (p *Pseudonyms) Restore(text string) string {
+	if p == nil {
+		return text
+	}
+	return pseudonymPattern.ReplaceAllStringFunc(text, func(word string) string {
+		if name, ok := p.Real(word); ok {
+			return name
+		}
+		return word
+	})
+}
+
+// TranslateSQL replaces pseudonyms used as identifiers in SQL with the real
+// identifiers, quoted where Postgres requires it. String constants are left alone.
+func (p *Pseudonyms) TranslateSQL(sql string) (string, error) {
+	if p == nil {
+		return sql, nil
+	}
+	tokens, err := sqlparse.Tokenize(sql)
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+	last := 0
+	for _, tok := range tokens {
+		if !tok.IsIdent() {
+			continue
+		}
+		name, ok := p.Real(tok.Value)
+		if !ok {
+			continue
+		}
+		result.WriteString(sql[last:tok.Pos])
+		result.WriteString(QuoteIdentifier(name))
+		last = tok.End
+	}
+	result.WriteString(sql[last:])
+	return result.String(), nil
+}
+
+// PseudonymConnection hides object comments, policy names and sequence names, which
+// pseudonyms do not cover, from schema operations. Identifiers are left as-is, but every
+// name it returns is given a pseudonym if it does not have one yet; the agent pseudonymizes
+// them in everything it sends to the LLM.
+type PseudonymConnection struct {
+	Connection
+	pseudonyms *Pseudonyms
+}
+
+// Ensure that PseudonymConnection implements the interfaces
+var (
+	_ Connection         = (*PseudonymConnection)(nil)
+	_ QueryValidator     = (*PseudonymConnection)(nil)
+	_ IdentifierRecorder = (*PseudonymConnection)(nil)
+)
+
+// NewPseudonymConnection wraps a connection for use by LLM tools when pseudonymizing identifiers
+func NewPseudonymConnection(inner Connection, pseudonyms *Pseudonyms) *PseudonymConnection {
+	return &PseudonymConnection{Connection: inner, pseudonyms: pseudonyms}
+}
+
+// RecordIdentifiers assigns pseudonyms to names that tools read from outside the schema
+// operations, such as the index names in a query plan
+func (c *PseudonymConnection) RecordIdentifiers(kind IdentifierKind, names ...string) {
+	c.pseudonyms.Add(kind, names...)
+}
+
+// ListTables returns tables without comments
+func (c *PseudonymConnection) ListTables(ctx context.Context) ([]TableInfo, error) {
+	tables, err := c.Connection.ListTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tables {
+		c.recordTable(&tables[i])
+		stripTableInfo(&tables[i])
+	}
+	return tables, nil
+}
+
+// DescribeTable describes a table without comments, policy names or sequence names
+func (c *PseudonymConnection) DescribeTable(ctx context.Context, schema, tableName string) (*TableInfo, error) {
+	table, err := c.Connection.DescribeTable(ctx, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	c.recordTable(table)
+	stripTableInfo(table)
+	return table, nil
+}
+
+func (c *PseudonymConnection) recordTable(table *TableInfo) {
+	c.pseudonyms.Add(IdentifierSchema, table.Schema)
+	c.pseudonyms.Add(IdentifierTable, table.Name)
+	for _, col := range table.Columns {
+		c.pseudonyms.Add(IdentifierColumn, col.Name)
+	}
+}
+
+func stripTableInfo(table *TableInfo) {
+	table.Description = ""
+	for i := range table.Columns {
+		table.Columns[i].Description = ""
+		if strings.Contains(table.Columns[i].Default, "nextval(") {
+			table.Columns[i].Default = "nextval(<sequence>)"
+		}
+	}
+	for i := range table.Policies {
+		table.Policies[i].Name = fmt.Sprintf("policy_%d", i+1)
+	}
+}
+
+// ListIndexes returns a table's indexes, giving their names pseudonyms
+func (c *PseudonymConnection) ListIndexes(ctx context.Context, schema, tableName string) ([]IndexInfo, error) {
+	indexes, err := c.Connection.ListIndexes(ctx, schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		c.pseudonyms.Add(IdentifierIndex, index.Name)
+		c.pseudonyms.Add(IdentifierColumn, index.Columns...)
+	}
+	return indexes, nil
+}
+
+// SearchColumns returns matching columns, giving new names pseudonyms
+func (c *PseudonymConnection) SearchColumns(ctx context.Context, pattern string) ([]ColumnInfo, error) {
+	columns, err := c.Connection.SearchColumns(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	for _, col := range columns {
+		c.pseudonyms.Add(IdentifierSchema, col.TableSchema)
+		c.pseudonyms.Add(IdentifierTable, col.TableName)
+		c.pseudonyms.Add(IdentifierColumn, col.Name)
+	}
+	return columns, nil
+}
+
+// GetViewDefinition returns a view definition without its comment
+func (c *PseudonymConnection) GetViewDefinition(ctx context.Context, schema, viewName string) (*ViewInfo, error) {
+	view, err := c.Connection.GetViewDefinition(ctx, schema, viewName)
+	if err != nil {
+		return nil, err
+	}
+	view.Description = ""
+	return view, nil
+}
+
+// ListFunctions returns functions without comments, giving their names and argument
+// names pseudonyms
+func (c *PseudonymConnection) ListFunctions(ctx context.Context, pattern string) ([]FunctionInfo, error) {
+	functions, err := c.Connection.ListFunctions(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	for i := range functions {
+		c.pseudonyms.Add(IdentifierSchema, functions[i].Schema)
+		c.pseudonyms.Add(IdentifierFunction, functions[i].Name)
+		c.pseudonyms.Add(IdentifierArgument, functions[i].ArgumentNames...)
+		functions[i].Description = ""
+	}
+	return functions, nil
+}
+
+// ValidateQuery delegates to the wrapped connection when it restricts queries
+func (c *PseudonymConnection) ValidateQuery(ctx context.Context, sql string) error {
+	if validator, ok := c.Connection.(QueryValidator); ok {
+		return validator.ValidateQuery(ctx, sql)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func newLoadedPseudonyms(t *testing.T) *Pseudonyms {
+	t.Helper()
+	stub := &stubConnection{
+		tables: []TableInfo{
+			{Schema: "public", Name: "users"},
+			{Schema: "public", Name: "Orders"},
+			{Schema: "staging", Name: "raw_users"},
+		},
+	}
+	p := NewPseudonyms()
+	if err := p.Load(context.Background(), stub); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return p
+}
+
+func TestPseudonyms_Load(t *testing.T) {
+	p := newLoadedPseudonyms(t)
+
+	// Sorted within each kind: schemas, then tables, then columns
+	expected := map[string]string{
+		"s_001": "public",
+		"s_002": "staging",
+		"t_001": "Orders",
+		"t_002": "raw_users",
+		"t_003": "users",
+		"c_001": "id",
+		"f_001": "f",
+		"f_002": "g",
+		"a_001": "since",
+	}
+	for pseudo, name := range expected {
+		if got, ok := p.Real(pseudo); !ok || got != name {
+			t.Errorf("Expected %s to stand for %s, got %q", pseudo, name, got)
+		}
+	}
+
+	again := newLoadedPseudonyms(t)
+	if got, _ := again.Real("t_003"); got != "users" {
+		t.Errorf("Expected pseudonyms to be stable across loads, got %q", got)
+	}
+}
+
+func TestPseudonyms_PseudonymizeText(t *testing.T) {
+	p := newLoadedPseudonyms(t)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Table: public.users", "Table: s_001.t_003"},
+		{`relation "Orders" does not exist`, `relation "t_001" does not exist`},
+		{"Seq Scan on raw_users r  (cost=0.00..1.00 rows=1)", "Seq Scan on t_002 r  (cost=0.00..1.00 rows=1)"},
+		{"Users and ID stay in prose", "Users and ID stay in prose"},
+		{`message "about users"`, `message "about t_003"`},
+	}
+	for _, tt := range tests {
+		if got := p.PseudonymizeText(tt.input); got != tt.expected {
+			t.Errorf("PseudonymizeText(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+
+	if got := p.PseudonymizeMessage("How many Users per ORDERS?"); got != "How many t_003 per t_001?" {
+		t.Errorf("Expected case-insensitive replacement in messages, got %q", got)
+	}
+
+	var nilPseudonyms *Pseudonyms
+	if got := nilPseudonyms.PseudonymizeText("public.users"); got != "public.users" {
+		t.Errorf("Expected nil pseudonyms to leave text unchanged, got %q", got)
+	}
+}
+
+func TestPseudonyms_TranslateSQL(t *testing.T) {
+	p := newLoadedPseudonyms(t)
+
+	got, err := p.TranslateSQL(`SELECT u.c_001, 't_003' FROM s_001.t_003 u JOIN "t_001" o ON o.c_001 = u.c_001`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `SELECT u.id, 't_003' FROM public.users u JOIN "Orders" o ON o.id = u.id`
+	if got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	if _, err := p.TranslateSQL("SELECT 'unterminated"); err == nil {
+		t.Error("Expected error for SQL that cannot be tokenized")
+	}
+
+	if got := p.Restore("The t_003 table has 5 rows in s_001; x_001 is unknown"); got != "The users table has 5 rows in public; x_001 is unknown" {
+		t.Errorf("Unexpected restored text: %q", got)
+	}
+}
+
+func TestPseudonymConnection_StripsComments(t *testing.T) {
+	stub := &stubConnection{
+		tables: []TableInfo{{
+			Schema:      "public",
+			Name:        "users",
+			Description: "Project Falcon customers",
+			Columns: []ColumnInfo{
+				{Name: "id", Default: "nextval('falcon_users_id_seq'::regclass)", Description: "Falcon id"},
+			},
+			Policies: []PolicyInfo{{Name: "falcon_tenant_isolation"}},
+		}},
+	}
+	conn := NewPseudonymConnection(stub, NewPseudonyms())
+
+	table, err := conn.DescribeTable(context.Background(), "public", "users")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if table.Description != "" || table.Columns[0].Description != "" {
+		t.Errorf("Expected comments to be dropped, got %+v", table)
+	}
+	if table.Columns[0].Default != "nextval(<sequence>)" || table.Policies[0].Name != "policy_1" {
+		t.Errorf("Expected sequence and policy names to be hidden, got %+v", table)
+	}
+}
+
+func TestPseudonymConnection_AssignsNewNames(t *testing.T) {
+	ctx := context.Background()
+	stub := &stubConnection{tables: []TableInfo{{Schema: "public", Name: "users"}}}
+	p := NewPseudonyms()
+	if err := p.Load(ctx, stub); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// A table created after Load, and index names, which Load does not list
+	stub.tables = append(stub.tables, TableInfo{Schema: "public", Name: "payments", Columns: []ColumnInfo{{Name: "amount"}}})
+	conn := NewPseudonymConnection(stub, p)
+	if _, err := conn.DescribeTable(ctx, "public", "payments"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := conn.ListIndexes(ctx, "public", "users"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conn.RecordIdentifiers(IdentifierIndex, "payments_amount_idx")
+
+	got := p.PseudonymizeText("Index Scan using users_ssn_idx on payments; payments_amount_idx; amount, ssn; f(since)")
+	expected := "Index Scan using i_002 on t_002; i_003; c_002, c_003; f_001(a_001)"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if restored := p.Restore(expected); restored != "Index Scan using users_ssn_idx on payments; payments_amount_idx; amount, ssn; f(since)" {
+		t.Errorf("Unexpected restored text: %q", restored)
+	}
+}
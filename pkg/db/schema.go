@@ -2,8 +2,12 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 // TableInfo represents information about a database table
@@ -12,10 +16,35 @@ type TableInfo struct {
 	Name          string
 	Type          string // table, view, materialized view
 	Description   string
-	EstimatedRows int64 // Estimated row count from pg_class.reltuples
+	EstimatedRows int64  // Estimated row count from pg_class.reltuples
+	Access        string // full, partial (only some columns), none; empty if unknown
+	RowSecurity   bool   // Row-level security is enabled
+	ForceRLS      bool   // Row-level security also applies to the table owner
+	Policies      []PolicyInfo
 	Columns       []ColumnInfo
 }
 
+// Table access levels for the connected role
+const (
+	AccessFull    = "full"
+	AccessPartial = "partial"
+	AccessNone    = "none"
+)
+
+// IsReadable reports whether the connected role can select at least some columns of the table
+func (t TableInfo) IsReadable() bool {
+	return t.Access != AccessNone
+}
+
+// PolicyInfo represents a row-level security policy from pg_policy
+type PolicyInfo struct {
+	Name       string
+	Command    string // ALL, SELECT, INSERT, UPDATE, DELETE
+	Permissive bool
+	Roles      []string
+	Using      string // USING expression, empty if none
+}
+
 // ColumnInfo represents information about a table column
 type ColumnInfo struct {
 	Name         string
@@ -24,6 +53,9 @@ type ColumnInfo struct {
 	Default      string
 	IsPrimaryKey bool
 	Description  string
+	SelectDenied bool   // The connected role lacks SELECT privilege on this column
+	TableSchema  string // Set by SearchColumns
+	TableName    string // Set by SearchColumns
 }
 
 // ForeignKeyInfo represents foreign key relationships
@@ -41,12 +73,15 @@ type ForeignKeyInfo struct {
 type IndexInfo struct {
 	Name       string
 	TableName  string
-	Columns    []string
+	Columns    []string // key columns in index order; expressions are omitted
 	IsUnique   bool
 	IsPrimary  bool
 	Definition string
 }
 
+// ErrHypoPGUnavailable is returned by HypotheticalPlan when the hypopg extension is not installed
+var ErrHypoPGUnavailable = errors.New("the hypopg extension is not installed")
+
 // ListTables returns all tables and views in the database
 func (c *ConnectionImpl) ListTables(ctx context.Context) ([]TableInfo, error) {
 	query := `
@@ -59,7 +94,14 @@ func (c *ConnectionImpl) ListTables(ctx context.Context) ([]TableInfo, error) {
 				WHEN 'm' THEN 'materialized view'
 				ELSE 'other'
 			END as table_type,
-			COALESCE(c.reltuples, 0)::bigint as estimated_rows
+			COALESCE(c.reltuples, 0)::bigint as estimated_rows,
+			CASE
+				WHEN has_table_privilege(c.oid, 'SELECT') THEN 'full'
+				WHEN has_any_column_privilege(c.oid, 'SELECT') THEN 'partial'
+				ELSE 'none'
+			END as access,
+			c.relrowsecurity,
+			c.relforcerowsecurity
 		FROM pg_class c
 		JOIN pg_namespace n ON c.relnamespace = n.oid
 		WHERE c.relkind IN ('r', 'v', 'm')  -- tables, views, materialized views
@@ -76,7 +118,8 @@ func (c *ConnectionImpl) ListTables(ctx context.Context) ([]TableInfo, error) {
 	var tables []TableInfo
 	for rows.Next() {
 		var table TableInfo
-		err := rows.Scan(&table.Schema, &table.Name, &table.Type, &table.EstimatedRows)
+		err := rows.Scan(&table.Schema, &table.Name, &table.Type, &table.EstimatedRows,
+			&table.Access, &table.RowSecurity, &table.ForceRLS)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan table info: %w", err)
 		}
@@ -134,9 +177,75 @@ func (c *ConnectionImpl) DescribeTable(ctx context.Context, schema, tableName st
 	}
 	table.Columns = columns
 
+	// Get privilege and row-level security information
+	if err := c.getTableSecurity(ctx, schema, tableName, &table); err != nil {
+		return nil, fmt.Errorf("failed to get table privileges: %w", err)
+	}
+
 	return &table, nil
 }
 
+// getTableSecurity fills in access level, row-level security status and policies for a table
+func (c *ConnectionImpl) getTableSecurity(ctx context.Context, schema, tableName string, table *TableInfo) error {
+	securityQuery := `
+		SELECT 
+			CASE
+				WHEN has_table_privilege(c.oid, 'SELECT') THEN 'full'
+				WHEN has_any_column_privilege(c.oid, 'SELECT') THEN 'partial'
+				ELSE 'none'
+			END as access,
+			c.relrowsecurity,
+			c.relforcerowsecurity
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2
+	`
+
+	err := c.QueryRow(ctx, securityQuery, schema, tableName).Scan(
+		&table.Access, &table.RowSecurity, &table.ForceRLS)
+	if err != nil {
+		return fmt.Errorf("failed to query table privileges: %w", err)
+	}
+
+	policyQuery := `
+		SELECT 
+			pol.polname,
+			CASE pol.polcmd
+				WHEN 'r' THEN 'SELECT'
+				WHEN 'a' THEN 'INSERT'
+				WHEN 'w' THEN 'UPDATE'
+				WHEN 'd' THEN 'DELETE'
+				ELSE 'ALL'
+			END as command,
+			pol.polpermissive,
+			CASE WHEN pol.polroles = '{0}' THEN ARRAY['public']::text[]
+				ELSE ARRAY(SELECT r.rolname::text FROM pg_roles r WHERE r.oid = ANY(pol.polroles) ORDER BY r.rolname)
+			END as roles,
+			COALESCE(pg_get_expr(pol.polqual, pol.polrelid), '') as using_expr
+		FROM pg_policy pol
+		JOIN pg_class c ON c.oid = pol.polrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2
+		ORDER BY pol.polname
+	`
+
+	rows, err := c.Query(ctx, policyQuery, schema, tableName)
+	if err != nil {
+		return fmt.Errorf("failed to query row-level security policies: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var policy PolicyInfo
+		if err := rows.Scan(&policy.Name, &policy.Command, &policy.Permissive, &policy.Roles, &policy.Using); err != nil {
+			return fmt.Errorf("failed to scan policy info: %w", err)
+		}
+		table.Policies = append(table.Policies, policy)
+	}
+
+	return rows.Err()
+}
+
 // getTableColumns retrieves column information for a table
 func (c *ConnectionImpl) getTableColumns(ctx context.Context, schema, tableName string) ([]ColumnInfo, error) {
 	query := `
@@ -145,7 +254,8 @@ func (c *ConnectionImpl) getTableColumns(ctx context.Context, schema, tableName
 			c.data_type,
 			c.is_nullable = 'YES' as is_nullable,
 			COALESCE(c.column_default, '') as column_default,
-			COALESCE(col_description(pgc.oid, c.ordinal_position), '') as description
+			COALESCE(col_description(pgc.oid, c.ordinal_position), '') as description,
+			NOT has_column_privilege(quote_ident(c.table_schema) || '.' || quote_ident(c.table_name), c.column_name, 'SELECT') as select_denied
 		FROM information_schema.columns c
 		LEFT JOIN pg_class pgc ON pgc.relname = c.table_name
 		LEFT JOIN pg_namespace pgn ON pgn.oid = pgc.relnamespace AND pgn.nspname = c.table_schema
@@ -162,7 +272,7 @@ func (c *ConnectionImpl) getTableColumns(ctx context.Context, schema, tableName
 	var columns []ColumnInfo
 	for rows.Next() {
 		var col ColumnInfo
-		err := rows.Scan(&col.Name, &col.DataType, &col.IsNullable, &col.Default, &col.Description)
+		err := rows.Scan(&col.Name, &col.DataType, &col.IsNullable, &col.Default, &col.Description, &col.SelectDenied)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan column info: %w", err)
 		}
@@ -226,6 +336,87 @@ func (c *ConnectionImpl) getPrimaryKeyColumns(ctx context.Context, schema, table
 	return columns, nil
 }
 
+// ListIndexes returns the indexes of a table
+func (c *ConnectionImpl) ListIndexes(ctx context.Context, schema, tableName string) ([]IndexInfo, error) {
+	query := `
+		SELECT
+			i.relname,
+			t.relname,
+			ARRAY(
+				SELECT a.attname
+				FROM unnest(ix.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord)
+				JOIN pg_attribute a ON a.attrelid = ix.indrelid AND a.attnum = k.attnum
+				ORDER BY k.ord
+			)::text[],
+			ix.indisunique,
+			ix.indisprimary,
+			pg_get_indexdef(ix.indexrelid)
+		FROM pg_index ix
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = $1 AND t.relname = $2
+		ORDER BY ix.indisprimary DESC, i.relname
+	`
+
+	rows, err := c.Query(ctx, query, schema, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	defer rows.Close()
+
+	var indexes []IndexInfo
+	for rows.Next() {
+		var idx IndexInfo
+		if err := rows.Scan(&idx.Name, &idx.TableName, &idx.Columns, &idx.IsUnique, &idx.IsPrimary, &idx.Definition); err != nil {
+			return nil, fmt.Errorf("failed to scan index info: %w", err)
+		}
+		indexes = append(indexes, idx)
+	}
+
+	return indexes, rows.Err()
+}
+
+// HypotheticalPlan plans a query with hypothetical indexes from hypopg. Hypothetical
+// indexes only exist in the current backend and are not transactional, so everything
+// runs on one connection and the indexes are removed before the connection is released.
+func (c *ConnectionImpl) HypotheticalPlan(ctx context.Context, sql string, createIndexStatements []string) ([]byte, error) {
+	conn, err := c.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var installed bool
+	if err := conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'hypopg')").Scan(&installed); err != nil {
+		return nil, fmt.Errorf("failed to check for hypopg: %w", err)
+	}
+	if !installed {
+		return nil, ErrHypoPGUnavailable
+	}
+
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(context.Background())
+		_, _ = conn.Exec(context.Background(), "SELECT hypopg_reset()")
+	}()
+
+	for _, stmt := range createIndexStatements {
+		if _, err := tx.Exec(ctx, "SELECT * FROM hypopg_create_index($1)", stmt); err != nil {
+			return nil, fmt.Errorf("failed to create hypothetical index: %w", err)
+		}
+	}
+
+	var plan []byte
+	if err := tx.QueryRow(ctx, "EXPLAIN (FORMAT JSON) "+sql).Scan(&plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
 // GetForeignKeys returns foreign key relationships for a table
 func (c *ConnectionImpl) GetForeignKeys(ctx context.Context, schema, tableName string) ([]ForeignKeyInfo, error) {
 	if schema == "" {
@@ -279,7 +470,8 @@ func (c *ConnectionImpl) GetForeignKeys(ctx context.Context, schema, tableName s
 func (c *ConnectionImpl) SearchColumns(ctx context.Context, pattern string) ([]ColumnInfo, error) {
 	query := `
 		SELECT 
-			c.table_schema || '.' || c.table_name as table_name,
+			c.table_schema,
+			c.table_name,
 			c.column_name,
 			c.data_type,
 			c.is_nullable = 'YES' as is_nullable,
@@ -299,12 +491,11 @@ func (c *ConnectionImpl) SearchColumns(ctx context.Context, pattern string) ([]C
 	var columns []ColumnInfo
 	for rows.Next() {
 		var col ColumnInfo
-		var tableName string
-		err := rows.Scan(&tableName, &col.Name, &col.DataType, &col.IsNullable, &col.Default)
+		err := rows.Scan(&col.TableSchema, &col.TableName, &col.Name, &col.DataType, &col.IsNullable, &col.Default)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan column info: %w", err)
 		}
-		col.Description = fmt.Sprintf("Found in table: %s", tableName)
+		col.Description = fmt.Sprintf("Found in table: %s.%s", col.TableSchema, col.TableName)
 		columns = append(columns, col)
 	}
 
@@ -313,3 +504,355 @@ func (c *ConnectionImpl) SearchColumns(ctx context.Context, pattern string) ([]C
 	}
 	return columns, nil
 }
+
+// ViewInfo represents the definition of a view or materialized view
+type ViewInfo struct {
+	Schema      string
+	Name        string
+	Type        string // view, materialized view
+	Definition  string
+	Description string
+}
+
+// ViewDependency is a table or column read by a view, directly or through other views
+type ViewDependency struct {
+	Schema string
+	Table  string
+	Column string // empty when the view depends on the relation as a whole
+}
+
+// FunctionInfo represents a user-defined SQL function
+type FunctionInfo struct {
+	Schema        string
+	Name          string
+	Arguments     string
+	ArgumentNames []string // names of the named arguments
+	ReturnType    string
+	Volatility    string // immutable, stable, volatile
+	Language      string
+	Description   string
+}
+
+// IsCallableFromQuery reports whether the function is safe to use inside a read-only query.
+// Only IMMUTABLE and STABLE functions are guaranteed not to modify the database.
+func (f FunctionInfo) IsCallableFromQuery() bool {
+	return f.Volatility == "immutable" || f.Volatility == "stable"
+}
+
+// Signature returns the function signature in name(args) form
+func (f FunctionInfo) Signature() string {
+	return fmt.Sprintf("%s.%s(%s)", f.Schema, f.Name, f.Arguments)
+}
+
+// GetViewDefinition returns the SQL definition of a view or materialized view
+func (c *ConnectionImpl) GetViewDefinition(ctx context.Context, schema, viewName string) (*ViewInfo, error) {
+	if schema == "" {
+		schema = "public"
+	}
+
+	query := `
+		SELECT 
+			n.nspname,
+			c.relname,
+			CASE c.relkind 
+				WHEN 'v' THEN 'view'
+				WHEN 'm' THEN 'materialized view'
+			END as view_type,
+			pg_get_viewdef(c.oid, true) as definition,
+			COALESCE(obj_description(c.oid, 'pg_class'), '') as description
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('v', 'm')
+		AND n.nspname = $1 AND c.relname = $2
+	`
+
+	var view ViewInfo
+	err := c.QueryRow(ctx, query, schema, viewName).Scan(
+		&view.Schema, &view.Name, &view.Type, &view.Definition, &view.Description)
+	if err != nil {
+		return nil, fmt.Errorf("view %s.%s not found: %w", schema, viewName, err)
+	}
+
+	return &view, nil
+}
+
+// ViewDependencies returns the relations and columns a view or materialized view reads,
+// following views defined over other views. It is empty for a plain table.
+func (c *ConnectionImpl) ViewDependencies(ctx context.Context, schema, viewName string) ([]ViewDependency, error) {
+	if schema == "" {
+		schema = "public"
+	}
+
+	// A view's query is stored as a rewrite rule, which depends on what it reads
+	query := `
+		WITH RECURSIVE views(oid) AS (
+			SELECT c.oid
+			FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = $1 AND c.relname = $2
+			UNION
+			SELECT d.refobjid
+			FROM views
+			JOIN pg_rewrite r ON r.ev_class = views.oid
+			JOIN pg_depend d ON d.classid = 'pg_rewrite'::regclass AND d.objid = r.oid
+				AND d.refclassid = 'pg_class'::regclass AND d.refobjid <> views.oid
+			JOIN pg_class ref ON ref.oid = d.refobjid
+			WHERE ref.relkind IN ('v', 'm')
+		)
+		SELECT DISTINCT n.nspname, c.relname, COALESCE(a.attname, '')
+		FROM views
+		JOIN pg_rewrite r ON r.ev_class = views.oid
+		JOIN pg_depend d ON d.classid = 'pg_rewrite'::regclass AND d.objid = r.oid
+			AND d.refclassid = 'pg_class'::regclass AND d.refobjid <> views.oid
+		JOIN pg_class c ON c.oid = d.refobjid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid AND d.refobjsubid > 0
+		ORDER BY 1, 2, 3
+	`
+
+	rows, err := c.Query(ctx, query, schema, viewName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dependencies of %s.%s: %w", schema, viewName, err)
+	}
+	defer rows.Close()
+
+	var dependencies []ViewDependency
+	for rows.Next() {
+		var dep ViewDependency
+		if err := rows.Scan(&dep.Schema, &dep.Table, &dep.Column); err != nil {
+			return nil, fmt.Errorf("failed to scan view dependency: %w", err)
+		}
+		dependencies = append(dependencies, dep)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during view dependency iteration: %w", err)
+	}
+	return dependencies, nil
+}
+
+// ListFunctions returns user-defined functions whose name matches the pattern.
+// Functions in system schemas and functions installed by extensions are excluded.
+func (c *ConnectionImpl) ListFunctions(ctx context.Context, pattern string) ([]FunctionInfo, error) {
+	query := `
+		SELECT 
+			n.nspname as schema_name,
+			p.proname as function_name,
+			pg_get_function_arguments(p.oid) as arguments,
+			ARRAY(SELECT a FROM unnest(p.proargnames) a WHERE a <> '') as argument_names,
+			COALESCE(pg_get_function_result(p.oid), '') as return_type,
+			CASE p.provolatile
+				WHEN 'i' THEN 'immutable'
+				WHEN 's' THEN 'stable'
+				ELSE 'volatile'
+			END as volatility,
+			l.lanname as language,
+			COALESCE(obj_description(p.oid, 'pg_proc'), '') as description
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		JOIN pg_language l ON l.oid = p.prolang
+		WHERE p.prokind = 'f'
+		AND n.nspname NOT IN ('information_schema', 'pg_catalog')
+		AND n.nspname NOT LIKE 'pg_toast%'
+		AND n.nspname NOT LIKE 'pg_temp%'
+		AND NOT EXISTS (
+			SELECT 1 FROM pg_depend d
+			WHERE d.classid = 'pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'e'
+		)
+		AND p.proname ILIKE $1
+		ORDER BY schema_name, function_name, arguments
+	`
+
+	rows, err := c.Query(ctx, query, "%"+pattern+"%")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list functions: %w", err)
+	}
+	defer rows.Close()
+
+	var functions []FunctionInfo
+	for rows.Next() {
+		var fn FunctionInfo
+		err := rows.Scan(&fn.Schema, &fn.Name, &fn.Arguments, &fn.ArgumentNames, &fn.ReturnType,
+			&fn.Volatility, &fn.Language, &fn.Description)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan function info: %w", err)
+		}
+		functions = append(functions, fn)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during function listing iteration: %w", err)
+	}
+	return functions, nil
+}
+
+// ColumnStats represents planner statistics for a column from pg_stats
+type ColumnStats struct {
+	Column          string
+	TypeName        string // Postgres type name of the column, such as int4 or text
+	NullFraction    float64
+	AvgWidth        int
+	NDistinct       float64  // Negative values are the negated fraction of rows that are distinct
+	Correlation     *float64 // nil when not available (e.g. for non-scalar types)
+	MostCommonVals  string   // Text form of the most common values array, empty if none
+	MostCommonFreqs []float64
+	HistogramBounds string // Text form of the histogram bounds array, empty if none
+}
+
+// GetColumnStats returns planner statistics for all analyzed columns of a table.
+// pg_stats only exposes rows for columns the current user is allowed to read.
+func (c *ConnectionImpl) GetColumnStats(ctx context.Context, schema, tableName string) ([]ColumnStats, error) {
+	if schema == "" {
+		schema = "public"
+	}
+
+	query := `
+		SELECT DISTINCT ON (s.attname)
+			s.attname,
+			COALESCE(t.typname, '') as type_name,
+			s.null_frac,
+			s.avg_width,
+			s.n_distinct,
+			s.correlation,
+			COALESCE(s.most_common_vals::text, '') as most_common_vals,
+			COALESCE(s.most_common_freqs, '{}'::real[]) as most_common_freqs,
+			COALESCE(s.histogram_bounds::text, '') as histogram_bounds
+		FROM pg_stats s
+		LEFT JOIN pg_namespace n ON n.nspname = s.schemaname
+		LEFT JOIN pg_class c ON c.relnamespace = n.oid AND c.relname = s.tablename
+		LEFT JOIN pg_attribute a ON a.attrelid = c.oid AND a.attname = s.attname
+		LEFT JOIN pg_type t ON t.oid = a.atttypid
+		WHERE s.schemaname = $1 AND s.tablename = $2
+		ORDER BY s.attname, s.inherited
+	`
+
+	rows, err := c.Query(ctx, query, schema, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get column statistics: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []ColumnStats
+	for rows.Next() {
+		var st ColumnStats
+		var nullFrac, nDistinct float32
+		var correlation *float32
+		var freqs []float32
+		err := rows.Scan(&st.Column, &st.TypeName, &nullFrac, &st.AvgWidth, &nDistinct, &correlation,
+			&st.MostCommonVals, &freqs, &st.HistogramBounds)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan column statistics: %w", err)
+		}
+		st.NullFraction = float64(nullFrac)
+		st.NDistinct = float64(nDistinct)
+		if correlation != nil {
+			corr := float64(*correlation)
+			st.Correlation = &corr
+		}
+		for _, f := range freqs {
+			st.MostCommonFreqs = append(st.MostCommonFreqs, float64(f))
+		}
+		stats = append(stats, st)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during column statistics iteration: %w", err)
+	}
+	return stats, nil
+}
+
+// sampleScanLimit bounds how many rows are scanned when sampling column values
+const sampleScanLimit = 10000
+
+// SampleColumnValues returns up to limit distinct non-null values of a column as text.
+// Only the first rows of the table are scanned so sampling stays cheap on large tables.
+func (c *ConnectionImpl) SampleColumnValues(ctx context.Context, schema, tableName, columnName string, limit int) ([]string, error) {
+	if schema == "" {
+		schema = "public"
+	}
+
+	column := pgx.Identifier{columnName}.Sanitize()
+	table := pgx.Identifier{schema, tableName}.Sanitize()
+	query := fmt.Sprintf(`
+		SELECT DISTINCT s.value
+		FROM (
+			SELECT %s::text AS value
+			FROM %s
+			WHERE %s IS NOT NULL
+			LIMIT %d
+		) s
+		ORDER BY s.value
+		LIMIT $1
+	`, column, table, column, sampleScanLimit)
+
+	rows, err := c.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample values of %s.%s.%s: %w", schema, tableName, columnName, err)
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, fmt.Errorf("failed to scan sample value: %w", err)
+		}
+		values = append(values, value)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during sample value iteration: %w", err)
+	}
+	return values, nil
+}
+
+// SourceColumns returns the name of the table column each result field reads directly, from
+// the table OID and attribute number Postgres reports for it. Computed fields have no source
+// and get an empty name.
+func (c *ConnectionImpl) SourceColumns(ctx context.Context, fields []pgconn.FieldDescription) ([]string, error) {
+	var tableOIDs []uint32
+	var attributeNumbers []int16
+	for _, fd := range fields {
+		if fd.TableOID != 0 && fd.TableAttributeNumber > 0 {
+			tableOIDs = append(tableOIDs, fd.TableOID)
+			attributeNumbers = append(attributeNumbers, int16(fd.TableAttributeNumber))
+		}
+	}
+	sources := make([]string, len(fields))
+	if len(tableOIDs) == 0 {
+		return sources, nil
+	}
+
+	query := `
+		SELECT a.attrelid, a.attnum, a.attname
+		FROM pg_catalog.pg_attribute a
+		JOIN unnest($1::oid[], $2::int2[]) AS f(relid, num) ON a.attrelid = f.relid AND a.attnum = f.num
+	`
+	rows, err := c.pool.Query(ctx, query, tableOIDs, attributeNumbers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up source columns: %w", err)
+	}
+	defer rows.Close()
+
+	type attribute struct {
+		table  uint32
+		number int16
+	}
+	names := make(map[attribute]string)
+	for rows.Next() {
+		var attr attribute
+		var name string
+		if err := rows.Scan(&attr.table, &attr.number, &name); err != nil {
+			return nil, fmt.Errorf("failed to scan source column: %w", err)
+		}
+		names[attr] = name
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during source column iteration: %w", err)
+	}
+
+	for i, fd := range fields {
+		sources[i] = names[attribute{table: fd.TableOID, number: int16(fd.TableAttributeNumber)}]
+	}
+	return sources, nil
+}
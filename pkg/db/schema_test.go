@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/AliciaSchep/pgbabble/internal/testutil"
@@ -46,6 +47,12 @@ func TestListTables_WithRealDatabase(t *testing.T) {
 			if table.Type != "table" {
 				t.Errorf("Expected table %s to have type 'table', got %s", table.Name, table.Type)
 			}
+			if table.Access != AccessFull {
+				t.Errorf("Expected full access to table %s, got %q", table.Name, table.Access)
+			}
+			if table.RowSecurity != (table.Name == "test_orders") {
+				t.Errorf("Unexpected row-level security status %v for table %s", table.RowSecurity, table.Name)
+			}
 		}
 	}
 
@@ -121,6 +128,42 @@ func TestDescribeTable_WithRealDatabase(t *testing.T) {
 		}
 	})
 
+	t.Run("test_orders_row_level_security", func(t *testing.T) {
+		table, err := conn.DescribeTable(ctx, "public", "test_orders")
+		if err != nil {
+			t.Fatalf("DescribeTable failed: %v", err)
+		}
+
+		if table.Access != AccessFull {
+			t.Errorf("Expected full access to owned table, got %q", table.Access)
+		}
+		if !table.RowSecurity {
+			t.Error("Expected row-level security to be enabled")
+		}
+		if table.ForceRLS {
+			t.Error("Expected row-level security not to be forced")
+		}
+		if len(table.Policies) != 1 {
+			t.Fatalf("Expected 1 policy, got %d", len(table.Policies))
+		}
+
+		policy := table.Policies[0]
+		if policy.Name != "test_orders_not_deleted" || policy.Command != "SELECT" || !policy.Permissive {
+			t.Errorf("Unexpected policy: %+v", policy)
+		}
+		if len(policy.Roles) != 1 || policy.Roles[0] != "public" {
+			t.Errorf("Expected policy to apply to public, got %v", policy.Roles)
+		}
+		if !contains(policy.Using, "deleted") {
+			t.Errorf("Expected USING expression to reference 'deleted', got %q", policy.Using)
+		}
+		for _, col := range table.Columns {
+			if col.SelectDenied {
+				t.Errorf("Expected column %s to be selectable", col.Name)
+			}
+		}
+	})
+
 	t.Run("nonexistent_table", func(t *testing.T) {
 		_, err := conn.DescribeTable(ctx, "public", "nonexistent_table")
 		if err == nil {
@@ -343,3 +386,302 @@ func TestGetDatabaseInfo_WithRealDatabase(t *testing.T) {
 	}
 	t.Logf("Database info: %+v", info)
 }
+
+func TestGetViewDefinition_WithRealDatabase(t *testing.T) {
+	cfg := testutil.GetRealDatabaseConfig()
+	if cfg == nil {
+		t.Skip("Skipping real database tests - no database config available.")
+		return
+	}
+
+	conn, err := Connect(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	t.Run("test_order_summary_view", func(t *testing.T) {
+		view, err := conn.GetViewDefinition(ctx, "public", "test_order_summary")
+		if err != nil {
+			t.Fatalf("GetViewDefinition failed: %v", err)
+		}
+
+		if view.Type != "view" {
+			t.Errorf("Expected type 'view', got %s", view.Type)
+		}
+		if !contains(view.Definition, "test_orders") || !contains(view.Definition, "test_users") {
+			t.Errorf("Expected definition to reference base tables, got: %s", view.Definition)
+		}
+		if view.Description != "Orders with the username of the buyer" {
+			t.Errorf("Expected view comment, got %q", view.Description)
+		}
+	})
+
+	t.Run("base_table_is_not_a_view", func(t *testing.T) {
+		_, err := conn.GetViewDefinition(ctx, "public", "test_users")
+		if err == nil {
+			t.Error("Expected error when fetching view definition of a base table")
+		}
+	})
+}
+
+func TestListFunctions_WithRealDatabase(t *testing.T) {
+	cfg := testutil.GetRealDatabaseConfig()
+	if cfg == nil {
+		t.Skip("Skipping real database tests - no database config available.")
+		return
+	}
+
+	conn, err := Connect(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	functions, err := conn.ListFunctions(ctx, "test_order_item")
+	if err != nil {
+		t.Fatalf("ListFunctions failed: %v", err)
+	}
+
+	if len(functions) != 1 {
+		t.Fatalf("Expected 1 function, got %d", len(functions))
+	}
+
+	fn := functions[0]
+	if fn.Schema != "public" || fn.Name != "test_order_item_count" {
+		t.Errorf("Unexpected function %s.%s", fn.Schema, fn.Name)
+	}
+	if fn.Arguments != "p_order_id integer" {
+		t.Errorf("Expected arguments 'p_order_id integer', got %q", fn.Arguments)
+	}
+	if fn.ReturnType != "bigint" {
+		t.Errorf("Expected return type 'bigint', got %q", fn.ReturnType)
+	}
+	if fn.Volatility != "stable" || !fn.IsCallableFromQuery() {
+		t.Errorf("Expected stable callable function, got volatility %q", fn.Volatility)
+	}
+	if fn.Language != "sql" {
+		t.Errorf("Expected language 'sql', got %q", fn.Language)
+	}
+	if fn.Description != "Number of line items in an order" {
+		t.Errorf("Expected function comment, got %q", fn.Description)
+	}
+
+	// System functions must not be listed
+	functions, err = conn.ListFunctions(ctx, "pg_get_viewdef")
+	if err != nil {
+		t.Fatalf("ListFunctions failed: %v", err)
+	}
+	if len(functions) != 0 {
+		t.Errorf("Expected no system functions, got %d", len(functions))
+	}
+}
+
+func TestGetColumnStats_WithRealDatabase(t *testing.T) {
+	cfg := testutil.GetRealDatabaseConfig()
+	if cfg == nil {
+		t.Skip("Skipping real database tests - no database config available.")
+		return
+	}
+
+	conn, err := Connect(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	if err := conn.Exec(ctx, "ANALYZE test_orders"); err != nil {
+		t.Fatalf("ANALYZE failed: %v", err)
+	}
+
+	stats, err := conn.GetColumnStats(ctx, "public", "test_orders")
+	if err != nil {
+		t.Fatalf("GetColumnStats failed: %v", err)
+	}
+
+	var status *ColumnStats
+	for i := range stats {
+		if stats[i].Column == "status" {
+			status = &stats[i]
+		}
+	}
+	if status == nil {
+		t.Fatalf("Expected statistics for column 'status', got %+v", stats)
+	}
+	if status.NullFraction != 0 {
+		t.Errorf("Expected null fraction 0, got %v", status.NullFraction)
+	}
+	if status.AvgWidth <= 0 {
+		t.Errorf("Expected positive average width, got %d", status.AvgWidth)
+	}
+	if status.NDistinct == 0 {
+		t.Error("Expected non-zero n_distinct")
+	}
+
+	stats, err = conn.GetColumnStats(ctx, "public", "nonexistent_table")
+	if err != nil {
+		t.Fatalf("GetColumnStats failed: %v", err)
+	}
+	if len(stats) != 0 {
+		t.Errorf("Expected no statistics for nonexistent table, got %d", len(stats))
+	}
+}
+
+func TestSampleColumnValues_WithRealDatabase(t *testing.T) {
+	cfg := testutil.GetRealDatabaseConfig()
+	if cfg == nil {
+		t.Skip("Skipping real database tests - no database config available.")
+		return
+	}
+
+	conn, err := Connect(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	values, err := conn.SampleColumnValues(ctx, "public", "test_orders", "status", 10)
+	if err != nil {
+		t.Fatalf("SampleColumnValues failed: %v", err)
+	}
+
+	expected := []string{"completed", "pending", "shipped"}
+	if len(values) != len(expected) {
+		t.Fatalf("Expected %d distinct values, got %v", len(expected), values)
+	}
+	for i, value := range expected {
+		if values[i] != value {
+			t.Errorf("Expected value %d to be %s, got %s", i, value, values[i])
+		}
+	}
+
+	values, err = conn.SampleColumnValues(ctx, "public", "test_orders", "status", 1)
+	if err != nil {
+		t.Fatalf("SampleColumnValues failed: %v", err)
+	}
+	if len(values) != 1 {
+		t.Errorf("Expected limit to be applied, got %v", values)
+	}
+
+	_, err = conn.SampleColumnValues(ctx, "public", "test_orders", "nonexistent_column", 10)
+	if err == nil {
+		t.Error("Expected error when sampling nonexistent column")
+	}
+}
+
+func TestViewDependencies_WithRealDatabase(t *testing.T) {
+	cfg := testutil.GetRealDatabaseConfig()
+	if cfg == nil {
+		t.Skip("Skipping real database tests - no database config available.")
+		return
+	}
+
+	conn, err := Connect(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	dependencies, err := conn.ViewDependencies(ctx, "public", "test_order_summary")
+	if err != nil {
+		t.Fatalf("ViewDependencies failed: %v", err)
+	}
+	found := make(map[string]bool)
+	for _, dep := range dependencies {
+		found[dep.Table+"."+dep.Column] = true
+	}
+	for _, expected := range []string{"test_orders.total_amount", "test_orders.user_id", "test_users.username", "test_users.id"} {
+		if !found[expected] {
+			t.Errorf("Expected dependency on %s, got %+v", expected, dependencies)
+		}
+	}
+	if found["test_users.email"] {
+		t.Errorf("Expected no dependency on a column the view does not read, got %+v", dependencies)
+	}
+
+	dependencies, err = conn.ViewDependencies(ctx, "public", "test_orders")
+	if err != nil {
+		t.Fatalf("ViewDependencies failed: %v", err)
+	}
+	if len(dependencies) != 0 {
+		t.Errorf("Expected no dependencies for a table, got %+v", dependencies)
+	}
+}
+
+func TestResolveTableName_WithRealDatabase(t *testing.T) {
+	cfg := testutil.GetRealDatabaseConfig()
+	if cfg == nil {
+		t.Skip("Skipping real database tests - no database config available.")
+		return
+	}
+
+	conn, err := Connect(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	schema, table, err := conn.ResolveTableName(ctx, "TEST_USERS")
+	if err != nil {
+		t.Fatalf("ResolveTableName failed: %v", err)
+	}
+	if schema != "public" || table != "test_users" {
+		t.Errorf("Expected public.test_users, got %s.%s", schema, table)
+	}
+
+	schema, table, err = conn.ResolveTableName(ctx, "other_schema.some_table")
+	if err != nil {
+		t.Fatalf("ResolveTableName failed for qualified name: %v", err)
+	}
+	if schema != "other_schema" || table != "some_table" {
+		t.Errorf("Expected qualified name to be kept, got %s.%s", schema, table)
+	}
+
+	_, _, err = conn.ResolveTableName(ctx, `"TEST_USERS"`)
+	if !errors.Is(err, ErrRelationNotFound) {
+		t.Errorf("Expected a not found error resolving a quoted name with the wrong case, got %v", err)
+	}
+}
+
+func TestSourceColumns_WithRealDatabase(t *testing.T) {
+	cfg := testutil.GetRealDatabaseConfig()
+	if cfg == nil {
+		t.Skip("Skipping real database tests - no database config available.")
+		return
+	}
+
+	conn, err := Connect(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	rows, err := conn.Query(ctx, "SELECT u.email AS x, lower(u.username) AS y FROM test_users u LIMIT 1")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	fields := rows.FieldDescriptions()
+	rows.Close()
+
+	sources, err := conn.SourceColumns(ctx, fields)
+	if err != nil {
+		t.Fatalf("SourceColumns failed: %v", err)
+	}
+	if len(sources) != 2 || sources[0] != "email" || sources[1] != "" {
+		t.Errorf("Expected [email, \"\"], got %q", sources)
+	}
+}
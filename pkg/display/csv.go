@@ -4,10 +4,10 @@ import (
 	"encoding/csv"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 )
 
 // validateFilePath validates that the filename is safe and doesn't contain path traversal attempts
@@ -32,6 +32,13 @@ func validateFilePath(filename string) error {
 
 // SaveCSV saves query results to a CSV file
 func SaveCSV(columnNames []string, allRows [][]interface{}, filename string) error {
+	return saveFile(filename, func(w io.Writer) error {
+		return WriteCSV(w, columnNames, allRows)
+	})
+}
+
+// saveFile creates a file and writes it with write
+func saveFile(filename string, write func(io.Writer) error) error {
 	// Validate the file path for security
 	if err := validateFilePath(filename); err != nil {
 		return fmt.Errorf("invalid file path: %w", err)
@@ -51,9 +58,21 @@ func SaveCSV(columnNames []string, allRows [][]interface{}, filename string) err
 		}
 	}()
 
-	// Create CSV writer
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	if err := write(file); err != nil {
+		return err
+	}
+
+	// Check if there was a close error after all other operations succeeded
+	if closeErr != nil {
+		return fmt.Errorf("failed to close file %s: %w", filename, closeErr)
+	}
+
+	return nil
+}
+
+// WriteCSV writes query results as CSV with a header row
+func WriteCSV(w io.Writer, columnNames []string, allRows [][]interface{}) error {
+	writer := csv.NewWriter(w)
 
 	// Write header row
 	if err := writer.Write(columnNames); err != nil {
@@ -73,18 +92,16 @@ func SaveCSV(columnNames []string, allRows [][]interface{}, filename string) err
 		}
 	}
 
-	// Check if there was a close error after all other operations succeeded
-	if closeErr != nil {
-		return fmt.Errorf("failed to close file %s: %w", filename, closeErr)
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
 	}
-
 	return nil
 }
 
 // GenerateDefaultCSVFilename creates a default filename with timestamp
 func GenerateDefaultCSVFilename() string {
-	timestamp := time.Now().Format("2006-01-02_15-04-05")
-	return fmt.Sprintf("pgbabble_results_%s.csv", timestamp)
+	return GenerateDefaultFilename(FormatCSV)
 }
 
 // formatValueForCSV converts various Go types to string for CSV output
@@ -110,36 +127,5 @@ func formatValueForCSV(value interface{}) string {
 
 // SaveQueryResultToCSV is a convenience function for saving query results
 func SaveQueryResultToCSV(columnNames []string, allRows [][]interface{}, filename string) (string, error) {
-	// Use default filename if not provided
-	if filename == "" {
-		filename = GenerateDefaultCSVFilename()
-	}
-
-	// Ensure .csv extension
-	if !strings.HasSuffix(strings.ToLower(filename), ".csv") {
-		filename += ".csv"
-	}
-
-	// Validate the file path for security (after processing filename)
-	if err := validateFilePath(filename); err != nil {
-		return "", fmt.Errorf("invalid file path: %w", err)
-	}
-
-	// Clean the filename
-	cleanFilename := filepath.Clean(filename)
-
-	// Get absolute path for display - use relative path if absolute path fails
-	absPath, err := filepath.Abs(cleanFilename)
-	if err != nil {
-		// Note: We fall back to relative path since absolute path calculation failed
-		// This is not critical for functionality, but the user will see relative path
-		absPath = cleanFilename
-	}
-
-	// Save the CSV
-	if err := SaveCSV(columnNames, allRows, cleanFilename); err != nil {
-		return "", err
-	}
-
-	return absPath, nil
+	return SaveQueryResult(columnNames, allRows, filename, FormatCSV)
 }
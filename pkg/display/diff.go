@@ -0,0 +1,48 @@
+package display
+
+import "strings"
+
+// LineDiff shows how newText differs from oldText line by line, prefixing removed
+// lines with "- ", added lines with "+ " and unchanged lines with "  ".
+// Trailing whitespace is ignored when comparing lines.
+func LineDiff(oldText, newText string) string {
+	oldLines := strings.Split(strings.TrimRight(oldText, "\n"), "\n")
+	newLines := strings.Split(strings.TrimRight(newText, "\n"), "\n")
+
+	// Longest common subsequence table: lcs[i][j] is the LCS length of oldLines[i:] and newLines[j:]
+	lcs := make([][]int, len(oldLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if sameLine(oldLines[i], newLines[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var b strings.Builder
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && sameLine(oldLines[i], newLines[j]):
+			b.WriteString("  " + newLines[j] + "\n")
+			i++
+			j++
+		case j < len(newLines) && (i == len(oldLines) || lcs[i][j+1] > lcs[i+1][j]):
+			b.WriteString("+ " + newLines[j] + "\n")
+			j++
+		default:
+			b.WriteString("- " + oldLines[i] + "\n")
+			i++
+		}
+	}
+	return b.String()
+}
+
+func sameLine(a, b string) bool {
+	return strings.TrimRight(a, " \t\r") == strings.TrimRight(b, " \t\r")
+}
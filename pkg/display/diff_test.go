@@ -0,0 +1,45 @@
+package display
+
+import "testing"
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old      string
+		new      string
+		expected string
+	}{
+		{
+			name:     "changed line",
+			old:      "SELECT nme\nFROM users\nLIMIT 10",
+			new:      "SELECT name\nFROM users\nLIMIT 10",
+			expected: "- SELECT nme\n+ SELECT name\n  FROM users\n  LIMIT 10\n",
+		},
+		{
+			name:     "added and removed lines",
+			old:      "SELECT id\nFROM users\nWHERE x = 1",
+			new:      "SELECT id\nFROM users u\nJOIN orders o ON o.user_id = u.id\nWHERE x = 1",
+			expected: "  SELECT id\n- FROM users\n+ FROM users u\n+ JOIN orders o ON o.user_id = u.id\n  WHERE x = 1\n",
+		},
+		{
+			name:     "identical apart from trailing whitespace",
+			old:      "SELECT 1  \n",
+			new:      "SELECT 1",
+			expected: "  SELECT 1\n",
+		},
+		{
+			name:     "single line",
+			old:      "SELCT 1",
+			new:      "SELECT 1",
+			expected: "- SELCT 1\n+ SELECT 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := LineDiff(tt.old, tt.new); result != tt.expected {
+				t.Errorf("LineDiff() =\n%s\nwant\n%s", result, tt.expected)
+			}
+		})
+	}
+}
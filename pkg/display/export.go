@@ -0,0 +1,166 @@
+package display
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Export formats for saved query results
+const (
+	FormatCSV     = "csv"
+	FormatJSON    = "json"   // an array of objects, one per row
+	FormatNDJSON  = "ndjson" // one object per line
+	FormatParquet = "parquet"
+)
+
+// ExportFormats lists the formats SaveQueryResult can write
+var ExportFormats = []string{FormatCSV, FormatJSON, FormatNDJSON, FormatParquet}
+
+// formatExtensions are the file extensions of each format; the first is added when missing
+var formatExtensions = map[string][]string{
+	FormatCSV:     {".csv"},
+	FormatJSON:    {".json"},
+	FormatNDJSON:  {".ndjson", ".jsonl"},
+	FormatParquet: {".parquet"},
+}
+
+// FormatFromFilename returns the export format implied by a file's extension, or ""
+func FormatFromFilename(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, format := range ExportFormats {
+		if slices.Contains(formatExtensions[format], ext) {
+			return format
+		}
+	}
+	return ""
+}
+
+// GenerateDefaultFilename creates a default filename with timestamp for a format
+func GenerateDefaultFilename(format string) string {
+	timestamp := time.Now().Format("2006-01-02_15-04-05")
+	return fmt.Sprintf("pgbabble_results_%s%s", timestamp, formatExtensions[format][0])
+}
+
+// SaveQueryResult saves query results to a file and returns its absolute path. Without a
+// format it is taken from the filename's extension, and CSV is the default. The format's
+// extension is added to the filename when missing.
+func SaveQueryResult(columnNames []string, allRows [][]interface{}, filename, format string) (string, error) {
+	columns := make([]ExportColumn, len(columnNames))
+	for i, name := range columnNames {
+		columns[i] = ExportColumn{Name: name, TypeModifier: -1}
+	}
+	return SaveTypedQueryResult(columns, allRows, filename, format)
+}
+
+// SaveTypedQueryResult is SaveQueryResult with the columns' Postgres types, which
+// Parquet needs for its schema; columns without a type are written as strings
+func SaveTypedQueryResult(columns []ExportColumn, allRows [][]interface{}, filename, format string) (string, error) {
+	format, cleanFilename, absPath, err := resolveExportFile(filename, format)
+	if err != nil {
+		return "", err
+	}
+
+	columnNames := make([]string, len(columns))
+	for i, column := range columns {
+		columnNames[i] = column.Name
+	}
+
+	switch format {
+	case FormatParquet:
+		err = SaveParquet(columns, allRows, cleanFilename)
+	case FormatJSON:
+		err = SaveJSON(columnNames, allRows, cleanFilename)
+	case FormatNDJSON:
+		err = SaveNDJSON(columnNames, allRows, cleanFilename)
+	default:
+		err = SaveCSV(columnNames, allRows, cleanFilename)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return absPath, nil
+}
+
+// StreamParquetResult writes rows to a Parquet file as next returns them, so results of any
+// size are saved without being held in memory. next returns a nil row after the last one.
+// It returns the file's absolute path and the number of rows written.
+func StreamParquetResult(columns []ExportColumn, filename string, next func() ([]interface{}, error)) (string, int, error) {
+	_, cleanFilename, absPath, err := resolveExportFile(filename, FormatParquet)
+	if err != nil {
+		return "", 0, err
+	}
+
+	count := 0
+	err = saveFile(cleanFilename, func(w io.Writer) error {
+		pw, err := NewParquetWriter(w, columns)
+		if err != nil {
+			return err
+		}
+		for {
+			row, err := next()
+			if err != nil {
+				return err
+			}
+			if row == nil {
+				break
+			}
+			if err := pw.Write(row); err != nil {
+				return err
+			}
+			count++
+		}
+		return pw.Close()
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return absPath, count, nil
+}
+
+// resolveExportFile returns the format to write, the cleaned filename with the format's
+// extension and its absolute path. Without a format it is taken from the filename's
+// extension, and CSV is the default.
+func resolveExportFile(filename, format string) (string, string, string, error) {
+	if format == "" {
+		format = FormatFromFilename(filename)
+	}
+	if format == "" {
+		format = FormatCSV
+	}
+	extensions, ok := formatExtensions[format]
+	if !ok {
+		return "", "", "", fmt.Errorf("unknown format %q (must be: %s)", format, strings.Join(ExportFormats, ", "))
+	}
+
+	// Use default filename if not provided
+	if filename == "" {
+		filename = GenerateDefaultFilename(format)
+	}
+
+	// Ensure the format's extension
+	if !slices.Contains(extensions, strings.ToLower(filepath.Ext(filename))) {
+		filename += extensions[0]
+	}
+
+	// Validate the file path for security (after processing filename)
+	if err := validateFilePath(filename); err != nil {
+		return "", "", "", fmt.Errorf("invalid file path: %w", err)
+	}
+
+	// Clean the filename
+	cleanFilename := filepath.Clean(filename)
+
+	// Get absolute path for display - use relative path if absolute path fails
+	absPath, err := filepath.Abs(cleanFilename)
+	if err != nil {
+		// Note: We fall back to relative path since absolute path calculation failed
+		// This is not critical for functionality, but the user will see relative path
+		absPath = cleanFilename
+	}
+	return format, cleanFilename, absPath, nil
+}
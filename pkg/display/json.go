@@ -0,0 +1,170 @@
+package display
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// JSONRow encodes a result row as a JSON object with the columns in query order
+func JSONRow(columnNames []string, row []interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, name := range columnNames {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if i < len(row) {
+			value = JSONValue(row[i])
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode column %s: %w", name, err)
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(encoded)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// maxExactDigits is the most significant digits a numeric can have and still be written
+// as a JSON number that float64 readers parse exactly
+const maxExactDigits = 15
+
+// JSONValue converts a value scanned from Postgres to one that encodes naturally as JSON:
+// numbers as numbers, timestamps as RFC 3339, json and jsonb embedded, arrays as arrays,
+// bytea as base64 and NULL as null. Numerics too precise for a float64 are strings.
+func JSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return v
+	case float32:
+		return JSONValue(float64(v))
+	case float64:
+		// JSON has no NaN or infinity
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Sprint(v)
+		}
+		return v
+	case []byte:
+		// bytea; encoding/json writes byte slices as base64
+		return v
+	case [16]byte:
+		// uuid
+		return fmt.Sprintf("%x-%x-%x-%x-%x", v[0:4], v[4:6], v[6:8], v[8:10], v[10:16])
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case pgtype.Numeric:
+		return numericJSONValue(v)
+	case []interface{}:
+		// arrays, and json and jsonb arrays
+		converted := make([]interface{}, len(v))
+		for i, element := range v {
+			converted[i] = JSONValue(element)
+		}
+		return converted
+	case map[string]interface{}:
+		// json and jsonb objects
+		return v
+	case json.Marshaler, encoding.TextMarshaler:
+		return v
+	case driver.Valuer:
+		// other pgtype values, e.g. intervals, in their Postgres text form
+		converted, err := v.Value()
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return JSONValue(converted)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// numericJSONValue writes a numeric as a JSON number, or as a string when a float64 would lose digits
+func numericJSONValue(n pgtype.Numeric) interface{} {
+	switch {
+	case !n.Valid:
+		return nil
+	case n.NaN:
+		return "NaN"
+	case n.InfinityModifier == pgtype.Infinity:
+		return "Infinity"
+	case n.InfinityModifier == pgtype.NegativeInfinity:
+		return "-Infinity"
+	case n.Int == nil:
+		return nil
+	}
+	text, err := n.MarshalJSON()
+	if err != nil {
+		return nil
+	}
+	if len(new(big.Int).Abs(n.Int).String()) > maxExactDigits {
+		return string(text)
+	}
+	return json.Number(text)
+}
+
+// WriteJSON writes query results as a JSON array with one object per row
+func WriteJSON(w io.Writer, columnNames []string, allRows [][]interface{}) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i, row := range allRows {
+		encoded, err := JSONRow(columnNames, row)
+		if err != nil {
+			return err
+		}
+		separator := ",\n"
+		if i == 0 {
+			separator = "\n"
+		}
+		if _, err := fmt.Fprintf(w, "%s  %s", separator, encoded); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "\n]\n")
+	return err
+}
+
+// WriteNDJSON writes query results as newline-delimited JSON, one object per row
+func WriteNDJSON(w io.Writer, columnNames []string, allRows [][]interface{}) error {
+	for _, row := range allRows {
+		encoded, err := JSONRow(columnNames, row)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", encoded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveJSON saves query results to a JSON file
+func SaveJSON(columnNames []string, allRows [][]interface{}, filename string) error {
+	return saveFile(filename, func(w io.Writer) error {
+		return WriteJSON(w, columnNames, allRows)
+	})
+}
+
+// SaveNDJSON saves query results to a newline-delimited JSON file
+func SaveNDJSON(columnNames []string, allRows [][]interface{}, filename string) error {
+	return saveFile(filename, func(w io.Writer) error {
+		return WriteNDJSON(w, columnNames, allRows)
+	})
+}
@@ -0,0 +1,129 @@
+package display
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestJSONRow(t *testing.T) {
+	uuid := [16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}
+	row := []interface{}{
+		int32(7),
+		"Zoë",
+		nil,
+		[]byte("raw"),
+		uuid,
+		math.NaN(),
+		time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		map[string]interface{}{"a": 1.0},
+	}
+	columns := []string{"id", "name", "note", "data", "uuid", "ratio", "at", "extra"}
+
+	encoded, err := JSONRow(columns, row)
+	if err != nil {
+		t.Fatalf("JSONRow failed: %v", err)
+	}
+	want := `{"id":7,"name":"Zoë","note":null,"data":"cmF3","uuid":"12345678-9abc-def0-1234-56789abcdef0","ratio":"NaN","at":"2024-01-02T03:04:05Z","extra":{"a":1}}`
+	if string(encoded) != want {
+		t.Errorf("unexpected JSON:\n got %s\nwant %s", encoded, want)
+	}
+	if !json.Valid(encoded) {
+		t.Error("expected valid JSON")
+	}
+
+	// Duplicate column names are kept, as in the query
+	encoded, err = JSONRow([]string{"count", "count"}, []interface{}{1, 2})
+	if err != nil || string(encoded) != `{"count":1,"count":2}` {
+		t.Errorf("unexpected JSON for duplicate columns: %s, %v", encoded, err)
+	}
+}
+
+func TestJSONValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"numeric", pgtype.Numeric{Int: big.NewInt(12345), Exp: -2, Valid: true}, `123.45`},
+		{"precise numeric", pgtype.Numeric{Int: big.NewInt(1234567890123456789), Exp: -4, Valid: true}, `"123456789012345.6789"`},
+		{"numeric nan", pgtype.Numeric{NaN: true, Valid: true}, `"NaN"`},
+		{"numeric infinity", pgtype.Numeric{InfinityModifier: pgtype.NegativeInfinity, Valid: true}, `"-Infinity"`},
+		{"null numeric", pgtype.Numeric{}, `null`},
+		{"timestamptz", time.Date(2024, 5, 6, 7, 8, 9, 500, time.FixedZone("", 2*3600)), `"2024-05-06T07:08:09.0000005+02:00"`},
+		{"array", []interface{}{int32(1), nil, []byte{0xff}}, `[1,null,"/w=="]`},
+		{"jsonb", map[string]interface{}{"tags": []interface{}{"a"}}, `{"tags":["a"]}`},
+		{"interval", pgtype.Interval{Days: 3, Valid: true}, `"3 day 00:00:00"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := json.Marshal(JSONValue(tt.value))
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			if string(encoded) != tt.want {
+				t.Errorf("got %s, want %s", encoded, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveQueryResult(t *testing.T) {
+	dir := t.TempDir()
+	columns := []string{"id", "name"}
+	rows := [][]interface{}{{1, "Alice"}, {2, nil}}
+
+	tests := []struct {
+		filename string
+		format   string
+		wantFile string
+		want     string
+	}{
+		{"people.json", "", "people.json", "[\n  {\"id\":1,\"name\":\"Alice\"},\n  {\"id\":2,\"name\":null}\n]\n"},
+		{"people.ndjson", "", "people.ndjson", "{\"id\":1,\"name\":\"Alice\"}\n{\"id\":2,\"name\":null}\n"},
+		{"people.jsonl", "", "people.jsonl", "{\"id\":1,\"name\":\"Alice\"}\n{\"id\":2,\"name\":null}\n"},
+		{"export", FormatNDJSON, "export.ndjson", "{\"id\":1,\"name\":\"Alice\"}\n{\"id\":2,\"name\":null}\n"},
+		{"people.txt", "", "people.txt.csv", "id,name\n1,Alice\n2,\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wantFile, func(t *testing.T) {
+			path, err := SaveQueryResult(columns, rows, filepath.Join(dir, tt.filename), tt.format)
+			if err != nil {
+				t.Fatalf("SaveQueryResult failed: %v", err)
+			}
+			if filepath.Base(path) != tt.wantFile {
+				t.Errorf("expected %s, got %s", tt.wantFile, path)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("got %q, want %q", data, tt.want)
+			}
+		})
+	}
+
+	// An empty JSON export is still an array
+	path, err := SaveQueryResult(columns, nil, filepath.Join(dir, "empty.json"), "")
+	if err != nil {
+		t.Fatalf("SaveQueryResult failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); !json.Valid(data) || strings.TrimSpace(string(data)) != "[\n]" {
+		t.Errorf("expected an empty array, got %q", data)
+	}
+
+	if _, err := SaveQueryResult(columns, rows, filepath.Join(dir, "x"), "xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+	if _, err := SaveQueryResult(columns, rows, "../escape.json", ""); err == nil {
+		t.Error("expected error for path traversal")
+	}
+}
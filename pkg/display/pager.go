@@ -3,17 +3,19 @@ package display
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
 )
 
-// PageResult sends formatted table data to less for interactive viewing
-func PageResult(title string, content string) error {
+// PageResult sends formatted table data to less for interactive viewing. Messages, and
+// the content itself when less is not installed, are written to out.
+func PageResult(out io.Writer, title string, content string) error {
 	// Check if less is available
 	if _, err := exec.LookPath("less"); err != nil {
-		fmt.Println("⚠️  'less' command not found, displaying all content:")
-		fmt.Print(content)
+		fmt.Fprintln(out, "⚠️  'less' command not found, displaying all content:")
+		fmt.Fprint(out, content)
 		return nil
 	}
 
@@ -24,13 +26,13 @@ func PageResult(title string, content string) error {
 	cmd.Stderr = os.Stderr
 
 	// Start the command and wait for completion
-	fmt.Printf("📖 Opening %s in less (press 'q' to exit)...\n", title)
+	fmt.Fprintf(out, "📖 Opening %s in less (press 'q' to exit)...\n", title)
 
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("error running less: %w", err)
 	}
 
-	fmt.Println("✅ Returned from less viewer")
+	fmt.Fprintln(out, "✅ Returned from less viewer")
 	return nil
 }
 
@@ -81,9 +83,9 @@ type QueryResultData struct {
 }
 
 // PageQueryResult is a convenience function for paging query results
-func PageQueryResult(data *QueryResultData, queryInfo string) error {
+func PageQueryResult(out io.Writer, data *QueryResultData, queryInfo string) error {
 	if data == nil || len(data.Rows) == 0 {
-		fmt.Println("No data to browse.")
+		fmt.Fprintln(out, "No data to browse.")
 		return nil
 	}
 
@@ -93,7 +95,7 @@ func PageQueryResult(data *QueryResultData, queryInfo string) error {
 	// Add query info to the top
 	fullContent := fmt.Sprintf("Query: %s\n\n%s", queryInfo, content)
 
-	return PageResult(title, fullContent)
+	return PageResult(out, title, fullContent)
 }
 
 func min(a, b int) int {
@@ -110,10 +112,10 @@ func CheckLessAvailable() bool {
 }
 
 // PageWithContext is a context-aware version of PageResult
-func PageWithContext(ctx context.Context, title string, content string) error {
+func PageWithContext(ctx context.Context, out io.Writer, title string, content string) error {
 	if !CheckLessAvailable() {
-		fmt.Println("⚠️  'less' command not found, displaying all content:")
-		fmt.Print(content)
+		fmt.Fprintln(out, "⚠️  'less' command not found, displaying all content:")
+		fmt.Fprint(out, content)
 		return nil
 	}
 
@@ -122,7 +124,7 @@ func PageWithContext(ctx context.Context, title string, content string) error {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	fmt.Printf("📖 Opening %s in less (press 'q' to exit)...\n", title)
+	fmt.Fprintf(out, "📖 Opening %s in less (press 'q' to exit)...\n", title)
 
 	if err := cmd.Run(); err != nil {
 		// Check if it was cancelled due to context
@@ -132,6 +134,6 @@ func PageWithContext(ctx context.Context, title string, content string) error {
 		return fmt.Errorf("error running less: %w", err)
 	}
 
-	fmt.Println("✅ Returned from less viewer")
+	fmt.Fprintln(out, "✅ Returned from less viewer")
 	return nil
 }
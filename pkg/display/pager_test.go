@@ -1,6 +1,7 @@
 package display
 
 import (
+	"io"
 	"strings"
 	"testing"
 )
@@ -129,7 +130,7 @@ func TestPageQueryResult(t *testing.T) {
 
 			if tt.data == nil || len(tt.data.Rows) == 0 {
 				// These cases should return early without error
-				err := PageQueryResult(tt.data, tt.queryInfo)
+				err := PageQueryResult(io.Discard, tt.data, tt.queryInfo)
 				if tt.expectErr && err == nil {
 					t.Error("Expected error but got none")
 				}
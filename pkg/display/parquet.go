@@ -0,0 +1,383 @@
+package display
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/encoding"
+)
+
+// ExportColumn describes a result column for export formats that are typed
+type ExportColumn struct {
+	Name         string
+	Type         string // Postgres type name, e.g. int4 or timestamptz; empty when unknown
+	TypeModifier int32  // e.g. a numeric's precision and scale; -1 when there is none
+}
+
+// parquetRowGroupSize is how many rows ParquetWriter buffers before writing them out
+const parquetRowGroupSize = 8192
+
+// Unconstrained numerics are written as decimal(38, 18), the widest decimal most readers support
+const (
+	defaultDecimalPrecision = 38
+	defaultDecimalScale     = 18
+)
+
+// parquetColumn is a column's Parquet type and how its values are converted to it
+type parquetColumn struct {
+	name    string
+	node    parquet.Node
+	convert func(c *parquetColumn, value interface{}) (parquet.Value, error)
+
+	// Decimal columns only
+	precision  int
+	scale      int
+	typeLength int // byte width when stored as a fixed length byte array
+}
+
+// ParquetWriter writes query results as a Parquet file, a row at a time. Rows are written
+// out in row groups of parquetRowGroupSize rows, so the whole result never needs to be in
+// memory. Every column is optional.
+type ParquetWriter struct {
+	writer  *parquet.Writer
+	columns []*parquetColumn
+	row     parquet.Row
+	closed  bool
+}
+
+// NewParquetWriter returns a writer for rows with the given columns
+func NewParquetWriter(w io.Writer, columns []ExportColumn) (*ParquetWriter, error) {
+	pw := &ParquetWriter{}
+	fields := make(orderedGroup, len(columns))
+	for i, column := range columns {
+		c := newParquetColumn(column)
+		pw.columns = append(pw.columns, c)
+		fields[i] = orderedField{Node: parquet.Optional(c.node), name: column.Name}
+	}
+	pw.writer = parquet.NewWriter(w,
+		parquet.NewSchema("schema", fields),
+		parquet.MaxRowsPerRowGroup(parquetRowGroupSize),
+		parquet.CreatedBy("pgbabble", "", ""),
+	)
+	return pw, nil
+}
+
+// Write adds a row, writing out a row group when enough rows are buffered
+func (pw *ParquetWriter) Write(row []interface{}) error {
+	if pw.closed {
+		return fmt.Errorf("parquet writer is closed")
+	}
+	pw.row = pw.row[:0]
+	for i, c := range pw.columns {
+		var value interface{}
+		if i < len(row) {
+			value = row[i]
+		}
+		if value == nil {
+			pw.row = append(pw.row, parquet.NullValue().Level(0, 0, i))
+			continue
+		}
+		v, err := c.convert(c, value)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", c.name, err)
+		}
+		pw.row = append(pw.row, v.Level(0, 1, i))
+	}
+	_, err := pw.writer.WriteRows([]parquet.Row{pw.row})
+	return err
+}
+
+// Close writes any buffered rows and the file footer. It does not close the underlying writer.
+func (pw *ParquetWriter) Close() error {
+	if pw.closed {
+		return nil
+	}
+	pw.closed = true
+	return pw.writer.Close()
+}
+
+// orderedGroup is a group node that keeps its fields in result column order; parquet.Group
+// sorts them by name
+type orderedGroup []orderedField
+
+type orderedField struct {
+	parquet.Node
+	name string
+}
+
+func (f orderedField) Name() string                           { return f.name }
+func (f orderedField) Value(base reflect.Value) reflect.Value { return base }
+
+func (g orderedGroup) ID() int                     { return 0 }
+func (g orderedGroup) String() string              { return "schema" }
+func (g orderedGroup) Type() parquet.Type          { return parquet.Group{}.Type() }
+func (g orderedGroup) Optional() bool              { return false }
+func (g orderedGroup) Repeated() bool              { return false }
+func (g orderedGroup) Required() bool              { return true }
+func (g orderedGroup) Leaf() bool                  { return false }
+func (g orderedGroup) Encoding() encoding.Encoding { return nil }
+func (g orderedGroup) Compression() compress.Codec { return nil }
+func (g orderedGroup) GoType() reflect.Type        { return reflect.TypeOf([]interface{}{}) }
+func (g orderedGroup) Fields() []parquet.Field {
+	fields := make([]parquet.Field, len(g))
+	for i, f := range g {
+		fields[i] = f
+	}
+	return fields
+}
+
+// newParquetColumn maps a Postgres type to a Parquet column. Types without a natural
+// Parquet equivalent are written as strings.
+func newParquetColumn(column ExportColumn) *parquetColumn {
+	c := &parquetColumn{name: column.Name, node: parquet.String(), convert: convertString}
+	switch column.Type {
+	case "int2":
+		c.node, c.convert = parquet.Int(16), convertInt32
+	case "int4":
+		c.node, c.convert = parquet.Leaf(parquet.Int32Type), convertInt32
+	case "int8":
+		c.node, c.convert = parquet.Leaf(parquet.Int64Type), convertInt64
+	case "float4":
+		c.node, c.convert = parquet.Leaf(parquet.FloatType), convertFloat
+	case "float8":
+		c.node, c.convert = parquet.Leaf(parquet.DoubleType), convertDouble
+	case "bool":
+		c.node, c.convert = parquet.Leaf(parquet.BooleanType), convertBoolean
+	case "date":
+		c.node, c.convert = parquet.Date(), convertDate
+	case "timestamptz":
+		c.node, c.convert = parquet.Timestamp(parquet.Microsecond), convertTimestamp
+	case "timestamp":
+		c.node, c.convert = parquet.TimestampAdjusted(parquet.Microsecond, false), convertTimestamp
+	case "bytea":
+		c.node, c.convert = parquet.Leaf(parquet.ByteArrayType), convertBytes
+	case "json", "jsonb":
+		c.convert = convertJSON
+	case "numeric":
+		c.precision, c.scale = numericPrecision(column.TypeModifier)
+		c.convert = convertDecimal
+		switch {
+		case c.precision <= 9:
+			c.node = parquet.Decimal(c.scale, c.precision, parquet.Int32Type)
+		case c.precision <= 18:
+			c.node = parquet.Decimal(c.scale, c.precision, parquet.Int64Type)
+		default:
+			c.typeLength = decimalByteLength(c.precision)
+			c.node = parquet.Decimal(c.scale, c.precision, parquet.FixedLenByteArrayType(c.typeLength))
+		}
+	}
+	return c
+}
+
+// numericPrecision returns the precision and scale of a numeric(p, s) type modifier
+func numericPrecision(typeModifier int32) (int, int) {
+	if typeModifier < 4 {
+		return defaultDecimalPrecision, defaultDecimalScale
+	}
+	precision := int(((typeModifier - 4) >> 16) & 0xffff)
+	scale := int((typeModifier - 4) & 0xffff)
+	if precision < 1 || scale > precision {
+		// e.g. a negative scale, which Parquet decimals do not allow
+		return defaultDecimalPrecision, defaultDecimalScale
+	}
+	return precision, scale
+}
+
+// decimalByteLength returns the bytes needed for a two's complement decimal of the given precision
+func decimalByteLength(precision int) int {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(precision)), nil)
+	n := 1
+	for new(big.Int).Lsh(big.NewInt(1), uint(8*n-1)).Cmp(limit) < 0 {
+		n++
+	}
+	return n
+}
+
+func asInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
+func convertInt32(c *parquetColumn, value interface{}) (parquet.Value, error) {
+	v, ok := asInt64(value)
+	if !ok {
+		return parquet.Value{}, fmt.Errorf("cannot write %T as an integer", value)
+	}
+	if v < math.MinInt32 || v > math.MaxInt32 {
+		return parquet.Value{}, fmt.Errorf("%d does not fit in a 32-bit integer", v)
+	}
+	return parquet.Int32Value(int32(v)), nil
+}
+
+func convertInt64(c *parquetColumn, value interface{}) (parquet.Value, error) {
+	v, ok := asInt64(value)
+	if !ok {
+		return parquet.Value{}, fmt.Errorf("cannot write %T as an integer", value)
+	}
+	return parquet.Int64Value(v), nil
+}
+
+func convertFloat(c *parquetColumn, value interface{}) (parquet.Value, error) {
+	switch v := value.(type) {
+	case float32:
+		return parquet.FloatValue(v), nil
+	case float64:
+		return parquet.FloatValue(float32(v)), nil
+	}
+	return parquet.Value{}, fmt.Errorf("cannot write %T as a float", value)
+}
+
+func convertDouble(c *parquetColumn, value interface{}) (parquet.Value, error) {
+	switch v := value.(type) {
+	case float32:
+		return parquet.DoubleValue(float64(v)), nil
+	case float64:
+		return parquet.DoubleValue(v), nil
+	}
+	return parquet.Value{}, fmt.Errorf("cannot write %T as a double", value)
+}
+
+func convertBoolean(c *parquetColumn, value interface{}) (parquet.Value, error) {
+	v, ok := value.(bool)
+	if !ok {
+		return parquet.Value{}, fmt.Errorf("cannot write %T as a boolean", value)
+	}
+	return parquet.BooleanValue(v), nil
+}
+
+func convertDate(c *parquetColumn, value interface{}) (parquet.Value, error) {
+	t, ok := value.(time.Time)
+	if !ok {
+		return parquet.Value{}, fmt.Errorf("cannot write %T as a date", value)
+	}
+	days := t.Unix() / 86400
+	if t.Unix() < 0 && t.Unix()%86400 != 0 {
+		days-- // round towards the earlier day
+	}
+	return parquet.Int32Value(int32(days)), nil
+}
+
+func convertTimestamp(c *parquetColumn, value interface{}) (parquet.Value, error) {
+	t, ok := value.(time.Time)
+	if !ok {
+		return parquet.Value{}, fmt.Errorf("cannot write %T as a timestamp", value)
+	}
+	return parquet.Int64Value(t.UnixMicro()), nil
+}
+
+func convertBytes(c *parquetColumn, value interface{}) (parquet.Value, error) {
+	b, ok := value.([]byte)
+	if !ok {
+		return parquet.Value{}, fmt.Errorf("cannot write %T as bytes", value)
+	}
+	return parquet.ByteArrayValue(b), nil
+}
+
+// convertJSON writes json and jsonb values as JSON text
+func convertJSON(c *parquetColumn, value interface{}) (parquet.Value, error) {
+	b, err := json.Marshal(JSONValue(value))
+	if err != nil {
+		return parquet.Value{}, err
+	}
+	return parquet.ByteArrayValue(b), nil
+}
+
+// convertString writes text, and the text form of types without a Parquet equivalent
+func convertString(c *parquetColumn, value interface{}) (parquet.Value, error) {
+	if s, ok := JSONValue(value).(string); ok {
+		return parquet.ByteArrayValue([]byte(s)), nil
+	}
+	if b, ok := value.([]byte); ok {
+		return parquet.ByteArrayValue(b), nil
+	}
+	return convertJSON(c, value)
+}
+
+// convertDecimal writes a numeric as an unscaled integer at the column's scale, rounding
+// half away from zero
+func convertDecimal(c *parquetColumn, value interface{}) (parquet.Value, error) {
+	var unscaled *big.Int
+	var exp int32
+	switch v := value.(type) {
+	case pgtype.Numeric:
+		switch {
+		case v.NaN:
+			return parquet.Value{}, fmt.Errorf("NaN cannot be stored as a Parquet decimal")
+		case v.InfinityModifier != pgtype.Finite:
+			return parquet.Value{}, fmt.Errorf("infinity cannot be stored as a Parquet decimal")
+		case v.Int == nil:
+			unscaled = new(big.Int)
+		default:
+			unscaled, exp = new(big.Int).Set(v.Int), v.Exp
+		}
+	default:
+		i, ok := asInt64(value)
+		if !ok {
+			return parquet.Value{}, fmt.Errorf("cannot write %T as a decimal", value)
+		}
+		unscaled = big.NewInt(i)
+	}
+
+	shift := int64(exp) + int64(c.scale)
+	if shift >= 0 {
+		unscaled.Mul(unscaled, new(big.Int).Exp(big.NewInt(10), big.NewInt(shift), nil))
+	} else {
+		divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(-shift), nil)
+		remainder := new(big.Int)
+		unscaled.QuoRem(unscaled, divisor, remainder)
+		if new(big.Int).Lsh(new(big.Int).Abs(remainder), 1).Cmp(divisor) >= 0 {
+			unscaled.Add(unscaled, big.NewInt(int64(remainder.Sign())))
+		}
+	}
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(c.precision)), nil)
+	if new(big.Int).Abs(unscaled).Cmp(limit) >= 0 {
+		return parquet.Value{}, fmt.Errorf("%v does not fit in decimal(%d, %d)", JSONValue(value), c.precision, c.scale)
+	}
+
+	switch {
+	case c.precision <= 9:
+		return parquet.Int32Value(int32(unscaled.Int64())), nil
+	case c.precision <= 18:
+		return parquet.Int64Value(unscaled.Int64()), nil
+	}
+	// Big-endian two's complement
+	if unscaled.Sign() < 0 {
+		unscaled.Add(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(8*c.typeLength)))
+	}
+	return parquet.FixedLenByteArrayValue(unscaled.FillBytes(make([]byte, c.typeLength))), nil
+}
+
+// SaveParquet saves query results to a Parquet file
+func SaveParquet(columns []ExportColumn, allRows [][]interface{}, filename string) error {
+	return saveFile(filename, func(w io.Writer) error {
+		pw, err := NewParquetWriter(w, columns)
+		if err != nil {
+			return err
+		}
+		for _, row := range allRows {
+			if err := pw.Write(row); err != nil {
+				return err
+			}
+		}
+		return pw.Close()
+	})
+}
@@ -0,0 +1,228 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/parquet-go/parquet-go"
+)
+
+// readParquet opens a file with parquet-go and returns, per column, the values of every
+// row with nil for nulls
+func readParquet(t *testing.T, data []byte) (*parquet.File, [][]interface{}) {
+	t.Helper()
+	f, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("failed to open the file: %v", err)
+	}
+	columns := make([][]interface{}, len(f.Schema().Fields()))
+	for _, rg := range f.RowGroups() {
+		rows := rg.Rows()
+		batch := make([]parquet.Row, 100)
+		for {
+			n, err := rows.ReadRows(batch)
+			for _, row := range batch[:n] {
+				for _, v := range row {
+					columns[v.Column()] = append(columns[v.Column()], parquetValue(v))
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		rows.Close()
+	}
+	return f, columns
+}
+
+// parquetFixture returns columns of every supported type and rows including nulls
+func parquetFixture() ([]ExportColumn, [][]interface{}, time.Time) {
+	columns := []ExportColumn{
+		{Name: "id", Type: "int4", TypeModifier: -1},
+		{Name: "big", Type: "int8", TypeModifier: -1},
+		{Name: "small", Type: "int2", TypeModifier: -1},
+		{Name: "ratio", Type: "float8", TypeModifier: -1},
+		{Name: "price", Type: "numeric", TypeModifier: (10<<16 | 2) + 4},
+		{Name: "total", Type: "numeric", TypeModifier: -1},
+		{Name: "name", Type: "text", TypeModifier: -1},
+		{Name: "active", Type: "bool", TypeModifier: -1},
+		{Name: "day", Type: "date", TypeModifier: -1},
+		{Name: "at", Type: "timestamptz", TypeModifier: -1},
+		{Name: "doc", Type: "jsonb", TypeModifier: -1},
+		{Name: "other", Type: "uuid", TypeModifier: -1},
+	}
+	at := time.Date(2024, 3, 1, 12, 30, 0, 123000, time.UTC)
+	rows := [][]interface{}{
+		{int32(1), int64(1) << 40, int16(-3), 0.5, pgtype.Numeric{Int: big.NewInt(1999), Exp: -2, Valid: true},
+			pgtype.Numeric{Int: big.NewInt(-12345), Exp: -1, Valid: true}, "Zoë", true,
+			time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), at, map[string]interface{}{"a": []interface{}{1.0}},
+			[16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}},
+		{int32(2), nil, nil, nil, pgtype.Numeric{Int: big.NewInt(5), Exp: -3, Valid: true}, nil, nil, false,
+			time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC), nil, "text", nil},
+		{nil, nil, nil, nil, nil, nil, nil, true, nil, nil, nil, nil},
+	}
+	return columns, rows, at
+}
+
+func TestParquetWriter(t *testing.T) {
+	columns, rows, at := parquetFixture()
+	var buf bytes.Buffer
+	pw, err := NewParquetWriter(&buf, columns)
+	if err != nil {
+		t.Fatalf("NewParquetWriter failed: %v", err)
+	}
+	for _, row := range rows {
+		if err := pw.Write(row); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	f, values := readParquet(t, buf.Bytes())
+	if f.NumRows() != 3 {
+		t.Errorf("expected 3 rows, got %d", f.NumRows())
+	}
+
+	wantTypes := []string{"INT(32,true)", "INT(64,true)", "INT(16,true)", "DOUBLE", "DECIMAL(10,2)", "DECIMAL(38,18)",
+		"STRING", "BOOLEAN", "DATE", "TIMESTAMP(isAdjustedToUTC=true,unit=MICROS)", "STRING", "STRING"}
+	fields := f.Schema().Fields()
+	if len(fields) != len(columns) {
+		t.Fatalf("expected %d fields, got %d", len(columns), len(fields))
+	}
+	for i, field := range fields {
+		if field.Name() != columns[i].Name || !field.Optional() || field.Type().String() != wantTypes[i] {
+			t.Errorf("column %s: got field %s optional=%v type %s, want %s",
+				columns[i].Name, field.Name(), field.Optional(), field.Type(), wantTypes[i])
+		}
+	}
+	if typ := fields[5].Type(); typ.Kind() != parquet.FixedLenByteArray || typ.Length() != 16 {
+		t.Errorf("expected an unconstrained numeric in 16 bytes, got %v of length %d", typ.Kind(), typ.Length())
+	}
+
+	want := [][]interface{}{
+		{int32(1), int32(2), nil},
+		{int64(1) << 40, nil, nil},
+		{int32(-3), nil, nil},
+		{0.5, nil, nil},
+		{int64(1999), int64(1), nil}, // 0.005 rounds half away from zero to 0.01
+		{"-1234500000000000000000", nil, nil},
+		{"Zoë", nil, nil},
+		{true, false, true},
+		{int32(19783), int32(-1), nil},
+		{at.UnixMicro(), nil, nil},
+		{`{"a":[1]}`, `"text"`, nil},
+		{"12345678-9abc-def0-1234-56789abcdef0", nil, nil},
+	}
+	for i := range want {
+		if fmt.Sprint(values[i]) != fmt.Sprint(want[i]) {
+			t.Errorf("column %s: got %v, want %v", columns[i].Name, values[i], want[i])
+		}
+	}
+}
+
+func TestParquetWriter_RowGroups(t *testing.T) {
+	var buf bytes.Buffer
+	pw, err := NewParquetWriter(&buf, []ExportColumn{{Name: "n", Type: "int8", TypeModifier: -1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := parquetRowGroupSize*2 + 5
+	for i := 0; i < total; i++ {
+		var value interface{} = int64(i)
+		if i%3 == 0 {
+			value = nil
+		}
+		if err := pw.Write([]interface{}{value}); err != nil {
+			t.Fatal(err)
+		}
+		// Rows are written out a row group at a time, not all at the end
+		if i == parquetRowGroupSize && buf.Len() < parquetRowGroupSize*8/2 {
+			t.Errorf("expected the first row group to be written, buffer has %d bytes", buf.Len())
+		}
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, values := readParquet(t, buf.Bytes())
+	if len(f.RowGroups()) != 3 || f.NumRows() != int64(total) {
+		t.Errorf("expected 3 row groups and %d rows, got %d and %d", total, len(f.RowGroups()), f.NumRows())
+	}
+	for i, v := range values[0] {
+		if (i%3 == 0) != (v == nil) || (v != nil && v.(int64) != int64(i)) {
+			t.Fatalf("row %d: unexpected value %v", i, v)
+		}
+	}
+}
+
+func TestParquetWriter_Errors(t *testing.T) {
+	tests := []struct {
+		column ExportColumn
+		value  interface{}
+	}{
+		{ExportColumn{Name: "price", Type: "numeric", TypeModifier: (4<<16 | 2) + 4}, pgtype.Numeric{Int: big.NewInt(12345), Exp: -2, Valid: true}},
+		{ExportColumn{Name: "ratio", Type: "numeric", TypeModifier: -1}, pgtype.Numeric{NaN: true, Valid: true}},
+		{ExportColumn{Name: "id", Type: "int4", TypeModifier: -1}, "one"},
+	}
+	for _, tt := range tests {
+		pw, err := NewParquetWriter(&bytes.Buffer{}, []ExportColumn{tt.column})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pw.Write([]interface{}{tt.value}); err == nil {
+			t.Errorf("%s: expected error writing %v", tt.column.Name, tt.value)
+		}
+	}
+}
+
+func TestSaveQueryResult_Parquet(t *testing.T) {
+	path, err := SaveTypedQueryResult([]ExportColumn{{Name: "n", Type: "int4", TypeModifier: -1}}, [][]interface{}{{int32(7)}}, filepath.Join(t.TempDir(), "out"), FormatParquet)
+	if err != nil {
+		t.Fatalf("SaveTypedQueryResult failed: %v", err)
+	}
+	if filepath.Ext(path) != ".parquet" || FormatFromFilename(path) != FormatParquet {
+		t.Errorf("expected a .parquet file, got %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, values := readParquet(t, data); fmt.Sprint(values) != "[[7]]" {
+		t.Errorf("unexpected values %v", values)
+	}
+}
+
+// parquetValue converts a value read by parquet-go to the form used in test expectations
+func parquetValue(v parquet.Value) interface{} {
+	if v.IsNull() {
+		return nil
+	}
+	switch v.Kind() {
+	case parquet.Boolean:
+		return v.Boolean()
+	case parquet.Int32:
+		return v.Int32()
+	case parquet.Int64:
+		return v.Int64()
+	case parquet.Double:
+		return v.Double()
+	case parquet.FixedLenByteArray:
+		// Unconstrained numerics are big-endian two's complement decimals
+		b := v.ByteArray()
+		n := new(big.Int).SetBytes(b)
+		if b[0]&0x80 != 0 {
+			n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+		}
+		return n.String()
+	default:
+		return string(v.ByteArray())
+	}
+}
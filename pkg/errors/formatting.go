@@ -1,33 +1,80 @@
 package errors
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Printer writes user-facing messages to a writer, e.g. stderr when stdout carries results
+type Printer struct {
+	w io.Writer
+}
+
+// To returns a Printer that writes to w, or to stdout when w is nil
+func To(w io.Writer) Printer {
+	if w == nil {
+		w = os.Stdout
+	}
+	return Printer{w: w}
+}
+
+// UserError formats user-facing error messages consistently
+func (p Printer) UserError(format string, args ...interface{}) {
+	fmt.Fprintf(p.w, "❌ %s\n", fmt.Sprintf(format, args...))
+}
+
+// UserWarning formats user-facing warning messages consistently
+func (p Printer) UserWarning(format string, args ...interface{}) {
+	fmt.Fprintf(p.w, "⚠️  %s\n", fmt.Sprintf(format, args...))
+}
+
+// UserInfo formats user-facing info messages consistently
+func (p Printer) UserInfo(format string, args ...interface{}) {
+	fmt.Fprintf(p.w, "ℹ️  %s\n", fmt.Sprintf(format, args...))
+}
+
+// ConnectionWarning formats connection-related warnings
+func (p Printer) ConnectionWarning(format string, args ...interface{}) {
+	fmt.Fprintf(p.w, "Warning: %s\n", fmt.Sprintf(format, args...))
+}
+
+// DatabaseError formats database-related errors with context
+func (p Printer) DatabaseError(operation string, err error) {
+	fmt.Fprintf(p.w, "❌ Database %s failed: %v\n", operation, err)
+}
+
+// APIError formats API-related errors with helpful context
+func (p Printer) APIError(service string, err error) {
+	fmt.Fprintf(p.w, "❌ %s error: %v\n", service, err)
+}
 
 // UserError formats user-facing error messages consistently
 func UserError(format string, args ...interface{}) {
-	fmt.Printf("❌ %s\n", fmt.Sprintf(format, args...))
+	To(os.Stdout).UserError(format, args...)
 }
 
 // UserWarning formats user-facing warning messages consistently
 func UserWarning(format string, args ...interface{}) {
-	fmt.Printf("⚠️  %s\n", fmt.Sprintf(format, args...))
+	To(os.Stdout).UserWarning(format, args...)
 }
 
 // UserInfo formats user-facing info messages consistently
 func UserInfo(format string, args ...interface{}) {
-	fmt.Printf("ℹ️  %s\n", fmt.Sprintf(format, args...))
+	To(os.Stdout).UserInfo(format, args...)
 }
 
 // ConnectionWarning formats connection-related warnings
 func ConnectionWarning(format string, args ...interface{}) {
-	fmt.Printf("Warning: %s\n", fmt.Sprintf(format, args...))
+	To(os.Stdout).ConnectionWarning(format, args...)
 }
 
 // DatabaseError formats database-related errors with context
 func DatabaseError(operation string, err error) {
-	fmt.Printf("❌ Database %s failed: %v\n", operation, err)
+	To(os.Stdout).DatabaseError(operation, err)
 }
 
 // APIError formats API-related errors with helpful context
 func APIError(service string, err error) {
-	fmt.Printf("❌ %s error: %v\n", service, err)
+	To(os.Stdout).APIError(service, err)
 }
@@ -0,0 +1,129 @@
+package explain
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Highlight kinds
+const (
+	KindExpensive   = "expensive"
+	KindSeqScan     = "seq_scan"
+	KindMisestimate = "misestimate"
+)
+
+// Thresholds for highlighting plan nodes
+var (
+	// LargeTableRows is the estimated table size above which a sequential scan is highlighted
+	LargeTableRows int64 = 100_000
+	// ExpensiveShare is the share of the total cost (or time) above which a node is highlighted
+	ExpensiveShare = 0.2
+	// MisestimateFactor is how far actual rows may be from the estimate before it is highlighted
+	MisestimateFactor = 10.0
+)
+
+// maxExpensiveNodes limits how many of the most expensive nodes are highlighted
+const maxExpensiveNodes = 3
+
+// Highlight points out a plan node that is likely to matter for performance
+type Highlight struct {
+	Node    *Node
+	Kind    string
+	Message string
+}
+
+// Analyze finds the most expensive nodes, sequential scans on large tables and,
+// for EXPLAIN ANALYZE plans, row estimates that are far off. tableRows returns the
+// estimated row count of a table by name (schema.table or table), or false if unknown;
+// it may be nil.
+func Analyze(plan *Plan, tableRows func(relation string) (int64, bool)) []Highlight {
+	var highlights []Highlight
+	highlights = append(highlights, expensiveNodes(plan)...)
+
+	plan.Walk(func(node *Node, depth int) {
+		if node.NodeType == "Seq Scan" && node.RelationName != "" && tableRows != nil {
+			rows, ok := tableRows(node.relation())
+			if !ok && node.Schema != "" {
+				rows, ok = tableRows(node.RelationName)
+			}
+			if ok && rows >= LargeTableRows {
+				highlights = append(highlights, Highlight{
+					Node:    node,
+					Kind:    KindSeqScan,
+					Message: fmt.Sprintf("sequential scan on large table %s (~%s rows)", node.relation(), formatCount(float64(rows))),
+				})
+			}
+		}
+
+		if node.ActualRows != nil {
+			estimated, actual := node.PlanRows, *node.ActualRows
+			if max(estimated, actual) >= MisestimateFactor*max(min(estimated, actual), 1) && max(estimated, actual) >= 100 {
+				highlights = append(highlights, Highlight{
+					Node:    node,
+					Kind:    KindMisestimate,
+					Message: fmt.Sprintf("row estimate off by %.0fx (estimated %s, actual %s)", max(estimated, actual)/max(min(estimated, actual), 1), formatCount(estimated), formatCount(actual)),
+				})
+			}
+		}
+	})
+	return highlights
+}
+
+// expensiveNodes returns the nodes with the largest share of the plan's own cost,
+// or of the actual time for EXPLAIN ANALYZE plans
+func expensiveNodes(plan *Plan) []Highlight {
+	analyzed := plan.Analyzed()
+	measure := func(n *Node) float64 {
+		if analyzed {
+			return n.SelfTime()
+		}
+		return n.SelfCost()
+	}
+	total := plan.Root.TotalCost
+	if analyzed {
+		total = plan.Root.actualTime()
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	var nodes []*Node
+	plan.Walk(func(node *Node, depth int) {
+		nodes = append(nodes, node)
+	})
+	// A single node is trivially the most expensive one
+	if len(nodes) < 2 {
+		return nil
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return measure(nodes[i]) > measure(nodes[j])
+	})
+
+	var highlights []Highlight
+	for _, node := range nodes[:min(len(nodes), maxExpensiveNodes)] {
+		share := measure(node) / total
+		if share < ExpensiveShare {
+			break
+		}
+		message := fmt.Sprintf("%.0f%% of the estimated cost", share*100)
+		if analyzed {
+			message = fmt.Sprintf("%.0f%% of the execution time (%.1f ms)", share*100, measure(node))
+		}
+		highlights = append(highlights, Highlight{Node: node, Kind: KindExpensive, Message: message})
+	}
+	return highlights
+}
+
+// formatCount formats a row count compactly, e.g. 1.2M
+func formatCount(n float64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.1fB", n/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1fM", n/1e6)
+	case n >= 1e4:
+		return fmt.Sprintf("%.0fk", n/1e3)
+	default:
+		return fmt.Sprintf("%.0f", n)
+	}
+}
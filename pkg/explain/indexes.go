@@ -0,0 +1,141 @@
+package explain
+
+import (
+	"regexp"
+	"strings"
+)
+
+// IndexCandidate describes the columns a sequential scan filters on, which an index could serve
+type IndexCandidate struct {
+	Node     *Node
+	Relation string   // table as named in the plan, schema.table when the plan includes the schema
+	Equality []string // columns compared with =, IN or IS NULL
+	Range    []string // columns compared with <, <=, > or >=
+}
+
+// Columns returns the index columns in the order a btree index serves them best:
+// equality columns first, then a single range column
+func (c IndexCandidate) Columns() []string {
+	columns := append([]string{}, c.Equality...)
+	if len(c.Range) > 0 {
+		columns = append(columns, c.Range[0])
+	}
+	return columns
+}
+
+// comparisonPattern matches a filter condition on a plain column, optionally cast, e.g.
+// "status = 'shipped'::text", "(status)::text = ANY (...)", "created_at >= '2024-01-01'" or "deleted_at IS NULL"
+var comparisonPattern = regexp.MustCompile(`^\(?("(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_$]*)\)?(?:::[A-Za-z_][A-Za-z0-9_ ]*(?:\[\])?)?\s+(=|<=|>=|<|>|IS NULL)(?:\s|$)`)
+
+// IndexCandidates finds sequential scans with filters on plain columns. Conditions joined
+// with OR, or on expressions, are skipped since a simple btree index does not serve them.
+func IndexCandidates(plan *Plan) []IndexCandidate {
+	var candidates []IndexCandidate
+	plan.Walk(func(node *Node, depth int) {
+		if node.NodeType != "Seq Scan" || node.RelationName == "" || node.Filter == "" {
+			return
+		}
+		equality, rng := filterColumns(node.Filter)
+		if len(equality) == 0 && len(rng) == 0 {
+			return
+		}
+		candidates = append(candidates, IndexCandidate{
+			Node:     node,
+			Relation: node.relation(),
+			Equality: equality,
+			Range:    rng,
+		})
+	})
+	return candidates
+}
+
+// filterColumns splits a filter into its top-level AND conditions and returns the
+// columns compared for equality and for ranges, without duplicates
+func filterColumns(filter string) (equality, rng []string) {
+	seen := make(map[string]bool)
+	for _, condition := range splitTopLevel(stripParens(filter), " AND ") {
+		condition = stripParens(condition)
+		if len(splitTopLevel(condition, " OR ")) > 1 {
+			continue
+		}
+		match := comparisonPattern.FindStringSubmatch(condition)
+		if match == nil {
+			continue
+		}
+		column := match[1]
+		if strings.HasPrefix(column, `"`) {
+			column = strings.ReplaceAll(column[1:len(column)-1], `""`, `"`)
+		}
+		if seen[column] {
+			continue
+		}
+		seen[column] = true
+		if match[2] == "=" || match[2] == "IS NULL" {
+			equality = append(equality, column)
+		} else {
+			rng = append(rng, column)
+		}
+	}
+	return equality, rng
+}
+
+// splitTopLevel splits s on sep where sep is outside parentheses and quotes
+func splitTopLevel(s, sep string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && strings.HasPrefix(s[i:], sep):
+			parts = append(parts, s[start:i])
+			start = i + len(sep)
+			i += len(sep) - 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// stripParens removes parentheses that enclose the whole condition
+func stripParens(s string) string {
+	s = strings.TrimSpace(s)
+	for strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") && enclosed(s) {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	return s
+}
+
+// enclosed reports whether the opening parenthesis at the start of s closes at its end
+func enclosed(s string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 && i < len(s)-1 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
@@ -0,0 +1,198 @@
+// Package explain parses PostgreSQL EXPLAIN (FORMAT JSON) output into a plan tree,
+// points out likely performance problems and renders the plan for the terminal and the LLM.
+package explain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Plan is a parsed EXPLAIN (FORMAT JSON) result
+type Plan struct {
+	Root          *Node   `json:"Plan"`
+	PlanningTime  float64 `json:"Planning Time"`  // milliseconds, only with ANALYZE
+	ExecutionTime float64 `json:"Execution Time"` // milliseconds, only with ANALYZE
+}
+
+// Node is one plan node. Actual* fields are only set when the plan comes from EXPLAIN ANALYZE.
+type Node struct {
+	NodeType     string  `json:"Node Type"`
+	Strategy     string  `json:"Strategy"`
+	JoinType     string  `json:"Join Type"`
+	RelationName string  `json:"Relation Name"`
+	Schema       string  `json:"Schema"`
+	Alias        string  `json:"Alias"`
+	IndexName    string  `json:"Index Name"`
+	CTEName      string  `json:"CTE Name"`
+	FunctionName string  `json:"Function Name"`
+	StartupCost  float64 `json:"Startup Cost"`
+	TotalCost    float64 `json:"Total Cost"`
+	PlanRows     float64 `json:"Plan Rows"`
+	PlanWidth    int     `json:"Plan Width"`
+
+	ActualStartupTime *float64 `json:"Actual Startup Time"`
+	ActualTotalTime   *float64 `json:"Actual Total Time"`
+	ActualRows        *float64 `json:"Actual Rows"`
+	ActualLoops       *float64 `json:"Actual Loops"`
+
+	Filter              string   `json:"Filter"`
+	RowsRemovedByFilter float64  `json:"Rows Removed by Filter"`
+	IndexCond           string   `json:"Index Cond"`
+	RecheckCond         string   `json:"Recheck Cond"`
+	HashCond            string   `json:"Hash Cond"`
+	MergeCond           string   `json:"Merge Cond"`
+	JoinFilter          string   `json:"Join Filter"`
+	SortKey             []string `json:"Sort Key"`
+	GroupKey            []string `json:"Group Key"`
+	SortMethod          string   `json:"Sort Method"`
+	SortSpaceType       string   `json:"Sort Space Type"`
+
+	// Buffer usage, only with EXPLAIN (ANALYZE, BUFFERS)
+	SharedHitBlocks   int64 `json:"Shared Hit Blocks"`
+	SharedReadBlocks  int64 `json:"Shared Read Blocks"`
+	TempReadBlocks    int64 `json:"Temp Read Blocks"`
+	TempWrittenBlocks int64 `json:"Temp Written Blocks"`
+
+	Plans []*Node `json:"Plans"`
+}
+
+// Parse parses the output of EXPLAIN (FORMAT JSON), a one-element array holding the plan
+func Parse(data []byte) (*Plan, error) {
+	var plans []Plan
+	if err := json.Unmarshal(data, &plans); err != nil {
+		return nil, fmt.Errorf("failed to parse EXPLAIN output: %w", err)
+	}
+	if len(plans) == 0 || plans[0].Root == nil {
+		return nil, fmt.Errorf("EXPLAIN output contains no plan")
+	}
+	return &plans[0], nil
+}
+
+// Analyzed reports whether the plan includes actual row counts and timings
+func (p *Plan) Analyzed() bool {
+	return p.Root.ActualTotalTime != nil
+}
+
+// Walk calls fn for every node in depth-first order with its depth below the root
+func (p *Plan) Walk(fn func(node *Node, depth int)) {
+	var walk func(node *Node, depth int)
+	walk = func(node *Node, depth int) {
+		fn(node, depth)
+		for _, child := range node.Plans {
+			walk(child, depth+1)
+		}
+	}
+	walk(p.Root, 0)
+}
+
+// Label describes the node like the text EXPLAIN format, e.g. "Index Scan using users_pkey on users u"
+func (n *Node) Label() string {
+	label := n.NodeType
+	switch {
+	case n.NodeType == "Aggregate":
+		switch n.Strategy {
+		case "Sorted":
+			label = "GroupAggregate"
+		case "Hashed":
+			label = "HashAggregate"
+		case "Mixed":
+			label = "MixedAggregate"
+		}
+	case n.JoinType != "" && n.JoinType != "Inner":
+		if strings.HasSuffix(n.NodeType, " Join") {
+			label = strings.TrimSuffix(n.NodeType, "Join") + n.JoinType + " Join"
+		} else {
+			label = n.NodeType + " " + n.JoinType + " Join"
+		}
+	}
+
+	if n.IndexName != "" {
+		label += " using " + n.IndexName
+	}
+	if relation := n.relation(); relation != "" {
+		label += " on " + relation
+		if n.Alias != "" && n.Alias != n.RelationName && n.Alias != n.CTEName && n.Alias != n.FunctionName {
+			label += " " + n.Alias
+		}
+	}
+	return label
+}
+
+// relation returns the table, CTE or function the node reads from
+func (n *Node) relation() string {
+	switch {
+	case n.RelationName != "" && n.Schema != "":
+		return n.Schema + "." + n.RelationName
+	case n.RelationName != "":
+		return n.RelationName
+	case n.CTEName != "":
+		return n.CTEName
+	default:
+		return n.FunctionName
+	}
+}
+
+// Conditions returns the node's filter, join, sort and buffer details as "name: value" strings
+func (n *Node) Conditions() []string {
+	var conditions []string
+	add := func(name, value string) {
+		if value != "" {
+			conditions = append(conditions, name+": "+value)
+		}
+	}
+	add("Index Cond", n.IndexCond)
+	add("Recheck Cond", n.RecheckCond)
+	add("Hash Cond", n.HashCond)
+	add("Merge Cond", n.MergeCond)
+	add("Join Filter", n.JoinFilter)
+	add("Filter", n.Filter)
+	add("Sort Key", strings.Join(n.SortKey, ", "))
+	add("Group Key", strings.Join(n.GroupKey, ", "))
+	if n.SortMethod != "" && n.SortSpaceType != "" {
+		add("Sort Method", n.SortMethod+" ("+strings.ToLower(n.SortSpaceType)+")")
+	} else {
+		add("Sort Method", n.SortMethod)
+	}
+	if n.SharedHitBlocks+n.SharedReadBlocks > 0 {
+		add("Buffers", fmt.Sprintf("shared hit=%d read=%d", n.SharedHitBlocks, n.SharedReadBlocks))
+	}
+	if n.TempReadBlocks+n.TempWrittenBlocks > 0 {
+		add("Temp Buffers", fmt.Sprintf("read=%d written=%d", n.TempReadBlocks, n.TempWrittenBlocks))
+	}
+	return conditions
+}
+
+// loops returns how many times the node ran, 1 when unknown
+func (n *Node) loops() float64 {
+	if n.ActualLoops == nil || *n.ActualLoops < 1 {
+		return 1
+	}
+	return *n.ActualLoops
+}
+
+// actualTime returns the total time spent in the node and its children over all loops
+func (n *Node) actualTime() float64 {
+	if n.ActualTotalTime == nil {
+		return 0
+	}
+	return *n.ActualTotalTime * n.loops()
+}
+
+// SelfCost is the node's estimated cost excluding its children
+func (n *Node) SelfCost() float64 {
+	cost := n.TotalCost
+	for _, child := range n.Plans {
+		cost -= child.TotalCost
+	}
+	return max(cost, 0)
+}
+
+// SelfTime is the actual time spent in the node excluding its children, in milliseconds
+func (n *Node) SelfTime() float64 {
+	t := n.actualTime()
+	for _, child := range n.Plans {
+		t -= child.actualTime()
+	}
+	return max(t, 0)
+}
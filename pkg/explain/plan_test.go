@@ -0,0 +1,255 @@
+package explain
+
+import (
+	"strings"
+	"testing"
+)
+
+const joinPlanJSON = `[
+  {
+    "Plan": {
+      "Node Type": "Hash Join",
+      "Join Type": "Left",
+      "Startup Cost": 12.50,
+      "Total Cost": 2480.00,
+      "Plan Rows": 50000,
+      "Plan Width": 40,
+      "Hash Cond": "(o.user_id = u.id)",
+      "Plans": [
+        {
+          "Node Type": "Seq Scan",
+          "Relation Name": "orders",
+          "Alias": "o",
+          "Startup Cost": 0.00,
+          "Total Cost": 2000.00,
+          "Plan Rows": 50000,
+          "Plan Width": 16,
+          "Filter": "(status = 'shipped'::text)"
+        },
+        {
+          "Node Type": "Hash",
+          "Startup Cost": 10.00,
+          "Total Cost": 10.00,
+          "Plan Rows": 200,
+          "Plan Width": 28,
+          "Plans": [
+            {
+              "Node Type": "Index Scan",
+              "Index Name": "users_pkey",
+              "Relation Name": "users",
+              "Alias": "u",
+              "Startup Cost": 0.00,
+              "Total Cost": 10.00,
+              "Plan Rows": 200,
+              "Plan Width": 28,
+              "Index Cond": "(id < 200)"
+            }
+          ]
+        }
+      ]
+    }
+  }
+]`
+
+const analyzedPlanJSON = `[
+  {
+    "Plan": {
+      "Node Type": "Aggregate",
+      "Strategy": "Hashed",
+      "Startup Cost": 30.00,
+      "Total Cost": 32.00,
+      "Plan Rows": 5,
+      "Plan Width": 12,
+      "Actual Startup Time": 4.0,
+      "Actual Total Time": 5.0,
+      "Actual Rows": 800,
+      "Actual Loops": 1,
+      "Group Key": ["category"],
+      "Plans": [
+        {
+          "Node Type": "Seq Scan",
+          "Relation Name": "products",
+          "Alias": "products",
+          "Startup Cost": 0.00,
+          "Total Cost": 20.00,
+          "Plan Rows": 1000,
+          "Plan Width": 8,
+          "Actual Startup Time": 0.01,
+          "Actual Total Time": 1.0,
+          "Actual Rows": 1000,
+          "Actual Loops": 1
+        }
+      ]
+    },
+    "Planning Time": 0.123,
+    "Execution Time": 5.5
+  }
+]`
+
+func TestParse(t *testing.T) {
+	plan, err := Parse([]byte(joinPlanJSON))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if plan.Analyzed() {
+		t.Error("expected plain EXPLAIN plan not to be analyzed")
+	}
+
+	var labels []string
+	plan.Walk(func(node *Node, depth int) {
+		labels = append(labels, strings.Repeat(">", depth)+node.Label())
+	})
+	expected := []string{
+		"Hash Left Join",
+		">Seq Scan on orders o",
+		">Hash",
+		">>Index Scan using users_pkey on users u",
+	}
+	if strings.Join(labels, "|") != strings.Join(expected, "|") {
+		t.Errorf("unexpected plan tree: %v", labels)
+	}
+
+	if _, err := Parse([]byte(`[]`)); err == nil {
+		t.Error("expected error for empty EXPLAIN output")
+	}
+	if _, err := Parse([]byte(`Seq Scan on orders`)); err == nil {
+		t.Error("expected error for text EXPLAIN output")
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	plan, err := Parse([]byte(joinPlanJSON))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	tableRows := func(relation string) (int64, bool) {
+		rows, ok := map[string]int64{"orders": 2_000_000, "users": 200}[relation]
+		return rows, ok
+	}
+
+	highlights := Analyze(plan, tableRows)
+	var found []string
+	for _, h := range highlights {
+		found = append(found, h.Kind+":"+h.Node.Label()+":"+h.Message)
+	}
+	expected := []string{
+		"expensive:Seq Scan on orders o:81% of the estimated cost",
+		"seq_scan:Seq Scan on orders o:sequential scan on large table orders (~2.0M rows)",
+	}
+	if strings.Join(found, "|") != strings.Join(expected, "|") {
+		t.Errorf("unexpected highlights:\n%s", strings.Join(found, "\n"))
+	}
+
+	// Without table sizes only the cost is considered
+	if highlights := Analyze(plan, nil); len(highlights) != 1 {
+		t.Errorf("expected 1 highlight without table sizes, got %d", len(highlights))
+	}
+}
+
+func TestAnalyze_Misestimate(t *testing.T) {
+	plan, err := Parse([]byte(analyzedPlanJSON))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !plan.Analyzed() {
+		t.Fatal("expected EXPLAIN ANALYZE plan to be analyzed")
+	}
+
+	highlights := Analyze(plan, nil)
+	var misestimates, expensive []Highlight
+	for _, h := range highlights {
+		switch h.Kind {
+		case KindMisestimate:
+			misestimates = append(misestimates, h)
+		case KindExpensive:
+			expensive = append(expensive, h)
+		}
+	}
+	if len(misestimates) != 1 || misestimates[0].Node.Label() != "HashAggregate" {
+		t.Fatalf("expected misestimate on the aggregate, got %+v", misestimates)
+	}
+	if !strings.Contains(misestimates[0].Message, "estimated 5, actual 800") {
+		t.Errorf("unexpected misestimate message: %s", misestimates[0].Message)
+	}
+	if len(expensive) == 0 || expensive[0].Node.Label() != "HashAggregate" || !strings.Contains(expensive[0].Message, "80% of the execution time") {
+		t.Errorf("expected the aggregate to use most of the execution time, got %+v", expensive)
+	}
+}
+
+func TestRender(t *testing.T) {
+	plan, err := Parse([]byte(joinPlanJSON))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	highlights := Analyze(plan, func(relation string) (int64, bool) { return 2_000_000, relation == "orders" })
+
+	rendered := Render(plan, highlights)
+	expectedLines := []string{
+		"Hash Left Join  (cost=12.50..2480.00 rows=50000)",
+		"│  Hash Cond: (o.user_id = u.id)",
+		"├─ Seq Scan on orders o  (cost=0.00..2000.00 rows=50000)  ⚠️",
+		"│     Filter: (status = 'shipped'::text)",
+		"└─ Hash  (cost=10.00..10.00 rows=200)",
+		"   └─ Index Scan using users_pkey on users u  (cost=0.00..10.00 rows=200)",
+		"         Index Cond: (id < 200)",
+		"Highlights:",
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(rendered, line+"\n") {
+			t.Errorf("expected line %q in:\n%s", line, rendered)
+		}
+	}
+
+	summary := Summary(plan, highlights)
+	for _, want := range []string{
+		"#1 Hash Left Join (cost=12.50..2480.00 rows=50000) Hash Cond: (o.user_id = u.id)\n",
+		"  #2 Seq Scan on orders o (cost=0.00..2000.00 rows=50000) Filter: (status = 'shipped'::text)\n",
+		"    #4 Index Scan using users_pkey on users u",
+		"- #2 Seq Scan on orders o: sequential scan on large table orders (~2.0M rows)\n",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("expected %q in summary:\n%s", want, summary)
+		}
+	}
+}
+
+func TestIndexCandidates(t *testing.T) {
+	tests := []struct {
+		filter   string
+		equality []string
+		rng      []string
+	}{
+		{"(status = 'shipped'::text)", []string{"status"}, nil},
+		{"(((status)::text = 'shipped'::text) AND (created_at >= '2024-01-01'::date))", []string{"status"}, []string{"created_at"}},
+		{"((amount > '100'::numeric) AND (deleted_at IS NULL) AND (customer_id = ANY ('{1,2}'::integer[])))", []string{"deleted_at", "customer_id"}, []string{"amount"}},
+		{`("Region" = 'EU'::text)`, []string{"Region"}, nil},
+		{"((status = 'a'::text) OR (status = 'b'::text))", nil, nil},
+		{"(lower(email) = 'x'::text)", nil, nil},
+		{"((note)::text ~~ '%x%'::text)", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			plan := &Plan{Root: &Node{NodeType: "Seq Scan", RelationName: "orders", Filter: tt.filter}}
+			candidates := IndexCandidates(plan)
+			if tt.equality == nil && tt.rng == nil {
+				if len(candidates) != 0 {
+					t.Errorf("expected no candidates, got %+v", candidates)
+				}
+				return
+			}
+			if len(candidates) != 1 {
+				t.Fatalf("expected one candidate, got %+v", candidates)
+			}
+			c := candidates[0]
+			if strings.Join(c.Equality, ",") != strings.Join(tt.equality, ",") || strings.Join(c.Range, ",") != strings.Join(tt.rng, ",") {
+				t.Errorf("expected equality %v and range %v, got %v and %v", tt.equality, tt.rng, c.Equality, c.Range)
+			}
+		})
+	}
+
+	c := IndexCandidate{Equality: []string{"status"}, Range: []string{"created_at", "amount"}}
+	if got := strings.Join(c.Columns(), ","); got != "status,created_at" {
+		t.Errorf("expected equality columns then one range column, got %s", got)
+	}
+}
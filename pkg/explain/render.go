@@ -0,0 +1,97 @@
+package explain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Render draws the plan as an indented tree for the terminal, with cost, estimated rows,
+// actual rows and time when analyzed, and a marker on highlighted nodes followed by a list
+// of the highlights
+func Render(plan *Plan, highlights []Highlight) string {
+	highlighted := make(map[*Node]bool)
+	for _, h := range highlights {
+		highlighted[h.Node] = true
+	}
+
+	var b strings.Builder
+	var render func(node *Node, prefix, childPrefix string)
+	render = func(node *Node, prefix, childPrefix string) {
+		marker := ""
+		if highlighted[node] {
+			marker = "  ⚠️"
+		}
+		fmt.Fprintf(&b, "%s%s  (%s)%s\n", prefix, node.Label(), nodeStats(node), marker)
+
+		detailPrefix := childPrefix + "│  "
+		if len(node.Plans) == 0 {
+			detailPrefix = childPrefix + "   "
+		}
+		for _, condition := range node.Conditions() {
+			fmt.Fprintf(&b, "%s%s\n", detailPrefix, condition)
+		}
+
+		for i, child := range node.Plans {
+			if i == len(node.Plans)-1 {
+				render(child, childPrefix+"└─ ", childPrefix+"   ")
+			} else {
+				render(child, childPrefix+"├─ ", childPrefix+"│  ")
+			}
+		}
+	}
+	render(plan.Root, "", "")
+
+	if plan.Analyzed() {
+		fmt.Fprintf(&b, "\nPlanning time: %.3f ms, execution time: %.3f ms\n", plan.PlanningTime, plan.ExecutionTime)
+	}
+	if len(highlights) > 0 {
+		b.WriteString("\nHighlights:\n")
+		for _, h := range highlights {
+			fmt.Fprintf(&b, "  ⚠️  %s: %s\n", h.Node.Label(), h.Message)
+		}
+	}
+	return b.String()
+}
+
+// Summary describes the plan compactly for the LLM: one line per node, indented by depth,
+// followed by the highlights
+func Summary(plan *Plan, highlights []Highlight) string {
+	ids := make(map[*Node]int)
+	var b strings.Builder
+	plan.Walk(func(node *Node, depth int) {
+		ids[node] = len(ids) + 1
+		fmt.Fprintf(&b, "%s#%d %s (%s)", strings.Repeat("  ", depth), ids[node], node.Label(), nodeStats(node))
+		if conditions := node.Conditions(); len(conditions) > 0 {
+			b.WriteString(" " + strings.Join(conditions, "; "))
+		}
+		if node.RowsRemovedByFilter > 0 {
+			fmt.Fprintf(&b, "; rows removed by filter: %.0f", node.RowsRemovedByFilter)
+		}
+		b.WriteString("\n")
+	})
+
+	if plan.Analyzed() {
+		fmt.Fprintf(&b, "Planning time: %.3f ms, execution time: %.3f ms\n", plan.PlanningTime, plan.ExecutionTime)
+	}
+	if len(highlights) > 0 {
+		b.WriteString("Highlights:\n")
+		for _, h := range highlights {
+			fmt.Fprintf(&b, "- #%d %s: %s\n", ids[h.Node], h.Node.Label(), h.Message)
+		}
+	} else {
+		b.WriteString("Highlights: none\n")
+	}
+	return b.String()
+}
+
+// nodeStats formats the cost and row estimates, and the actual rows and time when analyzed
+func nodeStats(node *Node) string {
+	stats := fmt.Sprintf("cost=%.2f..%.2f rows=%.0f", node.StartupCost, node.TotalCost, node.PlanRows)
+	if node.ActualRows != nil && node.ActualTotalTime != nil {
+		stats += fmt.Sprintf(" actual rows=%.0f time=%.3f ms", *node.ActualRows, *node.ActualTotalTime)
+		if loops := node.loops(); loops > 1 {
+			stats += fmt.Sprintf(" loops=%.0f", loops)
+		}
+	}
+	return stats
+}
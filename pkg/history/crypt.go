@@ -0,0 +1,127 @@
+package history
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// headerFormat identifies the first line of an encrypted history file
+const headerFormat = "pgbabble-history-encrypted-v1"
+
+// kdfIterations is the PBKDF2 iteration count for new encrypted histories
+var kdfIterations = 600_000
+
+// header is the first line of an encrypted history. It holds what is needed to derive
+// the key from the passphrase and a check value to detect a wrong passphrase.
+type header struct {
+	Format     string `json:"format"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Check      []byte `json:"check"` // headerFormat sealed with the derived key
+}
+
+// lineCipher encrypts history lines with AES-256-GCM. Each line is the base64 encoding
+// of a random nonce followed by the sealed entry. The entry's id is bound as associated
+// data, so a line that is moved, copied or dropped no longer decrypts in its place.
+type lineCipher struct {
+	aead cipher.AEAD
+}
+
+// newCipher derives a key from the passphrase with a new random salt and returns
+// the header line to write at the start of the file
+func newCipher(passphrase string) ([]byte, *lineCipher, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, err
+	}
+	c, err := deriveCipher(passphrase, salt, kdfIterations)
+	if err != nil {
+		return nil, nil, err
+	}
+	check, err := c.seal([]byte(headerFormat), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	line, err := json.Marshal(header{Format: headerFormat, KDF: "pbkdf2-sha256", Iterations: kdfIterations, Salt: salt, Check: check})
+	if err != nil {
+		return nil, nil, err
+	}
+	return line, c, nil
+}
+
+// cipherFromHeader derives the key for an existing encrypted history and checks the passphrase
+func cipherFromHeader(line []byte, passphrase string) (*lineCipher, error) {
+	var h header
+	if err := json.Unmarshal(line, &h); err != nil {
+		return nil, fmt.Errorf("invalid history header: %w", err)
+	}
+	if h.KDF != "pbkdf2-sha256" || h.Iterations < 1 {
+		return nil, fmt.Errorf("unsupported history encryption: %s with %d iterations", h.KDF, h.Iterations)
+	}
+	c, err := deriveCipher(passphrase, h.Salt, h.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if check, err := c.open(h.Check, nil); err != nil || string(check) != headerFormat {
+		return nil, fmt.Errorf("wrong passphrase for the encrypted history (check %s)", KeyEnv)
+	}
+	return c, nil
+}
+
+// deriveCipher derives an AES-256 key from the passphrase
+func deriveCipher(passphrase string, salt []byte, iterations int) (*lineCipher, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive history key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &lineCipher{aead: aead}, nil
+}
+
+// entryData returns the associated data that binds a line to the id of its entry
+func entryData(id int) []byte {
+	return []byte("entry " + strconv.Itoa(id))
+}
+
+// seal encrypts a line, authenticating it together with data
+func (c *lineCipher) seal(plaintext, data []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := c.aead.Seal(nonce, nonce, plaintext, data)
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(sealed)))
+	base64.StdEncoding.Encode(encoded, sealed)
+	return encoded, nil
+}
+
+// open decrypts a line written by seal with the same data
+func (c *lineCipher) open(line, data []byte) ([]byte, error) {
+	sealed := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(sealed, line)
+	if err != nil {
+		return nil, err
+	}
+	sealed = sealed[:n]
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, errors.New("entry too short")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	return c.aead.Open(nil, nonce, ciphertext, data)
+}
@@ -0,0 +1,313 @@
+// Package history keeps a local, structured record of every query pgbabble executes or
+// the user rejects, so past queries can be listed, searched and replayed without the LLM.
+// The history is a JSON lines file that can optionally be encrypted at rest.
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	pkgerrors "github.com/AliciaSchep/pgbabble/pkg/errors"
+)
+
+// Outcomes of a proposed query
+const (
+	OutcomeExecuted = "executed"
+	OutcomeFailed   = "failed"
+	OutcomeRejected = "rejected" // the user did not approve the query
+	OutcomeBlocked  = "blocked"  // the estimated cost exceeded the hard cap
+)
+
+// KeyEnv is the environment variable holding the passphrase for an encrypted history
+const KeyEnv = "PGBABBLE_HISTORY_KEY"
+
+// Entry is one query in the history
+type Entry struct {
+	ID       int           `json:"id"`
+	Time     time.Time     `json:"time"`
+	Database string        `json:"database,omitempty"`
+	Question string        `json:"question,omitempty"` // natural-language question the query answers
+	SQL      string        `json:"sql"`
+	Params   []string      `json:"params,omitempty"` // values of the $1, $2, ... parameters
+	Outcome  string        `json:"outcome"`
+	Rows     *int          `json:"rows,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	ReplayOf int           `json:"replay_of,omitempty"` // id of the entry re-run with /replay
+}
+
+// Log appends entries to a history file and keeps them in memory for listing and search.
+// Several sessions may share a file: each append takes a lock on it and first reads the
+// entries other sessions added, so ids stay unique.
+// A nil *Log records nothing, so callers do not need to check whether history is enabled.
+type Log struct {
+	mu       sync.Mutex
+	file     *os.File
+	read     int64       // bytes of the file loaded into entries
+	cipher   *lineCipher // nil when the history is not encrypted
+	database string
+	entries  []Entry
+	nextID   int
+
+	// context for the next entries
+	question string
+	replayOf int
+}
+
+// DefaultPath returns the history file location used when none is configured
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".pgbabble_query_history")
+}
+
+// Open loads the history file, creating it if needed, for recording queries against database.
+// With a passphrase the file is encrypted; an existing file must have been written with the
+// same setting.
+func Open(path, database, passphrase string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	l := &Log{file: file, database: database, nextID: 1}
+	if err := l.withLock(func() error { return l.load(path, passphrase) }); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// load reads the whole file, checking that its encryption matches the passphrase, and
+// writes the encryption header to a new encrypted history
+func (l *Log) load(path, passphrase string) error {
+	data, err := l.readNew()
+	if err != nil {
+		return err
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	encrypted := len(data) > 0 && isHeader(lines[0])
+	switch {
+	case encrypted && passphrase == "":
+		return fmt.Errorf("history file %s is encrypted; set %s to its passphrase", path, KeyEnv)
+	case !encrypted && len(bytes.TrimSpace(data)) > 0 && passphrase != "":
+		return fmt.Errorf("history file %s is not encrypted; use a different history file for an encrypted history", path)
+	case encrypted:
+		if l.cipher, err = cipherFromHeader(lines[0], passphrase); err != nil {
+			return err
+		}
+		lines = lines[1:]
+	}
+	if err := l.addLines(lines); err != nil {
+		return err
+	}
+
+	if passphrase != "" && !encrypted {
+		header, c, err := newCipher(passphrase)
+		if err == nil {
+			err = l.write(header)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to initialize encrypted history: %w", err)
+		}
+		l.cipher = c
+	}
+	return nil
+}
+
+// withLock runs fn holding the lock on the history file
+func (l *Log) withLock(fn func() error) error {
+	if err := lockFile(l.file); err != nil {
+		return fmt.Errorf("failed to lock history: %w", err)
+	}
+	defer unlockFile(l.file)
+	return fn()
+}
+
+// readNew returns what was appended to the file since it was last read
+func (l *Log) readNew() ([]byte, error) {
+	info, err := l.file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	data := make([]byte, info.Size()-l.read)
+	if _, err := l.file.ReadAt(data, l.read); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	l.read += int64(len(data))
+	return data, nil
+}
+
+// addLines decodes entry lines and adds them to the entries
+func (l *Log) addLines(lines [][]byte) error {
+	for _, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		n := len(l.entries) + 1
+		if l.cipher != nil {
+			var err error
+			if line, err = l.cipher.open(line, entryData(l.nextID)); err != nil {
+				return fmt.Errorf("failed to decrypt history entry %d: %w", n, err)
+			}
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("invalid history entry %d: %w", n, err)
+		}
+		if l.cipher != nil && entry.ID != l.nextID {
+			return fmt.Errorf("history entry %d has id %d, expected %d", n, entry.ID, l.nextID)
+		}
+		l.entries = append(l.entries, entry)
+		l.nextID = max(l.nextID, entry.ID+1)
+	}
+	return nil
+}
+
+// write appends a line to the file
+func (l *Log) write(line []byte) error {
+	n, err := l.file.Write(append(line, '\n'))
+	l.read += int64(n)
+	return err
+}
+
+// StartQuestion sets the natural-language question that the following entries answer
+func (l *Log) StartQuestion(question string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.question, l.replayOf = question, 0
+}
+
+// StartReplay marks the following entries as a re-run of the entry with the given id
+func (l *Log) StartReplay(id int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.question, l.replayOf = "", id
+}
+
+// Add appends an entry, filling in the id, time, database and the current question or replay
+func (l *Log) Add(entry Entry) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.withLock(func() error {
+		// Other sessions may have added entries since this one last wrote
+		data, err := l.readNew()
+		if err != nil {
+			return err
+		}
+		if err := l.addLines(bytes.Split(data, []byte("\n"))); err != nil {
+			return err
+		}
+
+		entry.ID = l.nextID
+		entry.Time = time.Now().UTC()
+		entry.Database = l.database
+		entry.Question = l.question
+		entry.ReplayOf = l.replayOf
+
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode history entry: %w", err)
+		}
+		if l.cipher != nil {
+			if line, err = l.cipher.seal(line, entryData(entry.ID)); err != nil {
+				return fmt.Errorf("failed to encrypt history entry: %w", err)
+			}
+		}
+		if err := l.write(line); err != nil {
+			return fmt.Errorf("failed to write history: %w", err)
+		}
+		l.nextID++
+		l.entries = append(l.entries, entry)
+		return nil
+	})
+}
+
+// Record adds an entry and reports a failure to the user on stderr instead of returning it,
+// so history problems are visible without interrupting the session
+func (l *Log) Record(entry Entry) {
+	if err := l.Add(entry); err != nil {
+		pkgerrors.To(os.Stderr).UserError("query history: %v", err)
+	}
+}
+
+// Get returns the entry with the given id
+func (l *Log) Get(id int) (Entry, bool) {
+	if l == nil {
+		return Entry{}, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, entry := range l.entries {
+		if entry.ID == id {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Recent returns up to n of the most recent entries, oldest first
+func (l *Log) Recent(n int) []Entry {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	start := max(len(l.entries)-n, 0)
+	return append([]Entry(nil), l.entries[start:]...)
+}
+
+// Search returns the entries whose question or SQL contains text, ignoring case, oldest first
+func (l *Log) Search(text string) []Entry {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	text = strings.ToLower(text)
+	var matched []Entry
+	for _, entry := range l.entries {
+		if strings.Contains(strings.ToLower(entry.Question), text) || strings.Contains(strings.ToLower(entry.SQL), text) {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
+
+// Close closes the history file
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// isHeader reports whether the first line of a history file is an encryption header
+func isHeader(line []byte) bool {
+	var h header
+	return json.Unmarshal(line, &h) == nil && h.Format == headerFormat
+}
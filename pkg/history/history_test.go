@@ -0,0 +1,173 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLog_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	l, err := Open(path, "shop", "")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	rows := 3
+	l.StartQuestion("How many customers are there?")
+	l.Record(Entry{SQL: "SELECT count(*) FROM customers", Outcome: OutcomeExecuted, Rows: &rows, Duration: 12 * time.Millisecond})
+	l.Record(Entry{SQL: "SELECT * FROM customers", Outcome: OutcomeRejected})
+	l.StartReplay(1)
+	l.Record(Entry{SQL: "SELECT count(*) FROM customers", Outcome: OutcomeFailed, Error: "connection reset"})
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Reopening continues the numbering and keeps all fields
+	l, err = Open(path, "shop", "")
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer l.Close()
+	l.Record(Entry{SQL: "SELECT 1", Outcome: OutcomeExecuted})
+
+	entries := l.Recent(10)
+	if len(entries) != 4 || entries[3].ID != 4 {
+		t.Fatalf("expected 4 entries numbered in order, got %+v", entries)
+	}
+	first := entries[0]
+	if first.Question != "How many customers are there?" || first.Database != "shop" || *first.Rows != 3 || first.Duration != 12*time.Millisecond {
+		t.Errorf("unexpected first entry: %+v", first)
+	}
+	if entries[2].ReplayOf != 1 || entries[2].Question != "" {
+		t.Errorf("expected replay entry, got %+v", entries[2])
+	}
+	if recent := l.Recent(2); len(recent) != 2 || recent[0].ID != 3 {
+		t.Errorf("expected the 2 most recent entries, got %+v", recent)
+	}
+
+	matched := l.Search("CUSTOMERS are")
+	if len(matched) != 2 {
+		t.Errorf("expected search to match the question of 2 entries, got %+v", matched)
+	}
+	if _, ok := l.Get(2); !ok {
+		t.Error("expected entry #2")
+	}
+
+	var none *Log
+	none.StartQuestion("q")
+	none.Record(Entry{SQL: "SELECT 1"})
+	if none.Recent(5) != nil {
+		t.Error("expected a nil log to record nothing")
+	}
+}
+
+func TestLog_Encrypted(t *testing.T) {
+	kdfIterations = 1000
+	path := filepath.Join(t.TempDir(), "history")
+
+	l, err := Open(path, "shop", "secret")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	l.StartQuestion("Who ordered the most?")
+	l.Record(Entry{SQL: "SELECT name FROM customers WHERE email = 'alice@example.com'", Outcome: OutcomeExecuted})
+	l.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if strings.Contains(string(data), "alice@example.com") || strings.Contains(string(data), "ordered") {
+		t.Errorf("expected the history to be encrypted at rest:\n%s", data)
+	}
+
+	if _, err := Open(path, "shop", ""); err == nil || !strings.Contains(err.Error(), KeyEnv) {
+		t.Errorf("expected an error naming %s without a passphrase, got %v", KeyEnv, err)
+	}
+	if _, err := Open(path, "shop", "wrong"); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("expected wrong passphrase error, got %v", err)
+	}
+
+	l, err = Open(path, "shop", "secret")
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer l.Close()
+	entries := l.Recent(10)
+	if len(entries) != 1 || entries[0].Question != "Who ordered the most?" {
+		t.Errorf("expected the decrypted entry, got %+v", entries)
+	}
+
+	// A plain history cannot be switched to encryption in place
+	plain := filepath.Join(t.TempDir(), "plain")
+	pl, err := Open(plain, "shop", "")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	pl.Record(Entry{SQL: "SELECT 1", Outcome: OutcomeExecuted})
+	pl.Close()
+	if _, err := Open(plain, "shop", "secret"); err == nil || !strings.Contains(err.Error(), "not encrypted") {
+		t.Errorf("expected error encrypting an existing plain history, got %v", err)
+	}
+
+	// Lines are bound to their entry's id, so they cannot be reordered
+	l.Record(Entry{SQL: "SELECT 2", Outcome: OutcomeExecuted})
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	lines[1], lines[2] = lines[2], lines[1]
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := Open(path, "shop", "secret"); err == nil || !strings.Contains(err.Error(), "failed to decrypt history entry 1") {
+		t.Errorf("expected reordered entries to fail to decrypt, got %v", err)
+	}
+}
+
+func TestLog_SharedFile(t *testing.T) {
+	kdfIterations = 1000
+	for _, passphrase := range []string{"", "secret"} {
+		path := filepath.Join(t.TempDir(), "history")
+
+		// Two sessions open the same history and record in turn
+		first, err := Open(path, "shop", passphrase)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		second, err := Open(path, "shop", passphrase)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		for _, sql := range []string{"SELECT 1", "SELECT 2"} {
+			if err := first.Add(Entry{SQL: sql, Outcome: OutcomeExecuted}); err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+			if err := second.Add(Entry{SQL: sql, Outcome: OutcomeExecuted}); err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+		}
+		first.Close()
+		second.Close()
+
+		l, err := Open(path, "shop", passphrase)
+		if err != nil {
+			t.Fatalf("reopen failed: %v", err)
+		}
+		entries := l.Recent(10)
+		l.Close()
+		if len(entries) != 4 {
+			t.Fatalf("expected the entries of both sessions, got %+v", entries)
+		}
+		for i, entry := range entries {
+			if entry.ID != i+1 {
+				t.Errorf("expected unique ids in order, got %+v", entries)
+				break
+			}
+		}
+	}
+}
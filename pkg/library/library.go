@@ -0,0 +1,309 @@
+// Package library stores named, parameterized queries in a plain SQL file that can be
+// committed to git and shared. Each query is preceded by comment lines naming it,
+// describing it and listing its parameters in $1, $2, ... order:
+//
+//	-- name: orders_since
+//	-- description: Orders placed since a date in one region
+//	-- params: since, region
+//	SELECT * FROM orders WHERE placed_at >= $1 AND region = $2;
+package library
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SavedQuery is a named query in the library
+type SavedQuery struct {
+	Name        string
+	Description string
+	Params      []string // parameter names; the first is bound to $1, the second to $2, ...
+	SQL         string
+}
+
+// Library is a set of saved queries backed by a file
+type Library struct {
+	path     string
+	preamble string // comment lines before the first query, kept when the file is rewritten
+	queries  []SavedQuery
+}
+
+// Header comment prefixes
+const (
+	namePrefix        = "-- name:"
+	descriptionPrefix = "-- description:"
+	paramsPrefix      = "-- params:"
+)
+
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// ValidateName checks that a query or parameter name is a simple identifier
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid name %q: use letters, digits, underscores and dashes, starting with a letter or underscore", name)
+	}
+	return nil
+}
+
+// DefaultPath returns the library location used when none is configured
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pgbabble", "queries.sql")
+}
+
+// Load reads a library file. A missing file is an empty library.
+func Load(path string) (*Library, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Library{path: path}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read query library: %w", err)
+	}
+	l, err := Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid query library %s: %w", path, err)
+	}
+	l.path = path
+	return l, nil
+}
+
+// Parse parses the contents of a library file
+func Parse(content string) (*Library, error) {
+	l := &Library{}
+	var preamble []string
+	var current *SavedQuery
+	var sqlLines []string
+	seen := make(map[string]bool)
+
+	finish := func() error {
+		if current == nil {
+			return nil
+		}
+		current.SQL = cleanSQL(strings.Join(sqlLines, "\n"))
+		if current.SQL == "" {
+			return fmt.Errorf("query %s has no SQL", current.Name)
+		}
+		l.queries = append(l.queries, *current)
+		return nil
+	}
+
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, namePrefix):
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			name := strings.TrimSpace(strings.TrimPrefix(trimmed, namePrefix))
+			if err := ValidateName(name); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("line %d: duplicate query name %s", i+1, name)
+			}
+			seen[name] = true
+			current, sqlLines = &SavedQuery{Name: name}, nil
+
+		case current != nil && len(sqlLines) == 0 && strings.HasPrefix(trimmed, descriptionPrefix):
+			current.Description = strings.TrimSpace(strings.TrimPrefix(trimmed, descriptionPrefix))
+
+		case current != nil && len(sqlLines) == 0 && strings.HasPrefix(trimmed, paramsPrefix):
+			for _, param := range strings.Split(strings.TrimPrefix(trimmed, paramsPrefix), ",") {
+				param = strings.TrimSpace(param)
+				if param == "" {
+					continue
+				}
+				if err := ValidateName(param); err != nil {
+					return nil, fmt.Errorf("line %d: %w", i+1, err)
+				}
+				current.Params = append(current.Params, param)
+			}
+
+		case current == nil:
+			preamble = append(preamble, line)
+
+		default:
+			sqlLines = append(sqlLines, line)
+		}
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	l.preamble = strings.TrimSpace(strings.Join(preamble, "\n"))
+	return l, nil
+}
+
+// cleanSQL trims blank lines and a trailing semicolon
+func cleanSQL(sql string) string {
+	sql = strings.TrimSpace(sql)
+	return strings.TrimSpace(strings.TrimSuffix(sql, ";"))
+}
+
+// Path returns the library file
+func (l *Library) Path() string {
+	return l.path
+}
+
+// Get returns the query with the given name
+func (l *Library) Get(name string) (SavedQuery, bool) {
+	for _, q := range l.queries {
+		if q.Name == name {
+			return q, true
+		}
+	}
+	return SavedQuery{}, false
+}
+
+// List returns the queries sorted by name
+func (l *Library) List() []SavedQuery {
+	queries := append([]SavedQuery(nil), l.queries...)
+	sort.Slice(queries, func(i, j int) bool {
+		return queries[i].Name < queries[j].Name
+	})
+	return queries
+}
+
+// Save adds a query, replacing one with the same name, and writes the library file
+func (l *Library) Save(q SavedQuery) error {
+	if err := ValidateName(q.Name); err != nil {
+		return err
+	}
+	for _, param := range q.Params {
+		if err := ValidateName(param); err != nil {
+			return err
+		}
+	}
+	q.SQL = cleanSQL(q.SQL)
+	if q.SQL == "" {
+		return fmt.Errorf("query %s has no SQL", q.Name)
+	}
+	q.Description = strings.Join(strings.Fields(q.Description), " ")
+
+	queries := append([]SavedQuery(nil), l.queries...)
+	replaced := false
+	for i := range queries {
+		if queries[i].Name == q.Name {
+			queries[i], replaced = q, true
+		}
+	}
+	if !replaced {
+		queries = append(queries, q)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create query library directory: %w", err)
+	}
+	content := format(l.preamble, queries)
+	if err := os.WriteFile(l.path, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("failed to write query library: %w", err)
+	}
+	l.queries = queries
+	return nil
+}
+
+// format writes the library file contents
+func format(preamble string, queries []SavedQuery) string {
+	var b strings.Builder
+	if preamble != "" {
+		b.WriteString(preamble + "\n\n")
+	}
+	for i, q := range queries {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s %s\n", namePrefix, q.Name)
+		if q.Description != "" {
+			fmt.Fprintf(&b, "%s %s\n", descriptionPrefix, q.Description)
+		}
+		if len(q.Params) > 0 {
+			fmt.Fprintf(&b, "%s %s\n", paramsPrefix, strings.Join(q.Params, ", "))
+		}
+		b.WriteString(q.SQL + ";\n")
+	}
+	return b.String()
+}
+
+// Bind returns the parameter values in $1, $2, ... order. Every parameter needs a value
+// and every value must belong to a parameter.
+func (q SavedQuery) Bind(values map[string]string) ([]string, error) {
+	known := make(map[string]bool, len(q.Params))
+	var missing []string
+	params := make([]string, len(q.Params))
+	for i, name := range q.Params {
+		known[name] = true
+		value, ok := values[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		params[i] = value
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing value for %s (usage: /run %s %s)", strings.Join(missing, ", "), q.Name, q.usage())
+	}
+	for name := range values {
+		if !known[name] {
+			return nil, fmt.Errorf("query %s has no parameter %s (usage: /run %s %s)", q.Name, name, q.Name, q.usage())
+		}
+	}
+	return params, nil
+}
+
+// usage lists the query's parameters as key=value placeholders
+func (q SavedQuery) usage() string {
+	var parts []string
+	for _, name := range q.Params {
+		parts = append(parts, name+"=<value>")
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseAssignments parses key=value arguments separated by spaces. Values containing
+// spaces can be double-quoted, e.g. region="North America".
+func ParseAssignments(input string) (map[string]string, error) {
+	values := make(map[string]string)
+	var tokens []string
+	var current strings.Builder
+	inQuotes, inToken := false, false
+	for _, r := range input {
+		switch {
+		case r == '"':
+			inQuotes, inToken = !inQuotes, true
+		case (r == ' ' || r == '\t') && !inQuotes:
+			if inToken {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				inToken = false
+			}
+		default:
+			current.WriteRune(r)
+			inToken = true
+		}
+	}
+	if inQuotes {
+		return nil, errors.New("unterminated quote")
+	}
+	if inToken {
+		tokens = append(tokens, current.String())
+	}
+
+	for _, token := range tokens {
+		key, value, ok := strings.Cut(token, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid argument %q: expected key=value", token)
+		}
+		if _, dup := values[key]; dup {
+			return nil, fmt.Errorf("duplicate argument %s", key)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
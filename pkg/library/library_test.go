@@ -0,0 +1,126 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sampleLibrary = `-- Shared queries for the analytics team
+
+-- name: orders_since
+-- description: Orders placed since a date in one region
+-- params: since, region
+SELECT *
+FROM orders
+-- only shipped orders count
+WHERE placed_at >= $1 AND region = $2 AND status = 'shipped';
+
+-- name: customer_count
+SELECT count(*) FROM customers
+`
+
+func TestParse(t *testing.T) {
+	l, err := Parse(sampleLibrary)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	queries := l.List()
+	if len(queries) != 2 || queries[0].Name != "customer_count" || queries[1].Name != "orders_since" {
+		t.Fatalf("expected 2 queries sorted by name, got %+v", queries)
+	}
+	q, _ := l.Get("orders_since")
+	if q.Description != "Orders placed since a date in one region" || strings.Join(q.Params, ",") != "since,region" {
+		t.Errorf("unexpected header fields: %+v", q)
+	}
+	if !strings.HasPrefix(q.SQL, "SELECT *\nFROM orders\n-- only shipped") || strings.HasSuffix(q.SQL, ";") {
+		t.Errorf("unexpected SQL: %q", q.SQL)
+	}
+
+	for _, invalid := range []string{
+		"-- name: bad name\nSELECT 1",
+		"-- name: a\nSELECT 1\n-- name: a\nSELECT 2",
+		"-- name: empty\n",
+		"-- name: a\n-- params: 1st\nSELECT $1",
+	} {
+		if _, err := Parse(invalid); err == nil {
+			t.Errorf("expected error parsing %q", invalid)
+		}
+	}
+}
+
+func TestLibrary_Save(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "team", "queries.sql")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(sampleLibrary), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := l.Save(SavedQuery{Name: "customer_count", Description: "How many\ncustomers", SQL: "SELECT count(*) FROM customers WHERE active;"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := l.Save(SavedQuery{Name: "top_parts", SQL: "SELECT * FROM parts LIMIT $1", Params: []string{"n"}}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if len(reloaded.List()) != 3 {
+		t.Errorf("expected 3 queries, got %+v", reloaded.List())
+	}
+	q, _ := reloaded.Get("customer_count")
+	if q.SQL != "SELECT count(*) FROM customers WHERE active" || q.Description != "How many customers" {
+		t.Errorf("expected the query to be replaced, got %+v", q)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "-- Shared queries for the analytics team\n\n-- name: orders_since\n") {
+		t.Errorf("expected preamble and order to be kept:\n%s", data)
+	}
+
+	empty, err := Load(filepath.Join(t.TempDir(), "missing.sql"))
+	if err != nil || len(empty.List()) != 0 {
+		t.Errorf("expected a missing file to be an empty library, got %v", err)
+	}
+}
+
+func TestBindAndParseAssignments(t *testing.T) {
+	q := SavedQuery{Name: "orders_since", Params: []string{"since", "region"}}
+
+	values, err := ParseAssignments(`region="North America" since=2024-01-01`)
+	if err != nil {
+		t.Fatalf("ParseAssignments failed: %v", err)
+	}
+	params, err := q.Bind(values)
+	if err != nil {
+		t.Fatalf("Bind failed: %v", err)
+	}
+	if strings.Join(params, "|") != "2024-01-01|North America" {
+		t.Errorf("expected values in parameter order, got %v", params)
+	}
+
+	if _, err := q.Bind(map[string]string{"since": "x"}); err == nil || !strings.Contains(err.Error(), "missing value for region") {
+		t.Errorf("expected missing value error, got %v", err)
+	}
+	if _, err := q.Bind(map[string]string{"since": "x", "region": "y", "limit": "5"}); err == nil || !strings.Contains(err.Error(), "no parameter limit") {
+		t.Errorf("expected unknown parameter error, got %v", err)
+	}
+
+	for _, invalid := range []string{`region="open`, "since", "=x", "a=1 a=2"} {
+		if _, err := ParseAssignments(invalid); err == nil {
+			t.Errorf("expected error parsing %q", invalid)
+		}
+	}
+	if values, err := ParseAssignments(`note=""`); err != nil || values["note"] != "" {
+		t.Errorf("expected an empty quoted value, got %v, %v", values, err)
+	}
+}
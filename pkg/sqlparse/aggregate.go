@@ -0,0 +1,273 @@
+package sqlparse
+
+import "fmt"
+
+// aggregateFunctions are the standard aggregates that collapse groups of rows
+var aggregateFunctions = map[string]bool{
+	"count": true, "sum": true, "avg": true, "min": true, "max": true,
+	"stddev": true, "stddev_pop": true, "stddev_samp": true, "variance": true,
+	"var_pop": true, "var_samp": true, "bool_and": true, "bool_or": true, "every": true,
+	"percentile_cont": true, "percentile_disc": true, "mode": true, "corr": true,
+	"covar_pop": true, "covar_samp": true, "regr_slope": true, "regr_intercept": true,
+	"array_agg": true, "string_agg": true, "json_agg": true, "jsonb_agg": true,
+	"json_object_agg": true, "jsonb_object_agg": true, "bit_and": true, "bit_or": true,
+}
+
+// collectionAggregates return every value of a group rather than a summary of it
+var collectionAggregates = map[string]bool{
+	"array_agg": true, "string_agg": true, "json_agg": true, "jsonb_agg": true,
+	"json_object_agg": true, "jsonb_object_agg": true, "xmlagg": true,
+	"json_agg_strict": true, "jsonb_agg_strict": true, "json_arrayagg": true, "json_objectagg": true,
+	"json_object_agg_strict": true, "jsonb_object_agg_strict": true,
+	"json_object_agg_unique": true, "jsonb_object_agg_unique": true,
+	"json_object_agg_unique_strict": true, "jsonb_object_agg_unique_strict": true,
+}
+
+// valueAggregates return the value of one row of a group, such as its largest email
+var valueAggregates = map[string]bool{
+	"min": true, "max": true, "mode": true, "percentile_disc": true, "any_value": true,
+}
+
+// setReturningFunctions return several rows per call, repeating the rows they are joined to
+var setReturningFunctions = map[string]bool{
+	"generate_series": true, "generate_subscripts": true, "unnest": true,
+	"regexp_split_to_table": true, "regexp_matches": true, "string_to_table": true,
+	"json_array_elements": true, "jsonb_array_elements": true, "json_array_elements_text": true,
+	"jsonb_array_elements_text": true, "json_each": true, "jsonb_each": true, "json_each_text": true,
+	"jsonb_each_text": true, "json_object_keys": true, "jsonb_object_keys": true,
+	"json_to_recordset": true, "jsonb_to_recordset": true, "json_populate_recordset": true,
+	"jsonb_populate_recordset": true, "jsonb_path_query": true,
+}
+
+// Aggregation describes whether a query returns one row per group rather than per record
+type Aggregation struct {
+	IsAggregate bool
+	Reason      string // why the query is not an aggregate, if it is not
+	CountColumn int    // index of the first output column that is a count(...), -1 if none
+}
+
+// AnalyzeAggregation inspects the outermost SELECT of a statement
+func AnalyzeAggregation(sql string) (*Aggregation, error) {
+	tokens, err := Tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	result := &Aggregation{CountColumn: -1}
+
+	// Collection and value aggregates anywhere, including subqueries feeding the outer
+	// SELECT, would pass individual values through a large enough group
+	for i, tok := range tokens {
+		if tok.Kind != TokenIdent || i+1 >= len(tokens) || !tokens[i+1].IsOp("(") {
+			continue
+		}
+		switch {
+		case collectionAggregates[tok.Value]:
+			result.Reason = fmt.Sprintf("%s returns every value in a group rather than a summary", tok.Value)
+			return result, nil
+		case valueAggregates[tok.Value]:
+			result.Reason = fmt.Sprintf("%s returns the value of a single row rather than a summary", tok.Value)
+			return result, nil
+		}
+	}
+
+	// Counts of repeated rows overstate how many records a group holds
+	if reason := rowMultiplier(tokens); reason != "" {
+		result.Reason = reason
+		return result, nil
+	}
+
+	// Locate the outermost SELECT, its select list and clauses at depth 0
+	depth := 0
+	selectIdx, fromIdx := -1, -1
+	grouped := false
+	for i, tok := range tokens {
+		switch {
+		case tok.IsOp("("):
+			depth++
+		case tok.IsOp(")"):
+			depth--
+		case depth != 0:
+		case tok.IsKeyword("select") && selectIdx == -1:
+			selectIdx = i
+		case selectIdx == -1:
+		case tok.IsKeyword("from") && fromIdx == -1:
+			fromIdx = i
+		case tok.IsKeyword("group") && i+1 < len(tokens) && tokens[i+1].IsKeyword("by"):
+			grouped = true
+		case tok.IsKeyword("union") || tok.IsKeyword("intersect") || tok.IsKeyword("except"):
+			result.Reason = "set operations (UNION/INTERSECT/EXCEPT) are not supported"
+			return result, nil
+		}
+	}
+	if selectIdx == -1 {
+		result.Reason = "no SELECT list found"
+		return result, nil
+	}
+	end := fromIdx
+	if end == -1 {
+		end = len(tokens)
+	}
+
+	// Skip DISTINCT [ON (...)] / ALL
+	start := selectIdx + 1
+	if start < end && (tokens[start].IsKeyword("distinct") || tokens[start].IsKeyword("all")) {
+		start++
+		if start < end && tokens[start].IsKeyword("on") {
+			start++
+			if start < end && tokens[start].IsOp("(") {
+				start = skipParens(tokens, start)
+			}
+		}
+	}
+
+	hasAggregate := false
+	column := 0
+	itemStart := start
+	for i := start; i <= end; i++ {
+		if i < end && !tokens[i].IsOp(",") {
+			if tokens[i].IsOp("(") {
+				i = skipParens(tokens, i) - 1
+			}
+			continue
+		}
+
+		item := tokens[itemStart:i]
+		if isStarItem(item) {
+			// Expanded columns shift the position of the count column
+			result.Reason = "* in the select list expands to columns that cannot be checked; list the grouped columns explicitly"
+			return result, nil
+		}
+		aggregate, window, isCount := classifyItem(item)
+		if window {
+			result.Reason = "window functions return one row per record"
+			return result, nil
+		}
+		if aggregate {
+			hasAggregate = true
+		}
+		if isCount && result.CountColumn == -1 {
+			result.CountColumn = column
+		}
+		column++
+		itemStart = i + 1
+	}
+
+	if !hasAggregate && !grouped {
+		result.Reason = "the query does not aggregate rows (no GROUP BY or aggregate function)"
+		return result, nil
+	}
+	result.IsAggregate = true
+	return result, nil
+}
+
+// classifyItem reports whether a select list item calls an aggregate, uses a window
+// function, and is exactly count(...) [FILTER (...)] [[AS] alias]
+func classifyItem(item []Token) (aggregate, window, isCount bool) {
+	for i := 0; i < len(item); i++ {
+		tok := item[i]
+		if tok.IsOp("(") && i+1 < len(item) && (item[i+1].IsKeyword("select") || item[i+1].IsKeyword("with")) {
+			// Scalar subqueries aggregate their own rows, not the outer query's
+			i = skipParens(item, i) - 1
+			continue
+		}
+		if tok.Kind != TokenIdent || i+1 >= len(item) || !item[i+1].IsOp("(") {
+			continue
+		}
+		if i > 0 && item[i-1].IsOp(".") {
+			// Schema-qualified user function
+			continue
+		}
+		closeIdx := skipParens(item, i+1)
+		after := closeIdx
+		if after < len(item) && item[after].IsKeyword("filter") && after+1 < len(item) && item[after+1].IsOp("(") {
+			after = skipParens(item, after+1)
+		}
+		if after < len(item) && item[after].IsKeyword("over") {
+			return false, true, false
+		}
+		if aggregateFunctions[tok.Value] {
+			aggregate = true
+			if i == 0 && tok.Value == "count" && isAliasTail(item[after:]) {
+				isCount = true
+			}
+		}
+	}
+	return aggregate, false, isCount
+}
+
+// isStarItem reports whether a select list item is * or qualifier.*
+func isStarItem(item []Token) bool {
+	return len(item) > 0 && item[len(item)-1].IsOp("*") && (len(item) == 1 || item[len(item)-2].IsOp("."))
+}
+
+// isAliasTail reports whether tokens are empty or just [AS] alias
+func isAliasTail(tokens []Token) bool {
+	switch len(tokens) {
+	case 0:
+		return true
+	case 1:
+		return tokens[0].IsIdent()
+	case 2:
+		return tokens[0].IsKeyword("as") && tokens[1].IsIdent()
+	}
+	return false
+}
+
+// rowMultiplier describes a construct that repeats rows, so that count(...) no longer
+// counts distinct records, or returns "" if there is none. Joins on conditions that
+// match many rows, such as ON true, are not detected.
+func rowMultiplier(tokens []Token) string {
+	var parens []bool // whether each open parenthesis is a function call
+	for i, tok := range tokens {
+		switch {
+		case tok.IsOp("("):
+			parens = append(parens, i > 0 && isFunctionName(tokens, i-1))
+		case tok.IsOp(")"):
+			if len(parens) > 0 {
+				parens = parens[:len(parens)-1]
+			}
+		case tok.Kind == TokenIdent && setReturningFunctions[tok.Value] && i+1 < len(tokens) && tokens[i+1].IsOp("("):
+			return fmt.Sprintf("%s returns several rows for each row, which inflates counts", tok.Value)
+		case tok.IsKeyword("cross") && i+1 < len(tokens) && tokens[i+1].IsKeyword("join"):
+			return "CROSS JOIN repeats every row for each row of the joined relation, which inflates counts"
+		case tok.IsKeyword("from"):
+			if (len(parens) > 0 && parens[len(parens)-1]) || (i > 0 && tokens[i-1].IsKeyword("distinct")) {
+				continue
+			}
+			if hasCommaJoin(tokens, i+1) {
+				return "a comma-separated FROM list joins every row of one relation with every row of another, which inflates counts"
+			}
+		}
+	}
+	return ""
+}
+
+// hasCommaJoin reports whether the FROM list starting at index i separates items with commas
+func hasCommaJoin(tokens []Token, i int) bool {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case tok.IsOp("("):
+			depth++
+		case tok.IsOp(")"):
+			depth--
+			if depth < 0 {
+				return false
+			}
+		case depth != 0:
+		case tok.IsOp(","):
+			return true
+		case tok.Kind == TokenIdent && fromListEnd[tok.Value]:
+			return false
+		}
+	}
+	return false
+}
+
+// fromListEnd are the clauses that can follow a FROM list
+var fromListEnd = map[string]bool{
+	"where": true, "group": true, "having": true, "window": true, "order": true, "limit": true,
+	"offset": true, "fetch": true, "for": true, "union": true, "intersect": true, "except": true,
+	"returning": true,
+}
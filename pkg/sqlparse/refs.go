@@ -0,0 +1,486 @@
+package sqlparse
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TableRef is a relation referenced in a FROM, JOIN, UPDATE or INTO clause
+type TableRef struct {
+	Schema string // empty when the reference is not schema-qualified
+	Name   string
+	Alias  string // empty when no alias was given
+	Pos    int    // byte offset of the reference in the source
+
+	// ColumnAliases renames the relation's columns by position, as in users u(id, name)
+	ColumnAliases []string
+}
+
+// ColumnRef is an identifier used as a column (or whole-row) reference in an expression
+type ColumnRef struct {
+	Qualifier string // table name or alias before the column, empty if unqualified
+	Name      string
+	Pos       int
+}
+
+// FunctionRef is a function call anywhere in the statement
+type FunctionRef struct {
+	Schema string // empty when the call is not schema-qualified
+	Name   string
+	Pos    int
+}
+
+// StarRef is a * or qualifier.* select list entry
+type StarRef struct {
+	Qualifier string // empty for a bare *
+	Pos       int
+}
+
+// Analysis describes the objects a SQL statement references
+type Analysis struct {
+	Tokens    []Token
+	Tables    []TableRef
+	CTEs      []string // names defined in WITH clauses; references to them are not in Tables
+	Columns   []ColumnRef
+	Stars     []StarRef
+	Functions []FunctionRef
+
+	consumed  map[int]bool // token indices that are part of table references, aliases or CTE names
+	cteScopes []cteScope
+}
+
+// cteScope is the range of tokens in which a name refers to a CTE rather than a relation
+type cteScope struct {
+	name       string
+	start, end int // token indices, end exclusive
+}
+
+// reservedKeywords are never treated as column references
+var reservedKeywords = map[string]bool{
+	"select": true, "from": true, "where": true, "and": true, "or": true, "not": true,
+	"null": true, "true": true, "false": true, "as": true, "on": true, "join": true,
+	"inner": true, "left": true, "right": true, "full": true, "outer": true, "cross": true,
+	"natural": true, "using": true, "group": true, "by": true, "order": true, "having": true,
+	"limit": true, "offset": true, "union": true, "intersect": true, "except": true,
+	"all": true, "distinct": true, "case": true, "when": true, "then": true, "else": true,
+	"end": true, "in": true, "is": true, "like": true, "ilike": true, "between": true,
+	"exists": true, "with": true, "recursive": true, "asc": true, "desc": true, "nulls": true,
+	"first": true, "last": true, "interval": true, "lateral": true, "only": true, "any": true,
+	"some": true, "array": true, "fetch": true, "next": true, "rows": true, "row": true,
+	"window": true, "partition": true, "over": true, "filter": true, "within": true,
+	"current_date": true, "current_time": true, "current_timestamp": true, "localtime": true,
+	"localtimestamp": true, "current_user": true, "session_user": true, "values": true,
+	"default": true, "into": true, "for": true, "update": true, "set": true, "similar": true,
+	"escape": true, "collate": true, "symmetric": true, "materialized": true, "explain": true,
+	"table": true,
+}
+
+// IsReservedKeyword reports whether an unquoted identifier would be read as a keyword
+func IsReservedKeyword(word string) bool {
+	return reservedKeywords[word]
+}
+
+// clauseEndKeywords end a FROM item; an identifier in this set is never an alias
+var clauseEndKeywords = map[string]bool{
+	"where": true, "join": true, "inner": true, "left": true, "right": true, "full": true,
+	"cross": true, "natural": true, "on": true, "using": true, "group": true, "order": true,
+	"limit": true, "offset": true, "having": true, "window": true, "union": true,
+	"intersect": true, "except": true, "fetch": true, "for": true, "returning": true,
+	"set": true, "tablesample": true, "values": true, "select": true, "outer": true,
+	"lateral": true, "with": true, "into": true, "from": true, "as": true, "then": true,
+	"when": true, "else": true, "end": true, "and": true, "or": true, "not": true,
+}
+
+// Analyze tokenizes a statement and extracts the relations it references
+func Analyze(sql string) (*Analysis, error) {
+	tokens, err := Tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Analysis{Tokens: tokens, consumed: make(map[int]bool)}
+	if err := a.collectCTEs(); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, scope := range a.cteScopes {
+		if !names[scope.name] {
+			names[scope.name] = true
+			a.CTEs = append(a.CTEs, scope.name)
+		}
+	}
+	sort.Strings(a.CTEs)
+
+	// Track whether each open parenthesis is a function call, where FROM is an
+	// argument keyword (EXTRACT(... FROM ...), SUBSTRING(... FROM ...)) rather than a clause
+	var parens []bool
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case tok.IsOp("("):
+			parens = append(parens, i > 0 && isFunctionName(tokens, i-1))
+		case tok.IsOp(")"):
+			if len(parens) > 0 {
+				parens = parens[:len(parens)-1]
+			}
+		case tok.IsKeyword("from"):
+			if len(parens) > 0 && parens[len(parens)-1] {
+				continue
+			}
+			// IS [NOT] DISTINCT FROM
+			if i > 0 && tokens[i-1].IsKeyword("distinct") {
+				continue
+			}
+			j := i + 1
+			for {
+				if j, err = a.parseFromItem(tokens, j, true); err != nil {
+					return nil, err
+				}
+				if j < len(tokens) && tokens[j].IsOp(",") {
+					j++
+					continue
+				}
+				break
+			}
+			if !endsFromItem(tokens, j) {
+				// Anything else could hide further relations from the checks
+				return nil, fmt.Errorf("could not read the FROM clause at position %d (%q)", tokens[j].Pos, tokens[j].Value)
+			}
+		case tok.IsKeyword("update"):
+			// FOR [NO KEY] UPDATE is a locking clause, not a target table
+			if i > 0 && (tokens[i-1].IsKeyword("for") || tokens[i-1].IsKeyword("key")) {
+				continue
+			}
+			if _, err := a.parseFromItem(tokens, i+1, false); err != nil {
+				return nil, err
+			}
+		case tok.IsKeyword("join"), tok.IsKeyword("into"):
+			if _, err := a.parseFromItem(tokens, i+1, tok.IsKeyword("join")); err != nil {
+				return nil, err
+			}
+		case tok.IsKeyword("table"):
+			// TABLE name is shorthand for SELECT * FROM name
+			if _, err := a.parseFromItem(tokens, i+1, true); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	a.collectColumns()
+	return a, nil
+}
+
+// collectColumns records identifiers used in expressions and * select list entries
+func (a *Analysis) collectColumns() {
+	tokens := a.Tokens
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+
+		if tok.IsOp("*") && i > 0 {
+			prev := tokens[i-1]
+			if prev.IsKeyword("select") || prev.IsKeyword("distinct") || prev.IsKeyword("all") || prev.IsOp(",") {
+				a.Stars = append(a.Stars, StarRef{Pos: tok.Pos})
+			}
+			continue
+		}
+
+		if a.consumed[i] || !tok.IsIdent() || (tok.Kind == TokenIdent && reservedKeywords[tok.Value]) {
+			continue
+		}
+		if i > 0 && (tokens[i-1].IsOp("::") || tokens[i-1].IsKeyword("as") || tokens[i-1].IsOp(".")) {
+			// Type names, output aliases and the tail of qualified names handled below
+			continue
+		}
+
+		parts := []string{tok.Value}
+		j := i + 1
+		for j+1 < len(tokens) && tokens[j].IsOp(".") && tokens[j+1].IsIdent() {
+			parts = append(parts, tokens[j+1].Value)
+			j += 2
+		}
+
+		switch {
+		case j+1 < len(tokens) && tokens[j].IsOp(".") && tokens[j+1].IsOp("*"):
+			a.Stars = append(a.Stars, StarRef{Qualifier: parts[len(parts)-1], Pos: tok.Pos})
+		case j < len(tokens) && tokens[j].IsOp("("):
+			fn := FunctionRef{Name: parts[len(parts)-1], Pos: tok.Pos}
+			if len(parts) >= 2 {
+				fn.Schema = parts[len(parts)-2]
+			}
+			a.Functions = append(a.Functions, fn)
+		case len(parts) == 1:
+			a.Columns = append(a.Columns, ColumnRef{Name: parts[0], Pos: tok.Pos})
+		default:
+			a.Columns = append(a.Columns, ColumnRef{Qualifier: parts[len(parts)-2], Name: parts[len(parts)-1], Pos: tok.Pos})
+		}
+		i = j - 1
+	}
+}
+
+// parseFromItem records the relation (if any) starting at index i and returns the index after it.
+// When required is set the item follows FROM or JOIN, and an item that cannot be read is an
+// error so that callers checking the referenced relations fail closed.
+func (a *Analysis) parseFromItem(tokens []Token, i int, required bool) (int, error) {
+	for i < len(tokens) && (tokens[i].IsKeyword("only") || tokens[i].IsKeyword("lateral")) {
+		i++
+	}
+	if i >= len(tokens) {
+		if required {
+			return i, fmt.Errorf("missing relation at end of query")
+		}
+		return i, nil
+	}
+
+	if tokens[i].IsOp("(") {
+		end := skipParens(tokens, i)
+		if isSubqueryStart(tokens, i+1) {
+			// Subquery contents are scanned by the caller
+			return a.skipAlias(tokens, end), nil
+		}
+		// Parenthesized join: only its first item follows no JOIN keyword, so record
+		// it here; the joined items are found by the caller
+		if _, err := a.parseFromItem(tokens, i+1, true); err != nil {
+			return i, err
+		}
+		aliasEnd := a.skipAlias(tokens, end)
+		if len(columnAliases(tokens, end, aliasEnd)) > 0 {
+			return i, fmt.Errorf("column aliases on a parenthesized join at position %d are not supported", tokens[i].Pos)
+		}
+		return aliasEnd, nil
+	}
+
+	if !tokens[i].IsIdent() || (tokens[i].Kind == TokenIdent && clauseEndKeywords[tokens[i].Value]) {
+		if required {
+			return i, fmt.Errorf("could not read the relation at position %d (%q)", tokens[i].Pos, tokens[i].Value)
+		}
+		return i, nil
+	}
+
+	start := i
+	parts := []string{tokens[i].Value}
+	i++
+	for i+1 < len(tokens) && tokens[i].IsOp(".") && tokens[i+1].IsIdent() {
+		parts = append(parts, tokens[i+1].Value)
+		i += 2
+	}
+
+	// Table functions such as generate_series(...) are not relations
+	if i < len(tokens) && tokens[i].IsOp("(") {
+		i = skipParens(tokens, i)
+		if i+1 < len(tokens) && tokens[i].IsKeyword("with") && tokens[i+1].IsKeyword("ordinality") {
+			i += 2
+		}
+		return a.skipAlias(tokens, i), nil
+	}
+
+	ref := TableRef{Name: parts[len(parts)-1], Pos: tokens[start].Pos}
+	if len(parts) >= 2 {
+		ref.Schema = parts[len(parts)-2]
+	}
+
+	aliasStart := i
+	i = skipAlias(tokens, i)
+	for k := start; k < i; k++ {
+		a.consumed[k] = true
+	}
+	if i > aliasStart {
+		for k := aliasStart; k < i; k++ {
+			if tokens[k].IsIdent() && !tokens[k].IsKeyword("as") {
+				ref.Alias = tokens[k].Value
+				break
+			}
+		}
+		ref.ColumnAliases = columnAliases(tokens, aliasStart, i)
+	}
+
+	if ref.Schema == "" && a.isCTE(ref.Name, start) {
+		return i, nil
+	}
+	a.Tables = append(a.Tables, ref)
+	return i, nil
+}
+
+// endsFromItem reports whether the token at index i can follow a FROM item
+func endsFromItem(tokens []Token, i int) bool {
+	if i >= len(tokens) {
+		return true
+	}
+	tok := tokens[i]
+	return tok.IsOp(")") || tok.IsOp(";") || (tok.Kind == TokenIdent && clauseEndKeywords[tok.Value])
+}
+
+// columnAliases returns the names in the column list of the alias between start and end
+func columnAliases(tokens []Token, start, end int) []string {
+	var names []string
+	inList := false
+	for k := start; k < end; k++ {
+		switch {
+		case tokens[k].IsOp("("):
+			inList = true
+		case inList && tokens[k].IsIdent():
+			names = append(names, tokens[k].Value)
+		}
+	}
+	return names
+}
+
+// skipAlias skips and consumes the alias of a subquery or table function
+func (a *Analysis) skipAlias(tokens []Token, i int) int {
+	end := skipAlias(tokens, i)
+	for k := i; k < end; k++ {
+		a.consumed[k] = true
+	}
+	return end
+}
+
+// skipAlias skips an optional [AS] alias [(column, ...)] starting at index i
+func skipAlias(tokens []Token, i int) int {
+	if i < len(tokens) && tokens[i].IsKeyword("as") {
+		i++
+	}
+	if i < len(tokens) && tokens[i].IsIdent() && !(tokens[i].Kind == TokenIdent && clauseEndKeywords[tokens[i].Value]) {
+		i++
+		if i < len(tokens) && tokens[i].IsOp("(") {
+			i = skipParens(tokens, i)
+		}
+	}
+	return i
+}
+
+// isSubqueryStart reports whether the token at index i starts a query rather than a FROM item
+func isSubqueryStart(tokens []Token, i int) bool {
+	if i >= len(tokens) {
+		return false
+	}
+	tok := tokens[i]
+	return tok.IsKeyword("select") || tok.IsKeyword("with") || tok.IsKeyword("values") || tok.IsKeyword("table")
+}
+
+// skipParens returns the index just past the parenthesis matching the one at index i
+func skipParens(tokens []Token, i int) int {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		if tokens[i].IsOp("(") {
+			depth++
+		} else if tokens[i].IsOp(")") {
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
+
+// isFunctionName reports whether the token at index i names a function being called
+func isFunctionName(tokens []Token, i int) bool {
+	tok := tokens[i]
+	if tok.Kind == TokenQuotedIdent {
+		return true
+	}
+	if tok.Kind != TokenIdent {
+		return false
+	}
+	switch tok.Value {
+	case "from", "join", "in", "exists", "any", "all", "some", "as", "select", "where",
+		"and", "or", "not", "on", "using", "values", "lateral", "union", "intersect",
+		"except", "with", "materialized", "then", "else", "when", "case", "over", "filter",
+		"within", "into", "by", "is", "like", "ilike", "between", "recursive":
+		return false
+	}
+	return true
+}
+
+// notQueryWith follow WITH when it is part of a type or clause rather than a WITH query
+var notQueryWith = map[string]bool{
+	"ordinality": true, "time": true, "check": true, "cascaded": true, "local": true,
+	"no": true, "data": true, "grant": true, "admin": true, "hold": true,
+}
+
+// collectCTEs records the names defined by WITH clauses anywhere in the statement with the
+// tokens in which each is visible, marking the name and column list tokens as consumed.
+// A name is visible after its definition up to the end of the query that defines it, and
+// throughout the WITH list of a recursive WITH. A WITH clause that cannot be read is an error.
+func (a *Analysis) collectCTEs() error {
+	tokens := a.Tokens
+	for i := 0; i < len(tokens); i++ {
+		if !tokens[i].IsKeyword("with") {
+			continue
+		}
+		j := i + 1
+		if j < len(tokens) && (tokens[j].IsOp("(") || (tokens[j].Kind == TokenIdent && notQueryWith[tokens[j].Value])) {
+			continue
+		}
+		recursive := j < len(tokens) && tokens[j].IsKeyword("recursive")
+		if recursive {
+			j++
+		}
+		listStart, queryEnd := j, enclosingEnd(tokens, i)
+
+		for {
+			if j >= len(tokens) || !tokens[j].IsIdent() {
+				return fmt.Errorf("could not read the WITH clause at position %d", tokens[i].Pos)
+			}
+			name := tokens[j].Value
+			nameStart := j
+			j++
+			if j < len(tokens) && tokens[j].IsOp("(") {
+				j = skipParens(tokens, j)
+			}
+			for k := nameStart; k < j; k++ {
+				a.consumed[k] = true
+			}
+			if j >= len(tokens) || !tokens[j].IsKeyword("as") {
+				return fmt.Errorf("could not read the WITH clause at position %d", tokens[i].Pos)
+			}
+			j++
+			for j < len(tokens) && (tokens[j].IsKeyword("not") || tokens[j].IsKeyword("materialized")) {
+				j++
+			}
+			if j >= len(tokens) || !tokens[j].IsOp("(") {
+				return fmt.Errorf("could not read the WITH clause at position %d", tokens[i].Pos)
+			}
+			j = skipParens(tokens, j)
+
+			scope := cteScope{name: name, start: j, end: queryEnd}
+			if recursive {
+				scope.start = listStart
+			}
+			a.cteScopes = append(a.cteScopes, scope)
+
+			if j < len(tokens) && tokens[j].IsOp(",") {
+				j++
+				continue
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// isCTE reports whether name refers to a CTE at token index i
+func (a *Analysis) isCTE(name string, i int) bool {
+	for _, scope := range a.cteScopes {
+		if scope.name == name && i >= scope.start && i < scope.end {
+			return true
+		}
+	}
+	return false
+}
+
+// enclosingEnd returns the index of the parenthesis closing the group that contains
+// index i, or the number of tokens when i is not inside parentheses
+func enclosingEnd(tokens []Token, i int) int {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		if tokens[i].IsOp("(") {
+			depth++
+		} else if tokens[i].IsOp(")") {
+			depth--
+			if depth < 0 {
+				return i
+			}
+		}
+	}
+	return i
+}
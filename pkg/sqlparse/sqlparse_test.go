@@ -0,0 +1,274 @@
+package sqlparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens, err := Tokenize(`SELECT "User Name", E'it\'s', $tag$a;b$tag$ FROM Public.Users -- comment
+	/* block /* nested */ */ WHERE id = $1 AND x::int >= 1.5e3`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, tok.Value)
+	}
+	expected := []string{"select", "User Name", ",", `E'it\'s'`, ",", "$tag$a;b$tag$", "from", "public", ".", "users",
+		"where", "id", "=", "$1", "and", "x", "::", "int", ">=", "1.5e3"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected tokens %v, got %v", expected, got)
+	}
+
+	if tokens[1].Kind != TokenQuotedIdent {
+		t.Errorf("Expected quoted identifier, got kind %d", tokens[1].Kind)
+	}
+	if tokens[13].Kind != TokenParam {
+		t.Errorf("Expected parameter, got kind %d", tokens[13].Kind)
+	}
+}
+
+func TestTokenize_Errors(t *testing.T) {
+	for _, sql := range []string{
+		"SELECT 'unterminated",
+		`SELECT "unterminated`,
+		"SELECT 1 /* unterminated",
+		"SELECT $$unterminated",
+		`SELECT ""`,
+	} {
+		t.Run(sql, func(t *testing.T) {
+			if _, err := Tokenize(sql); err == nil {
+				t.Errorf("Expected error tokenizing %q", sql)
+			}
+		})
+	}
+}
+
+func TestAnalyze_Tables(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		expected []TableRef
+	}{
+		{
+			name:     "simple",
+			sql:      "SELECT * FROM users",
+			expected: []TableRef{{Name: "users"}},
+		},
+		{
+			name:     "qualified with alias",
+			sql:      `SELECT u.id FROM Sales."Users" AS u`,
+			expected: []TableRef{{Schema: "sales", Name: "Users", Alias: "u"}},
+		},
+		{
+			name:     "comma list and joins",
+			sql:      "SELECT * FROM a x, b LEFT JOIN c ON c.id = b.id JOIN staging.d USING (id)",
+			expected: []TableRef{{Name: "a", Alias: "x"}, {Name: "b"}, {Name: "c"}, {Schema: "staging", Name: "d"}},
+		},
+		{
+			name:     "subqueries",
+			sql:      "SELECT * FROM (SELECT id FROM orders) o WHERE o.id IN (SELECT order_id FROM items)",
+			expected: []TableRef{{Name: "orders"}, {Name: "items"}},
+		},
+		{
+			name:     "cte references are not tables",
+			sql:      "WITH recent AS (SELECT * FROM orders), top AS MATERIALIZED (SELECT * FROM recent) SELECT * FROM top JOIN users u ON true",
+			expected: []TableRef{{Name: "orders"}, {Name: "users", Alias: "u"}},
+		},
+		{
+			name:     "cte names are scoped to the query that defines them",
+			sql:      "SELECT * FROM payment_methods, (WITH payment_methods AS (SELECT 1 AS a) SELECT a FROM payment_methods) s",
+			expected: []TableRef{{Name: "payment_methods"}},
+		},
+		{
+			name:     "cte is not visible in its own definition unless recursive",
+			sql:      "WITH users AS (SELECT * FROM users) SELECT * FROM users",
+			expected: []TableRef{{Name: "users"}},
+		},
+		{
+			name:     "recursive cte",
+			sql:      "WITH RECURSIVE tree AS (SELECT id FROM nodes UNION ALL SELECT n.id FROM nodes n JOIN tree t ON n.parent = t.id) SELECT * FROM tree",
+			expected: []TableRef{{Name: "nodes"}, {Name: "nodes", Alias: "n"}},
+		},
+		{
+			name:     "table command",
+			sql:      "SELECT * FROM (TABLE payment_methods) t UNION TABLE ONLY staging.cards",
+			expected: []TableRef{{Name: "payment_methods"}, {Schema: "staging", Name: "cards"}},
+		},
+		{
+			name:     "with in types and table functions",
+			sql:      "SELECT now()::timestamp with time zone FROM unnest(ids) WITH ORDINALITY AS x(id, n), events",
+			expected: []TableRef{{Name: "events"}},
+		},
+		{
+			name:     "parenthesized joins",
+			sql:      "SELECT * FROM (staging.raw_events e JOIN public.users u ON true), ((a CROSS JOIN b) JOIN (SELECT 1) s ON true) j",
+			expected: []TableRef{{Schema: "staging", Name: "raw_events", Alias: "e"}, {Name: "a"}, {Schema: "public", Name: "users", Alias: "u"}, {Name: "b"}},
+		},
+		{
+			name:     "alias column list",
+			sql:      "SELECT u.x FROM users AS u(id, x)",
+			expected: []TableRef{{Name: "users", Alias: "u", ColumnAliases: []string{"id", "x"}}},
+		},
+		{
+			name:     "from inside function calls",
+			sql:      "SELECT extract(year FROM created_at), substring(name FROM 1 FOR 3) FROM events WHERE a IS DISTINCT FROM b",
+			expected: []TableRef{{Name: "events"}},
+		},
+		{
+			name:     "table functions and locking",
+			sql:      "SELECT * FROM generate_series(1, 3) g, ONLY parents p FOR UPDATE",
+			expected: []TableRef{{Name: "parents", Alias: "p"}},
+		},
+		{
+			name:     "strings and comments are ignored",
+			sql:      "SELECT 'FROM secrets' AS x -- FROM secrets\nFROM visible",
+			expected: []TableRef{{Name: "visible"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis, err := Analyze(tt.sql)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []TableRef
+			for _, ref := range analysis.Tables {
+				ref.Pos = 0
+				got = append(got, ref)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected tables %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAnalyze_UnreadableFromItems(t *testing.T) {
+	for _, sql := range []string{
+		"SELECT * FROM",
+		"SELECT * FROM users JOIN 'users' ON true",
+		"SELECT * FROM users, WHERE true",
+		"SELECT * FROM (a JOIN b ON true) j(x, y)",
+		"SELECT * FROM users u v, secrets",
+		"SELECT * FROM (TABLE) t",
+		"WITH AS (SELECT 1) SELECT * FROM users",
+		"WITH x AS SELECT 1 SELECT * FROM x",
+		"WITH x (SELECT * FROM secrets) SELECT * FROM x",
+	} {
+		t.Run(sql, func(t *testing.T) {
+			if _, err := Analyze(sql); err == nil {
+				t.Errorf("Expected error analyzing %q", sql)
+			}
+		})
+	}
+}
+
+func TestAnalyze_Functions(t *testing.T) {
+	analysis, err := Analyze("SELECT lower(email), pg_catalog.query_to_xml('select 1', true, false, '') FROM generate_series(1, 2) g")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []FunctionRef{{Name: "lower"}, {Schema: "pg_catalog", Name: "query_to_xml"}, {Name: "generate_series"}}
+	var got []FunctionRef
+	for _, fn := range analysis.Functions {
+		fn.Pos = 0
+		got = append(got, fn)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected functions %+v, got %+v", expected, got)
+	}
+}
+
+func TestAnalyze_ColumnsAndStars(t *testing.T) {
+	analysis, err := Analyze(`WITH recent (id) AS (SELECT o.id FROM orders o)
+		SELECT u.*, ssn AS social, count(*), lower(u.email), created_at::date, r.id
+		FROM public.users u JOIN recent r ON r.id = u.last_order_id
+		WHERE u.name <> 'ssn'`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var columns []string
+	for _, col := range analysis.Columns {
+		if col.Qualifier != "" {
+			columns = append(columns, col.Qualifier+"."+col.Name)
+		} else {
+			columns = append(columns, col.Name)
+		}
+	}
+	expected := []string{"o.id", "ssn", "u.email", "created_at", "r.id", "r.id", "u.last_order_id", "u.name"}
+	if !reflect.DeepEqual(columns, expected) {
+		t.Errorf("Expected columns %v, got %v", expected, columns)
+	}
+
+	if len(analysis.Stars) != 1 || analysis.Stars[0].Qualifier != "u" {
+		t.Errorf("Expected a single u.* star, got %+v", analysis.Stars)
+	}
+
+	analysis, err = Analyze("SELECT DISTINCT * FROM users, (SELECT 1) AS s(x)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(analysis.Stars) != 1 || analysis.Stars[0].Qualifier != "" {
+		t.Errorf("Expected a bare star, got %+v", analysis.Stars)
+	}
+	if len(analysis.Columns) != 0 {
+		t.Errorf("Expected aliases not to be column references, got %+v", analysis.Columns)
+	}
+}
+
+func TestAnalyzeAggregation(t *testing.T) {
+	tests := []struct {
+		name        string
+		sql         string
+		isAggregate bool
+		countColumn int
+	}{
+		{"group by with count", "SELECT region, count(*) AS n, avg(amount) FROM orders GROUP BY region", true, 1},
+		{"count first", "SELECT COUNT(id) n, status FROM orders GROUP BY status", true, 0},
+		{"count with filter", "SELECT status, count(*) FILTER (WHERE paid) AS paid FROM orders GROUP BY 1", true, 1},
+		{"whole table aggregate", "SELECT avg(amount), count(*) FROM orders", true, 1},
+		{"count inside expression", "SELECT region, sum(amount) / count(*) FROM orders GROUP BY region", true, -1},
+		{"group by without aggregate", "SELECT region FROM orders GROUP BY region", true, -1},
+		{"cte body is ignored", "WITH t AS (SELECT region, count(*) FROM orders GROUP BY region) SELECT * FROM t", false, -1},
+		{"aggregate in subquery", "SELECT id, (SELECT count(*) FROM items i WHERE i.order_id = o.id) FROM orders o", false, -1},
+		{"plain select", "SELECT id, email FROM users", false, -1},
+		{"window function", "SELECT region, count(*) OVER (PARTITION BY region) FROM orders", false, -1},
+		{"union", "SELECT region, count(*) FROM a GROUP BY region UNION SELECT region, count(*) FROM b GROUP BY region", false, -1},
+		{"qualified user function", "SELECT myschema.count(id) FROM users", false, -1},
+		{"star before count", "SELECT u.*, count(*) FROM users u GROUP BY u.id", false, -1},
+		{"bare star", "SELECT *, count(*) OVER () FROM users", false, -1},
+		{"collection aggregate", "SELECT string_agg(email, ','), count(*) FROM users", false, -1},
+		{"collection aggregate in subquery", "SELECT s, count(*) FROM (SELECT array_agg(email) s FROM users) x, generate_series(1, 10) GROUP BY s", false, -1},
+		{"value aggregate", "SELECT max(email), count(*) FROM users", false, -1},
+		{"value aggregate in subquery", "SELECT m, count(*) FROM (SELECT min(email) m FROM users) x GROUP BY m", false, -1},
+		{"ordered-set value aggregate", "SELECT percentile_disc(0.5) WITHIN GROUP (ORDER BY salary), count(*) FROM staff", false, -1},
+		{"cross join", "SELECT region, count(*) FROM orders CROSS JOIN generate_series(1, 10) GROUP BY region", false, -1},
+		{"set-returning function", "SELECT region, count(*) FROM orders JOIN LATERAL unnest(tags) t ON true GROUP BY region", false, -1},
+		{"comma join", "SELECT region, count(*) FROM orders o, regions r GROUP BY region", false, -1},
+		{"comma join in subquery", "SELECT region, count(*) FROM (SELECT o.region FROM orders o, orders p) x GROUP BY region", false, -1},
+		{"join and from inside functions", "SELECT extract(year FROM o.placed_at) y, count(*) FROM orders o JOIN users u ON u.id = o.user_id GROUP BY 1, 2", true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agg, err := AnalyzeAggregation(tt.sql)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if agg.IsAggregate != tt.isAggregate {
+				t.Errorf("Expected IsAggregate=%v, got %v (reason: %s)", tt.isAggregate, agg.IsAggregate, agg.Reason)
+			}
+			if agg.IsAggregate && agg.CountColumn != tt.countColumn {
+				t.Errorf("Expected count column %d, got %d", tt.countColumn, agg.CountColumn)
+			}
+			if !agg.IsAggregate && agg.Reason == "" {
+				t.Errorf("Expected a reason for a non-aggregate query")
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+// Package sqlparse provides a lightweight PostgreSQL tokenizer and query analysis
+// used to check which database objects a proposed query references.
+package sqlparse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TokenKind identifies the lexical class of a token
+type TokenKind int
+
+const (
+	TokenIdent       TokenKind = iota // unquoted identifier or keyword, folded to lower case
+	TokenQuotedIdent                  // "double quoted" identifier, case preserved
+	TokenString                       // string constant ('...', E'...', $$...$$)
+	TokenNumber                       // numeric constant
+	TokenParam                        // positional parameter ($1)
+	TokenOperator                     // punctuation and operators
+)
+
+// Token is a single lexical element of a SQL statement
+type Token struct {
+	Kind  TokenKind
+	Value string // identifier name after Postgres folding/unquoting; raw text for other kinds
+	Pos   int    // byte offset of the token in the source
+	End   int    // byte offset just past the token
+}
+
+// IsKeyword reports whether the token is the given unquoted keyword (lower case)
+func (t Token) IsKeyword(keyword string) bool {
+	return t.Kind == TokenIdent && t.Value == keyword
+}
+
+// IsIdent reports whether the token is a quoted or unquoted identifier
+func (t Token) IsIdent() bool {
+	return t.Kind == TokenIdent || t.Kind == TokenQuotedIdent
+}
+
+// IsOp reports whether the token is the given operator or punctuation
+func (t Token) IsOp(op string) bool {
+	return t.Kind == TokenOperator && t.Value == op
+}
+
+const operatorChars = "+-*/<>=~!@#%^&|`?:"
+
+// Tokenize splits a SQL string into tokens, skipping whitespace and comments
+func Tokenize(sql string) ([]Token, error) {
+	var tokens []Token
+	i := 0
+	n := len(sql)
+
+	for i < n {
+		c := sql[i]
+		switch {
+		case isSpace(c):
+			i++
+
+		case c == '-' && i+1 < n && sql[i+1] == '-':
+			for i < n && sql[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && i+1 < n && sql[i+1] == '*':
+			// Block comments nest in Postgres
+			depth := 0
+			start := i
+			for i < n {
+				if i+1 < n && sql[i] == '/' && sql[i+1] == '*' {
+					depth++
+					i += 2
+				} else if i+1 < n && sql[i] == '*' && sql[i+1] == '/' {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+			if depth != 0 {
+				return nil, fmt.Errorf("unterminated block comment at position %d", start+1)
+			}
+
+		case c == '\'':
+			end, err := scanQuoted(sql, i, '\'', false)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, Token{Kind: TokenString, Value: sql[i:end], Pos: i, End: end})
+			i = end
+
+		case isStringPrefix(sql, i):
+			// E'...', B'...', X'...', N'...' and U&'...' constants
+			quote := strings.IndexByte(sql[i:], '\'') + i
+			backslash := c == 'e' || c == 'E'
+			end, err := scanQuoted(sql, quote, '\'', backslash)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, Token{Kind: TokenString, Value: sql[i:end], Pos: i, End: end})
+			i = end
+
+		case c == '"':
+			end, err := scanQuoted(sql, i, '"', false)
+			if err != nil {
+				return nil, err
+			}
+			if end-i == 2 {
+				return nil, fmt.Errorf("zero-length quoted identifier at position %d", i+1)
+			}
+			value := strings.ReplaceAll(sql[i+1:end-1], `""`, `"`)
+			tokens = append(tokens, Token{Kind: TokenQuotedIdent, Value: value, Pos: i, End: end})
+			i = end
+
+		case c == '$':
+			if i+1 < n && isDigit(sql[i+1]) {
+				end := i + 1
+				for end < n && isDigit(sql[end]) {
+					end++
+				}
+				tokens = append(tokens, Token{Kind: TokenParam, Value: sql[i:end], Pos: i, End: end})
+				i = end
+				break
+			}
+			tag, ok := dollarTag(sql, i)
+			if !ok {
+				tokens = append(tokens, Token{Kind: TokenOperator, Value: "$", Pos: i, End: i + 1})
+				i++
+				break
+			}
+			closing := strings.Index(sql[i+len(tag):], tag)
+			if closing == -1 {
+				return nil, fmt.Errorf("unterminated dollar-quoted string at position %d", i+1)
+			}
+			end := i + len(tag) + closing + len(tag)
+			tokens = append(tokens, Token{Kind: TokenString, Value: sql[i:end], Pos: i, End: end})
+			i = end
+
+		case isDigit(c) || (c == '.' && i+1 < n && isDigit(sql[i+1])):
+			end := scanNumber(sql, i)
+			tokens = append(tokens, Token{Kind: TokenNumber, Value: sql[i:end], Pos: i, End: end})
+			i = end
+
+		case isIdentStart(c):
+			end := i + 1
+			for end < n && isIdentChar(sql[end]) {
+				end++
+			}
+			tokens = append(tokens, Token{Kind: TokenIdent, Value: foldIdent(sql[i:end]), Pos: i, End: end})
+			i = end
+
+		case strings.IndexByte(operatorChars, c) >= 0:
+			end := i + 1
+			for end < n && strings.IndexByte(operatorChars, sql[end]) >= 0 {
+				// A comment start ends the operator
+				if end+1 < n && ((sql[end] == '-' && sql[end+1] == '-') || (sql[end] == '/' && sql[end+1] == '*')) {
+					break
+				}
+				end++
+			}
+			tokens = append(tokens, Token{Kind: TokenOperator, Value: sql[i:end], Pos: i, End: end})
+			i = end
+
+		default:
+			// Single-character punctuation: ( ) , ; . [ ] and anything unexpected
+			tokens = append(tokens, Token{Kind: TokenOperator, Value: sql[i : i+1], Pos: i, End: i + 1})
+			i++
+		}
+	}
+
+	return tokens, nil
+}
+
+// scanQuoted returns the offset just past a quoted section starting at start;
+// doubled quote characters (and backslash escapes when enabled) do not close it
+func scanQuoted(sql string, start int, quote byte, backslash bool) (int, error) {
+	i := start + 1
+	for i < len(sql) {
+		switch {
+		case backslash && sql[i] == '\\':
+			i += 2
+		case sql[i] == quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i += 2
+				continue
+			}
+			return i + 1, nil
+		default:
+			i++
+		}
+	}
+	if quote == '"' {
+		return 0, fmt.Errorf("unterminated quoted identifier at position %d", start+1)
+	}
+	return 0, fmt.Errorf("unterminated quoted string at position %d", start+1)
+}
+
+// isStringPrefix reports whether a string constant with a letter prefix starts at i
+func isStringPrefix(sql string, i int) bool {
+	if i > 0 && isIdentChar(sql[i-1]) {
+		return false
+	}
+	rest := sql[i:]
+	if len(rest) >= 2 && rest[1] == '\'' && strings.IndexByte("eEbBxXnN", rest[0]) >= 0 {
+		return true
+	}
+	return len(rest) >= 3 && (rest[0] == 'u' || rest[0] == 'U') && rest[1] == '&' && rest[2] == '\''
+}
+
+// dollarTag returns the opening $tag$ of a dollar-quoted string starting at i
+func dollarTag(sql string, i int) (string, bool) {
+	end := i + 1
+	for end < len(sql) && sql[end] != '$' {
+		if !isIdentChar(sql[end]) {
+			return "", false
+		}
+		end++
+	}
+	if end >= len(sql) {
+		return "", false
+	}
+	if end > i+1 && isDigit(sql[i+1]) {
+		return "", false
+	}
+	return sql[i : end+1], true
+}
+
+func scanNumber(sql string, i int) int {
+	n := len(sql)
+	for i < n && (isDigit(sql[i]) || sql[i] == '_') {
+		i++
+	}
+	if i < n && sql[i] == '.' && !(i+1 < n && sql[i+1] == '.') {
+		i++
+		for i < n && (isDigit(sql[i]) || sql[i] == '_') {
+			i++
+		}
+	}
+	if i < n && (sql[i] == 'e' || sql[i] == 'E') {
+		j := i + 1
+		if j < n && (sql[j] == '+' || sql[j] == '-') {
+			j++
+		}
+		if j < n && isDigit(sql[j]) {
+			i = j
+			for i < n && isDigit(sql[i]) {
+				i++
+			}
+		}
+	}
+	return i
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '$'
+}
+
+// foldIdent lower-cases ASCII letters the way Postgres folds unquoted identifiers
+func foldIdent(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+	}
+	return string(b)
+}